@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/core"
+)
+
+const benchmarkNameCount = 10000
+
+// lruCache is the message cache before sharding, every hit takes the
+// exclusive lock to move element and rotate answers in place, and returns
+// a shallow copy of cached message
+type lruCache struct {
+	ll    *list.List
+	cache map[Key]*list.Element
+	lock  sync.Mutex
+}
+
+func newLRUCache() *lruCache {
+	return &lruCache{
+		ll:    list.New(),
+		cache: make(map[Key]*list.Element),
+	}
+}
+
+func (c *lruCache) Add(message *g53.Message) {
+	key := keyForMessage(message.Question.Name, message.Question.Type)
+	entry := &MessageCacheEntry{
+		message:    message,
+		expireTime: time.Now().Add(time.Hour),
+	}
+	c.lock.Lock()
+	c.cache[key] = c.ll.PushFront(entry)
+	c.lock.Unlock()
+}
+
+func (c *lruCache) Get(client *core.Client) (*g53.Message, bool) {
+	name := client.Request.Question.Name
+	key := keyForMessage(name, client.Request.Question.Type)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, hit := c.cache[key]; hit {
+		entry := elem.Value.(*MessageCacheEntry)
+		if entry.IsExpire() == false && entry.message.Question.Name.Equals(name) {
+			c.ll.MoveToFront(elem)
+			for _, rrset := range entry.message.Sections[g53.AnswerSection] {
+				rrset.RotateRdata()
+			}
+			response := *entry.message
+			return &response, true
+		}
+	}
+	return nil, false
+}
+
+type messageGetter interface {
+	Add(*g53.Message)
+	Get(*core.Client) (*g53.Message, bool)
+}
+
+func benchmarkGet(b *testing.B, cache messageGetter) {
+	clients := make([]*core.Client, benchmarkNameCount)
+	for i := range clients {
+		name := fmt.Sprintf("www%d.example.com.", i)
+		message := buildMessage(name, "1.1.1.1", 3600)
+		rdata, _ := g53.AFromString("2.2.2.2")
+		message.Sections[g53.AnswerSection][0].AddRdata(rdata)
+		cache.Add(message)
+		clients[i] = &core.Client{
+			Request: g53.MakeQuery(g53.NameFromStringUnsafe(name), g53.RR_A, 512, false),
+		}
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, found := cache.Get(clients[i%benchmarkNameCount]); found == false {
+				b.Fatal("message should be cached")
+			}
+			i += 7
+		}
+	})
+}
+
+func BenchmarkLRUCacheGet(b *testing.B) {
+	benchmarkGet(b, newLRUCache())
+}
+
+func BenchmarkMessageCacheGet(b *testing.B) {
+	benchmarkGet(b, newMessageCache(&config.CacheConf{}, nil))
+}
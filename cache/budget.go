@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zdnscloud/g53"
+)
+
+// memory used by structs of entry and rrset besides the data in wire format
+const (
+	entryOverhead = 256
+	rrsetOverhead = 64
+)
+
+// cacheBudget limits the total estimated bytes of caches of all views
+type cacheBudget struct {
+	bytes    int64 //atomic
+	size     int64 //atomic
+	maxBytes int64
+	caches   []*MessageCache
+	lock     sync.Mutex
+}
+
+func newCacheBudget() *cacheBudget {
+	return &cacheBudget{}
+}
+
+func (b *cacheBudget) reloadConfig(maxBytes uint64, caches map[string]*MessageCache) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.maxBytes = int64(maxBytes)
+	b.caches = make([]*MessageCache, 0, len(caches))
+	for _, c := range caches {
+		b.caches = append(b.caches, c)
+	}
+}
+
+// nil budget has no limit
+func (b *cacheBudget) exceeded() bool {
+	return b != nil && b.maxBytes != 0 && atomic.LoadInt64(&b.bytes) > b.maxBytes
+}
+
+func (b *cacheBudget) addBytes(n int64) {
+	if b != nil {
+		atomic.AddInt64(&b.bytes, n)
+	}
+}
+
+func (b *cacheBudget) Bytes() int64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&b.bytes)
+}
+
+func (b *cacheBudget) addSize(n int64) {
+	if b != nil {
+		atomic.AddInt64(&b.size, n)
+	}
+}
+
+// Len returns the number of messages in caches of all views
+func (b *cacheBudget) Len() int {
+	if b == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&b.size))
+}
+
+// evict one entry from the cache which uses most bytes, entry keep won't
+// be evicted, the eviction is counted to the view of the cache
+func (b *cacheBudget) evictFromLargest(keep *MessageCacheEntry) bool {
+	b.lock.Lock()
+	caches := append([]*MessageCache{}, b.caches...)
+	b.lock.Unlock()
+
+	sort.Slice(caches, func(i, j int) bool {
+		return caches[i].Bytes() > caches[j].Bytes()
+	})
+	for _, c := range caches {
+		if c.evict(0, keep) {
+			c.recordSize()
+			return true
+		}
+	}
+	return false
+}
+
+// size of message in memory is estimated by its length in wire format
+func estimateSize(message *g53.Message) int64 {
+	render := g53.NewMsgRender()
+	message.Rend(render)
+	size := int64(entryOverhead + render.Len())
+	for _, section := range message.Sections {
+		size += int64(rrsetOverhead * len(section))
+	}
+	return size
+}
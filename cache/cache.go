@@ -1,27 +1,56 @@
 package cache
 
 import (
+	"os"
+
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/config"
 	"github.com/zdnscloud/vanguard/core"
 	"github.com/zdnscloud/vanguard/httpcmd"
+	"github.com/zdnscloud/vanguard/logger"
 	"github.com/zdnscloud/vanguard/metrics"
 	view "github.com/zdnscloud/vanguard/viewselector"
 )
 
 type Cache struct {
 	core.DefaultHandler
-	cache map[string]*MessageCache
+	cache    map[string]*MessageCache
+	budget   *cacheBudget
+	dumpFile string
 }
 
 func NewCache(conf *config.VanguardConf) core.DNSQueryHandler {
-	c := &Cache{}
+	c := &Cache{
+		budget: newCacheBudget(),
+	}
 	c.ReloadConfig(conf)
-	httpcmd.RegisterHandler(c, []httpcmd.Command{&CleanCache{}, &CleanViewCache{}, &CleanDomainCache{}, &CleanRRsetsCache{}, &GetDomainCache{}, &GetMessageCache{}})
+	if c.dumpFile != "" {
+		if count, err := c.LoadFromFile(c.dumpFile); err == nil {
+			logger.GetLogger().Info("load %d messages from cache file %s", count, c.dumpFile)
+		} else if os.IsNotExist(err) == false {
+			logger.GetLogger().Warn("load cache file %s failed: %s", c.dumpFile, err.Error())
+		}
+	}
+	httpcmd.RegisterHandler(c, []httpcmd.Command{&CleanCache{}, &CleanViewCache{}, &CleanDomainCache{}, &CleanRRsetsCache{}, &GetDomainCache{}, &GetMessageCache{}, &DumpCache{}})
 	return c
 }
 
+func (c *Cache) Shutdown() {
+	if c.dumpFile == "" {
+		return
+	}
+
+	if err := c.DumpToFile(c.dumpFile); err != nil {
+		logger.GetLogger().Error("dump cache to %s failed: %s", c.dumpFile, err.Error())
+	}
+}
+
 func (c *Cache) ReloadConfig(conf *config.VanguardConf) {
+	serveStale := make(map[string]*config.ServeStaleInView)
+	for i, s := range conf.Cache.ServeStale {
+		serveStale[s.View] = &conf.Cache.ServeStale[i]
+	}
+
 	cache := make(map[string]*MessageCache)
 	for view, _ := range view.GetViewAndIds() {
 		if _, exist := c.cache[view]; exist {
@@ -38,28 +67,53 @@ func (c *Cache) ReloadConfig(conf *config.VanguardConf) {
 		defaultCache.reloadConfig(&conf.Cache)
 	}
 
+	quotas := make(map[string]uint64)
+	for _, q := range conf.Cache.ViewQuotas {
+		quotas[q.View] = q.MaxBytes
+	}
+
+	for view, messageCache := range cache {
+		messageCache.setServeStale(serveStale[view])
+		messageCache.setQuota(view, quotas[view], c.budget)
+	}
+	//bytes of deleted views are returned to budget
+	for view, messageCache := range c.cache {
+		if _, ok := cache[view]; ok == false {
+			messageCache.Clear()
+		}
+	}
+	c.budget.reloadConfig(conf.Cache.MaxCacheBytes, cache)
+	c.dumpFile = conf.Cache.DumpFile
 	c.cache = cache
 }
 
 func (c *Cache) HandleQuery(ctx *core.Context) {
 	client := &ctx.Client
 	message, found := c.get(client)
-	client.CacheHit = found
 	if found == true {
-		metrics.RecordCacheHit(client.View)
-		response := *message
-		response.Header.Id = client.Request.Header.Id
-		response.Header.SetFlag(g53.FLAG_AA, false)
-		response.Question = client.Request.Question
-		client.Response = &response
+		c.serveFromCache(client, message)
+	} else if messageCache, stale, ok := c.getStale(client); ok {
+		c.resolveOrServeStale(ctx, messageCache, stale)
 	} else {
 		core.PassToNext(c, ctx)
 		if client.Response != nil && client.CacheAnswer {
-			c.AddMessage(client.View, client.Response)
+			if messageCache, ok := c.cache[client.View]; ok {
+				messageCache.AddResponse(client)
+			}
 		}
 	}
 }
 
+func (c *Cache) serveFromCache(client *core.Client, message *g53.Message) {
+	client.CacheHit = true
+	metrics.RecordCacheHit(client.View)
+	response := *message
+	response.Header.Id = client.Request.Header.Id
+	response.Header.SetFlag(g53.FLAG_AA, false)
+	response.Question = client.Request.Question
+	client.Response = &response
+}
+
 func (c *Cache) AddMessage(view string, message *g53.Message) {
 	if messageCache, ok := c.cache[view]; ok {
 		messageCache.Add(message)
@@ -73,3 +127,13 @@ func (c *Cache) get(client *core.Client) (*g53.Message, bool) {
 		return nil, false
 	}
 }
+
+func (c *Cache) getStale(client *core.Client) (*MessageCache, *g53.Message, bool) {
+	if messageCache, ok := c.cache[client.View]; ok {
+		question := client.Request.Question
+		if message, found := messageCache.GetStale(question.Name, question.Type); found {
+			return messageCache, message, true
+		}
+	}
+	return nil, nil, false
+}
@@ -59,6 +59,13 @@ func (g *GetMessageCache) String() string {
 	return fmt.Sprintf("name: get rrsets from cache and params:{name:%s, type:%s, view:%s}", g.Name, g.Type, g.View)
 }
 
+type DumpCache struct {
+}
+
+func (d *DumpCache) String() string {
+	return "name: dump cache to file"
+}
+
 func (cache *Cache) HandleCmd(cmd httpcmd.Command) (interface{}, *httpcmd.Error) {
 	switch c := cmd.(type) {
 	case *CleanCache:
@@ -73,11 +80,24 @@ func (cache *Cache) HandleCmd(cmd httpcmd.Command) (interface{}, *httpcmd.Error)
 		return cache.getDomainCache(c.Name, c.Type)
 	case *GetMessageCache:
 		return cache.getMessageCacheInView(c.View, c.Name, c.Type)
+	case *DumpCache:
+		return cache.dump()
 	default:
 		panic("shouldn't be here")
 	}
 }
 
+func (c *Cache) dump() (interface{}, *httpcmd.Error) {
+	if c.dumpFile == "" {
+		return nil, ErrNoDumpFile
+	}
+
+	if err := c.DumpToFile(c.dumpFile); err != nil {
+		return nil, ErrDumpCacheFailed.AddDetail(err.Error())
+	}
+	return nil, nil
+}
+
 func (c *Cache) cleanAll() (interface{}, *httpcmd.Error) {
 	for _, msgCache := range c.cache {
 		msgCache.Clear()
@@ -210,8 +230,6 @@ func (c *Cache) getSingleMessageCache(view string, qname *g53.Name, qtype g53.RR
 }
 
 func (c *MessageCache) GetSingleMessageCache(name *g53.Name, typ g53.RRType) (*g53.Message, bool) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
 	if entry, found := c.get(name, typ); found {
 		return entry.Message(), true
 	} else {
@@ -0,0 +1,10 @@
+package cache
+
+import (
+	"github.com/zdnscloud/vanguard/httpcmd"
+)
+
+var (
+	ErrNoDumpFile      = httpcmd.NewError(httpcmd.CacheErrCodeStart, "cache dump file isn't configured")
+	ErrDumpCacheFailed = httpcmd.NewError(httpcmd.CacheErrCodeStart+1, "dump cache failed")
+)
@@ -1,14 +1,15 @@
 package cache
 
 import (
-	"container/list"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/config"
 	"github.com/zdnscloud/vanguard/core"
 	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/metrics"
 )
 
 const (
@@ -20,13 +21,44 @@ const (
 
 type Key uint64
 
+// entry isn't changed after it's added into cache except the atomic
+// counters, so it's read without lock
 type MessageCacheEntry struct {
+	key        Key
+	size       int64
 	message    *g53.Message
+	addTime    time.Time
 	expireTime time.Time
+	slot       int
+	referenced uint32
+	rotation   uint32
+	rotatable  bool
+	security   core.SecurityStatus
 }
 
+// Message returns a copy of cached message whose ttl is the remaining
+// lifetime of each rrset, rdatas of answers are rotated in each copy, AD
+// bit follows the validation status of the entry
 func (e *MessageCacheEntry) Message() *g53.Message {
-	return e.message
+	elapsed := g53.RRTTL(time.Now().Sub(e.addTime) / time.Second)
+	msg := messageWithTtl(e.message, func(ttl g53.RRTTL) g53.RRTTL {
+		if ttl > elapsed {
+			return ttl - elapsed
+		}
+		return 0
+	})
+	if e.rotatable {
+		roundrobinAnswer(msg, int(atomic.AddUint32(&e.rotation, 1)))
+	}
+	e.setADFlag(msg)
+	return msg
+}
+
+// AD bit isn't changed for message which isn't validated
+func (e *MessageCacheEntry) setADFlag(msg *g53.Message) {
+	if e.security != core.SecurityUnchecked {
+		msg.Header.SetFlag(g53.FLAG_AD, e.security == core.SecuritySecure)
+	}
 }
 
 func (e *MessageCacheEntry) IsExpire() bool {
@@ -38,22 +70,32 @@ func (e *MessageCacheEntry) NeedPrefetch() bool {
 }
 
 type MessageCache struct {
+	//atomic, they are the first fields to be 64 bit aligned
+	size         int64
+	bytes        int64
 	positiveTtl  uint32
 	negativeTtl  uint32
 	maxSize      uint
+	maxBytes     int64
+	view         string
+	budget       *cacheBudget
 	shortAnswer  bool
 	needPrefetch bool
+	serveStale   *serveStaleConf
 
-	ll         *list.List
-	cache      map[Key]*list.Element
+	shards     [shardCount]*cacheShard
+	refreshing map[Key]time.Time
+	//lock of serve stale conf and refreshing
 	lock       sync.RWMutex
 	prefetcher *Prefetcher
 }
 
 func newMessageCache(conf *config.CacheConf, handler core.DNSQueryHandler) *MessageCache {
 	c := &MessageCache{
-		ll:    list.New(),
-		cache: make(map[Key]*list.Element),
+		refreshing: make(map[Key]time.Time),
+	}
+	for i := range c.shards {
+		c.shards[i] = newCacheShard()
 	}
 
 	c.prefetcher = newPrefetcher(handler, c)
@@ -88,31 +130,126 @@ func (c *MessageCache) reloadConfig(conf *config.CacheConf) {
 	}
 }
 
+// view quota and budget limit the estimated bytes of messages, zero quota
+// means no limit
+func (c *MessageCache) setQuota(view string, maxBytes uint64, budget *cacheBudget) {
+	c.view = view
+	c.maxBytes = int64(maxBytes)
+	c.budget = budget
+}
+
 func (c *MessageCache) Add(message *g53.Message) {
-	entry := c.messageToCache(message)
-	if entry == nil {
-		return
+	if entry := c.messageToCache(message); entry != nil {
+		c.addEntry(entry)
 	}
+}
 
-	key := keyForMessage(message.Question.Name, message.Question.Type)
-	c.lock.Lock()
-	c.add(key, entry)
-	c.lock.Unlock()
+// AddResponse adds response of client with its validation status
+func (c *MessageCache) AddResponse(client *core.Client) {
+	if entry := c.messageToCache(client.Response); entry != nil {
+		entry.security = client.Security
+		c.addEntry(entry)
+	}
 }
 
-func (c *MessageCache) add(key Key, entry *MessageCacheEntry) {
-	if elem, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(elem)
-		elem.Value = entry
+func (c *MessageCache) addEntry(entry *MessageCacheEntry) {
+	message := entry.message
+	entry.key = keyForMessage(message.Question.Name, message.Question.Type)
+	entry.size = estimateSize(message)
+	for _, rrset := range message.Sections[g53.AnswerSection] {
+		if len(rrset.Rdatas) > 1 {
+			entry.rotatable = true
+		}
+	}
+	index := shardIndex(entry.key)
+	shard := c.shards[index]
+	shard.lock.Lock()
+	old := shard.add(entry)
+	shard.lock.Unlock()
+	if old == nil {
+		c.addSize(1)
+		c.addBytes(entry.size)
 	} else {
-		elem := c.ll.PushFront(entry)
-		c.cache[key] = elem
+		c.addBytes(entry.size - old.size)
+	}
+
+	c.enforceLimits(index, entry)
+	c.recordSize()
+}
+
+// entries of the largest view are evicted if total bytes of all views
+// exceeds the budget, so a noisy view doesn't evict entries of others
+func (c *MessageCache) enforceLimits(index int, newEntry *MessageCacheEntry) {
+	for c.exceeded() {
+		logger.GetLogger().Debug("cache messages size %v or bytes %v exceeded limit, will evict one",
+			atomic.LoadInt64(&c.size), atomic.LoadInt64(&c.bytes))
+		if c.evict(index, newEntry) == false {
+			break
+		}
+	}
+
+	for c.budget.exceeded() {
+		if c.budget.evictFromLargest(newEntry) == false {
+			break
+		}
+	}
+}
+
+func (c *MessageCache) exceeded() bool {
+	if c.maxSize != defaultMaxCacheSize && uint(atomic.LoadInt64(&c.size)) > c.maxSize {
+		return true
+	}
+	return c.maxBytes != 0 && atomic.LoadInt64(&c.bytes) > c.maxBytes
+}
+
+// evict one entry from the shard of the new entry, other shards are tried
+// if there is no entry can be evicted in it, in the second round, all the
+// entries have been unreferenced by the clock hand
+func (c *MessageCache) evict(index int, newEntry *MessageCacheEntry) bool {
+	for i := 0; i < 2*shardCount; i++ {
+		shard := c.shards[(index+i)%shardCount]
+		shard.lock.Lock()
+		entry := shard.evict(newEntry)
+		shard.lock.Unlock()
+		if entry != nil {
+			c.entryRemoved(entry)
+			metrics.RecordCacheEviction(c.view)
+			return true
+		}
 	}
-	if c.maxSize != defaultMaxCacheSize && uint(c.ll.Len()) > c.maxSize {
-		logger.GetLogger().Debug("cache messages size %v exceeded max size %v, will remove oldest one",
-			c.ll.Len(), c.maxSize)
-		c.removeOldest()
+	return false
+}
+
+func (c *MessageCache) addSize(n int64) {
+	atomic.AddInt64(&c.size, n)
+	c.budget.addSize(n)
+}
+
+func (c *MessageCache) addBytes(n int64) {
+	atomic.AddInt64(&c.bytes, n)
+	c.budget.addBytes(n)
+}
+
+// Bytes returns estimated bytes used by messages in cache
+func (c *MessageCache) Bytes() int64 {
+	return atomic.LoadInt64(&c.bytes)
+}
+
+func (c *MessageCache) recordSize() {
+	totalSize, totalBytes := c.budget.Len(), c.budget.Bytes()
+	if c.budget == nil {
+		totalSize, totalBytes = c.Len(), c.Bytes()
 	}
+	metrics.RecordCacheSize(c.view, c.Len(), totalSize)
+	metrics.RecordCacheBytes(c.view, int(c.Bytes()), int(totalBytes))
+}
+
+func (c *MessageCache) entryRemoved(entry *MessageCacheEntry) {
+	c.addSize(-1)
+	c.addBytes(-entry.size)
+	c.lock.Lock()
+	delete(c.refreshing, entry.key)
+	c.lock.Unlock()
 }
 
 func (c *MessageCache) messageToCache(message *g53.Message) *MessageCacheEntry {
@@ -150,9 +287,11 @@ func (c *MessageCache) negativeMessageToCache(message *g53.Message) *MessageCach
 		message.ClearSection(g53.AdditionalSection)
 	}
 
+	now := time.Now()
 	return &MessageCacheEntry{
 		message:    message,
-		expireTime: time.Now().Add(time.Duration(minTtl) * time.Second),
+		addTime:    now,
+		expireTime: now.Add(time.Duration(minTtl) * time.Second),
 	}
 }
 
@@ -174,9 +313,11 @@ func (c *MessageCache) positiveMessageToCache(message *g53.Message) *MessageCach
 		}
 	}
 
+	now := time.Now()
 	return &MessageCacheEntry{
 		message:    message,
-		expireTime: time.Now().Add(time.Second * time.Duration(minTtl)),
+		addTime:    now,
+		expireTime: now.Add(time.Second * time.Duration(minTtl)),
 	}
 }
 
@@ -186,12 +327,11 @@ func keyForMessage(name *g53.Name, typ g53.RRType) Key {
 }
 
 func (c *MessageCache) Get(client *core.Client) (*g53.Message, bool) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
 	if entry, found := c.get(client.Request.Question.Name, client.Request.Question.Type); found {
 		if c.needPrefetch && entry.NeedPrefetch() {
 			c.prefetcher.addPrefetchTask(client)
 		}
+		client.Security = entry.security
 		return entry.Message(), true
 	} else {
 		return nil, false
@@ -200,11 +340,12 @@ func (c *MessageCache) Get(client *core.Client) (*g53.Message, bool) {
 
 func (c *MessageCache) get(name *g53.Name, typ g53.RRType) (*MessageCacheEntry, bool) {
 	key := keyForMessage(name, typ)
-	if elem, hit := c.cache[key]; hit {
-		entry := elem.Value.(*MessageCacheEntry)
+	if entry, hit := c.shards[shardIndex(key)].get(key); hit {
 		if entry.IsExpire() == false && entry.message.Question.Name.Equals(name) {
-			c.ll.MoveToFront(elem)
-			roundrobinAnswer(entry.message)
+			//avoid writing shared memory if it's already referenced
+			if atomic.LoadUint32(&entry.referenced) == 0 {
+				atomic.StoreUint32(&entry.referenced, 1)
+			}
 			return entry, true
 		}
 	}
@@ -213,47 +354,78 @@ func (c *MessageCache) get(name *g53.Name, typ g53.RRType) (*MessageCacheEntry,
 
 func (c *MessageCache) Remove(name *g53.Name, typ g53.RRType) {
 	key := keyForMessage(name, typ)
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	if ele, hit := c.cache[key]; hit {
-		c.removeElement(ele)
+	shard := c.shards[shardIndex(key)]
+	shard.lock.Lock()
+	entry, hit := shard.entries[key]
+	if hit {
+		shard.remove(entry)
 	}
-}
-
-func (c *MessageCache) removeOldest() {
-	ele := c.ll.Back()
-	if ele != nil {
-		c.removeElement(ele)
+	shard.lock.Unlock()
+	if hit {
+		c.entryRemoved(entry)
+		c.recordSize()
 	}
 }
 
-func (c *MessageCache) removeElement(e *list.Element) {
-	c.ll.Remove(e)
-	message := e.Value.(*MessageCacheEntry).message
-	key := keyForMessage(message.Question.Name, message.Question.Type)
-	delete(c.cache, key)
-}
-
 func (c *MessageCache) Len() int {
-	c.lock.RLock()
-	defer c.lock.RUnlock()
-
-	return c.ll.Len()
+	return int(atomic.LoadInt64(&c.size))
 }
 
 func (c *MessageCache) Clear() {
+	for _, shard := range c.shards {
+		shard.clear()
+	}
+	c.budget.addSize(-atomic.SwapInt64(&c.size, 0))
+	c.budget.addBytes(-atomic.SwapInt64(&c.bytes, 0))
+	c.recordSize()
+
 	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.refreshing = make(map[Key]time.Time)
+	c.lock.Unlock()
+}
 
-	c.ll.Init()
-	c.cache = make(map[Key]*list.Element)
+// rrsets of cached message are read by other goroutines, so ttl is set to
+// copies of them
+func messageWithTtl(message *g53.Message, ttlOf func(g53.RRTTL) g53.RRTTL) *g53.Message {
+	rrsetCount := 0
+	for _, section := range message.Sections {
+		rrsetCount += len(section)
+	}
+	copies := make([]g53.RRset, rrsetCount)
+	pointers := make([]*g53.RRset, rrsetCount)
+
+	msg := *message
+	for i, section := range message.Sections {
+		//empty slice without capacity, append to it won't change cache
+		msg.Sections[i] = pointers[:0:0]
+		if len(section) == 0 {
+			continue
+		}
+		rrsets := pointers[:len(section):len(section)]
+		pointers = pointers[len(section):]
+		for j, rrset := range section {
+			copies[j] = *rrset
+			copies[j].Ttl = ttlOf(rrset.Ttl)
+			rrsets[j] = &copies[j]
+		}
+		copies = copies[len(section):]
+		msg.Sections[i] = rrsets
+	}
+	return &msg
 }
 
-func roundrobinAnswer(msg *g53.Message) {
-	answers := msg.Sections[g53.AnswerSection]
-	for _, rrset := range answers {
-		if len(rrset.Rdatas) > 1 {
-			rrset.RotateRdata()
+// rdatas are rotated count times to a new slice, rrsets in answer section
+// should be copies
+func roundrobinAnswer(msg *g53.Message, count int) {
+	for _, rrset := range msg.Sections[g53.AnswerSection] {
+		rrCount := len(rrset.Rdatas)
+		if rrCount < 2 {
+			continue
 		}
+
+		offset := count % rrCount
+		rdatas := make([]g53.Rdata, 0, rrCount)
+		rdatas = append(rdatas, rrset.Rdatas[rrCount-offset:]...)
+		rrset.Rdatas = append(rdatas, rrset.Rdatas[:rrCount-offset]...)
 	}
 }
@@ -1,14 +1,17 @@
 package cache
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	ut "github.com/zdnscloud/cement/unittest"
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/config"
 	"github.com/zdnscloud/vanguard/core"
 	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/metrics"
 )
 
 func buildMessage(qname, ip string, ttl int) *g53.Message {
@@ -103,3 +106,145 @@ func TestMessageCache(t *testing.T) {
 	ut.Assert(t, found == false, "message should be cleaned")
 	ut.Equal(t, cache.Len(), 2)
 }
+
+func TestTtlDecrement(t *testing.T) {
+	conf := &config.CacheConf{}
+	cache := newMessageCache(conf, nil)
+
+	message := buildMessage("test.example.com.", "1.1.1.1", 10)
+	ns, _ := g53.RRsetFromString("example.com. 20 IN NS ns.example.com.")
+	glue, _ := g53.RRsetFromString("ns.example.com. 20 IN A 2.2.2.2")
+	message.AddRRset(g53.AuthSection, ns)
+	message.AddRRset(g53.AdditionalSection, glue)
+	cache.Add(message)
+
+	<-time.After(2100 * time.Millisecond)
+	client := &core.Client{
+		Request: g53.MakeQuery(g53.NameFromStringUnsafe("test.example.com."), g53.RR_A, 512, false),
+	}
+	response, found := cache.Get(client)
+	ut.Assert(t, found == true, "message shouldn't expired")
+	ut.Equal(t, response.Sections[g53.AnswerSection][0].Ttl, g53.RRTTL(8))
+	ut.Equal(t, response.Sections[g53.AuthSection][0].Ttl, g53.RRTTL(18))
+	ut.Equal(t, response.Sections[g53.AdditionalSection][0].Ttl, g53.RRTTL(18))
+
+	//cached message isn't changed
+	ut.Equal(t, message.Sections[g53.AnswerSection][0].Ttl, g53.RRTTL(10))
+	ut.Equal(t, message.Sections[g53.AuthSection][0].Ttl, g53.RRTTL(20))
+}
+
+func TestRoundrobinAnswer(t *testing.T) {
+	cache := newMessageCache(&config.CacheConf{}, nil)
+	message := buildMessage("test.example.com.", "1.1.1.1", 60)
+	for _, ip := range []string{"2.2.2.2", "3.3.3.3"} {
+		rdata, _ := g53.AFromString(ip)
+		message.Sections[g53.AnswerSection][0].AddRdata(rdata)
+	}
+	cache.Add(message)
+
+	client := &core.Client{
+		Request: g53.MakeQuery(g53.NameFromStringUnsafe("test.example.com."), g53.RR_A, 512, false),
+	}
+	for _, first := range []string{"3.3.3.3", "2.2.2.2", "1.1.1.1", "3.3.3.3"} {
+		response, _ := cache.Get(client)
+		ut.Equal(t, response.Sections[g53.AnswerSection][0].Rdatas[0].String(), first)
+		ut.Equal(t, len(response.Sections[g53.AnswerSection][0].Rdatas), 3)
+	}
+	ut.Equal(t, message.Sections[g53.AnswerSection][0].Rdatas[0].String(), "1.1.1.1")
+}
+
+func TestClockEviction(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	maxSize := 100
+	cache := newMessageCache(&config.CacheConf{MaxCacheSize: uint(maxSize)}, nil)
+	hotName := "hot.example.com."
+	cache.Add(buildMessage(hotName, "1.1.1.1", 60))
+	client := &core.Client{
+		Request: g53.MakeQuery(g53.NameFromStringUnsafe(hotName), g53.RR_A, 512, false),
+	}
+
+	for i := 0; i < 10*maxSize; i++ {
+		_, found := cache.Get(client)
+		ut.Assert(t, found, "referenced message shouldn't be evicted")
+		cache.Add(buildMessage(fmt.Sprintf("test%d.example.com.", i), "1.1.1.1", 60))
+		ut.Assert(t, cache.Len() <= maxSize, "cache size %d exceeds max size", cache.Len())
+	}
+	ut.Equal(t, cache.Len(), maxSize)
+
+	cache.Clear()
+	ut.Equal(t, cache.Len(), 0)
+	_, found := cache.Get(client)
+	ut.Equal(t, found, false)
+}
+
+func TestCacheQuota(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	size := estimateSize(buildMessage("test00.example.com.", "1.1.1.1", 60))
+	budget := newCacheBudget()
+	caches := make(map[string]*MessageCache)
+	for _, view := range []string{"v1", "v2", "v3"} {
+		caches[view] = newMessageCache(&config.CacheConf{}, nil)
+		caches[view].setQuota(view, 0, budget)
+	}
+	caches["v1"].setQuota("v1", uint64(10*size), budget)
+	budget.reloadConfig(uint64(20*size), caches)
+
+	add := func(view string, count int) {
+		for i := 0; i < count; i++ {
+			caches[view].Add(buildMessage(fmt.Sprintf("test%02d.example.com.", i), "1.1.1.1", 60))
+		}
+	}
+
+	add("v1", 50)
+	ut.Equal(t, caches["v1"].Len(), 10)
+	ut.Equal(t, caches["v1"].Bytes(), 10*size)
+
+	//the largest view is evicted when budget is exceeded
+	add("v2", 15)
+	ut.Equal(t, caches["v2"].Len(), 10)
+	ut.Equal(t, caches["v1"].Len(), 10)
+	ut.Equal(t, budget.Bytes(), 20*size)
+
+	add("v3", 1)
+	ut.Equal(t, caches["v3"].Len(), 1)
+	ut.Equal(t, caches["v1"].Len()+caches["v2"].Len(), 19)
+	ut.Equal(t, budget.Bytes(), 20*size)
+	ut.Equal(t, budget.Len(), 20)
+	ut.Equal(t, testutil.ToFloat64(metrics.CacheSize.WithLabelValues("cache")), float64(20))
+	ut.Equal(t, testutil.ToFloat64(metrics.CacheBytes.WithLabelValues("cache")), float64(20*size))
+	ut.Equal(t, testutil.ToFloat64(metrics.CacheSizeByView.WithLabelValues("cache", "v3")), float64(1))
+	evictions := testutil.ToFloat64(metrics.CacheEvictionsByView.WithLabelValues("cache", "v1")) +
+		testutil.ToFloat64(metrics.CacheEvictionsByView.WithLabelValues("cache", "v2"))
+	ut.Equal(t, evictions, float64(40+5+1))
+
+	caches["v3"].Clear()
+	ut.Equal(t, budget.Bytes(), 19*size)
+	ut.Equal(t, budget.Len(), 19)
+}
+
+func TestCacheSecurityStatus(t *testing.T) {
+	cache := newMessageCache(&config.CacheConf{}, nil)
+	for name, security := range map[string]core.SecurityStatus{
+		"secure.example.com.":    core.SecuritySecure,
+		"insecure.example.com.":  core.SecurityInsecure,
+		"unchecked.example.com.": core.SecurityUnchecked,
+	} {
+		message := buildMessage(name, "1.1.1.1", 60)
+		message.Header.SetFlag(g53.FLAG_AD, security == core.SecuritySecure)
+		cache.AddResponse(&core.Client{Response: message, Security: security})
+	}
+
+	for name, security := range map[string]core.SecurityStatus{
+		"secure.example.com.":    core.SecuritySecure,
+		"insecure.example.com.":  core.SecurityInsecure,
+		"unchecked.example.com.": core.SecurityUnchecked,
+	} {
+		client := &core.Client{
+			Request: g53.MakeQuery(g53.NameFromStringUnsafe(name), g53.RR_A, 512, false),
+		}
+		response, found := cache.Get(client)
+		ut.Assert(t, found, "%s should be cached", name)
+		ut.Equal(t, client.Security, security)
+		ut.Equal(t, response.Header.GetFlag(g53.FLAG_AD), security == core.SecuritySecure)
+	}
+}
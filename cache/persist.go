@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
+	vutil "github.com/zdnscloud/vanguard/util"
+)
+
+// cache file begins with magic and dump time, followed by views, each view
+// has its name, message count and messages, each message has its absolute
+// expire time, validation status and data in wire format with length
+// prefix, ttl of messages is the remaining lifetime at dump time, integers
+// are in big endian
+var cacheFileMagic = []byte("VGCACHE2")
+
+var errInvalidCacheFile = errors.New("invalid cache file")
+
+type cacheFileEntry struct {
+	expireTime int64 //unix seconds
+	security   core.SecurityStatus
+	data       []byte
+}
+
+// messages which aren't expired, ttl is decreased to the remaining
+func (c *MessageCache) dumpEntries(now time.Time) []cacheFileEntry {
+	var entries []cacheFileEntry
+	render := g53.NewMsgRender()
+	for _, shard := range c.shards {
+		shard.lock.RLock()
+		for _, entry := range shard.entries {
+			if entry.expireTime.After(now) == false {
+				continue
+			}
+			elapsed := g53.RRTTL(now.Sub(entry.addTime) / time.Second)
+			message := messageWithTtl(entry.message, func(ttl g53.RRTTL) g53.RRTTL {
+				if ttl > elapsed {
+					return ttl - elapsed
+				}
+				return 0
+			})
+			vutil.RecalculateSectionRRCount(message)
+			message.Rend(render)
+			entries = append(entries, cacheFileEntry{
+				expireTime: entry.expireTime.Unix(),
+				security:   entry.security,
+				data:       append([]byte{}, render.Data()...),
+			})
+			render.Clear()
+		}
+		shard.lock.RUnlock()
+	}
+	return entries
+}
+
+// DumpToFile writes messages of all views into file, file is replaced
+// after all the messages are written
+func (c *Cache) DumpToFile(path string) error {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	now := time.Now()
+	w.Write(cacheFileMagic)
+	binary.Write(w, binary.BigEndian, now.Unix())
+	for view, messageCache := range c.cache {
+		if len(view) > 255 {
+			continue
+		}
+		entries := messageCache.dumpEntries(now)
+		w.WriteByte(byte(len(view)))
+		w.WriteString(view)
+		binary.Write(w, binary.BigEndian, uint32(len(entries)))
+		for _, entry := range entries {
+			binary.Write(w, binary.BigEndian, entry.expireTime)
+			w.WriteByte(byte(entry.security))
+			binary.Write(w, binary.BigEndian, uint16(len(entry.data)))
+			w.Write(entry.data)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadFromFile adds messages in file into cache, expired messages and
+// messages of views which don't exist are discarded
+func (c *Cache) LoadFromFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(cacheFileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != string(cacheFileMagic) {
+		return 0, errInvalidCacheFile
+	}
+	var dumpTime int64
+	if err := binary.Read(r, binary.BigEndian, &dumpTime); err != nil {
+		return 0, errInvalidCacheFile
+	}
+
+	now := time.Now().Unix()
+	loaded := 0
+	for {
+		viewLen, err := r.ReadByte()
+		if err == io.EOF {
+			return loaded, nil
+		} else if err != nil {
+			return loaded, errInvalidCacheFile
+		}
+		view := make([]byte, viewLen)
+		var count uint32
+		if _, err := io.ReadFull(r, view); err != nil {
+			return loaded, errInvalidCacheFile
+		} else if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+			return loaded, errInvalidCacheFile
+		}
+
+		messageCache := c.cache[string(view)]
+		for i := uint32(0); i < count; i++ {
+			var expireTime int64
+			var length uint16
+			if err := binary.Read(r, binary.BigEndian, &expireTime); err != nil {
+				return loaded, errInvalidCacheFile
+			}
+			security, err := r.ReadByte()
+			if err != nil || core.SecurityStatus(security) > core.SecurityBogus {
+				return loaded, errInvalidCacheFile
+			} else if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+				return loaded, errInvalidCacheFile
+			}
+			data := make([]byte, length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return loaded, errInvalidCacheFile
+			}
+
+			if messageCache == nil || expireTime <= now {
+				continue
+			}
+			message, err := rdata.MessageFromWire(util.NewInputBuffer(data))
+			if err != nil || message.Question == nil {
+				logger.GetLogger().Warn("invalid message in cache file of view %s", string(view))
+				continue
+			}
+			messageCache.addEntry(&MessageCacheEntry{
+				message:    message,
+				addTime:    time.Unix(dumpTime, 0),
+				expireTime: time.Unix(expireTime, 0),
+				security:   core.SecurityStatus(security),
+			})
+			loaded += 1
+		}
+	}
+}
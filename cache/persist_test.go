@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/logger"
+)
+
+func newTestCache(views ...string) *Cache {
+	c := &Cache{
+		cache:  make(map[string]*MessageCache),
+		budget: newCacheBudget(),
+	}
+	for _, view := range views {
+		c.cache[view] = newMessageCache(&config.CacheConf{}, c)
+		c.cache[view].setQuota(view, 0, c.budget)
+	}
+	return c
+}
+
+func TestCachePersistence(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	dir, err := ioutil.TempDir("", "cache")
+	ut.Assert(t, err == nil, "create temp dir failed: %v", err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.dump")
+
+	c := newTestCache("v1", "v2")
+	message := buildMessage("www.example.com.", "1.1.1.1", 60)
+	rdata, _ := g53.AFromString("2.2.2.2")
+	message.Sections[g53.AnswerSection][0].AddRdata(rdata)
+	c.cache["v1"].AddResponse(&core.Client{Response: message, Security: core.SecurityInsecure})
+	c.cache["v1"].Add(buildMessage("short.example.com.", "1.1.1.1", 1))
+	c.cache["v2"].Add(buildMessage("www.example.com.", "3.3.3.3", 60))
+	ut.Equal(t, c.DumpToFile(path), nil)
+
+	//expired message and message of deleted view are discarded
+	<-time.After(1100 * time.Millisecond)
+	c = newTestCache("v1", "v3")
+	count, err := c.LoadFromFile(path)
+	ut.Assert(t, err == nil, "load cache file failed: %v", err)
+	ut.Equal(t, count, 1)
+	ut.Equal(t, c.cache["v1"].Len(), 1)
+	ut.Equal(t, c.cache["v3"].Len(), 0)
+	ut.Equal(t, c.budget.Bytes(), c.cache["v1"].Bytes())
+
+	client := &core.Client{
+		Request: g53.MakeQuery(g53.NameFromStringUnsafe("www.example.com."), g53.RR_A, 512, false),
+	}
+	response, found := c.cache["v1"].Get(client)
+	ut.Assert(t, found, "loaded message should be found")
+	ut.Equal(t, client.Security, core.SecurityInsecure)
+	answer := response.Sections[g53.AnswerSection][0]
+	ut.Equal(t, len(answer.Rdatas), 2)
+	ut.Assert(t, answer.Ttl <= 59 && answer.Ttl >= 57, "ttl %v should be decreased", answer.Ttl)
+
+	ioutil.WriteFile(path, []byte("VGCACHE0"), 0644)
+	_, err = c.LoadFromFile(path)
+	ut.Equal(t, err, errInvalidCacheFile)
+}
@@ -45,7 +45,7 @@ func (p *Prefetcher) run() {
 		case task = <-p.taskChan:
 			core.PassToNext(p.handler, task.ctx)
 			if task.ctx.Client.Response != nil && task.ctx.Client.CacheAnswer {
-				p.cache.Add(task.ctx.Client.Response)
+				p.cache.AddResponse(&task.ctx.Client)
 				p.deletePrefetchTask(task.ctx.Client.QueryKey())
 			}
 		}
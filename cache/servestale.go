@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/util"
+)
+
+const (
+	defaultMaxStaleTtl    uint32 = 86400 //1 day
+	defaultStaleAnswerTtl uint32 = 30
+	defaultClientTimeout  uint32 = 1800 //milliseconds
+	//no resolution is tried in this time after the last one failed
+	failureRecheckInterval = 30 * time.Second
+)
+
+type serveStaleConf struct {
+	maxStaleTtl   time.Duration
+	answerTtl     g53.RRTTL
+	clientTimeout time.Duration
+}
+
+// nil conf is returned if serve stale isn't enabled
+func newServeStaleConf(conf *config.ServeStaleInView) *serveStaleConf {
+	if conf == nil || conf.Enable == false {
+		return nil
+	}
+
+	maxStaleTtl := conf.MaxStaleTtl
+	if maxStaleTtl == 0 {
+		maxStaleTtl = defaultMaxStaleTtl
+	}
+
+	answerTtl := conf.StaleAnswerTtl
+	if answerTtl == 0 {
+		answerTtl = defaultStaleAnswerTtl
+	}
+
+	clientTimeout := conf.ClientTimeout
+	if clientTimeout == 0 {
+		clientTimeout = defaultClientTimeout
+	}
+
+	return &serveStaleConf{
+		maxStaleTtl:   time.Duration(maxStaleTtl) * time.Second,
+		answerTtl:     g53.RRTTL(answerTtl),
+		clientTimeout: time.Duration(clientTimeout) * time.Millisecond,
+	}
+}
+
+func (c *MessageCache) setServeStale(conf *config.ServeStaleInView) {
+	c.lock.Lock()
+	c.serveStale = newServeStaleConf(conf)
+	c.lock.Unlock()
+}
+
+// GetStale returns expired message which is still in stale window, the
+// message is a copy with stale ttl
+func (c *MessageCache) GetStale(name *g53.Name, typ g53.RRType) (*g53.Message, bool) {
+	c.lock.RLock()
+	serveStale := c.serveStale
+	c.lock.RUnlock()
+	if serveStale == nil {
+		return nil, false
+	}
+
+	key := keyForMessage(name, typ)
+	if entry, hit := c.shards[shardIndex(key)].get(key); hit {
+		if entry.IsExpire() && entry.expireTime.Add(serveStale.maxStaleTtl).After(time.Now()) &&
+			entry.message.Question.Name.Equals(name) {
+			return staleMessage(entry, serveStale.answerTtl), true
+		}
+	}
+	return nil, false
+}
+
+// only one resolution of a name is running, and it isn't retried soon
+// after failure, RFC 8767 4
+func (c *MessageCache) startRefresh(key Key) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.serveStale == nil {
+		return false
+	} else if notBefore, ok := c.refreshing[key]; ok && notBefore.After(time.Now()) {
+		return false
+	}
+	c.refreshing[key] = time.Now().Add(c.serveStale.maxStaleTtl)
+	return true
+}
+
+func (c *MessageCache) endRefresh(key Key, succeed bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if succeed {
+		delete(c.refreshing, key)
+	} else {
+		c.refreshing[key] = time.Now().Add(failureRecheckInterval)
+	}
+}
+
+func (c *MessageCache) clientTimeout() time.Duration {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.serveStale == nil {
+		return 0
+	}
+	return c.serveStale.clientTimeout
+}
+
+func staleMessage(entry *MessageCacheEntry, ttl g53.RRTTL) *g53.Message {
+	stale := messageWithTtl(entry.message, func(g53.RRTTL) g53.RRTTL {
+		return ttl
+	})
+	entry.setADFlag(stale)
+	if stale.Edns != nil {
+		util.AddEdnsOption(stale, &util.ExtendedErrorOpt{InfoCode: util.EDE_STALE_ANSWER})
+		util.RecalculateSectionRRCount(stale)
+	}
+	return stale
+}
+
+// resolution runs in background with a copy of the context, stale answer is
+// returned if it fails or doesn't finish within client timeout, the answer
+// is cached when it finishes
+func (c *Cache) resolveOrServeStale(ctx *core.Context, messageCache *MessageCache, stale *g53.Message) {
+	client := &ctx.Client
+	key := keyForMessage(client.Request.Question.Name, client.Request.Question.Type)
+	if messageCache.startRefresh(key) == false {
+		c.serveFromCache(client, stale)
+		return
+	}
+
+	refreshCtx := core.NewContext().Clone(client)
+	request := *client.Request
+	refreshCtx.Client.Request = &request
+	done := make(chan struct{})
+	go func() {
+		core.PassToNext(c, refreshCtx)
+		succeed := isResolved(refreshCtx.Client.Response)
+		if succeed && refreshCtx.Client.CacheAnswer {
+			messageCache.AddResponse(&refreshCtx.Client)
+		}
+		messageCache.endRefresh(key, succeed)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if isResolved(refreshCtx.Client.Response) {
+			client.Response = refreshCtx.Client.Response
+			client.CacheAnswer = refreshCtx.Client.CacheAnswer
+			client.Security = refreshCtx.Client.Security
+			return
+		}
+	case <-time.After(messageCache.clientTimeout()):
+	}
+	c.serveFromCache(client, stale)
+}
+
+func isResolved(response *g53.Message) bool {
+	return response != nil && response.Header.Rcode != g53.R_SERVFAIL
+}
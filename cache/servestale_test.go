@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/logger"
+)
+
+// resolver fails if respIP is empty
+type slowResolver struct {
+	core.DefaultHandler
+	respIP     string
+	delay      time.Duration
+	queryCount int32
+}
+
+func (r *slowResolver) HandleQuery(ctx *core.Context) {
+	atomic.AddInt32(&r.queryCount, 1)
+	<-time.After(r.delay)
+	if r.respIP == "" {
+		return
+	}
+
+	client := &ctx.Client
+	resp := client.Request.MakeResponse()
+	rdata, _ := g53.AFromString(r.respIP)
+	resp.AddRR(g53.AnswerSection, client.Request.Question.Name, g53.RR_A, g53.CLASS_IN, g53.RRTTL(60), rdata, false)
+	client.Response = resp
+	client.CacheAnswer = true
+}
+
+func queryCache(c *Cache, name string) *core.Client {
+	ctx := core.NewContext()
+	ctx.Reset()
+	ctx.Client.Request = g53.MakeQuery(g53.NameFromStringUnsafe(name), g53.RR_A, 512, false)
+	c.HandleQuery(ctx)
+	return &ctx.Client
+}
+
+func TestServeStale(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	resolver := &slowResolver{}
+	c := &Cache{cache: make(map[string]*MessageCache)}
+	c.SetNext(resolver)
+	messageCache := newMessageCache(&config.CacheConf{}, c)
+	messageCache.setServeStale(&config.ServeStaleInView{
+		Enable:         true,
+		StaleAnswerTtl: 5,
+		ClientTimeout:  200,
+	})
+	c.cache["default"] = messageCache
+
+	messageCache.Add(buildMessage("fail.example.com.", "1.1.1.1", 1))
+	messageCache.Add(buildMessage("slow.example.com.", "1.1.1.1", 1))
+	<-time.After(1100 * time.Millisecond)
+
+	//stale answer is returned if resolution fails, and resolution isn't
+	//tried again soon
+	for i := 0; i < 2; i++ {
+		client := queryCache(c, "fail.example.com.")
+		ut.Equal(t, client.CacheHit, true)
+		answer := client.Response.Sections[g53.AnswerSection][0]
+		ut.Equal(t, answer.Rdatas[0].String(), "1.1.1.1")
+		ut.Equal(t, answer.Ttl, g53.RRTTL(5))
+	}
+	ut.Equal(t, atomic.LoadInt32(&resolver.queryCount), int32(1))
+	_, found := messageCache.get(g53.NameFromStringUnsafe("fail.example.com."), g53.RR_A)
+	ut.Equal(t, found, false)
+
+	//stale answer is returned if resolution is slow, and the answer is
+	//cached when resolution finishes
+	resolver.respIP = "2.2.2.2"
+	resolver.delay = 500 * time.Millisecond
+	client := queryCache(c, "slow.example.com.")
+	ut.Equal(t, client.Response.Sections[g53.AnswerSection][0].Rdatas[0].String(), "1.1.1.1")
+	<-time.After(time.Second)
+	client = queryCache(c, "slow.example.com.")
+	answer := client.Response.Sections[g53.AnswerSection][0]
+	ut.Equal(t, answer.Rdatas[0].String(), "2.2.2.2")
+	ut.Equal(t, answer.Ttl, g53.RRTTL(60))
+	ut.Equal(t, atomic.LoadInt32(&resolver.queryCount), int32(2))
+
+	messageCache.setServeStale(nil)
+	_, found = messageCache.GetStale(g53.NameFromStringUnsafe("fail.example.com."), g53.RR_A)
+	ut.Equal(t, found, false)
+}
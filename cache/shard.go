@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// messages are spread to shards by key to reduce lock contention
+const (
+	shardBits  = 6
+	shardCount = 1 << shardBits
+)
+
+// cacheShard evicts entries with CLOCK algorithm, entry is marked as
+// referenced on hit, which only needs read lock, and the clock hand gives
+// referenced entry a second chance before evicting it, new entry isn't
+// referenced, so entries which are never hit are evicted first
+type cacheShard struct {
+	lock    sync.RWMutex
+	entries map[Key]*MessageCacheEntry
+	//removed entries leave holes which are reused by new entries
+	slots     []*MessageCacheEntry
+	freeSlots []int
+	hand      int
+}
+
+func newCacheShard() *cacheShard {
+	return &cacheShard{
+		entries: make(map[Key]*MessageCacheEntry),
+	}
+}
+
+// fibonacci hashing, high bits of the product depend on all bits of key
+func shardIndex(key Key) int {
+	return int((uint64(key) * 0x9e3779b97f4a7c15) >> (64 - shardBits))
+}
+
+func (s *cacheShard) get(key Key) (*MessageCacheEntry, bool) {
+	s.lock.RLock()
+	entry, ok := s.entries[key]
+	s.lock.RUnlock()
+	return entry, ok
+}
+
+// return the old entry which is replaced
+func (s *cacheShard) add(entry *MessageCacheEntry) *MessageCacheEntry {
+	if old, ok := s.entries[entry.key]; ok {
+		entry.slot = old.slot
+		s.slots[entry.slot] = entry
+		s.entries[entry.key] = entry
+		return old
+	}
+
+	if n := len(s.freeSlots); n > 0 {
+		entry.slot = s.freeSlots[n-1]
+		s.freeSlots = s.freeSlots[:n-1]
+		s.slots[entry.slot] = entry
+	} else {
+		entry.slot = len(s.slots)
+		s.slots = append(s.slots, entry)
+	}
+	s.entries[entry.key] = entry
+	return nil
+}
+
+func (s *cacheShard) remove(entry *MessageCacheEntry) {
+	delete(s.entries, entry.key)
+	s.slots[entry.slot] = nil
+	s.freeSlots = append(s.freeSlots, entry.slot)
+}
+
+// evict moves clock hand to the first entry which isn't referenced or is
+// expired and removes it, the hand moves one round at most, and entry keep
+// won't be evicted
+func (s *cacheShard) evict(keep *MessageCacheEntry) *MessageCacheEntry {
+	for i := 0; i < len(s.slots); i++ {
+		s.hand = (s.hand + 1) % len(s.slots)
+		entry := s.slots[s.hand]
+		if entry == nil || entry == keep {
+			continue
+		}
+		if atomic.SwapUint32(&entry.referenced, 0) == 1 && entry.IsExpire() == false {
+			continue
+		}
+		s.remove(entry)
+		return entry
+	}
+	return nil
+}
+
+func (s *cacheShard) clear() {
+	s.lock.Lock()
+	s.entries = make(map[Key]*MessageCacheEntry)
+	s.slots = nil
+	s.freeSlots = nil
+	s.hand = 0
+	s.lock.Unlock()
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/zdnscloud/vanguard/resolver"
 	"github.com/zdnscloud/vanguard/responsetransfer"
 	"github.com/zdnscloud/vanguard/server"
+	"github.com/zdnscloud/vanguard/update"
 	view "github.com/zdnscloud/vanguard/viewselector"
 	"github.com/zdnscloud/vanguard/xfr"
 )
@@ -85,8 +86,8 @@ func main() {
 	}
 
 	acl.NewAclManager(conf)
-	queryHandler, xfrHandler := createHandler(conf)
-	server, err := server.NewServer(conf, queryHandler, xfrHandler)
+	queryHandler, xfrHandler, updateHandler := createHandler(conf)
+	server, err := server.NewServer(conf, queryHandler, xfrHandler, updateHandler)
 	if err != nil {
 		panic("create server failed:" + err.Error())
 	}
@@ -130,7 +131,7 @@ var moduleInOrder = []string{
 	ModuleFailForwarder,
 }
 
-func createHandler(conf *config.VanguardConf) (core.DNSQueryHandler, core.DNSQueryHandler) {
+func createHandler(conf *config.VanguardConf) (core.DNSQueryHandler, core.DNSQueryHandler, core.DNSQueryHandler) {
 	creator := make(map[string]ModuleCreator)
 	resolverEnable := false
 	for _, m := range conf.EnableModules {
@@ -176,9 +177,10 @@ func createHandler(conf *config.VanguardConf) (core.DNSQueryHandler, core.DNSQue
 	}
 	core.BuildQueryChain(handlers...)
 
-	var xfrHandler core.DNSQueryHandler
+	var xfrHandler, updateHandler core.DNSQueryHandler
 	if viewSelector != nil && resol != nil && resol.Auth != nil {
 		xfrHandler = xfr.NewXFRHandler(viewSelector, resol.Auth)
+		updateHandler = update.NewUpdateHandler(viewSelector, resol.Auth)
 	}
-	return handlers[0], xfrHandler
+	return handlers[0], xfrHandler, updateHandler
 }
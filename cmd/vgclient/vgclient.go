@@ -23,6 +23,10 @@ const (
 	cmdAddForwarder    = "add_forwarder"
 	cmdGetDomainCache  = "get_domain_cache"
 	cmdGetMessageCache = "get_message_cache"
+	cmdDumpCache       = "dump_cache"
+	cmdZoneVersions    = "zone_versions"
+	cmdDiffZone        = "diff_zone"
+	cmdRollbackZone    = "rollback_zone"
 )
 
 const cmdServiceName = "vanguard_cmd"
@@ -43,8 +47,12 @@ var supportedCommands = []httpcmd.Command{
 	&cache.CleanRRsetsCache{},
 	&cache.GetDomainCache{},
 	&cache.GetMessageCache{},
+	&cache.DumpCache{},
 	&auth.AddAuthRrs{},
 	&auth.DeleteAuthRrs{},
+	&auth.GetAuthZoneVersions{},
+	&auth.DiffAuthZoneVersions{},
+	&auth.RollbackAuthZone{},
 
 	&forwarder.AddForwardZone{},
 }
@@ -109,6 +117,29 @@ func main() {
 			Type: args[3],
 		}
 		task.AddCmd(getMessageCache)
+	case cmdDumpCache:
+		task.AddCmd(&cache.DumpCache{})
+	case cmdZoneVersions:
+		task.AddCmd(&auth.GetAuthZoneVersions{View: args[1], Name: args[2]})
+	case cmdDiffZone:
+		from, err := strconv.ParseUint(args[3], 10, 32)
+		if err != nil {
+			fmt.Printf("serial %s isn't valid\n", args[3])
+			return
+		}
+		to, err := strconv.ParseUint(args[4], 10, 32)
+		if err != nil {
+			fmt.Printf("serial %s isn't valid\n", args[4])
+			return
+		}
+		task.AddCmd(&auth.DiffAuthZoneVersions{View: args[1], Name: args[2], From: uint32(from), To: uint32(to)})
+	case cmdRollbackZone:
+		serial, err := strconv.ParseUint(args[3], 10, 32)
+		if err != nil {
+			fmt.Printf("serial %s isn't valid\n", args[3])
+			return
+		}
+		task.AddCmd(&auth.RollbackAuthZone{View: args[1], Name: args[2], Serial: uint32(serial)})
 	default:
 		fmt.Printf("unknown cmd %v\n", args[0])
 		return
@@ -141,6 +172,25 @@ func main() {
 				fmt.Printf("%v\n", rrset)
 			}
 		}
+	} else if args[0] == cmdZoneVersions {
+		var versions []uint32
+		err = proxy.HandleTask(task, &versions)
+		if err.(*httpcmd.Error) == nil {
+			for _, version := range versions {
+				fmt.Printf("%d\n", version)
+			}
+		}
+	} else if args[0] == cmdDiffZone {
+		var change auth.ZoneChange
+		err = proxy.HandleTask(task, &change)
+		if err.(*httpcmd.Error) == nil {
+			for _, rr := range change.Deleted {
+				fmt.Printf("- %s\n", rr)
+			}
+			for _, rr := range change.Added {
+				fmt.Printf("+ %s\n", rr)
+			}
+		}
 	} else {
 		err = proxy.HandleTask(task, nil)
 	}
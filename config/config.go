@@ -40,10 +40,20 @@ type VanguardConf struct {
 }
 
 type ServerConf struct {
-	Addrs        []string `yaml:"addr"`
-	HttpCmdAddr  string   `yaml:"http_cmd_addr"`
-	HandlerCount int      `yaml:"handler_count"`
-	EnableTCP    bool     `yaml:"enable_tcp"`
+	Addrs           []string `yaml:"addr"`
+	HttpCmdAddr     string   `yaml:"http_cmd_addr"`
+	HandlerCount    int      `yaml:"handler_count"`
+	EnableTCP       bool     `yaml:"enable_tcp"`
+	TCPIdleTimeout  uint32   `yaml:"tcp_idle_timeout"`
+	MaxTCPConn      int      `yaml:"max_tcp_conn"`
+	MaxTCPConnPerIP int      `yaml:"max_tcp_conn_per_ip"`
+	MaxUdpSize      uint16   `yaml:"max_udp_size"`
+	TLSAddrs        []string `yaml:"tls_addr"`
+	TLSCertFile     string   `yaml:"tls_cert_file"`
+	TLSKeyFile      string   `yaml:"tls_key_file"`
+	DoHAddrs        []string `yaml:"doh_addr"`
+	DoHPath         string   `yaml:"doh_path"`
+	DoHProxies      []string `yaml:"doh_trusted_proxies"`
 }
 
 type ViewConf struct {
@@ -93,6 +103,30 @@ type CacheConf struct {
 	MaxCacheSize uint   `yaml:"max_cache_size"`
 	ShortAnswer  bool   `yaml:"short_answer"`
 	Prefetch     bool   `yaml:"prefetch"`
+	//estimated bytes of messages in cache of all views
+	MaxCacheBytes uint64             `yaml:"max_cache_bytes"`
+	ViewQuotas    []CacheQuotaInView `yaml:"view_quota"`
+	//messages are dumped into the file on shutdown and loaded on startup
+	DumpFile string `yaml:"dump_file"`
+	//expired answers are served when resolution fails, RFC 8767
+	ServeStale []ServeStaleInView `yaml:"serve_stale"`
+}
+
+// estimated bytes of messages in cache of a view
+type CacheQuotaInView struct {
+	View     string `yaml:"view"`
+	MaxBytes uint64 `yaml:"max_bytes"`
+}
+
+type ServeStaleInView struct {
+	View   string `yaml:"view"`
+	Enable bool   `yaml:"enable"`
+	//how long answers are kept after they expire
+	MaxStaleTtl uint32 `yaml:"max_stale_ttl"`
+	//ttl of rrsets in stale answer
+	StaleAnswerTtl uint32 `yaml:"stale_answer_ttl"`
+	//milliseconds to wait for resolution before stale answer is returned
+	ClientTimeout uint32 `yaml:"client_timeout"`
 }
 
 type SortListInView struct {
@@ -118,6 +152,12 @@ type RecursorInView struct {
 	View             string `yaml:"view"`
 	RootHintFile     string `yaml:"root_hint"`
 	EdnsSubnetEnable bool   `yaml:"subnet_enable"`
+	//answers are validated with dnssec, root ksk of iana is used if trust
+	//anchor file isn't specified, the file is updated by RFC 5011
+	DNSSECValidation bool   `yaml:"dnssec_validation"`
+	TrustAnchorFile  string `yaml:"trust_anchor_file"`
+	//only necessary labels of query name are sent to name servers
+	QnameMinimisation bool `yaml:"qname_minimisation"`
 }
 
 type ForwardZoneInView struct {
@@ -133,6 +173,14 @@ type ForwarderConf struct {
 
 type ResolverConf struct {
 	CheckCnameIndirect bool `yaml:"check_cname_indirect"`
+	//case of query name sent to upstream servers is randomized
+	CaseRandomization Dns0x20Conf `yaml:"dns0x20"`
+}
+
+type Dns0x20Conf struct {
+	Enable bool `yaml:"enable"`
+	//ip of servers which don't copy the question into response
+	Exceptions []string `yaml:"exceptions"`
 }
 
 type QuerySourceInView struct {
@@ -208,9 +256,30 @@ type DNS64InView struct {
 }
 
 type AuthZoneConf struct {
-	Name    string   `yaml:"name"`
-	File    string   `yaml:"file"`
-	Masters []string `yaml:"masters"`
+	Name         string     `yaml:"name"`
+	File         string     `yaml:"file"`
+	Journal      string     `yaml:"journal"`
+	Masters      []string   `yaml:"masters"`
+	UpdateAcls   []string   `yaml:"update_acls"`
+	TransferAcls []string   `yaml:"transfer_acls"`
+	Notify       string     `yaml:"notify"`
+	AlsoNotify   []string   `yaml:"also_notify"`
+	KeyName      string     `yaml:"key_name"`
+	KeySecret    string     `yaml:"key_secret"`
+	KeyAlgorithm string     `yaml:"key_algorithm"`
+	DNSSEC       DNSSECConf `yaml:"dnssec"`
+}
+
+// zone is signed if keys are configured, key is the path of key files
+// generated by dnssec-keygen without .key or .private suffix, validity and
+// refresh of signatures are in seconds
+type DNSSECConf struct {
+	Keys              []string `yaml:"keys"`
+	NSEC3             bool     `yaml:"nsec3"`
+	NSEC3Iterations   uint16   `yaml:"nsec3_iterations"`
+	NSEC3Salt         string   `yaml:"nsec3_salt"`
+	SignatureValidity uint32   `yaml:"signature_validity"`
+	SignatureRefresh  uint32   `yaml:"signature_refresh"`
 }
 
 type StubZoneConf struct {
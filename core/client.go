@@ -7,17 +7,48 @@ import (
 	"github.com/zdnscloud/g53"
 )
 
+// result of dnssec validation of response, RFC 4035 4.3, response which
+// isn't validated is unchecked
+type SecurityStatus uint8
+
+const (
+	SecurityUnchecked SecurityStatus = iota
+	SecuritySecure
+	SecurityInsecure
+	SecurityBogus
+)
+
+// Combine returns status of response assembled from responses with status
+// s and other, like the links of cname chain, it's secure only if both are
+// secure and bogus if either is bogus
+func (s SecurityStatus) Combine(other SecurityStatus) SecurityStatus {
+	switch {
+	case s == SecurityBogus || other == SecurityBogus:
+		return SecurityBogus
+	case s == other:
+		return s
+	case s == SecurityInsecure || other == SecurityInsecure:
+		return SecurityInsecure
+	default:
+		return SecurityUnchecked
+	}
+}
+
 type Client struct {
-	Addr        net.Addr
-	DestAddr    net.Addr
-	UsingTCP    bool
-	Request     *g53.Message
-	Response    *g53.Message
-	View        string
-	ViewId      uint16
-	CacheHit    bool
-	CacheAnswer bool
-	CreateTime  time.Time
+	Addr      net.Addr
+	DestAddr  net.Addr
+	UsingTCP  bool
+	Transport Transport
+	Request   *g53.Message
+	Response  *g53.Message
+	//response with multiple messages which is rendered by handler
+	RawResponses [][]byte
+	View         string
+	ViewId       uint16
+	CacheHit     bool
+	CacheAnswer  bool
+	Security     SecurityStatus
+	CreateTime   time.Time
 }
 
 func (c *Client) QueryKey() uint64 {
@@ -30,24 +61,30 @@ func (c *Client) QueryKey() uint64 {
 func (c *Client) reset() {
 	c.Addr = nil
 	c.DestAddr = nil
+	c.Transport = TransportUDP
 	c.Request = nil
 	c.Response = nil
+	c.RawResponses = nil
 	c.View = "default"
 	c.ViewId = 0
 	c.CacheHit = false
 	c.CacheAnswer = true
+	c.Security = SecurityUnchecked
 	c.CreateTime = time.Now()
 }
 
 func (c *Client) clone(other *Client) *Client {
 	c.Addr = other.Addr
 	c.DestAddr = other.DestAddr
+	c.Transport = other.Transport
 	c.Request = other.Request
 	c.Response = other.Response
+	c.RawResponses = other.RawResponses
 	c.View = other.View
 	c.ViewId = other.ViewId
 	c.CacheHit = other.CacheHit
 	c.CacheAnswer = other.CacheAnswer
+	c.Security = other.Security
 	c.CreateTime = other.CreateTime
 	return c
 }
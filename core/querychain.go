@@ -6,6 +6,11 @@ type DNSQueryHandler interface {
 	SetNext(DNSQueryHandler)
 }
 
+// handler which saves its state before server exits
+type ShutdownHandler interface {
+	Shutdown()
+}
+
 type DefaultHandler struct {
 	next DNSQueryHandler
 }
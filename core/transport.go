@@ -0,0 +1,21 @@
+package core
+
+type Transport uint8
+
+const (
+	TransportUDP   Transport = 0
+	TransportTCP   Transport = 1
+	TransportTLS   Transport = 2
+	TransportHTTPS Transport = 3
+)
+
+var transportStr = map[Transport]string{
+	TransportUDP:   "udp",
+	TransportTCP:   "tcp",
+	TransportTLS:   "tls",
+	TransportHTTPS: "https",
+}
+
+func (t Transport) String() string {
+	return transportStr[t]
+}
@@ -0,0 +1,346 @@
+// Package dnssec signs and verifies rrsets with dnssec keys, RFC 4034
+package dnssec
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported dnssec algorithm")
+	ErrInvalidKeyFile       = errors.New("invalid key file")
+	ErrKeyMismatch          = errors.New("private key doesn't match dnskey")
+	ErrNotZoneKey           = errors.New("dnskey isn't zone key")
+	ErrUnsupportedDigest    = errors.New("unsupported ds digest type")
+)
+
+// only ECDSAP256SHA256 and ED25519 keys could sign, the others are
+// supported in verification
+const (
+	AlgorithmRSASHA256       uint8 = 8
+	AlgorithmRSASHA512       uint8 = 10
+	AlgorithmECDSAP256SHA256 uint8 = 13
+	AlgorithmECDSAP384SHA384 uint8 = 14
+	AlgorithmED25519         uint8 = 15
+)
+
+const (
+	FlagZone   uint16 = 0x0100
+	FlagRevoke uint16 = 0x0080
+	FlagSEP    uint16 = 0x0001
+
+	DigestSHA1   uint8 = 1
+	DigestSHA256 uint8 = 2
+	DigestSHA384 uint8 = 4
+
+	dnskeyProtocol = 3
+	p256KeySize    = 32
+	p384KeySize    = 48
+)
+
+// key pair which signs a zone, key with SEP flag is key signing key
+type Key struct {
+	Owner  *g53.Name
+	DNSKEY *rdata.DNSKEY
+	Tag    uint16
+
+	privateKey crypto.PrivateKey
+}
+
+func (k *Key) IsKSK() bool {
+	return k.DNSKEY.Flags&FlagSEP != 0
+}
+
+// GenerateKey creates a key pair of algorithm ECDSAP256SHA256 or ED25519
+func GenerateKey(owner *g53.Name, algorithm uint8, ksk bool) (*Key, error) {
+	flags := FlagZone
+	if ksk {
+		flags |= FlagSEP
+	}
+
+	dnskey := &rdata.DNSKEY{
+		Flags:     flags,
+		Protocol:  dnskeyProtocol,
+		Algorithm: algorithm,
+	}
+	var privateKey crypto.PrivateKey
+	switch algorithm {
+	case AlgorithmECDSAP256SHA256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		dnskey.PublicKey = p256PublicKey(&key.PublicKey)
+		privateKey = key
+	case AlgorithmED25519:
+		public, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		dnskey.PublicKey = public
+		privateKey = key
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return &Key{
+		Owner:      owner,
+		DNSKEY:     dnskey,
+		Tag:        KeyTag(dnskey),
+		privateKey: privateKey,
+	}, nil
+}
+
+// LoadKey reads key pair generated by dnssec-keygen, path is the common
+// prefix of the .key and .private files, suffix of either file is accepted
+func LoadKey(path string) (*Key, error) {
+	path = strings.TrimSuffix(strings.TrimSuffix(path, ".key"), ".private")
+	owner, dnskey, err := readPublicKey(path + ".key")
+	if err != nil {
+		return nil, err
+	}
+	if dnskey.Flags&FlagZone == 0 {
+		return nil, ErrNotZoneKey
+	}
+
+	privateKey, err := readPrivateKey(path+".private", dnskey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Owner:      owner,
+		DNSKEY:     dnskey,
+		Tag:        KeyTag(dnskey),
+		privateKey: privateKey,
+	}, nil
+}
+
+// public key file has one dnskey rr, lines start with ; are comments
+func readPublicKey(path string) (*g53.Name, *rdata.DNSKEY, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, ";"); i != -1 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		for i, field := range fields {
+			if strings.EqualFold(field, "DNSKEY") == false {
+				continue
+			}
+			owner, err := g53.NameFromString(fields[0])
+			if err != nil {
+				return nil, nil, err
+			}
+			key, err := rdata.FromString(g53.RR_DNSKEY, strings.Join(fields[i+1:], " "))
+			if err != nil {
+				return nil, nil, err
+			}
+			return owner, key.(*rdata.DNSKEY), nil
+		}
+		return nil, nil, ErrInvalidKeyFile
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, ErrInvalidKeyFile
+}
+
+// private key file has lines of "field: value", the key is the
+// PrivateKey field in base64
+func readPrivateKey(path string, dnskey *rdata.DNSKEY) (crypto.PrivateKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) == 2 {
+			fields[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	algorithm := strings.Fields(fields["algorithm"])
+	if len(algorithm) == 0 || algorithm[0] != fmt.Sprintf("%d", dnskey.Algorithm) {
+		return nil, ErrKeyMismatch
+	}
+	data, err := base64.StdEncoding.DecodeString(fields["privatekey"])
+	if err != nil || len(data) == 0 {
+		return nil, ErrInvalidKeyFile
+	}
+
+	switch dnskey.Algorithm {
+	case AlgorithmECDSAP256SHA256:
+		if len(data) != p256KeySize {
+			return nil, ErrInvalidKeyFile
+		}
+		key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(data)}
+		key.Curve = elliptic.P256()
+		key.X, key.Y = key.Curve.ScalarBaseMult(data)
+		if string(p256PublicKey(&key.PublicKey)) != string(dnskey.PublicKey) {
+			return nil, ErrKeyMismatch
+		}
+		return key, nil
+	case AlgorithmED25519:
+		if len(data) != ed25519.SeedSize {
+			return nil, ErrInvalidKeyFile
+		}
+		key := ed25519.NewKeyFromSeed(data)
+		if string(key.Public().(ed25519.PublicKey)) != string(dnskey.PublicKey) {
+			return nil, ErrKeyMismatch
+		}
+		return key, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// private key in the format of dnssec-keygen, which is read by LoadKey
+func (k *Key) PrivateKeyString() string {
+	var data []byte
+	switch key := k.privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		data = paddedBytes(key.D, p256KeySize)
+	case ed25519.PrivateKey:
+		data = key.Seed()
+	}
+	return fmt.Sprintf("Private-key-format: v1.3\nAlgorithm: %d (%s)\nPrivateKey: %s\n",
+		k.DNSKEY.Algorithm, algorithmName(k.DNSKEY.Algorithm), base64.StdEncoding.EncodeToString(data))
+}
+
+func algorithmName(algorithm uint8) string {
+	switch algorithm {
+	case AlgorithmECDSAP256SHA256:
+		return "ECDSAP256SHA256"
+	case AlgorithmED25519:
+		return "ED25519"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// public key of ecdsa is x and y of the point, RFC 6605 4
+func p256PublicKey(key *ecdsa.PublicKey) []byte {
+	return append(paddedBytes(key.X, p256KeySize), paddedBytes(key.Y, p256KeySize)...)
+}
+
+// big endian bytes with leading zeros
+func paddedBytes(v *big.Int, size int) []byte {
+	data := v.Bytes()
+	if len(data) >= size {
+		return data
+	}
+	return append(make([]byte, size-len(data)), data...)
+}
+
+// RFC 4034 appendix B
+func KeyTag(key *rdata.DNSKEY) uint16 {
+	buf := util.NewOutputBuffer(64)
+	key.ToWire(buf)
+	var ac uint32
+	for i, b := range buf.Data() {
+		if i&1 == 1 {
+			ac += uint32(b)
+		} else {
+			ac += uint32(b) << 8
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac & 0xffff)
+}
+
+// DS is the delegation signer record of the key, which is published in
+// parent zone, only SHA-256 digest is generated
+func DS(owner *g53.Name, key *rdata.DNSKEY) *g53.DS {
+	digest, _ := Digest(owner, key, DigestSHA256)
+	return &g53.DS{
+		KeyTag:     KeyTag(key),
+		Algorithm:  key.Algorithm,
+		DigestType: DigestSHA256,
+		Digest:     fmt.Sprintf("%x", digest),
+	}
+}
+
+// Digest is the digest of owner and key in ds, RFC 4034 5.1.4
+func Digest(owner *g53.Name, key *rdata.DNSKEY, digestType uint8) ([]byte, error) {
+	var h hash.Hash
+	switch digestType {
+	case DigestSHA1:
+		h = sha1.New()
+	case DigestSHA256:
+		h = sha256.New()
+	case DigestSHA384:
+		h = sha512.New384()
+	default:
+		return nil, ErrUnsupportedDigest
+	}
+
+	buf := util.NewOutputBuffer(128)
+	CanonicalName(owner).ToWire(buf)
+	key.ToWire(buf)
+	h.Write(buf.Data())
+	return h.Sum(nil), nil
+}
+
+// MatchDS checks whether ds is generated from the key
+func MatchDS(owner *g53.Name, key *rdata.DNSKEY, ds *g53.DS) bool {
+	if ds.Algorithm != key.Algorithm || ds.KeyTag != KeyTag(key) {
+		return false
+	}
+	digest, err := Digest(owner, key, ds.DigestType)
+	return err == nil && strings.EqualFold(fmt.Sprintf("%x", digest), ds.Digest)
+}
+
+// IsSupportedAlgorithm returns whether signature of the algorithm could
+// be verified
+func IsSupportedAlgorithm(algorithm uint8) bool {
+	switch algorithm {
+	case AlgorithmRSASHA256, AlgorithmRSASHA512, AlgorithmECDSAP256SHA256,
+		AlgorithmECDSAP384SHA384, AlgorithmED25519:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsSupportedDigest returns whether ds with the digest type could be
+// matched with dnskey
+func IsSupportedDigest(digestType uint8) bool {
+	return digestType == DigestSHA1 || digestType == DigestSHA256 || digestType == DigestSHA384
+}
@@ -0,0 +1,245 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+var (
+	ErrInvalidSignature = errors.New("signature doesn't match rrset")
+	ErrSignerMismatch   = errors.New("rrsig doesn't match rrset or key")
+)
+
+// Sign generates the signature of rrset with key, owner of wildcard rrset
+// is the wildcard name, the signature is valid between inception and
+// expiration
+func Sign(rrset *g53.RRset, key *Key, inception, expiration time.Time) (*rdata.RRSIG, error) {
+	labels := rrset.Name.LabelCount() - 1
+	if rrset.Name.IsWildCard() {
+		labels -= 1
+	}
+
+	sig := &rdata.RRSIG{
+		Covered:     rrset.Type,
+		Algorithm:   key.DNSKEY.Algorithm,
+		Labels:      uint8(labels),
+		OriginalTtl: uint32(rrset.Ttl),
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		Tag:         key.Tag,
+		Signer:      CanonicalName(key.Owner),
+	}
+	data := signedData(rrset.Name, rrset, sig)
+
+	switch privateKey := key.privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig.Signature = append(paddedBytes(r, p256KeySize), paddedBytes(s, p256KeySize)...)
+	case ed25519.PrivateKey:
+		sig.Signature = ed25519.Sign(privateKey, data)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return sig, nil
+}
+
+// Verify checks the signature of rrset, rrset could be expanded from
+// wildcard, validity period of the signature isn't checked
+func Verify(rrset *g53.RRset, sig *rdata.RRSIG, signer *g53.Name, key *rdata.DNSKEY) error {
+	if sig.Covered != rrset.Type || sig.Algorithm != key.Algorithm || sig.Tag != KeyTag(key) ||
+		sig.Signer.Equals(signer) == false || int(sig.Labels) > int(rrset.Name.LabelCount())-1 {
+		return ErrSignerMismatch
+	}
+
+	owner := rrset.Name
+	if labels := rrset.Name.LabelCount() - 1; uint(sig.Labels) < labels {
+		suffix, _ := rrset.Name.StripLeft(labels - uint(sig.Labels))
+		owner, _ = g53.NameFromStringUnsafe("*").Concat(suffix)
+	}
+	data := signedData(owner, rrset, sig)
+
+	return verifySignature(key, data, sig.Signature)
+}
+
+func verifySignature(key *rdata.DNSKEY, data, signature []byte) error {
+	switch key.Algorithm {
+	case AlgorithmRSASHA256, AlgorithmRSASHA512:
+		publicKey, err := rsaPublicKey(key.PublicKey)
+		if err != nil {
+			return err
+		}
+		hash := crypto.SHA256
+		if key.Algorithm == AlgorithmRSASHA512 {
+			hash = crypto.SHA512
+		}
+		h := hash.New()
+		h.Write(data)
+		if rsa.VerifyPKCS1v15(publicKey, hash, h.Sum(nil), signature) != nil {
+			return ErrInvalidSignature
+		}
+	case AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384:
+		curve, size, hash := elliptic.P256(), p256KeySize, crypto.SHA256
+		if key.Algorithm == AlgorithmECDSAP384SHA384 {
+			curve, size, hash = elliptic.P384(), p384KeySize, crypto.SHA384
+		}
+		if len(key.PublicKey) != 2*size || len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		publicKey := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(key.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(key.PublicKey[size:]),
+		}
+		h := hash.New()
+		h.Write(data)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if ecdsa.Verify(publicKey, h.Sum(nil), r, s) == false {
+			return ErrInvalidSignature
+		}
+	case AlgorithmED25519:
+		if len(key.PublicKey) != ed25519.PublicKeySize {
+			return ErrInvalidSignature
+		}
+		if ed25519.Verify(ed25519.PublicKey(key.PublicKey), data, signature) == false {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+	return nil
+}
+
+// RFC 3110 2, exponent length is one byte or three bytes with the first
+// one is zero, followed by exponent and modulus
+func rsaPublicKey(data []byte) (*rsa.PublicKey, error) {
+	if len(data) < 3 {
+		return nil, ErrInvalidSignature
+	}
+	expLen, data := int(data[0]), data[1:]
+	if expLen == 0 {
+		expLen, data = int(data[0])<<8|int(data[1]), data[2:]
+	}
+	if expLen == 0 || expLen > 4 || len(data) <= expLen {
+		return nil, ErrInvalidSignature
+	}
+
+	exponent := 0
+	for _, b := range data[:expLen] {
+		exponent = exponent<<8 | int(b)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(data[expLen:]),
+		E: exponent,
+	}, nil
+}
+
+// RFC 4034 3.1.8.1, rrsig rdata without signature followed by rrs in
+// canonical form and order, ttl of rrs is the original ttl
+func signedData(owner *g53.Name, rrset *g53.RRset, sig *rdata.RRSIG) []byte {
+	buf := util.NewOutputBuffer(512)
+	sig.HeaderToWire(buf)
+
+	rdatas := make([][]byte, 0, len(rrset.Rdatas))
+	for _, rd := range rrset.Rdatas {
+		rdatas = append(rdatas, CanonicalRdata(rd))
+	}
+	sort.Slice(rdatas, func(i, j int) bool { return bytes.Compare(rdatas[i], rdatas[j]) < 0 })
+
+	name := CanonicalName(owner)
+	for i, rd := range rdatas {
+		if i > 0 && bytes.Equal(rdatas[i-1], rd) {
+			continue
+		}
+		name.ToWire(buf)
+		buf.WriteUint16(uint16(rrset.Type))
+		buf.WriteUint16(uint16(rrset.Class))
+		buf.WriteUint32(sig.OriginalTtl)
+		buf.WriteUint16(uint16(len(rd)))
+		buf.WriteData(rd)
+	}
+	return buf.Data()
+}
+
+// RFC 4034 6.2 and RFC 6840 5.1, names in rdata of these types are
+// lowercased
+func CanonicalRdata(rd g53.Rdata) []byte {
+	switch r := rd.(type) {
+	case *g53.NS:
+		rd = &g53.NS{Name: CanonicalName(r.Name)}
+	case *g53.CName:
+		rd = &g53.CName{Name: CanonicalName(r.Name)}
+	case *g53.DName:
+		rd = &g53.DName{Target: CanonicalName(r.Target)}
+	case *g53.PTR:
+		rd = &g53.PTR{Name: CanonicalName(r.Name)}
+	case *g53.MX:
+		rd = &g53.MX{Preference: r.Preference, Exchange: CanonicalName(r.Exchange)}
+	case *g53.SRV:
+		rd = &g53.SRV{Priority: r.Priority, Weight: r.Weight, Port: r.Port, Target: CanonicalName(r.Target)}
+	case *g53.RP:
+		rd = &g53.RP{Mbox: CanonicalName(r.Mbox), Txt: CanonicalName(r.Txt)}
+	case *g53.NAPTR:
+		naptr := *r
+		naptr.Replacement = CanonicalName(r.Replacement)
+		rd = &naptr
+	case *g53.SOA:
+		soa := *r
+		soa.MName = CanonicalName(r.MName)
+		soa.RName = CanonicalName(r.RName)
+		rd = &soa
+	case *rdata.RRSIG:
+		sig := *r
+		sig.Signer = CanonicalName(r.Signer)
+		rd = &sig
+	}
+
+	buf := util.NewOutputBuffer(64)
+	rd.ToWire(buf)
+	return buf.Data()
+}
+
+// CanonicalName returns the lowercased name without modifying the
+// original one
+func CanonicalName(name *g53.Name) *g53.Name {
+	buf := util.NewOutputBuffer(name.Length())
+	name.ToWire(buf)
+	lower, _ := g53.NameFromWire(util.NewInputBuffer(buf.Data()), true)
+	return lower
+}
+
+// RFC 5155 5, iterated hash of name in canonical form
+func HashName(name *g53.Name, iterations uint16, salt []byte) []byte {
+	buf := util.NewOutputBuffer(name.Length())
+	CanonicalName(name).ToWire(buf)
+	data := buf.Data()
+
+	h := sha1.New()
+	for i := 0; i <= int(iterations); i++ {
+		h.Reset()
+		h.Write(data)
+		h.Write(salt)
+		data = h.Sum(nil)
+	}
+	return data
+}
@@ -0,0 +1,152 @@
+package dnssec
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+func testRRset(s ...string) *g53.RRset {
+	var rrset *g53.RRset
+	for _, rr := range s {
+		rrs, err := rdata.RRsetFromString(rr)
+		if err != nil {
+			panic("invalid rr " + rr + ":" + err.Error())
+		}
+		if rrset == nil {
+			rrset = rrs
+		} else {
+			rrset.AddRdata(rrs.Rdatas[0])
+		}
+	}
+	return rrset
+}
+
+func TestSignAndVerify(t *testing.T) {
+	owner := g53.NameFromStringUnsafe("example.com.")
+	now := time.Now()
+	for _, algorithm := range []uint8{AlgorithmECDSAP256SHA256, AlgorithmED25519} {
+		key, err := GenerateKey(owner, algorithm, false)
+		ut.Assert(t, err == nil, "generate key failed: %v", err)
+
+		rrset := testRRset("www.example.com. 300 IN A 1.1.1.1", "www.example.com. 300 IN A 2.2.2.2")
+		sig, err := Sign(rrset, key, now, now.Add(time.Hour))
+		ut.Assert(t, err == nil, "sign failed: %v", err)
+		ut.Equal(t, sig.Labels, uint8(3))
+		ut.Equal(t, Verify(rrset, sig, owner, key.DNSKEY), nil)
+
+		//rdata order and name case don't matter
+		reordered := testRRset("WWW.Example.com. 300 IN A 2.2.2.2", "www.example.com. 300 IN A 1.1.1.1")
+		ut.Equal(t, Verify(reordered, sig, owner, key.DNSKEY), nil)
+
+		changed := testRRset("www.example.com. 300 IN A 1.1.1.1", "www.example.com. 300 IN A 3.3.3.3")
+		ut.Equal(t, Verify(changed, sig, owner, key.DNSKEY), ErrInvalidSignature)
+		ut.Equal(t, Verify(rrset, sig, g53.NameFromStringUnsafe("example.org."), key.DNSKEY), ErrSignerMismatch)
+
+		wildcard := testRRset("*.example.com. 300 IN TXT \"wildcard\"")
+		sig, err = Sign(wildcard, key, now, now.Add(time.Hour))
+		ut.Assert(t, err == nil, "sign failed: %v", err)
+		ut.Equal(t, sig.Labels, uint8(2))
+		expanded := testRRset("a.b.example.com. 300 IN TXT \"wildcard\"")
+		ut.Equal(t, Verify(expanded, sig, owner, key.DNSKEY), nil)
+	}
+}
+
+func TestVerifyRSA(t *testing.T) {
+	owner := g53.NameFromStringUnsafe("example.com.")
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	ut.Assert(t, err == nil, "generate rsa key failed: %v", err)
+	//exponent 65537 in 3 bytes
+	publicKey := append([]byte{3, 1, 0, 1}, privateKey.N.Bytes()...)
+	key := &rdata.DNSKEY{
+		Flags:     FlagZone,
+		Protocol:  3,
+		Algorithm: AlgorithmRSASHA256,
+		PublicKey: publicKey,
+	}
+
+	rrset := testRRset("www.example.com. 300 IN A 1.1.1.1")
+	now := time.Now()
+	sig := &rdata.RRSIG{
+		Covered:     g53.RR_A,
+		Algorithm:   AlgorithmRSASHA256,
+		Labels:      3,
+		OriginalTtl: 300,
+		Expiration:  uint32(now.Add(time.Hour).Unix()),
+		Inception:   uint32(now.Unix()),
+		Tag:         KeyTag(key),
+		Signer:      owner,
+	}
+	digest := sha256.Sum256(signedData(rrset.Name, rrset, sig))
+	sig.Signature, err = rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	ut.Assert(t, err == nil, "sign with rsa failed: %v", err)
+	ut.Equal(t, Verify(rrset, sig, owner, key), nil)
+
+	changed := testRRset("www.example.com. 300 IN A 2.2.2.2")
+	ut.Equal(t, Verify(changed, sig, owner, key), ErrInvalidSignature)
+}
+
+func TestLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnssec")
+	ut.Assert(t, err == nil, "create temp dir failed: %v", err)
+	defer os.RemoveAll(dir)
+
+	owner := g53.NameFromStringUnsafe("example.com.")
+	for _, algorithm := range []uint8{AlgorithmECDSAP256SHA256, AlgorithmED25519} {
+		key, err := GenerateKey(owner, algorithm, true)
+		ut.Assert(t, err == nil, "generate key failed: %v", err)
+		ut.Equal(t, key.IsKSK(), true)
+
+		path := filepath.Join(dir, "Kexample.com.+"+algorithmName(algorithm))
+		publicKey := "; key signing key\nexample.com. 3600 IN DNSKEY " + key.DNSKEY.String() + "\n"
+		ioutil.WriteFile(path+".key", []byte(publicKey), 0644)
+		ioutil.WriteFile(path+".private", []byte(key.PrivateKeyString()), 0600)
+
+		loaded, err := LoadKey(path + ".private")
+		ut.Assert(t, err == nil, "load key failed: %v", err)
+		ut.Equal(t, loaded.Tag, key.Tag)
+		ut.Assert(t, loaded.Owner.Equals(owner), "key owner should be loaded")
+
+		rrset := testRRset("example.com. 300 IN NS ns.example.com.")
+		sig, err := Sign(rrset, loaded, time.Now(), time.Now().Add(time.Hour))
+		ut.Assert(t, err == nil, "sign failed: %v", err)
+		ut.Equal(t, Verify(rrset, sig, owner, key.DNSKEY), nil)
+
+		other, _ := GenerateKey(owner, algorithm, true)
+		ioutil.WriteFile(path+".private", []byte(other.PrivateKeyString()), 0600)
+		_, err = LoadKey(path)
+		ut.Equal(t, err, ErrKeyMismatch)
+	}
+}
+
+func TestKeyTagAndDS(t *testing.T) {
+	//example from RFC 4034 5.4
+	key, err := rdata.FromString(g53.RR_DNSKEY, "256 3 5 AQOeiiR0GOMYkDshWoSKz9XzfwJr1AYtsmx3TGkJaNXVbfi/2pHm822aJ5iI9BMzNXxeYCmZDRD99WYwYqUSdjMmmAphXdvxegXd/M5+X7OrzKBaMbCVdFLUUh6DhweJBjEVv5f2wwjM9XzcnOf+EPbtG9DMBmADjFDc2w/rljwvFw==")
+	ut.Assert(t, err == nil, "parse dnskey failed: %v", err)
+	dnskey := key.(*rdata.DNSKEY)
+	ut.Equal(t, KeyTag(dnskey), uint16(60485))
+
+	ds := DS(g53.NameFromStringUnsafe("dskey.example.com."), dnskey)
+	ut.Equal(t, ds.KeyTag, uint16(60485))
+	ut.Equal(t, ds.DigestType, DigestSHA256)
+	ut.Equal(t, len(ds.Digest), 64)
+}
+
+func TestHashName(t *testing.T) {
+	//example from RFC 5155 appendix A
+	salt := []byte{0xaa, 0xbb, 0xcc, 0xdd}
+	hash := HashName(g53.NameFromStringUnsafe("example."), 12, salt)
+	ut.Equal(t, rdata.Base32Hex.EncodeToString(hash), "0P9MHAVEQVM6T7VBL5LOP2U3T2RP3TOM")
+	hash = HashName(g53.NameFromStringUnsafe("A.Example."), 12, salt)
+	ut.Equal(t, rdata.Base32Hex.EncodeToString(hash), "35MTHGPGCU1QG68FAB165KLNSNK3DPVL")
+}
@@ -18,8 +18,9 @@ var (
 )
 
 type forwarder struct {
-	sender *util.SafeUDPSender
-	server string
+	sender     *util.SafeUDPSender
+	server     string
+	capability util.ServerCapability
 }
 
 type FailForwarder struct {
@@ -53,7 +54,7 @@ func (ff *FailForwarder) ReloadConfig(conf *config.VanguardConf) {
 func (ff *FailForwarder) HandleQuery(ctx *core.Context) {
 	client := &ctx.Client
 	if f := ff.GetForwarder(client.View); f != nil {
-		response, _, err := f.sender.Query(f.server, client.Request)
+		response, _, err := f.sender.QueryServer(f.server, client.Request, &f.capability)
 		if err == nil {
 			client.Response = response
 		} else {
@@ -36,13 +36,18 @@ func NewMetrics(conf *config.VanguardConf) *Metrics {
 	gMetrics.reg.MustRegister(UpdateCount)
 	gMetrics.reg.MustRegister(QPS)
 	gMetrics.reg.MustRegister(CacheSize)
+	gMetrics.reg.MustRegister(CacheBytes)
+	gMetrics.reg.MustRegister(CacheEvictions)
 	gMetrics.reg.MustRegister(CacheHits)
 
 	gMetrics.reg.MustRegister(RequestCountByView)
+	gMetrics.reg.MustRegister(RequestCountByTransport)
 	gMetrics.reg.MustRegister(ResponseCountByView)
 	gMetrics.reg.MustRegister(UpdateCountByView)
 	gMetrics.reg.MustRegister(QPSByView)
 	gMetrics.reg.MustRegister(CacheSizeByView)
+	gMetrics.reg.MustRegister(CacheBytesByView)
+	gMetrics.reg.MustRegister(CacheEvictionsByView)
 	gMetrics.reg.MustRegister(CacheHitsByView)
 
 	gMetrics.ReloadConfig(conf)
@@ -102,6 +107,7 @@ func RecordMetrics(client core.Client) {
 		recordQps(client.View)
 		RequestCount.WithLabelValues("server").Inc()
 		RequestCountByView.WithLabelValues("server", client.View).Inc()
+		RequestCountByTransport.WithLabelValues("server", client.Transport.String()).Inc()
 		if client.Response != nil {
 			ResponseCount.WithLabelValues("server").Inc()
 			ResponseCountByView.WithLabelValues("server", client.View).Inc()
@@ -131,3 +137,13 @@ func RecordCacheSize(view string, size int, totalSize int) {
 	CacheSize.WithLabelValues("cache").Set(float64(totalSize))
 	CacheSizeByView.WithLabelValues("cache", view).Set(float64(size))
 }
+
+func RecordCacheBytes(view string, bytes int, totalBytes int) {
+	CacheBytes.WithLabelValues("cache").Set(float64(totalBytes))
+	CacheBytesByView.WithLabelValues("cache", view).Set(float64(bytes))
+}
+
+func RecordCacheEviction(view string) {
+	CacheEvictions.WithLabelValues("cache").Inc()
+	CacheEvictionsByView.WithLabelValues("cache", view).Inc()
+}
@@ -25,6 +25,13 @@ var (
 		Help:      "Counter of DNS requests made per view.",
 	}, []string{"module", "view"})
 
+	RequestCountByTransport = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      "request_count_by_transport",
+		Help:      "Counter of DNS requests made per transport protocol.",
+	}, []string{"module", "transport"})
+
 	ResponseCount = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: Namespace,
 		Subsystem: Subsystem,
@@ -81,6 +88,34 @@ var (
 		Help:      "The number of elements in the cache made per view.",
 	}, []string{"module", "view"})
 
+	CacheBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      "cache_bytes",
+		Help:      "The estimated bytes of messages in the cache made all views.",
+	}, []string{"module"})
+
+	CacheBytesByView = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      "cache_bytes_by_view",
+		Help:      "The estimated bytes of messages in the cache made per view.",
+	}, []string{"module", "view"})
+
+	CacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      "cache_evictions_total",
+		Help:      "The count of messages evicted from the cache all views.",
+	}, []string{"module"})
+
+	CacheEvictionsByView = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      "cache_evictions_by_view",
+		Help:      "The count of messages evicted from the cache per view.",
+	}, []string{"module", "view"})
+
 	CacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: Namespace,
 		Subsystem: Subsystem,
@@ -181,9 +181,14 @@ func (l *QueryLogger) LogWrite(client core.Client) {
 			msgBuffer.WriteString(" NE")
 		}
 
-		if client.UsingTCP {
+		switch client.Transport {
+		case core.TransportTCP:
 			msgBuffer.WriteString(" T")
-		} else {
+		case core.TransportTLS:
+			msgBuffer.WriteString(" TLS")
+		case core.TransportHTTPS:
+			msgBuffer.WriteString(" HTTPS")
+		default:
 			msgBuffer.WriteString(" NT")
 		}
 
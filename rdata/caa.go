@@ -0,0 +1,97 @@
+package rdata
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+var ErrInvalidCAATag = errors.New("caa tag should be 1 to 15 letters or digits")
+
+// RFC 8659
+type CAA struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+func (caa *CAA) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(caa))
+}
+
+func (caa *CAA) ToWire(buf *util.OutputBuffer) {
+	buf.WriteUint8(caa.Flags)
+	buf.WriteUint8(uint8(len(caa.Tag)))
+	buf.WriteData([]byte(caa.Tag))
+	buf.WriteData([]byte(caa.Value))
+}
+
+func (caa *CAA) Compare(other g53.Rdata) int {
+	return compareWire(caa, other)
+}
+
+func (caa *CAA) String() string {
+	return fmt.Sprintf("%d %s %s", caa.Flags, caa.Tag, quote(caa.Value))
+}
+
+var caaTagTemplate = regexp.MustCompile(`^[a-zA-Z0-9]{1,15}$`)
+
+func caaFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen < 2 {
+		return nil, g53.ErrDataIsTooShort
+	}
+	data, err := readBytes(buf, rdlen)
+	if err != nil {
+		return nil, err
+	}
+
+	tagLen := int(data[1])
+	if 2+tagLen > len(data) {
+		return nil, g53.ErrDataIsTooShort
+	}
+	tag := string(data[2 : 2+tagLen])
+	if caaTagTemplate.MatchString(tag) == false {
+		return nil, ErrInvalidCAATag
+	}
+	return &CAA{
+		Flags: data[0],
+		Tag:   tag,
+		Value: string(data[2+tagLen:]),
+	}, nil
+}
+
+var caaRdataTemplate = regexp.MustCompile(`^\s*(\S+)\s+(\S+)\s+(.*?)\s*$`)
+
+func caaFromString(s string) (g53.Rdata, error) {
+	fields := caaRdataTemplate.FindStringSubmatch(s)
+	if len(fields) != 4 {
+		return nil, ErrShortOfFields
+	}
+
+	flags, err := parseUint(fields[1], 8)
+	if err != nil {
+		return nil, err
+	}
+
+	if caaTagTemplate.MatchString(fields[2]) == false {
+		return nil, ErrInvalidCAATag
+	}
+
+	if strings.HasPrefix(fields[3], "\"") == false && len(strings.Fields(fields[3])) > 1 {
+		return nil, ErrTooManyFields
+	}
+	value, err := unquote(fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return &CAA{
+		Flags: uint8(flags),
+		Tag:   strings.ToLower(fields[2]),
+		Value: value,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package rdata
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+// RFC 4398
+type CERT struct {
+	Type        uint16
+	KeyTag      uint16
+	Algorithm   uint8
+	Certificate []byte
+}
+
+var certTypeNames = map[uint16]string{
+	1:   "PKIX",
+	2:   "SPKI",
+	3:   "PGP",
+	4:   "IPKIX",
+	5:   "ISPKI",
+	6:   "IPGP",
+	7:   "ACPKIX",
+	8:   "IACPKIX",
+	253: "URI",
+	254: "OID",
+}
+
+// dnssec algorithm mnemonics, RFC 4034 appendix A.1 and later
+var algorithmNames = map[uint8]string{
+	1:  "RSAMD5",
+	2:  "DH",
+	3:  "DSA",
+	5:  "RSASHA1",
+	6:  "DSA-NSEC3-SHA1",
+	7:  "RSASHA1-NSEC3-SHA1",
+	8:  "RSASHA256",
+	10: "RSASHA512",
+	12: "ECC-GOST",
+	13: "ECDSAP256SHA256",
+	14: "ECDSAP384SHA384",
+	15: "ED25519",
+	16: "ED448",
+}
+
+func (cert *CERT) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(cert))
+}
+
+func (cert *CERT) ToWire(buf *util.OutputBuffer) {
+	buf.WriteUint16(cert.Type)
+	buf.WriteUint16(cert.KeyTag)
+	buf.WriteUint8(cert.Algorithm)
+	buf.WriteData(cert.Certificate)
+}
+
+func (cert *CERT) Compare(other g53.Rdata) int {
+	return compareWire(cert, other)
+}
+
+func (cert *CERT) String() string {
+	typ, ok := certTypeNames[cert.Type]
+	if ok == false {
+		typ = fmt.Sprintf("%d", cert.Type)
+	}
+	return fmt.Sprintf("%s %d %d %s", typ, cert.KeyTag, cert.Algorithm, base64.StdEncoding.EncodeToString(cert.Certificate))
+}
+
+func certFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen < 5 {
+		return nil, g53.ErrDataIsTooShort
+	}
+	data, err := readBytes(buf, rdlen)
+	if err != nil {
+		return nil, err
+	}
+	return &CERT{
+		Type:        uint16(data[0])<<8 | uint16(data[1]),
+		KeyTag:      uint16(data[2])<<8 | uint16(data[3]),
+		Algorithm:   data[4],
+		Certificate: data[5:],
+	}, nil
+}
+
+func certFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 4 {
+		return nil, ErrShortOfFields
+	}
+
+	typ, err := mnemonicOrNumber(fields[0], 16, func(s string) (uint64, bool) {
+		for t, name := range certTypeNames {
+			if strings.EqualFold(name, s) {
+				return uint64(t), true
+			}
+		}
+		return 0, false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keyTag, err := parseUint(fields[1], 16)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, err := mnemonicOrNumber(fields[2], 8, algorithmFromString)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := base64.StdEncoding.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CERT{
+		Type:        uint16(typ),
+		KeyTag:      uint16(keyTag),
+		Algorithm:   uint8(algorithm),
+		Certificate: certificate,
+	}, nil
+}
+
+func algorithmFromString(s string) (uint64, bool) {
+	for alg, name := range algorithmNames {
+		if strings.EqualFold(name, s) {
+			return uint64(alg), true
+		}
+	}
+	return 0, false
+}
+
+func mnemonicOrNumber(s string, bitSize int, lookup func(string) (uint64, bool)) (uint64, error) {
+	if v, ok := lookup(s); ok {
+		return v, nil
+	}
+	return parseUint(s, bitSize)
+}
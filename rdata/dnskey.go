@@ -0,0 +1,85 @@
+package rdata
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+// RFC 4034
+type DNSKEY struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+func (key *DNSKEY) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(key))
+}
+
+func (key *DNSKEY) ToWire(buf *util.OutputBuffer) {
+	buf.WriteUint16(key.Flags)
+	buf.WriteUint8(key.Protocol)
+	buf.WriteUint8(key.Algorithm)
+	buf.WriteData(key.PublicKey)
+}
+
+func (key *DNSKEY) Compare(other g53.Rdata) int {
+	return compareWire(key, other)
+}
+
+func (key *DNSKEY) String() string {
+	return fmt.Sprintf("%d %d %d %s", key.Flags, key.Protocol, key.Algorithm, base64.StdEncoding.EncodeToString(key.PublicKey))
+}
+
+func dnskeyFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen < 4 {
+		return nil, g53.ErrDataIsTooShort
+	}
+	data, err := readBytes(buf, rdlen)
+	if err != nil {
+		return nil, err
+	}
+	return &DNSKEY{
+		Flags:     uint16(data[0])<<8 | uint16(data[1]),
+		Protocol:  data[2],
+		Algorithm: data[3],
+		PublicKey: data[4:],
+	}, nil
+}
+
+func dnskeyFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 4 {
+		return nil, ErrShortOfFields
+	}
+
+	flags, err := parseUint(fields[0], 16)
+	if err != nil {
+		return nil, err
+	}
+	protocol, err := parseUint(fields[1], 8)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := parseUint(fields[2], 8)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DNSKEY{
+		Flags:     uint16(flags),
+		Protocol:  uint8(protocol),
+		Algorithm: uint8(algorithm),
+		PublicKey: key,
+	}, nil
+}
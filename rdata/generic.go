@@ -0,0 +1,59 @@
+package rdata
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+// rdata of unknown type in RFC 3597 format: \# length hex
+type Generic struct {
+	Data []byte
+}
+
+func (g *Generic) Rend(r *g53.MsgRender) {
+	r.WriteData(g.Data)
+}
+
+func (g *Generic) ToWire(buf *util.OutputBuffer) {
+	buf.WriteData(g.Data)
+}
+
+func (g *Generic) Compare(other g53.Rdata) int {
+	return compareWire(g, other)
+}
+
+func (g *Generic) String() string {
+	if len(g.Data) == 0 {
+		return GenericMark + " 0"
+	}
+	return fmt.Sprintf("%s %d %s", GenericMark, len(g.Data), hexString(g.Data))
+}
+
+func genericFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	data, err := readBytes(buf, rdlen)
+	if err != nil {
+		return nil, err
+	}
+	return &Generic{Data: data}, nil
+}
+
+// fields after \#, hex data could be split into several fields
+func genericFromString(fields []string) ([]byte, error) {
+	if len(fields) == 0 {
+		return nil, ErrInvalidGeneric
+	}
+
+	length, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, ErrInvalidGeneric
+	}
+
+	data, err := hexFromString(fields[1:])
+	if err != nil || len(data) != int(length) {
+		return nil, ErrInvalidGeneric
+	}
+	return data, nil
+}
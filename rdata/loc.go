@@ -0,0 +1,238 @@
+package rdata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+var (
+	ErrInvalidLOC        = errors.New("invalid loc coordinate")
+	ErrUnknownLOCVersion = errors.New("loc version isn't 0")
+)
+
+const (
+	locRdataLen = 16
+	//coordinate is 2^31 plus the offset from equator or prime meridian
+	//in thousandths of a second of arc
+	locEquator = 1 << 31
+	//altitude is in centimeters from 100000m below the reference spheroid
+	locAltitudeBase = 10000000
+	locMaxAltitude  = 42849672.95
+
+	locDefaultSize     = 100
+	locDefaultHorizPre = 1000000
+	locDefaultVertPre  = 1000
+	locMaxPrecision    = 90000000
+)
+
+// RFC 1876, size and precisions are in centimeters as mantissa and
+// exponent of power of 10
+type LOC struct {
+	Version   uint8
+	Size      uint8
+	HorizPre  uint8
+	VertPre   uint8
+	Latitude  uint32
+	Longitude uint32
+	Altitude  uint32
+}
+
+func (loc *LOC) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(loc))
+}
+
+func (loc *LOC) ToWire(buf *util.OutputBuffer) {
+	buf.WriteUint8(loc.Version)
+	buf.WriteUint8(loc.Size)
+	buf.WriteUint8(loc.HorizPre)
+	buf.WriteUint8(loc.VertPre)
+	buf.WriteUint32(loc.Latitude)
+	buf.WriteUint32(loc.Longitude)
+	buf.WriteUint32(loc.Altitude)
+}
+
+func (loc *LOC) Compare(other g53.Rdata) int {
+	return compareWire(loc, other)
+}
+
+func (loc *LOC) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(coordinateString(loc.Latitude, "N", "S"))
+	buf.WriteString(" ")
+	buf.WriteString(coordinateString(loc.Longitude, "E", "W"))
+	fmt.Fprintf(&buf, " %.2fm", float64(int64(loc.Altitude)-locAltitudeBase)/100)
+	for _, precision := range []uint8{loc.Size, loc.HorizPre, loc.VertPre} {
+		fmt.Fprintf(&buf, " %.2fm", float64(decodePrecision(precision))/100)
+	}
+	return buf.String()
+}
+
+func coordinateString(v uint32, positive, negative string) string {
+	offset := int64(v) - locEquator
+	hemisphere := positive
+	if offset < 0 {
+		hemisphere = negative
+		offset = -offset
+	}
+	return fmt.Sprintf("%d %d %.3f %s", offset/3600000, offset%3600000/60000, float64(offset%60000)/1000, hemisphere)
+}
+
+func decodePrecision(p uint8) uint64 {
+	v := uint64(p >> 4)
+	for i := uint8(0); i < p&0x0f; i++ {
+		v *= 10
+	}
+	return v
+}
+
+func encodePrecision(cm uint64) uint8 {
+	exponent := uint8(0)
+	for cm > 9 {
+		cm /= 10
+		exponent += 1
+	}
+	return uint8(cm)<<4 | exponent
+}
+
+func locFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen != locRdataLen {
+		return nil, g53.ErrDataIsTooShort
+	}
+	data, err := readBytes(buf, rdlen)
+	if err != nil {
+		return nil, err
+	}
+
+	if data[0] != 0 {
+		return nil, ErrUnknownLOCVersion
+	}
+	for _, p := range data[1:4] {
+		if p>>4 > 9 || p&0x0f > 9 {
+			return nil, ErrInvalidLOC
+		}
+	}
+
+	in := util.NewInputBuffer(data[4:])
+	lat, _ := in.ReadUint32()
+	lon, _ := in.ReadUint32()
+	alt, _ := in.ReadUint32()
+	return &LOC{
+		Version:   data[0],
+		Size:      data[1],
+		HorizPre:  data[2],
+		VertPre:   data[3],
+		Latitude:  lat,
+		Longitude: lon,
+		Altitude:  alt,
+	}, nil
+}
+
+// d1 [m1 [s1]] {N|S} d2 [m2 [s2]] {E|W} alt[m] [siz[m] [hp[m] [vp[m]]]]
+func locFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	lat, fields, err := parseCoordinate(fields, "N", "S", 90)
+	if err != nil {
+		return nil, err
+	}
+	lon, fields, err := parseCoordinate(fields, "E", "W", 180)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrShortOfFields
+	} else if len(fields) > 4 {
+		return nil, ErrTooManyFields
+	}
+
+	alt, err := parseMeters(fields[0])
+	if err != nil || alt < -100000 || alt > locMaxAltitude {
+		return nil, ErrInvalidLOC
+	}
+
+	precisions := []uint64{locDefaultSize, locDefaultHorizPre, locDefaultVertPre}
+	for i, f := range fields[1:] {
+		v, err := parseMeters(f)
+		if err != nil || v < 0 || v*100 > locMaxPrecision {
+			return nil, ErrInvalidLOC
+		}
+		precisions[i] = uint64(math.Round(v * 100))
+	}
+
+	return &LOC{
+		Size:      encodePrecision(precisions[0]),
+		HorizPre:  encodePrecision(precisions[1]),
+		VertPre:   encodePrecision(precisions[2]),
+		Latitude:  lat,
+		Longitude: lon,
+		Altitude:  uint32(math.Round(alt*100) + locAltitudeBase),
+	}, nil
+}
+
+// degrees with optional minutes and seconds end with hemisphere
+func parseCoordinate(fields []string, positive, negative string, maxDegrees int64) (uint32, []string, error) {
+	var values []string
+	for len(fields) > 0 && len(values) <= 3 {
+		f := fields[0]
+		fields = fields[1:]
+		if strings.EqualFold(f, positive) || strings.EqualFold(f, negative) {
+			if len(values) == 0 {
+				return 0, nil, ErrInvalidLOC
+			}
+			offset, err := coordinateOffset(values, maxDegrees)
+			if err != nil {
+				return 0, nil, err
+			}
+			if strings.EqualFold(f, negative) {
+				offset = -offset
+			}
+			return uint32(locEquator + offset), fields, nil
+		}
+		values = append(values, f)
+	}
+	return 0, nil, ErrInvalidLOC
+}
+
+func coordinateOffset(values []string, maxDegrees int64) (int64, error) {
+	if len(values) > 3 {
+		return 0, ErrInvalidLOC
+	}
+
+	degrees, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || degrees < 0 || degrees > maxDegrees {
+		return 0, ErrInvalidLOC
+	}
+	offset := degrees * 3600000
+
+	if len(values) > 1 {
+		minutes, err := strconv.ParseInt(values[1], 10, 64)
+		if err != nil || minutes < 0 || minutes > 59 {
+			return 0, ErrInvalidLOC
+		}
+		offset += minutes * 60000
+	}
+
+	if len(values) > 2 {
+		seconds, err := strconv.ParseFloat(values[2], 64)
+		if err != nil || seconds < 0 || seconds >= 60 {
+			return 0, ErrInvalidLOC
+		}
+		offset += int64(math.Round(seconds * 1000))
+	}
+
+	if offset > maxDegrees*3600000 {
+		return 0, ErrInvalidLOC
+	}
+	return offset, nil
+}
+
+func parseMeters(s string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "m"), 64)
+}
@@ -0,0 +1,112 @@
+package rdata
+
+import (
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+// same as g53.MessageFromWire, rrs with types supported here are parsed
+// too, which could be in transfer and dynamic update
+func MessageFromWire(buf *util.InputBuffer) (*g53.Message, error) {
+	m := &g53.Message{}
+	if err := g53.HeaderFromWire(&m.Header, buf); err != nil {
+		return nil, err
+	}
+
+	if m.Header.QDCount == 1 {
+		q, err := g53.QuestionFromWire(buf)
+		if err != nil {
+			return nil, err
+		}
+		m.Question = q
+	}
+
+	for i := 0; i < g53.SectionCount; i++ {
+		if err := sectionFromWire(m, g53.SectionType(i), buf); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func sectionFromWire(m *g53.Message, st g53.SectionType, buf *util.InputBuffer) error {
+	var count uint16
+	switch st {
+	case g53.AnswerSection:
+		count = m.Header.ANCount
+	case g53.AuthSection:
+		count = m.Header.NSCount
+	case g53.AdditionalSection:
+		count = m.Header.ARCount
+	}
+
+	var s g53.Section
+	var lastRRset *g53.RRset
+	for i := uint16(0); i < count; i++ {
+		rrset, err := rrsetFromWire(buf)
+		if err != nil {
+			return err
+		}
+
+		if lastRRset == nil {
+			lastRRset = rrset
+		} else if lastRRset.IsSameRRset(rrset) {
+			lastRRset.Rdatas = append(lastRRset.Rdatas, rrset.Rdatas...)
+		} else {
+			s = append(s, lastRRset)
+			lastRRset = rrset
+		}
+	}
+
+	if lastRRset != nil {
+		if st == g53.AdditionalSection && lastRRset.Type == g53.RR_OPT {
+			m.Edns = g53.EdnsFromRRset(lastRRset)
+		} else if st == g53.AdditionalSection && lastRRset.Type == g53.RR_TSIG {
+			m.Tsig = g53.TSIGFromRRset(lastRRset)
+		} else {
+			s = append(s, lastRRset)
+		}
+	}
+
+	m.Sections[st] = s
+	return nil
+}
+
+func rrsetFromWire(buf *util.InputBuffer) (*g53.RRset, error) {
+	name, err := g53.NameFromWire(buf, false)
+	if err != nil {
+		return nil, err
+	}
+
+	typ, err := g53.TypeFromWire(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	cls, err := g53.ClassFromWire(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := g53.TTLFromWire(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	rdata, err := FromWire(typ, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var rdatas []g53.Rdata
+	if rdata != nil {
+		rdatas = []g53.Rdata{rdata}
+	}
+	return &g53.RRset{
+		Name:   name,
+		Type:   typ,
+		Class:  cls,
+		Ttl:    ttl,
+		Rdatas: rdatas,
+	}, nil
+}
@@ -0,0 +1,167 @@
+package rdata
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+var ErrInvalidTypeBitmap = errors.New("invalid type bitmap")
+
+// RFC 4034, next name is never compressed
+type NSEC struct {
+	NextName *g53.Name
+	Types    []g53.RRType
+}
+
+func (nsec *NSEC) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(nsec))
+}
+
+func (nsec *NSEC) ToWire(buf *util.OutputBuffer) {
+	nsec.NextName.ToWire(buf)
+	typeBitmapToWire(buf, nsec.Types)
+}
+
+func (nsec *NSEC) Compare(other g53.Rdata) int {
+	return compareWire(nsec, other)
+}
+
+func (nsec *NSEC) String() string {
+	return nsec.NextName.String(false) + typesString(nsec.Types)
+}
+
+func nsecFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	end := buf.Position() + uint(rdlen)
+	next, err := g53.NameFromWire(buf, false)
+	if err != nil {
+		return nil, err
+	}
+	if buf.Position() > end {
+		return nil, g53.ErrDataIsTooShort
+	}
+	types, err := typeBitmapFromWire(buf, uint16(end-buf.Position()))
+	if err != nil {
+		return nil, err
+	}
+	return &NSEC{
+		NextName: next,
+		Types:    types,
+	}, nil
+}
+
+func nsecFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, ErrShortOfFields
+	}
+
+	next, err := g53.NameFromString(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	types, err := typesFromString(fields[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &NSEC{
+		NextName: next,
+		Types:    types,
+	}, nil
+}
+
+// types in nsec and nsec3 are sorted and unique
+func SortTypes(types []g53.RRType) []g53.RRType {
+	sorted := append([]g53.RRType{}, types...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	unique := sorted[:0]
+	for i, t := range sorted {
+		if i == 0 || sorted[i-1] != t {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+func typesString(types []g53.RRType) string {
+	var buf bytes.Buffer
+	for _, t := range types {
+		buf.WriteString(" ")
+		buf.WriteString(TypeString(t))
+	}
+	return buf.String()
+}
+
+func typesFromString(fields []string) ([]g53.RRType, error) {
+	var types []g53.RRType
+	for _, f := range fields {
+		t, err := TypeFromString(f)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return SortTypes(types), nil
+}
+
+// RFC 4034 4.1.2, types are grouped into windows of 256 types, each window
+// has a bitmap up to 32 bytes without trailing zero bytes
+func typeBitmapToWire(buf *util.OutputBuffer, types []g53.RRType) {
+	var bitmap [32]byte
+	window, length := -1, 0
+	flush := func() {
+		if window >= 0 {
+			buf.WriteUint8(uint8(window))
+			buf.WriteUint8(uint8(length))
+			buf.WriteData(bitmap[:length])
+		}
+	}
+
+	for _, t := range types {
+		if int(t>>8) != window {
+			flush()
+			window, length = int(t>>8), 0
+			bitmap = [32]byte{}
+		}
+		offset := int(t & 0xff)
+		bitmap[offset/8] |= 0x80 >> uint(offset%8)
+		if offset/8+1 > length {
+			length = offset/8 + 1
+		}
+	}
+	flush()
+}
+
+func typeBitmapFromWire(buf *util.InputBuffer, length uint16) ([]g53.RRType, error) {
+	data, err := readBytes(buf, length)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []g53.RRType
+	lastWindow := -1
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, ErrInvalidTypeBitmap
+		}
+		window, size := int(data[0]), int(data[1])
+		if window <= lastWindow || size == 0 || size > 32 || len(data) < 2+size {
+			return nil, ErrInvalidTypeBitmap
+		}
+		for i, b := range data[2 : 2+size] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>uint(bit)) != 0 {
+					types = append(types, g53.RRType(window<<8|i*8+bit))
+				}
+			}
+		}
+		lastWindow = window
+		data = data[2+size:]
+	}
+	return types, nil
+}
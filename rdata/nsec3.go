@@ -0,0 +1,234 @@
+package rdata
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+const (
+	NSEC3SHA1    uint8 = 1
+	NSEC3OptOut  uint8 = 1
+	noSaltString       = "-"
+)
+
+// next hashed owner name is shown in base32 with extended hex alphabet
+var Base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// RFC 5155
+type NSEC3 struct {
+	Algorithm  uint8
+	Flags      uint8
+	Iterations uint16
+	Salt       []byte
+	NextHash   []byte
+	Types      []g53.RRType
+}
+
+func (nsec3 *NSEC3) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(nsec3))
+}
+
+func (nsec3 *NSEC3) ToWire(buf *util.OutputBuffer) {
+	nsec3ParamToWire(buf, nsec3.Algorithm, nsec3.Flags, nsec3.Iterations, nsec3.Salt)
+	buf.WriteUint8(uint8(len(nsec3.NextHash)))
+	buf.WriteData(nsec3.NextHash)
+	typeBitmapToWire(buf, nsec3.Types)
+}
+
+func (nsec3 *NSEC3) Compare(other g53.Rdata) int {
+	return compareWire(nsec3, other)
+}
+
+func (nsec3 *NSEC3) String() string {
+	return fmt.Sprintf("%d %d %d %s %s%s", nsec3.Algorithm, nsec3.Flags, nsec3.Iterations, saltString(nsec3.Salt),
+		Base32Hex.EncodeToString(nsec3.NextHash), typesString(nsec3.Types))
+}
+
+// RFC 5155 4
+type NSEC3PARAM struct {
+	Algorithm  uint8
+	Flags      uint8
+	Iterations uint16
+	Salt       []byte
+}
+
+func (param *NSEC3PARAM) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(param))
+}
+
+func (param *NSEC3PARAM) ToWire(buf *util.OutputBuffer) {
+	nsec3ParamToWire(buf, param.Algorithm, param.Flags, param.Iterations, param.Salt)
+}
+
+func (param *NSEC3PARAM) Compare(other g53.Rdata) int {
+	return compareWire(param, other)
+}
+
+func (param *NSEC3PARAM) String() string {
+	return fmt.Sprintf("%d %d %d %s", param.Algorithm, param.Flags, param.Iterations, saltString(param.Salt))
+}
+
+func nsec3ParamToWire(buf *util.OutputBuffer, algorithm, flags uint8, iterations uint16, salt []byte) {
+	buf.WriteUint8(algorithm)
+	buf.WriteUint8(flags)
+	buf.WriteUint16(iterations)
+	buf.WriteUint8(uint8(len(salt)))
+	buf.WriteData(salt)
+}
+
+func saltString(salt []byte) string {
+	if len(salt) == 0 {
+		return noSaltString
+	}
+	return hexString(salt)
+}
+
+func saltFromString(s string) ([]byte, error) {
+	if s == noSaltString {
+		return nil, nil
+	}
+	salt, err := hex.DecodeString(s)
+	if err != nil || len(salt) > 255 {
+		return nil, fmt.Errorf("invalid salt %s", s)
+	}
+	return salt, nil
+}
+
+func nsec3ParamFromWire(buf *util.InputBuffer) (uint8, uint8, uint16, []byte, error) {
+	algorithm, err := buf.ReadUint8()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	flags, err := buf.ReadUint8()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	iterations, err := buf.ReadUint16()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	saltLen, err := buf.ReadUint8()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	salt, err := readBytes(buf, uint16(saltLen))
+	return algorithm, flags, iterations, salt, err
+}
+
+func nsec3ParamFromString(fields []string) (uint8, uint8, uint16, []byte, error) {
+	algorithm, err := parseUint(fields[0], 8)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	flags, err := parseUint(fields[1], 8)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	iterations, err := parseUint(fields[2], 16)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	salt, err := saltFromString(fields[3])
+	return uint8(algorithm), uint8(flags), uint16(iterations), salt, err
+}
+
+func nsec3FromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	end := buf.Position() + uint(rdlen)
+	algorithm, flags, iterations, salt, err := nsec3ParamFromWire(buf)
+	if err != nil {
+		return nil, err
+	}
+	hashLen, err := buf.ReadUint8()
+	if err != nil {
+		return nil, err
+	}
+	next, err := readBytes(buf, uint16(hashLen))
+	if err != nil {
+		return nil, err
+	}
+	if buf.Position() > end {
+		return nil, g53.ErrDataIsTooShort
+	}
+	types, err := typeBitmapFromWire(buf, uint16(end-buf.Position()))
+	if err != nil {
+		return nil, err
+	}
+	return &NSEC3{
+		Algorithm:  algorithm,
+		Flags:      flags,
+		Iterations: iterations,
+		Salt:       salt,
+		NextHash:   next,
+		Types:      types,
+	}, nil
+}
+
+func nsec3FromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 5 {
+		return nil, ErrShortOfFields
+	}
+
+	algorithm, flags, iterations, salt, err := nsec3ParamFromString(fields)
+	if err != nil {
+		return nil, err
+	}
+	next, err := Base32Hex.DecodeString(strings.ToUpper(fields[4]))
+	if err != nil || len(next) == 0 || len(next) > 255 {
+		return nil, fmt.Errorf("invalid next hashed owner name %s", fields[4])
+	}
+	types, err := typesFromString(fields[5:])
+	if err != nil {
+		return nil, err
+	}
+	return &NSEC3{
+		Algorithm:  algorithm,
+		Flags:      flags,
+		Iterations: iterations,
+		Salt:       salt,
+		NextHash:   next,
+		Types:      types,
+	}, nil
+}
+
+func nsec3paramFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	end := buf.Position() + uint(rdlen)
+	algorithm, flags, iterations, salt, err := nsec3ParamFromWire(buf)
+	if err != nil {
+		return nil, err
+	}
+	if buf.Position() != end {
+		return nil, ErrExtraData
+	}
+	return &NSEC3PARAM{
+		Algorithm:  algorithm,
+		Flags:      flags,
+		Iterations: iterations,
+		Salt:       salt,
+	}, nil
+}
+
+func nsec3paramFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 4 {
+		return nil, ErrShortOfFields
+	} else if len(fields) > 4 {
+		return nil, ErrTooManyFields
+	}
+
+	algorithm, flags, iterations, salt, err := nsec3ParamFromString(fields)
+	if err != nil {
+		return nil, err
+	}
+	return &NSEC3PARAM{
+		Algorithm:  algorithm,
+		Flags:      flags,
+		Iterations: iterations,
+		Salt:       salt,
+	}, nil
+}
@@ -0,0 +1,348 @@
+// Package rdata supplements g53 with rr types it doesn't parse, records of
+// these types are parsed into rdatas here and rendered by g53 as usual
+package rdata
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+var (
+	ErrUnknownType       = errors.New("unknown rr type")
+	ErrShortOfFields     = errors.New("short of rdata fields")
+	ErrTooManyFields     = errors.New("too many rdata fields")
+	ErrInvalidGeneric    = errors.New("invalid generic rdata")
+	ErrExtraData         = errors.New("extra data in rdata part")
+	ErrUnterminatedQuote = errors.New("quote isn't closed")
+	ErrInvalidEscape     = errors.New("invalid escape in string")
+)
+
+const (
+	RR_SVCB  g53.RRType = 64
+	RR_HTTPS g53.RRType = 65
+)
+
+// rdata in RFC 3597 generic format begins with the mark
+const GenericMark = `\#`
+
+var extraTypeNames = map[g53.RRType]string{
+	RR_SVCB:  "SVCB",
+	RR_HTTPS: "HTTPS",
+}
+
+// types which g53 parses from string, TSIG is only parsed from wire, RRSIG
+// and NSEC3 are parsed here since they are required by dnssec
+var g53Types = map[g53.RRType]bool{
+	g53.RR_A:     true,
+	g53.RR_AAAA:  true,
+	g53.RR_CNAME: true,
+	g53.RR_SOA:   true,
+	g53.RR_NS:    true,
+	g53.RR_OPT:   true,
+	g53.RR_PTR:   true,
+	g53.RR_SRV:   true,
+	g53.RR_NAPTR: true,
+	g53.RR_DNAME: true,
+	g53.RR_MX:    true,
+	g53.RR_TXT:   true,
+	g53.RR_RP:    true,
+	g53.RR_SPF:   true,
+	g53.RR_DS:    true,
+}
+
+type fromWireFunc func(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error)
+type fromStringFunc func(s string) (g53.Rdata, error)
+
+type parser struct {
+	fromWire   fromWireFunc
+	fromString fromStringFunc
+}
+
+var parsers = map[g53.RRType]parser{
+	g53.RR_CAA:        {caaFromWire, caaFromString},
+	g53.RR_SSHFP:      {sshfpFromWire, sshfpFromString},
+	g53.RR_TLSA:       {tlsaFromWire, tlsaFromString},
+	g53.RR_DNSKEY:     {dnskeyFromWire, dnskeyFromString},
+	g53.RR_CERT:       {certFromWire, certFromString},
+	g53.RR_URI:        {uriFromWire, uriFromString},
+	g53.RR_LOC:        {locFromWire, locFromString},
+	g53.RR_RRSIG:      {rrsigFromWire, rrsigFromString},
+	g53.RR_NSEC:       {nsecFromWire, nsecFromString},
+	g53.RR_NSEC3:      {nsec3FromWire, nsec3FromString},
+	g53.RR_NSEC3PARAM: {nsec3paramFromWire, nsec3paramFromString},
+	RR_SVCB:           {svcbFromWire, svcbFromString},
+	RR_HTTPS:          {svcbFromWire, svcbFromString},
+}
+
+var typeTemplate = regexp.MustCompile(`^(?i)TYPE([0-9]+)$`)
+
+// type mnemonic known by g53, SVCB, HTTPS or TYPEnnn of RFC 3597
+func TypeFromString(s string) (g53.RRType, error) {
+	if t, err := g53.TypeFromString(s); err == nil {
+		return t, nil
+	}
+
+	for t, name := range extraTypeNames {
+		if strings.EqualFold(name, s) {
+			return t, nil
+		}
+	}
+
+	if fields := typeTemplate.FindStringSubmatch(s); len(fields) == 2 {
+		if t, err := strconv.ParseUint(fields[1], 10, 16); err == nil {
+			return g53.RRType(t), nil
+		}
+	}
+	return 0, ErrUnknownType
+}
+
+// type without mnemonic is shown as TYPEnnn, which could be parsed back
+func TypeString(t g53.RRType) string {
+	if name, ok := extraTypeNames[t]; ok {
+		return name
+	}
+
+	s := t.String()
+	if strings.HasPrefix(s, "unknowntype") {
+		return fmt.Sprintf("TYPE%d", uint16(t))
+	}
+	return s
+}
+
+// meta types only appear in query and transfer, they couldn't be in zone
+func isMetaType(t g53.RRType) bool {
+	return t == 0 || t == g53.RR_OPT || (t >= 128 && t <= 255)
+}
+
+// type which has no parser in g53 and here is kept as generic rdata
+func IsUnknownType(t g53.RRType) bool {
+	_, ok := parsers[t]
+	return ok == false && g53Types[t] == false && t != g53.RR_TSIG && isMetaType(t) == false
+}
+
+// rdata in generic format is converted to the known format of its type
+func FromString(t g53.RRType, s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) > 0 && fields[0] == GenericMark {
+		data, err := genericFromString(fields[1:])
+		if err != nil {
+			return nil, err
+		}
+		if IsUnknownType(t) {
+			return &Generic{Data: data}, nil
+		} else if len(data) == 0 {
+			return nil, ErrInvalidGeneric
+		}
+
+		buf := util.NewOutputBuffer(uint(len(data) + 2))
+		buf.WriteUint16(uint16(len(data)))
+		buf.WriteData(data)
+		return FromWire(t, util.NewInputBuffer(buf.Data()))
+	}
+
+	if p, ok := parsers[t]; ok {
+		return p.fromString(s)
+	} else if g53Types[t] {
+		return g53RdataFromString(t, s)
+	} else if IsUnknownType(t) {
+		return nil, ErrInvalidGeneric
+	}
+	return nil, fmt.Errorf("unimplement type: %s", TypeString(t))
+}
+
+// digest of ds is compared as string by g53, it's kept in lower case as
+// the one parsed from wire
+func g53RdataFromString(t g53.RRType, s string) (g53.Rdata, error) {
+	rdata, err := g53.RdataFromString(t, s)
+	if ds, ok := rdata.(*g53.DS); ok {
+		ds.Digest = strings.ToLower(ds.Digest)
+	}
+	return rdata, err
+}
+
+// rdlen is read first as g53.RdataFromWire, nil is returned for empty
+// rdata which is used in dynamic update
+func FromWire(t g53.RRType, buf *util.InputBuffer) (g53.Rdata, error) {
+	if g53Types[t] || t == g53.RR_TSIG {
+		return g53.RdataFromWire(t, buf)
+	}
+
+	rdlen, err := buf.ReadUint16()
+	if err != nil {
+		return nil, err
+	}
+	if rdlen == 0 {
+		return nil, nil
+	}
+
+	if p, ok := parsers[t]; ok {
+		return p.fromWire(buf, rdlen)
+	}
+	return genericFromWire(buf, rdlen)
+}
+
+var rrsetTemplate = regexp.MustCompile(`^\s*(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(.+)\s*$`)
+
+// same format as g53.RRsetFromString, with types supported here
+func RRsetFromString(s string) (*g53.RRset, error) {
+	fields := rrsetTemplate.FindStringSubmatch(s)
+	if len(fields) != 6 {
+		return nil, g53.ErrRRsetStringFormatInValid
+	}
+
+	name, err := g53.NameFromString(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := g53.TTLFromString(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	cls, err := g53.ClassFromString(fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	typ, err := TypeFromString(fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	rdata, err := FromString(typ, fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	return &g53.RRset{
+		Name:   name,
+		Type:   typ,
+		Class:  cls,
+		Ttl:    ttl,
+		Rdatas: []g53.Rdata{rdata},
+	}, nil
+}
+
+// same as rrset.String, except type without mnemonic is TYPEnnn
+func RRsetString(rrset *g53.RRset) string {
+	header := strings.Join([]string{rrset.Name.String(false), rrset.Ttl.String(), rrset.Class.String(), TypeString(rrset.Type)}, "\t")
+	if len(rrset.Rdatas) == 0 {
+		return header
+	}
+
+	var buf bytes.Buffer
+	for _, rdata := range rrset.Rdatas {
+		buf.WriteString(header)
+		buf.WriteString("\t")
+		buf.WriteString(rdata.String())
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func toWire(rdata g53.Rdata) []byte {
+	buf := util.NewOutputBuffer(64)
+	rdata.ToWire(buf)
+	return buf.Data()
+}
+
+// rdatas without compressible name are compared in wire format
+func compareWire(rdata, other g53.Rdata) int {
+	return bytes.Compare(toWire(rdata), toWire(other))
+}
+
+func readBytes(buf *util.InputBuffer, length uint16) ([]byte, error) {
+	data, err := buf.ReadBytes(uint(length))
+	if err != nil {
+		return nil, err
+	}
+	clone := make([]byte, length)
+	copy(clone, data)
+	return clone, nil
+}
+
+func parseUint(s string, bitSize int) (uint64, error) {
+	v, err := strconv.ParseUint(s, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", s)
+	}
+	return v, nil
+}
+
+func hexFromString(fields []string) ([]byte, error) {
+	return hex.DecodeString(strings.Join(fields, ""))
+}
+
+func hexString(data []byte) string {
+	return strings.ToUpper(hex.EncodeToString(data))
+}
+
+// quoted string is unquoted with escapes resolved, unquoted one is kept
+func unquote(s string) (string, error) {
+	if strings.HasPrefix(s, "\"") {
+		if len(s) < 2 || strings.HasSuffix(s, "\"") == false {
+			return "", ErrUnterminatedQuote
+		}
+		s = s[1 : len(s)-1]
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		if i+3 < len(s) && isDigits(s[i+1:i+4]) {
+			v, err := strconv.ParseUint(s[i+1:i+4], 10, 8)
+			if err != nil {
+				return "", ErrInvalidEscape
+			}
+			buf.WriteByte(byte(v))
+			i += 3
+		} else if i+1 < len(s) {
+			buf.WriteByte(s[i+1])
+			i += 1
+		} else {
+			return "", ErrInvalidEscape
+		}
+	}
+	return buf.String(), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// string is quoted, quote, backslash and unprintable chars are escaped
+func quote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' {
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		} else if c < 0x20 || c > 0x7e {
+			fmt.Fprintf(&buf, "\\%03d", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,179 @@
+package rdata
+
+import (
+	"testing"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+func wireRoundTrip(t *testing.T, typ g53.RRType, rdata g53.Rdata) g53.Rdata {
+	render := g53.NewMsgRender()
+	render.WriteUint16(0)
+	rdata.Rend(render)
+	data := render.Data()
+	data[0], data[1] = byte((len(data)-2)>>8), byte(len(data)-2)
+
+	parsed, err := FromWire(typ, util.NewInputBuffer(data))
+	ut.Assert(t, err == nil, "parse rdata from wire shouldn't fail")
+	ut.Equal(t, parsed.Compare(rdata), 0)
+	return parsed
+}
+
+func TestRdataFromString(t *testing.T) {
+	cases := []struct {
+		typ    string
+		rdata  string
+		result string
+	}{
+		{"CAA", `0 issue "letsencrypt.org"`, `0 issue "letsencrypt.org"`},
+		{"caa", `128 IODEF "mailto:a\"b@example.com"`, `128 iodef "mailto:a\"b@example.com"`},
+		{"CAA", `0 issue ;`, `0 issue ";"`},
+		{"SSHFP", "1 1 dd465c09ce 35c47e", "1 1 DD465C09CE35C47E"},
+		{"TLSA", "3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b566 64c5d3d6", "3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6"},
+		{"DS", "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118", "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118"},
+		{"DNSKEY", "257 3 8 AwEAAag/ Ue4x", "257 3 8 AwEAAag/Ue4x"},
+		{"CERT", "PGP 0 0 AwEAAag=", "PGP 0 0 AwEAAag="},
+		{"CERT", "1000 1 ECDSAP256SHA256 AwEAAag=", "1000 1 13 AwEAAag="},
+		{"URI", `10 1 "ftp://ftp1.example.com/public"`, `10 1 "ftp://ftp1.example.com/public"`},
+		{"LOC", "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m", "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000.00m 10.00m"},
+		{"LOC", "42 21 43.952 S 71 5 6.344 W -24m", "42 21 43.952 S 71 5 6.344 W -24.00m 1.00m 10000.00m 10.00m"},
+		{"LOC", "32 N 116 W 10m 20m", "32 0 0.000 N 116 0 0.000 W 10.00m 20.00m 10000.00m 10.00m"},
+		{"SVCB", "0 svc.example.com.", "0 svc.example.com."},
+		{"HTTPS", `1 . alpn="h2,h3" port=8443 ipv4hint=192.0.2.1,192.0.2.2 no-default-alpn`, `1 . alpn="h2,h3" no-default-alpn port=8443 ipv4hint=192.0.2.1,192.0.2.2`},
+		{"SVCB", `16 foo.example.org. mandatory=alpn,ipv4hint alpn= "h2" ipv6hint=2001:db8::1 key667="hello"`, `16 foo.example.org. mandatory=alpn,ipv4hint alpn="h2" ipv6hint=2001:db8::1 key667="hello"`},
+		{"TYPE65534", `\# 4 0a000001`, `\# 4 0A000001`},
+		{"TYPE65534", `\# 0`, `\# 0`},
+		{"HINFO", `\# 4 01 41 01 42`, `\# 4 01410142`},
+		{"A", `\# 4 0a000001`, "10.0.0.1"},
+		{"TYPE257", `\# 9 00 05 69 73 73 75 65 63 61`, `0 issue "ca"`},
+		{"RRSIG", "A ECDSAP256SHA256 2 3600 20261101000000 20261018000000 12345 Example.com. AwEAAag=", "A 13 2 3600 20261101000000 20261018000000 12345 example.com. AwEAAag="},
+		{"RRSIG", "NSEC3PARAM 15 2 0 1792800000 1790208000 1 example.com. AwEAAag=", "NSEC3PARAM 15 2 0 20261024000000 20260924000000 1 example.com. AwEAAag="},
+		{"NSEC", "host.example.com. MX A RRSIG NSEC A TYPE1234", "host.example.com. A MX RRSIG NSEC TYPE1234"},
+		{"NSEC", "example.com.", "example.com."},
+		{"NSEC3", "1 1 12 aabbccdd 2t7b4g4vsa5smi47k61mv5bv1a22bojr A RRSIG", "1 1 12 AABBCCDD 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A RRSIG"},
+		{"NSEC3", "1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR", "1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR"},
+		{"NSEC3PARAM", "1 0 10 -", "1 0 10 -"},
+		{"NSEC3PARAM", "1 0 10 aabb", "1 0 10 AABB"},
+	}
+
+	for _, c := range cases {
+		typ, err := TypeFromString(c.typ)
+		ut.Assert(t, err == nil, "type %s should be known", c.typ)
+		rdata, err := FromString(typ, c.rdata)
+		ut.Assert(t, err == nil, "parse %s rdata %s failed: %v", c.typ, c.rdata, err)
+		ut.Equal(t, rdata.String(), c.result)
+
+		parsed, err := FromString(typ, rdata.String())
+		ut.Assert(t, err == nil, "parse %s rdata %s failed: %v", c.typ, rdata.String(), err)
+		ut.Equal(t, parsed.Compare(rdata), 0)
+		if len(toWire(rdata)) > 0 {
+			wireRoundTrip(t, typ, rdata)
+		}
+	}
+}
+
+func TestInvalidRdataFromString(t *testing.T) {
+	cases := []struct {
+		typ   g53.RRType
+		rdata string
+	}{
+		{g53.RR_CAA, `0 is-sue "ca"`},
+		{g53.RR_CAA, `256 issue "ca"`},
+		{g53.RR_CAA, `0 issue ca ca`},
+		{g53.RR_SSHFP, "1 1"},
+		{g53.RR_TLSA, "3 1 1 xyz"},
+		{g53.RR_DNSKEY, "257 3 8 !!!"},
+		{g53.RR_URI, "10 1 ftp://example.com"},
+		{g53.RR_URI, `10 1 ""`},
+		{g53.RR_LOC, "91 N 116 W 10m"},
+		{g53.RR_LOC, "32 60 N 116 W 10m"},
+		{g53.RR_LOC, "32 N 116 E"},
+		{RR_SVCB, "1 . port=http"},
+		{RR_SVCB, "1 . alpn"},
+		{RR_SVCB, "1 . port=53 port=54"},
+		{RR_SVCB, "1 . ipv4hint=2001:db8::1"},
+		{RR_SVCB, "1 . unknown=1"},
+		{g53.RRType(65534), "0a000001"},
+		{g53.RRType(65534), `\# 3 0a000001`},
+		{g53.RR_A, `\# 0`},
+		{g53.RR_RRSIG, "A 13 2 3600 2026-11-01 20261018000000 12345 example.com. AwEAAag="},
+		{g53.RR_RRSIG, "A 13 2 3600 20261101000000 20261018000000 12345 example.com."},
+		{g53.RR_NSEC, "host.example.com. A UNKNOWN"},
+		{g53.RR_NSEC3, "1 0 0 - 2t7b4g4vsa5smi47k61mv5bv1a22boj! A"},
+		{g53.RR_NSEC3PARAM, "1 0 10 xyz"},
+		{g53.RR_NSEC3PARAM, "1 0 10 - -"},
+	}
+
+	for _, c := range cases {
+		_, err := FromString(c.typ, c.rdata)
+		ut.Assert(t, err != nil, "parse %s rdata %s should fail", TypeString(c.typ), c.rdata)
+	}
+}
+
+func TestTypeString(t *testing.T) {
+	for _, s := range []string{"A", "CAA", "SVCB", "HTTPS", "TYPE65534"} {
+		typ, err := TypeFromString(s)
+		ut.Assert(t, err == nil, "type %s should be known", s)
+		ut.Equal(t, TypeString(typ), s)
+	}
+
+	typ, _ := TypeFromString("type1")
+	ut.Equal(t, typ, g53.RR_A)
+	_, err := TypeFromString("TYPE65536")
+	ut.Assert(t, err != nil, "type out of range should be rejected")
+
+	ut.Equal(t, IsUnknownType(g53.RRType(65534)), true)
+	ut.Equal(t, IsUnknownType(g53.RR_HINFO), true)
+	ut.Equal(t, IsUnknownType(g53.RR_CAA), false)
+	ut.Equal(t, IsUnknownType(g53.RR_AXFR), false)
+	ut.Equal(t, IsUnknownType(g53.RR_OPT), false)
+}
+
+func TestRRsetString(t *testing.T) {
+	for _, s := range []string{
+		"example.com.\t3600\tIN\tCAA\t0 issue \"ca.example.net\"\n",
+		"example.com.\t3600\tIN\tTYPE65534\t\\# 3 010203\n",
+		"_443._tcp.example.com.\t3600\tIN\tHTTPS\t1 . alpn=\"h2\"\n",
+	} {
+		rrset, err := RRsetFromString(s)
+		ut.Assert(t, err == nil, "parse rrset %s failed: %v", s, err)
+		ut.Equal(t, RRsetString(rrset), s)
+	}
+}
+
+func TestMessageFromWire(t *testing.T) {
+	msg := g53.MakeQuery(g53.NameFromStringUnsafe("example.com."), g53.RR_SOA, 512, false)
+	msg.Header.Opcode = g53.OP_UPDATE
+	for _, s := range []string{
+		"example.com. 3600 IN CAA 0 issue \"ca.example.net\"",
+		"example.com. 3600 IN CAA 0 issuewild \";\"",
+		"example.com. 3600 IN HTTPS 1 . alpn=\"h2\"",
+		"example.com. 3600 IN TYPE65534 \\# 3 010203",
+		"example.com. 3600 IN A 1.1.1.1",
+	} {
+		rrset, _ := RRsetFromString(s)
+		msg.AddRR(g53.AuthSection, rrset.Name, rrset.Type, rrset.Class, rrset.Ttl, rrset.Rdatas[0], true)
+	}
+	msg.AddRRset(g53.AuthSection, &g53.RRset{Name: g53.NameFromStringUnsafe("b.example.com."), Type: g53.RR_CAA, Class: g53.CLASS_ANY})
+	msg.RecalculateSectionRRCount()
+	render := g53.NewMsgRender()
+	msg.Rend(render)
+
+	_, err := g53.MessageFromWire(util.NewInputBuffer(render.Data()))
+	ut.Assert(t, err != nil, "g53 doesn't parse caa")
+
+	parsed, err := MessageFromWire(util.NewInputBuffer(render.Data()))
+	ut.Assert(t, err == nil, "parse message shouldn't fail")
+	ut.Equal(t, parsed.Header.Opcode, g53.OP_UPDATE)
+	ut.Equal(t, parsed.Question.Name.String(false), "example.com.")
+	ut.Assert(t, parsed.Edns != nil, "edns should be parsed")
+	auth := parsed.Sections[g53.AuthSection]
+	ut.Equal(t, len(auth), 5)
+	ut.Equal(t, auth[0].Type, g53.RR_CAA)
+	ut.Equal(t, len(auth[0].Rdatas), 2)
+	ut.Equal(t, auth[1].Rdatas[0].String(), "1 . alpn=\"h2\"")
+	ut.Equal(t, auth[2].Rdatas[0].(*Generic).Data, []byte{1, 2, 3})
+	ut.Equal(t, len(auth[4].Rdatas), 0)
+}
@@ -0,0 +1,180 @@
+package rdata
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+var ErrInvalidSigTime = errors.New("invalid signature time")
+
+const sigTimeFormat = "20060102150405"
+
+// RFC 4034, signer name is never compressed and kept as it is, it's
+// required to calculate the signature
+type RRSIG struct {
+	Covered     g53.RRType
+	Algorithm   uint8
+	Labels      uint8
+	OriginalTtl uint32
+	Expiration  uint32
+	Inception   uint32
+	Tag         uint16
+	Signer      *g53.Name
+	Signature   []byte
+}
+
+func (sig *RRSIG) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(sig))
+}
+
+func (sig *RRSIG) ToWire(buf *util.OutputBuffer) {
+	sig.HeaderToWire(buf)
+	buf.WriteData(sig.Signature)
+}
+
+// rdata without signature, which is the prefix of signed data
+func (sig *RRSIG) HeaderToWire(buf *util.OutputBuffer) {
+	buf.WriteUint16(uint16(sig.Covered))
+	buf.WriteUint8(sig.Algorithm)
+	buf.WriteUint8(sig.Labels)
+	buf.WriteUint32(sig.OriginalTtl)
+	buf.WriteUint32(sig.Expiration)
+	buf.WriteUint32(sig.Inception)
+	buf.WriteUint16(sig.Tag)
+	sig.Signer.ToWire(buf)
+}
+
+func (sig *RRSIG) Compare(other g53.Rdata) int {
+	return compareWire(sig, other)
+}
+
+func (sig *RRSIG) String() string {
+	return fmt.Sprintf("%s %d %d %d %s %s %d %s %s", TypeString(sig.Covered), sig.Algorithm, sig.Labels, sig.OriginalTtl,
+		SigTimeString(sig.Expiration), SigTimeString(sig.Inception), sig.Tag, sig.Signer.String(false),
+		base64.StdEncoding.EncodeToString(sig.Signature))
+}
+
+// signature time is seconds since epoch modulo 2^32, RFC 4034 3.1.5
+func SigTimeString(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format(sigTimeFormat)
+}
+
+func sigTimeFromString(s string) (uint32, error) {
+	if len(s) == len(sigTimeFormat) {
+		t, err := time.Parse(sigTimeFormat, s)
+		if err != nil {
+			return 0, ErrInvalidSigTime
+		}
+		return uint32(t.Unix()), nil
+	}
+
+	v, err := parseUint(s, 32)
+	if err != nil {
+		return 0, ErrInvalidSigTime
+	}
+	return uint32(v), nil
+}
+
+func rrsigFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen < 19 {
+		return nil, g53.ErrDataIsTooShort
+	}
+	end := buf.Position() + uint(rdlen)
+	data, err := readBytes(buf, 18)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := g53.NameFromWire(buf, false)
+	if err != nil {
+		return nil, err
+	}
+	if buf.Position() > end {
+		return nil, g53.ErrDataIsTooShort
+	}
+	signature, err := readBytes(buf, uint16(end-buf.Position()))
+	if err != nil {
+		return nil, err
+	}
+
+	in := util.NewInputBuffer(data)
+	covered, _ := in.ReadUint16()
+	algorithm, _ := in.ReadUint8()
+	labels, _ := in.ReadUint8()
+	ttl, _ := in.ReadUint32()
+	expiration, _ := in.ReadUint32()
+	inception, _ := in.ReadUint32()
+	tag, _ := in.ReadUint16()
+	return &RRSIG{
+		Covered:     g53.RRType(covered),
+		Algorithm:   algorithm,
+		Labels:      labels,
+		OriginalTtl: ttl,
+		Expiration:  expiration,
+		Inception:   inception,
+		Tag:         tag,
+		Signer:      signer,
+		Signature:   signature,
+	}, nil
+}
+
+func rrsigFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 9 {
+		return nil, ErrShortOfFields
+	}
+
+	covered, err := TypeFromString(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := mnemonicOrNumber(fields[1], 8, algorithmFromString)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseUint(fields[2], 8)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := parseUint(fields[3], 32)
+	if err != nil {
+		return nil, err
+	}
+	expiration, err := sigTimeFromString(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	inception, err := sigTimeFromString(fields[5])
+	if err != nil {
+		return nil, err
+	}
+	tag, err := parseUint(fields[6], 16)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := g53.NameFromString(fields[7])
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(fields[8:], ""))
+	if err != nil {
+		return nil, err
+	}
+
+	return &RRSIG{
+		Covered:     covered,
+		Algorithm:   uint8(algorithm),
+		Labels:      uint8(labels),
+		OriginalTtl: uint32(ttl),
+		Expiration:  expiration,
+		Inception:   inception,
+		Tag:         uint16(tag),
+		Signer:      signer,
+		Signature:   signature,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package rdata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+// RFC 4255
+type SSHFP struct {
+	Algorithm   uint8
+	Type        uint8
+	Fingerprint []byte
+}
+
+func (fp *SSHFP) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(fp))
+}
+
+func (fp *SSHFP) ToWire(buf *util.OutputBuffer) {
+	buf.WriteUint8(fp.Algorithm)
+	buf.WriteUint8(fp.Type)
+	buf.WriteData(fp.Fingerprint)
+}
+
+func (fp *SSHFP) Compare(other g53.Rdata) int {
+	return compareWire(fp, other)
+}
+
+func (fp *SSHFP) String() string {
+	return fmt.Sprintf("%d %d %s", fp.Algorithm, fp.Type, hexString(fp.Fingerprint))
+}
+
+func sshfpFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen < 3 {
+		return nil, g53.ErrDataIsTooShort
+	}
+	data, err := readBytes(buf, rdlen)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHFP{
+		Algorithm:   data[0],
+		Type:        data[1],
+		Fingerprint: data[2:],
+	}, nil
+}
+
+func sshfpFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return nil, ErrShortOfFields
+	}
+
+	var nums [2]uint8
+	for i := range nums {
+		v, err := parseUint(fields[i], 8)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = uint8(v)
+	}
+
+	fingerprint, err := hexFromString(fields[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSHFP{
+		Algorithm:   nums[0],
+		Type:        nums[1],
+		Fingerprint: fingerprint,
+	}, nil
+}
@@ -0,0 +1,392 @@
+package rdata
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+var (
+	ErrUnknownSvcParamKey   = errors.New("unknown svc param key")
+	ErrDuplicateSvcParamKey = errors.New("svc param keys aren't unique and in order")
+	ErrInvalidSvcParamValue = errors.New("invalid svc param value")
+)
+
+const (
+	SvcParamMandatory     uint16 = 0
+	SvcParamALPN          uint16 = 1
+	SvcParamNoDefaultALPN uint16 = 2
+	SvcParamPort          uint16 = 3
+	SvcParamIPv4Hint      uint16 = 4
+	SvcParamECH           uint16 = 5
+	SvcParamIPv6Hint      uint16 = 6
+)
+
+var svcParamKeyNames = map[uint16]string{
+	SvcParamMandatory:     "mandatory",
+	SvcParamALPN:          "alpn",
+	SvcParamNoDefaultALPN: "no-default-alpn",
+	SvcParamPort:          "port",
+	SvcParamIPv4Hint:      "ipv4hint",
+	SvcParamECH:           "ech",
+	SvcParamIPv6Hint:      "ipv6hint",
+}
+
+// value is kept in wire format
+type SvcParam struct {
+	Key   uint16
+	Value []byte
+}
+
+// RFC 9460, HTTPS has the same format as SVCB, target is never compressed,
+// params are sorted by key
+type SVCB struct {
+	Priority uint16
+	Target   *g53.Name
+	Params   []SvcParam
+}
+
+// in AliasMode with priority 0, root target means service doesn't exist,
+// in ServiceMode root target is the owner name
+func (svcb *SVCB) IsAliasMode() bool {
+	return svcb.Priority == 0
+}
+
+func (svcb *SVCB) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(svcb))
+}
+
+func (svcb *SVCB) ToWire(buf *util.OutputBuffer) {
+	buf.WriteUint16(svcb.Priority)
+	svcb.Target.ToWire(buf)
+	for _, param := range svcb.Params {
+		buf.WriteUint16(param.Key)
+		buf.WriteUint16(uint16(len(param.Value)))
+		buf.WriteData(param.Value)
+	}
+}
+
+func (svcb *SVCB) Compare(other g53.Rdata) int {
+	return compareWire(svcb, other)
+}
+
+func (svcb *SVCB) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d %s", svcb.Priority, svcb.Target.String(false))
+	for _, param := range svcb.Params {
+		buf.WriteString(" ")
+		buf.WriteString(svcParamKeyString(param.Key))
+		if value := svcParamValueString(param); value != "" {
+			buf.WriteString("=")
+			buf.WriteString(value)
+		}
+	}
+	return buf.String()
+}
+
+func svcParamKeyString(key uint16) string {
+	if name, ok := svcParamKeyNames[key]; ok {
+		return name
+	}
+	return fmt.Sprintf("key%d", key)
+}
+
+func svcParamKeyFromString(s string) (uint16, error) {
+	s = strings.ToLower(s)
+	for key, name := range svcParamKeyNames {
+		if name == s {
+			return key, nil
+		}
+	}
+
+	if strings.HasPrefix(s, "key") {
+		if key, err := strconv.ParseUint(s[3:], 10, 16); err == nil {
+			return uint16(key), nil
+		}
+	}
+	return 0, ErrUnknownSvcParamKey
+}
+
+func svcParamValueString(param SvcParam) string {
+	in := util.NewInputBuffer(param.Value)
+	switch param.Key {
+	case SvcParamMandatory:
+		var keys []string
+		for in.Position() < in.Len() {
+			key, _ := in.ReadUint16()
+			keys = append(keys, svcParamKeyString(key))
+		}
+		return strings.Join(keys, ",")
+	case SvcParamALPN:
+		var ids []string
+		for in.Position() < in.Len() {
+			l, _ := in.ReadUint8()
+			id, _ := in.ReadBytes(uint(l))
+			ids = append(ids, strings.Replace(string(id), ",", "\\,", -1))
+		}
+		return quote(strings.Join(ids, ","))
+	case SvcParamNoDefaultALPN:
+		return ""
+	case SvcParamPort:
+		port, _ := in.ReadUint16()
+		return strconv.Itoa(int(port))
+	case SvcParamIPv4Hint, SvcParamIPv6Hint:
+		var ips []string
+		size := uint(net.IPv4len)
+		if param.Key == SvcParamIPv6Hint {
+			size = net.IPv6len
+		}
+		for in.Position() < in.Len() {
+			ip, _ := in.ReadBytes(size)
+			ips = append(ips, net.IP(ip).String())
+		}
+		return strings.Join(ips, ",")
+	case SvcParamECH:
+		return base64.StdEncoding.EncodeToString(param.Value)
+	default:
+		return quote(string(param.Value))
+	}
+}
+
+// value in presentation format is converted into wire format
+func svcParamValueFromString(key uint16, value string, hasValue bool) ([]byte, error) {
+	if key == SvcParamNoDefaultALPN {
+		if hasValue {
+			return nil, ErrInvalidSvcParamValue
+		}
+		return nil, nil
+	}
+
+	value, err := unquote(value)
+	if err != nil {
+		return nil, err
+	}
+	if hasValue == false || value == "" {
+		if _, ok := svcParamKeyNames[key]; ok {
+			return nil, ErrInvalidSvcParamValue
+		}
+		return nil, nil
+	}
+
+	buf := util.NewOutputBuffer(64)
+	switch key {
+	case SvcParamMandatory:
+		var keys []int
+		for _, name := range strings.Split(value, ",") {
+			k, err := svcParamKeyFromString(name)
+			if err != nil || k == SvcParamMandatory {
+				return nil, ErrInvalidSvcParamValue
+			}
+			keys = append(keys, int(k))
+		}
+		sort.Ints(keys)
+		for i, k := range keys {
+			if i > 0 && keys[i-1] == k {
+				return nil, ErrDuplicateSvcParamKey
+			}
+			buf.WriteUint16(uint16(k))
+		}
+	case SvcParamALPN:
+		for _, id := range splitALPN(value) {
+			if id == "" || len(id) > 255 {
+				return nil, ErrInvalidSvcParamValue
+			}
+			buf.WriteUint8(uint8(len(id)))
+			buf.WriteData([]byte(id))
+		}
+	case SvcParamPort:
+		port, err := parseUint(value, 16)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteUint16(uint16(port))
+	case SvcParamIPv4Hint, SvcParamIPv6Hint:
+		for _, s := range strings.Split(value, ",") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, g53.ErrInvalidIPAddr
+			}
+			if key == SvcParamIPv4Hint {
+				if ip = ip.To4(); ip == nil {
+					return nil, g53.ErrInvalidIPAddr
+				}
+			} else if strings.Contains(s, ":") == false {
+				return nil, g53.ErrInvalidIPAddr
+			}
+			buf.WriteData(ip)
+		}
+	case SvcParamECH:
+		ech, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteData(ech)
+	default:
+		buf.WriteData([]byte(value))
+	}
+	return buf.Data(), nil
+}
+
+// alpn ids are separated by comma, comma in id is escaped
+func splitALPN(s string) []string {
+	var ids []string
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == ',' {
+			current.WriteByte(',')
+			i += 1
+		} else if s[i] == ',' {
+			ids = append(ids, current.String())
+			current.Reset()
+		} else {
+			current.WriteByte(s[i])
+		}
+	}
+	return append(ids, current.String())
+}
+
+func svcbFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen < 3 {
+		return nil, g53.ErrDataIsTooShort
+	}
+	end := buf.Position() + uint(rdlen)
+	priority, err := buf.ReadUint16()
+	if err != nil {
+		return nil, err
+	}
+	target, err := g53.NameFromWire(buf, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var params []SvcParam
+	for buf.Position() < end {
+		key, err := buf.ReadUint16()
+		if err != nil {
+			return nil, err
+		}
+		if len(params) > 0 && key <= params[len(params)-1].Key {
+			return nil, ErrDuplicateSvcParamKey
+		}
+		l, err := buf.ReadUint16()
+		if err != nil {
+			return nil, err
+		}
+		value, err := readBytes(buf, l)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, SvcParam{Key: key, Value: value})
+	}
+
+	if buf.Position() != end {
+		return nil, ErrExtraData
+	}
+	return &SVCB{
+		Priority: priority,
+		Target:   target,
+		Params:   params,
+	}, nil
+}
+
+// params are key=value, and value could be quoted, the master file parser
+// splits key= and the following quoted value into two fields
+func svcbFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return nil, ErrShortOfFields
+	}
+
+	priority, err := parseUint(fields[0], 16)
+	if err != nil {
+		return nil, err
+	}
+	target, err := g53.NameFromString(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	rest := s[strings.Index(s, fields[0])+len(fields[0]):]
+	rest = rest[strings.Index(rest, fields[1])+len(fields[1]):]
+	params, err := svcParamsFromString(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SVCB{
+		Priority: uint16(priority),
+		Target:   target,
+		Params:   params,
+	}, nil
+}
+
+func svcParamsFromString(s string) ([]SvcParam, error) {
+	var params []SvcParam
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+
+		end := strings.IndexAny(s, "= \t")
+		if end == -1 {
+			end = len(s)
+		}
+		key, err := svcParamKeyFromString(s[:end])
+		if err != nil {
+			return nil, err
+		}
+		s = s[end:]
+
+		var value string
+		hasValue := strings.HasPrefix(s, "=")
+		if hasValue {
+			s = s[1:]
+			if trimmed := strings.TrimLeft(s, " \t"); strings.HasPrefix(trimmed, "\"") {
+				s = trimmed
+			}
+			value, s = nextSvcParamValue(s)
+		}
+
+		data, err := svcParamValueFromString(key, value, hasValue)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", svcParamKeyString(key), err.Error())
+		}
+		params = append(params, SvcParam{Key: key, Value: data})
+	}
+
+	sort.Slice(params, func(i, j int) bool { return params[i].Key < params[j].Key })
+	for i := 1; i < len(params); i++ {
+		if params[i].Key == params[i-1].Key {
+			return nil, ErrDuplicateSvcParamKey
+		}
+	}
+	return params, nil
+}
+
+// value ends at blank, quoted value ends at the closing quote
+func nextSvcParamValue(s string) (string, string) {
+	if strings.HasPrefix(s, "\"") {
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i += 1
+			} else if s[i] == '"' {
+				return s[:i+1], s[i+1:]
+			}
+		}
+		return s, ""
+	}
+
+	if end := strings.IndexAny(s, " \t"); end != -1 {
+		return s[:end], s[end:]
+	}
+	return s, ""
+}
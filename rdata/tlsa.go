@@ -0,0 +1,80 @@
+package rdata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+// RFC 6698
+type TLSA struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	Data         []byte
+}
+
+func (tlsa *TLSA) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(tlsa))
+}
+
+func (tlsa *TLSA) ToWire(buf *util.OutputBuffer) {
+	buf.WriteUint8(tlsa.Usage)
+	buf.WriteUint8(tlsa.Selector)
+	buf.WriteUint8(tlsa.MatchingType)
+	buf.WriteData(tlsa.Data)
+}
+
+func (tlsa *TLSA) Compare(other g53.Rdata) int {
+	return compareWire(tlsa, other)
+}
+
+func (tlsa *TLSA) String() string {
+	return fmt.Sprintf("%d %d %d %s", tlsa.Usage, tlsa.Selector, tlsa.MatchingType, hexString(tlsa.Data))
+}
+
+func tlsaFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen < 4 {
+		return nil, g53.ErrDataIsTooShort
+	}
+	data, err := readBytes(buf, rdlen)
+	if err != nil {
+		return nil, err
+	}
+	return &TLSA{
+		Usage:        data[0],
+		Selector:     data[1],
+		MatchingType: data[2],
+		Data:         data[3:],
+	}, nil
+}
+
+func tlsaFromString(s string) (g53.Rdata, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 4 {
+		return nil, ErrShortOfFields
+	}
+
+	var nums [3]uint8
+	for i := range nums {
+		v, err := parseUint(fields[i], 8)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = uint8(v)
+	}
+
+	data, err := hexFromString(fields[3:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &TLSA{
+		Usage:        nums[0],
+		Selector:     nums[1],
+		MatchingType: nums[2],
+		Data:         data,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package rdata
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+var (
+	ErrEmptyURITarget = errors.New("uri target is empty")
+	ErrInvalidURI     = errors.New("uri should have priority, weight and quoted target")
+)
+
+// RFC 7553
+type URI struct {
+	Priority uint16
+	Weight   uint16
+	Target   string
+}
+
+func (uri *URI) Rend(r *g53.MsgRender) {
+	r.WriteData(toWire(uri))
+}
+
+func (uri *URI) ToWire(buf *util.OutputBuffer) {
+	buf.WriteUint16(uri.Priority)
+	buf.WriteUint16(uri.Weight)
+	buf.WriteData([]byte(uri.Target))
+}
+
+func (uri *URI) Compare(other g53.Rdata) int {
+	return compareWire(uri, other)
+}
+
+func (uri *URI) String() string {
+	return fmt.Sprintf("%d %d %s", uri.Priority, uri.Weight, quote(uri.Target))
+}
+
+func uriFromWire(buf *util.InputBuffer, rdlen uint16) (g53.Rdata, error) {
+	if rdlen < 5 {
+		return nil, g53.ErrDataIsTooShort
+	}
+	data, err := readBytes(buf, rdlen)
+	if err != nil {
+		return nil, err
+	}
+	return &URI{
+		Priority: uint16(data[0])<<8 | uint16(data[1]),
+		Weight:   uint16(data[2])<<8 | uint16(data[3]),
+		Target:   string(data[4:]),
+	}, nil
+}
+
+var uriRdataTemplate = regexp.MustCompile(`^\s*(\S+)\s+(\S+)\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+func uriFromString(s string) (g53.Rdata, error) {
+	fields := uriRdataTemplate.FindStringSubmatch(s)
+	if len(fields) != 4 {
+		return nil, ErrInvalidURI
+	}
+
+	priority, err := parseUint(fields[1], 16)
+	if err != nil {
+		return nil, err
+	}
+	weight, err := parseUint(fields[2], 16)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := unquote(fields[3])
+	if err != nil {
+		return nil, err
+	} else if target == "" {
+		return nil, ErrEmptyURITarget
+	}
+
+	return &URI{
+		Priority: uint16(priority),
+		Weight:   uint16(weight),
+		Target:   target,
+	}, nil
+}
@@ -1,9 +1,9 @@
 package auth
 
 import (
-	"io/ioutil"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/zdnscloud/cement/domaintree"
 	"github.com/zdnscloud/g53"
@@ -17,16 +17,26 @@ import (
 	view "github.com/zdnscloud/vanguard/viewselector"
 )
 
+const (
+	journalCompactInterval = 15 * time.Minute
+	resignCheckInterval    = 10 * time.Minute
+)
+
 type AuthDataSource struct {
 	chain.DefaultResolver
 	viewZones map[string]*domaintree.DomainTree
 	lock      sync.RWMutex
+	notifier  *Notifier
 }
 
 func NewAuth(conf *config.VanguardConf) *AuthDataSource {
-	ds := &AuthDataSource{}
+	ds := &AuthDataSource{
+		notifier: newNotifier(),
+	}
 	ds.ReloadConfig(conf)
-	httpcmd.RegisterHandler(ds, []httpcmd.Command{&AddAuthZone{}, &DeleteAuthZone{}, &UpdateAuthZone{}, &AddAuthRrs{}, &DeleteAuthRrs{}, &UpdateAuthRrs{}})
+	httpcmd.RegisterHandler(ds, []httpcmd.Command{&AddAuthZone{}, &DeleteAuthZone{}, &UpdateAuthZone{}, &AddAuthRrs{}, &DeleteAuthRrs{}, &UpdateAuthRrs{}, &GetAuthZoneHistory{}, &GetAuthZoneVersions{}, &DiffAuthZoneVersions{}, &RollbackAuthZone{}})
+	go ds.compactJournals()
+	go ds.resignZones()
 	return ds
 }
 
@@ -46,19 +56,40 @@ func (ds *AuthDataSource) ReloadConfig(conf *config.VanguardConf) {
 
 			var zoneData zone.Zone
 			if len(z.Masters) > 0 {
-				zoneData = loadZoneFromMaster(origin, viewAuth.View, z.Masters)
-				zoneData.SetMasters(z.Masters)
-			} else {
-				f, err := os.OpenFile(z.File, os.O_RDONLY, 0755)
+				key, err := transferKey(z)
 				if err != nil {
+					panic("load auth zone " + z.Name + " failed:" + err.Error())
+				}
+				zoneData = loadSecondaryZone(origin, viewAuth.View, z, key)
+			} else {
+				if _, err := os.Stat(z.File); err != nil {
 					panic("open zone file " + z.File + " failed " + err.Error())
 				}
-				defer f.Close()
-				content, err := ioutil.ReadAll(f)
-				if err != nil {
-					panic("read zone file " + z.File + " failed " + err.Error())
+				zoneData = loadMasterZone(origin, viewAuth.View, z)
+				if err := zoneData.EnableJournal(snapshotPath(z), journalPath(z)); err != nil {
+					panic("replay journal " + journalPath(z) + " failed " + err.Error())
 				}
-				zoneData = loadZone(origin, string(content))
+			}
+			if len(z.UpdateAcls) > 0 {
+				zoneData.SetAcls(z.UpdateAcls)
+			}
+			if len(z.TransferAcls) > 0 {
+				zoneData.SetTransferAcls(z.TransferAcls)
+			}
+			notifyMode, err := zone.NotifyModeFromString(z.Notify)
+			if err != nil {
+				panic("load auth zone " + z.Name + " failed:" + err.Error())
+			}
+			zoneData.SetNotify(notifyMode, z.AlsoNotify)
+			policy, err := signPolicy(z)
+			if err != nil {
+				panic("load auth zone " + z.Name + " failed:" + err.Error())
+			}
+			if policy != nil {
+				if err := zoneData.EnableDNSSEC(policy); err != nil {
+					panic("sign auth zone " + z.Name + " failed:" + err.Error())
+				}
+				logDS(origin, viewAuth.View, policy)
 			}
 
 			if _, err := tree.Insert(origin, zoneData); err != nil {
@@ -107,3 +138,59 @@ func (ds *AuthDataSource) GetZone(viewName string, name *g53.Name) (zone.Zone, d
 		return nil, result
 	}
 }
+
+// zone is changed, notify its secondaries
+func (ds *AuthDataSource) NotifyZone(viewName string, z zone.Zone) {
+	ds.notifier.Notify(viewName, z)
+}
+
+type viewZone struct {
+	view string
+	zone zone.Zone
+}
+
+// f is called without lock, since it may be slow and block zone changes
+func (ds *AuthDataSource) ForEachZone(f func(viewName string, z zone.Zone)) {
+	var zones []viewZone
+	ds.lock.RLock()
+	for viewName, tree := range ds.viewZones {
+		tree.ForEach(func(data interface{}) {
+			if z, ok := data.(zone.Zone); ok {
+				zones = append(zones, viewZone{viewName, z})
+			}
+		})
+	}
+	ds.lock.RUnlock()
+
+	for _, vz := range zones {
+		f(vz.view, vz.zone)
+	}
+}
+
+// merge journal into zone file periodically to keep journal small
+func (ds *AuthDataSource) compactJournals() {
+	ticker := time.NewTicker(journalCompactInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ds.ForEachZone(func(viewName string, z zone.Zone) {
+			if err := z.Compact(); err != nil {
+				logger.GetLogger().Error("compact zone %s in view %s failed: %s",
+					z.GetOrigin().String(false), viewName, err.Error())
+			}
+		})
+	}
+}
+
+// signatures are regenerated before they expire
+func (ds *AuthDataSource) resignZones() {
+	ticker := time.NewTicker(resignCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ds.ForEachZone(func(viewName string, z zone.Zone) {
+			if err := z.Resign(); err != nil {
+				logger.GetLogger().Error("resign zone %s in view %s failed: %s",
+					z.GetOrigin().String(false), viewName, err.Error())
+			}
+		})
+	}
+}
@@ -1,20 +1,62 @@
 package auth
 
 import (
-	//	"fmt"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/zdnscloud/cement/domaintree"
 	ut "github.com/zdnscloud/cement/unittest"
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/dnssec"
 	"github.com/zdnscloud/vanguard/httpcmd"
 	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
 	"github.com/zdnscloud/vanguard/resolver/auth/zone"
 	view "github.com/zdnscloud/vanguard/viewselector"
 )
 
+// zone file and journal are changed by tests, so tests use copy of zone
+// file in testDir
+var testDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	if testDir, err = ioutil.TempDir("", "auth"); err != nil {
+		panic("create test dir failed:" + err.Error())
+	}
+	code := m.Run()
+	os.RemoveAll(testDir)
+	os.Exit(code)
+}
+
+func copyTestZoneFile(file string) string {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		panic("read zone file failed:" + err.Error())
+	}
+
+	dir, err := ioutil.TempDir(testDir, "")
+	if err != nil {
+		panic("create zone dir failed:" + err.Error())
+	}
+	path := filepath.Join(dir, filepath.Base(file))
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		panic("write zone file failed:" + err.Error())
+	}
+	return path
+}
+
 func setupTestZone() *AuthDataSource {
+	return setupTestZoneWithFile(copyTestZoneFile("testdata/example.com"))
+}
+
+func setupTestZoneWithFile(file string) *AuthDataSource {
 	logger.UseDefaultLogger("error")
 	view.InitViews(view.DefaultView)
 
@@ -24,8 +66,9 @@ func setupTestZone() *AuthDataSource {
 				View: "default",
 				Zones: []config.AuthZoneConf{
 					config.AuthZoneConf{
-						Name: "example.com.",
-						File: "testdata/example.com",
+						Name:   "example.com.",
+						File:   file,
+						Notify: string(zone.NotifyExplicit),
 					},
 				},
 			},
@@ -196,3 +239,240 @@ func TestAuthInvalidCmd(t *testing.T) {
 	findResult = zoneData.Find(g53.NameFromStringUnsafe(old_a.Name), g53.RR_A, zone.DefaultFind).GetResult()
 	ut.Equal(t, findResult.Type, zone.FRNXDomain)
 }
+
+func TestAuthZoneHistory(t *testing.T) {
+	file := copyTestZoneFile("testdata/example.com")
+	auth := setupTestZoneWithFile(file)
+	rrs := AuthRRs{&AuthRR{view.DefaultView, "example.com.", "aa.example.com.", "3600", "A", "1.2.3.4"}}
+	_, err := auth.HandleCmd(&AddAuthRrs{Rrs: rrs})
+	ut.Equal(t, err, (*httpcmd.Error)(nil))
+
+	history, err := auth.HandleCmd(&GetAuthZoneHistory{View: view.DefaultView, Name: "example.com."})
+	ut.Equal(t, err, (*httpcmd.Error)(nil))
+	changes := history.([]*ZoneChange)
+	ut.Equal(t, len(changes), 1)
+	ut.Equal(t, changes[0].OldSerial, uint32(1))
+	ut.Equal(t, changes[0].NewSerial, uint32(2))
+	ut.Equal(t, changes[0].Deleted, []string{})
+	ut.Equal(t, changes[0].Added, []string{"aa.example.com.\t3600\tIN\tA\t1.2.3.4"})
+
+	_, err = auth.HandleCmd(&GetAuthZoneHistory{View: view.DefaultView, Name: "example.org."})
+	ut.Equal(t, err, ErrGetZoneFail)
+
+	//changes are replayed from journal after restart
+	auth = setupTestZoneWithFile(file)
+	zoneData, _ := auth.GetZone(view.DefaultView, g53.NameFromStringUnsafe("example.com."))
+	result := zoneData.Find(g53.NameFromStringUnsafe("aa.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+	ut.Equal(t, len(zoneData.History()), 1)
+}
+
+func TestAuthZoneSnapshot(t *testing.T) {
+	file := copyTestZoneFile("testdata/example.com")
+	content, _ := ioutil.ReadFile(file)
+	content = append([]byte("; written by hand\n$TTL 3600\n"), content...)
+	ioutil.WriteFile(file, content, 0644)
+
+	auth := setupTestZoneWithFile(file)
+	rrs := AuthRRs{&AuthRR{view.DefaultView, "example.com.", "aa.example.com.", "3600", "A", "1.2.3.4"}}
+	_, err := auth.HandleCmd(&AddAuthRrs{Rrs: rrs})
+	ut.Equal(t, err, (*httpcmd.Error)(nil))
+	zoneData, _ := auth.GetZone(view.DefaultView, g53.NameFromStringUnsafe("example.com."))
+	ut.Assert(t, zoneData.Compact() == nil, "compact shouldn't fail")
+
+	//zone file is kept, changes are loaded from snapshot after restart
+	saved, _ := ioutil.ReadFile(file)
+	ut.Equal(t, string(saved), string(content))
+	auth = setupTestZoneWithFile(file)
+	zoneData, _ = auth.GetZone(view.DefaultView, g53.NameFromStringUnsafe("example.com."))
+	result := zoneData.Find(g53.NameFromStringUnsafe("aa.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+
+	//zone file with newer serial is edited after compaction
+	edited := strings.Replace(string(content), " 1 7200 3600 1209600 3600", " 3 7200 3600 1209600 3600\nbb.example.com. 3600 IN A 1.2.3.5", 1)
+	ioutil.WriteFile(file, []byte(edited), 0644)
+	auth = setupTestZoneWithFile(file)
+	zoneData, _ = auth.GetZone(view.DefaultView, g53.NameFromStringUnsafe("example.com."))
+	result = zoneData.Find(g53.NameFromStringUnsafe("bb.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+	result = zoneData.Find(g53.NameFromStringUnsafe("aa.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRNXDomain)
+}
+
+func TestAuthModernTypes(t *testing.T) {
+	file := copyTestZoneFile("testdata/example.com")
+	auth := setupTestZoneWithFile(file)
+	rrs := AuthRRs{
+		&AuthRR{view.DefaultView, "example.com.", "example.com.", "3600", "CAA", "0 issue \"ca.example.net\""},
+		&AuthRR{view.DefaultView, "example.com.", "svc.example.com.", "3600", "HTTPS", "1 . alpn=\"h2\""},
+		&AuthRR{view.DefaultView, "example.com.", "svc.example.com.", "3600", "TYPE65534", "\\# 2 0102"},
+	}
+	_, err := auth.HandleCmd(&AddAuthRrs{Rrs: rrs})
+	ut.Equal(t, err, (*httpcmd.Error)(nil))
+
+	history, err := auth.HandleCmd(&GetAuthZoneHistory{View: view.DefaultView, Name: "example.com."})
+	ut.Equal(t, err, (*httpcmd.Error)(nil))
+	ut.Equal(t, history.([]*ZoneChange)[0].Added, []string{
+		"example.com.\t3600\tIN\tCAA\t0 issue \"ca.example.net\"",
+		"svc.example.com.\t3600\tIN\tHTTPS\t1 . alpn=\"h2\"",
+		"svc.example.com.\t3600\tIN\tTYPE65534\t\\# 2 0102",
+	})
+
+	rrs = AuthRRs{&AuthRR{view.DefaultView, "example.com.", "example.com.", "3600", "CAA", "0 is-sue \"ca.example.net\""}}
+	_, err = auth.HandleCmd(&AddAuthRrs{Rrs: rrs})
+	ut.Assert(t, err != nil, "invalid caa should be rejected")
+
+	//journal with new types is replayed after restart
+	auth = setupTestZoneWithFile(file)
+	zoneData, _ := auth.GetZone(view.DefaultView, g53.NameFromStringUnsafe("example.com."))
+	result := zoneData.Find(g53.NameFromStringUnsafe("svc.example.com."), rdata.RR_HTTPS, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+	ut.Equal(t, result.RRset.Rdatas[0].String(), "1 . alpn=\"h2\"")
+}
+
+func TestAuthZoneRollback(t *testing.T) {
+	auth := setupTestZone()
+	for _, ip := range []string{"1.2.3.4", "5.6.7.8"} {
+		rrs := AuthRRs{&AuthRR{view.DefaultView, "example.com.", "aa.example.com.", "3600", "A", ip}}
+		_, err := auth.HandleCmd(&AddAuthRrs{Rrs: rrs})
+		ut.Equal(t, err, (*httpcmd.Error)(nil))
+	}
+
+	versions, err := auth.HandleCmd(&GetAuthZoneVersions{View: view.DefaultView, Name: "example.com."})
+	ut.Equal(t, err, (*httpcmd.Error)(nil))
+	ut.Equal(t, versions, []uint32{1, 2, 3})
+
+	change, err := auth.HandleCmd(&DiffAuthZoneVersions{View: view.DefaultView, Name: "example.com.", From: 1, To: 3})
+	ut.Equal(t, err, (*httpcmd.Error)(nil))
+	ut.Equal(t, change.(*ZoneChange).Added, []string{"aa.example.com.\t3600\tIN\tA\t1.2.3.4", "aa.example.com.\t3600\tIN\tA\t5.6.7.8"})
+	_, err = auth.HandleCmd(&DiffAuthZoneVersions{View: view.DefaultView, Name: "example.com.", From: 0, To: 3})
+	ut.Equal(t, err.Code, ErrUnknownZoneVersion.Code)
+
+	_, err = auth.HandleCmd(&RollbackAuthZone{View: view.DefaultView, Name: "example.com.", Serial: 2})
+	ut.Equal(t, err, (*httpcmd.Error)(nil))
+	zoneData, _ := auth.GetZone(view.DefaultView, g53.NameFromStringUnsafe("example.com."))
+	result := zoneData.Find(g53.NameFromStringUnsafe("aa.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.RRset.RRCount(), 1)
+	ut.Equal(t, result.RRset.Rdatas[0].String(), "1.2.3.4")
+	ut.Equal(t, zoneData.Versions(), []uint32{1, 2, 3, 4})
+
+	_, err = auth.HandleCmd(&RollbackAuthZone{View: view.DefaultView, Name: "example.com.", Serial: 9})
+	ut.Equal(t, err.Code, ErrUnknownZoneVersion.Code)
+}
+
+func TestLoadSecondaryZoneFromBackup(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	origin := g53.NameFromStringUnsafe("example.com.")
+	conf := config.AuthZoneConf{
+		Name:    "example.com.",
+		File:    copyTestZoneFile("testdata/example.com"),
+		Masters: []string{"127.0.0.1:1"},
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(conf.File, modTime, modTime)
+
+	zoneData := loadSecondaryZone(origin, view.DefaultView, conf, nil)
+	result := zoneData.Find(g53.NameFromStringUnsafe("a.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+	ut.Equal(t, zoneData.IsMaster(), false)
+	ut.Equal(t, zoneData.LastRefresh().Equal(modTime), true)
+
+	//backup older than expire interval is discarded
+	modTime = time.Now().Add(-1209601 * time.Second)
+	os.Chtimes(conf.File, modTime, modTime)
+	zoneData = loadSecondaryZone(origin, view.DefaultView, conf, nil)
+	result = zoneData.Find(g53.NameFromStringUnsafe("a.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRServFail)
+	ut.Equal(t, zoneData.LastRefresh().IsZero(), true)
+
+	conf.File = filepath.Join(testDir, "nonexist")
+	zoneData = loadSecondaryZone(origin, view.DefaultView, conf, nil)
+	result = zoneData.Find(g53.NameFromStringUnsafe("a.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRServFail)
+}
+
+func TestLoadZoneSkipInvalidRR(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	zoneData := loadZone(g53.NameFromStringUnsafe("example.com."), `$TTL 3600
+@ SOA ns1 root 10 7200 3600 1209600 3600
+@ NS ns1
+ns1 A 10.0.0.1
+bad A 10.0.0.256
+www A 10.0.0.2
+`)
+	result := zoneData.Find(g53.NameFromStringUnsafe("www.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+	result = zoneData.Find(g53.NameFromStringUnsafe("bad.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRNXDomain)
+}
+
+func writeTestKey(dir string, ksk bool) string {
+	key, err := dnssec.GenerateKey(g53.NameFromStringUnsafe("example.com."), dnssec.AlgorithmED25519, ksk)
+	if err != nil {
+		panic("generate key failed:" + err.Error())
+	}
+	path := filepath.Join(dir, fmt.Sprintf("Kexample.com.+015+%05d", key.Tag))
+	ioutil.WriteFile(path+".key", []byte("example.com. IN DNSKEY "+key.DNSKEY.String()+"\n"), 0644)
+	ioutil.WriteFile(path+".private", []byte(key.PrivateKeyString()), 0600)
+	return path
+}
+
+func sectionTypes(rrsets []*g53.RRset) []g53.RRType {
+	var types []g53.RRType
+	for _, rrset := range rrsets {
+		types = append(types, rrset.Type)
+	}
+	return types
+}
+
+func TestAuthDNSSEC(t *testing.T) {
+	file := copyTestZoneFile("testdata/example.com")
+	dir := filepath.Dir(file)
+	logger.UseDefaultLogger("error")
+	view.InitViews(view.DefaultView)
+	auth := NewAuth(&config.VanguardConf{
+		Auth: []config.AuthZoneInView{
+			config.AuthZoneInView{
+				View: "default",
+				Zones: []config.AuthZoneConf{
+					config.AuthZoneConf{
+						Name: "example.com.",
+						File: file,
+						DNSSEC: config.DNSSECConf{
+							Keys: []string{writeTestKey(dir, true), writeTestKey(dir, false)},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	query := func(name string, typ g53.RRType, do bool) *g53.Message {
+		request := g53.MakeQuery(g53.NameFromStringUnsafe(name), typ, 4096, do)
+		zoneData, matchType := auth.GetZone(view.DefaultView, request.Question.Name)
+		q := NewQuery(matchType, request, zoneData)
+		q.Process()
+		return q.GetResponse()
+	}
+
+	response := query("a.example.com.", g53.RR_A, true)
+	ut.Equal(t, sectionTypes(response.GetSection(g53.AnswerSection)), []g53.RRType{g53.RR_A, g53.RR_RRSIG})
+	response = query("a.example.com.", g53.RR_A, false)
+	ut.Equal(t, sectionTypes(response.GetSection(g53.AnswerSection)), []g53.RRType{g53.RR_A})
+
+	response = query("example.com.", g53.RR_DNSKEY, true)
+	ut.Equal(t, sectionTypes(response.GetSection(g53.AnswerSection)), []g53.RRType{g53.RR_DNSKEY, g53.RR_RRSIG})
+	ut.Equal(t, len(response.GetSection(g53.AnswerSection)[0].Rdatas), 2)
+
+	response = query("b.example.com.", g53.RR_A, true)
+	ut.Equal(t, response.Header.Rcode, g53.R_NXDOMAIN)
+	ut.Equal(t, sectionTypes(response.GetSection(g53.AuthSection)),
+		[]g53.RRType{g53.RR_SOA, g53.RR_RRSIG, g53.RR_NSEC, g53.RR_RRSIG, g53.RR_NSEC, g53.RR_RRSIG})
+
+	//added rrs are signed once transaction is committed
+	rrs := AuthRRs{&AuthRR{"default", "example.com.", "b.example.com.", "3600", "A", "3.3.3.3"}}
+	ut.Equal(t, auth.addAuthRrs(rrs), (*httpcmd.Error)(nil))
+	response = query("b.example.com.", g53.RR_A, true)
+	ut.Equal(t, response.Header.Rcode, g53.R_NOERROR)
+	ut.Equal(t, sectionTypes(response.GetSection(g53.AnswerSection)), []g53.RRType{g53.RR_A, g53.RR_RRSIG})
+}
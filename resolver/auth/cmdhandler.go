@@ -2,11 +2,13 @@ package auth
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 
 	"github.com/zdnscloud/cement/domaintree"
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/httpcmd"
+	"github.com/zdnscloud/vanguard/rdata"
 	zn "github.com/zdnscloud/vanguard/resolver/auth/zone"
 )
 
@@ -103,6 +105,60 @@ func (z *UpdateAuthRrs) String() string {
 		", rrs for add:\n" + stringFromRRs(z.NewRrs) + "}"
 }
 
+type GetAuthZoneHistory struct {
+	View string `json:"view"`
+	Name string `json:"name"`
+}
+
+func (z *GetAuthZoneHistory) String() string {
+	return "name: get authzone history and params: {zone:" + z.Name +
+		", view:" + z.View + "}"
+}
+
+// one change in zone history, rrs are in master file format
+type ZoneChange struct {
+	OldSerial uint32   `json:"old_serial"`
+	NewSerial uint32   `json:"new_serial"`
+	Deleted   []string `json:"deleted"`
+	Added     []string `json:"added"`
+}
+
+type GetAuthZoneVersions struct {
+	View string `json:"view"`
+	Name string `json:"name"`
+}
+
+func (z *GetAuthZoneVersions) String() string {
+	return "name: get authzone versions and params: {zone:" + z.Name +
+		", view:" + z.View + "}"
+}
+
+type DiffAuthZoneVersions struct {
+	View string `json:"view"`
+	Name string `json:"name"`
+	From uint32 `json:"from"`
+	To   uint32 `json:"to"`
+}
+
+func (z *DiffAuthZoneVersions) String() string {
+	return "name: diff authzone versions and params: {zone:" + z.Name +
+		", view:" + z.View +
+		", from:" + strconv.FormatUint(uint64(z.From), 10) +
+		", to:" + strconv.FormatUint(uint64(z.To), 10) + "}"
+}
+
+type RollbackAuthZone struct {
+	View   string `json:"view"`
+	Name   string `json:"name"`
+	Serial uint32 `json:"serial"`
+}
+
+func (z *RollbackAuthZone) String() string {
+	return "name: rollback authzone and params: {zone:" + z.Name +
+		", view:" + z.View +
+		", serial:" + strconv.FormatUint(uint64(z.Serial), 10) + "}"
+}
+
 func (z *AuthDataSource) HandleCmd(cmd httpcmd.Command) (interface{}, *httpcmd.Error) {
 	switch c := cmd.(type) {
 	case *AddAuthZone:
@@ -117,6 +173,14 @@ func (z *AuthDataSource) HandleCmd(cmd httpcmd.Command) (interface{}, *httpcmd.E
 		return nil, z.deleteAuthRrs(c.Rrs)
 	case *UpdateAuthRrs:
 		return nil, z.updateAuthRrs(c.OldRrs, c.NewRrs)
+	case *GetAuthZoneHistory:
+		return z.getAuthZoneHistory(c.View, c.Name)
+	case *GetAuthZoneVersions:
+		return z.getAuthZoneVersions(c.View, c.Name)
+	case *DiffAuthZoneVersions:
+		return z.diffAuthZoneVersions(c.View, c.Name, c.From, c.To)
+	case *RollbackAuthZone:
+		return nil, z.rollbackAuthZone(c.View, c.Name, c.Serial)
 	default:
 		panic("should not be here")
 	}
@@ -192,7 +256,7 @@ func (z *AuthDataSource) addAuthRrs(rrs AuthRRs) *httpcmd.Error {
 		newRRsets = append(newRRsets, rrset)
 	}
 
-	if err := z.handleDynamicRRsets(targetView, targetZone, nil, newRRsets); err != nil {
+	if err := z.handleDynamicRRsets(targetView, targetZone, nil, nil, newRRsets); err != nil {
 		return ErrZoneUpdateFailed.AddDetail(err.Error())
 	} else {
 		return nil
@@ -226,7 +290,7 @@ func (z *AuthDataSource) deleteAuthRrs(rrs AuthRRs) *httpcmd.Error {
 		rrsetsToRemove = append(rrsetsToRemove, rrset)
 	}
 
-	if err := z.handleDynamicRRsets(targetView, targetZone, nil, rrsetsToRemove); err != nil {
+	if err := z.handleDynamicRRsets(targetView, targetZone, nil, nil, rrsetsToRemove); err != nil {
 		return ErrZoneUpdateFailed.AddDetail(err.Error())
 	}
 
@@ -243,6 +307,92 @@ func (z *AuthDataSource) updateAuthRrs(oldRrs, newRrs AuthRRs) *httpcmd.Error {
 	return z.addAuthRrs(newRrs)
 }
 
+func (z *AuthDataSource) getAuthZoneHistory(view, name string) ([]*ZoneChange, *httpcmd.Error) {
+	zoneData, err := z.getExactZone(view, name)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := zoneData.History()
+	changes := make([]*ZoneChange, 0, len(diffs))
+	for _, diff := range diffs {
+		changes = append(changes, zoneChangeFromDiff(diff))
+	}
+	return changes, nil
+}
+
+func (z *AuthDataSource) getAuthZoneVersions(view, name string) ([]uint32, *httpcmd.Error) {
+	zoneData, err := z.getExactZone(view, name)
+	if err != nil {
+		return nil, err
+	}
+	return zoneData.Versions(), nil
+}
+
+func (z *AuthDataSource) diffAuthZoneVersions(view, name string, from, to uint32) (*ZoneChange, *httpcmd.Error) {
+	zoneData, err := z.getExactZone(view, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if diff, err := zoneData.DiffVersions(from, to); err != nil {
+		return nil, ErrUnknownZoneVersion.AddDetail(err.Error())
+	} else {
+		return zoneChangeFromDiff(diff), nil
+	}
+}
+
+// rollback is a change of zone, so secondaries are notified
+func (z *AuthDataSource) rollbackAuthZone(view, name string, serial uint32) *httpcmd.Error {
+	zoneData, err := z.getExactZone(view, name)
+	if err != nil {
+		return err
+	}
+
+	if zoneData.IsMaster() == false {
+		return ErrUpdateSlaveZone
+	}
+
+	if err := zoneData.Rollback(serial); err == zn.ErrUnknownVersion {
+		return ErrUnknownZoneVersion.AddDetail(strconv.FormatUint(uint64(serial), 10))
+	} else if err != nil {
+		return ErrRollbackZoneFailed.AddDetail(err.Error())
+	}
+
+	z.NotifyZone(view, zoneData)
+	return nil
+}
+
+func (z *AuthDataSource) getExactZone(view, name string) (zn.Zone, *httpcmd.Error) {
+	origin, err := g53.NameFromString(name)
+	if err != nil {
+		return nil, ErrInvalidZoneName.AddDetail(err.Error())
+	}
+
+	zoneData, result := z.GetZone(view, origin)
+	if result != domaintree.ExactMatch {
+		return nil, ErrGetZoneFail
+	}
+	return zoneData, nil
+}
+
+func zoneChangeFromDiff(diff *zn.ZoneDiff) *ZoneChange {
+	return &ZoneChange{
+		OldSerial: diff.OldSOA.Rdatas[0].(*g53.SOA).Serial,
+		NewSerial: diff.NewSOA.Rdatas[0].(*g53.SOA).Serial,
+		Deleted:   stringsFromRRsets(diff.Deleted),
+		Added:     stringsFromRRsets(diff.Added),
+	}
+}
+
+func stringsFromRRsets(rrsets []*g53.RRset) []string {
+	rrs := []string{}
+	for _, rrset := range rrsets {
+		rrs = append(rrs, strings.Split(strings.TrimSpace(rdata.RRsetString(rrset)), "\n")...)
+	}
+	return rrs
+}
+
 func genBasicZoneContent(origin string) string {
 	var buf bytes.Buffer
 	buf.WriteString(origin)
@@ -284,7 +434,7 @@ func (z *AuthDataSource) loadZoneData(origin *g53.Name, viewName, content string
 	return err
 }
 
-func newRRset(name, ttl, typ, rdata string, class g53.RRClass) (*g53.RRset, error) {
+func newRRset(name, ttl, typ, rd string, class g53.RRClass) (*g53.RRset, error) {
 	rrName, err := g53.NameFromString(name)
 	if err != nil {
 		return nil, err
@@ -300,12 +450,12 @@ func newRRset(name, ttl, typ, rdata string, class g53.RRClass) (*g53.RRset, erro
 		}
 	}
 
-	rrType, err := g53.TypeFromString(typ)
+	rrType, err := rdata.TypeFromString(typ)
 	if err != nil {
 		return nil, err
 	}
 
-	rrData, err := g53.RdataFromString(rrType, rdata)
+	rrData, err := rdata.FromString(rrType, rd)
 	if err != nil {
 		return nil, err
 	}
@@ -33,4 +33,6 @@ var (
 	ErrInvalidRR           = httpcmd.NewError(httpcmd.AuthErrCodeStart+25, "rr data isn't valid")
 	ErrDeleteZoneFailed    = httpcmd.NewError(httpcmd.AuthErrCodeStart+26, "delete auth zone failed")
 	ErrUpdateZoneFailed    = httpcmd.NewError(httpcmd.AuthErrCodeStart+27, "update auth zone failed")
+	ErrUnknownZoneVersion  = httpcmd.NewError(httpcmd.AuthErrCodeStart+28, "zone version isn't kept")
+	ErrRollbackZoneFailed  = httpcmd.NewError(httpcmd.AuthErrCodeStart+29, "rollback auth zone failed")
 )
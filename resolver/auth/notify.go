@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+	"github.com/zdnscloud/vanguard/util"
+)
+
+const (
+	notifyTimeout       = 2 * time.Second
+	notifyRetryInterval = 5 * time.Second
+	notifyMaxRetry      = 5
+	notifyResolveTime   = 3 * time.Second
+	defaultDNSPort      = "53"
+)
+
+type notifyKey struct {
+	view   string
+	zone   string
+	target string
+}
+
+// Notifier sends notify to secondaries, RFC 1996, retry interval is
+// doubled after each timeout, and retry is stopped once a newer serial is
+// notified to the same target
+type Notifier struct {
+	timeout       time.Duration
+	retryInterval time.Duration
+	maxRetry      int
+
+	lock         sync.Mutex
+	serials      map[notifyKey]uint32
+	capabilities *util.ServerCapabilities
+}
+
+func newNotifier() *Notifier {
+	return &Notifier{
+		timeout:       notifyTimeout,
+		retryInterval: notifyRetryInterval,
+		maxRetry:      notifyMaxRetry,
+		serials:       make(map[notifyKey]uint32),
+		capabilities:  util.NewServerCapabilities(),
+	}
+}
+
+func (n *Notifier) Notify(view string, z zone.Zone) {
+	result := z.Find(z.GetOrigin(), g53.RR_SOA, zone.DefaultFind).GetResult()
+	if result.Type != zone.FRSuccess {
+		return
+	}
+
+	soa := result.RRset
+	go func() {
+		for _, target := range notifyTargets(z, soa) {
+			key := notifyKey{
+				view:   view,
+				zone:   z.GetOrigin().String(false),
+				target: target,
+			}
+			if n.addNotify(key, soa) {
+				go n.sendNotify(key, soa)
+			}
+		}
+	}()
+}
+
+func (n *Notifier) addNotify(key notifyKey, soa *g53.RRset) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	serial := soa.Rdatas[0].(*g53.SOA).Serial
+	if old, ok := n.serials[key]; ok && g53.CompareSerial(old, serial) >= 0 {
+		return false
+	}
+	n.serials[key] = serial
+	return true
+}
+
+func (n *Notifier) isObsoleted(key notifyKey, serial uint32) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	current, ok := n.serials[key]
+	return ok == false || current != serial
+}
+
+func (n *Notifier) finishNotify(key notifyKey, serial uint32) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if current, ok := n.serials[key]; ok && current == serial {
+		delete(n.serials, key)
+	}
+}
+
+func (n *Notifier) sendNotify(key notifyKey, soa *g53.RRset) {
+	serial := soa.Rdatas[0].(*g53.SOA).Serial
+	defer n.finishNotify(key, serial)
+
+	sender, err := util.NewSafeUDPSender("", n.timeout)
+	if err != nil {
+		logger.GetLogger().Error("create notify sender failed:%s", err.Error())
+		return
+	}
+
+	interval := n.retryInterval
+	for i := 0; i <= n.maxRetry; i++ {
+		if n.isObsoleted(key, serial) {
+			return
+		}
+
+		resp, _, err := sender.QueryServer(key.target, makeNotify(soa), n.capabilities.Get(key.target))
+		if err == nil {
+			if resp.Header.Rcode != g53.R_NOERROR {
+				logger.GetLogger().Warn("notify zone %s in view %s with serial %d to %s get rcode %s",
+					key.zone, key.view, serial, key.target, resp.Header.Rcode.String())
+			} else {
+				logger.GetLogger().Info("notify zone %s in view %s with serial %d to %s succeed",
+					key.zone, key.view, serial, key.target)
+			}
+			return
+		}
+
+		if i < n.maxRetry {
+			time.Sleep(interval)
+			interval *= 2
+		}
+	}
+
+	logger.GetLogger().Error("notify zone %s in view %s with serial %d to %s timeout",
+		key.zone, key.view, serial, key.target)
+}
+
+func makeNotify(soa *g53.RRset) *g53.Message {
+	notify := g53.MakeQuery(soa.Name, g53.RR_SOA, 512, false)
+	notify.Header.Opcode = g53.OP_NOTIFY
+	notify.Header.SetFlag(g53.FLAG_AA, true)
+	notify.Edns = nil
+	notify.AddRRset(g53.AnswerSection, soa)
+	notify.RecalculateSectionRRCount()
+	return notify
+}
+
+// also notify addresses and the name servers of the zone except the
+// primary master in soa, RFC 1996 3.6
+func notifyTargets(z zone.Zone, soa *g53.RRset) []string {
+	mode, alsoNotify := z.Notify()
+	if mode == zone.NotifyNo {
+		return nil
+	}
+
+	var targets []string
+	for _, addr := range alsoNotify {
+		targets = appendTarget(targets, addr)
+	}
+	if mode == zone.NotifyExplicit {
+		return targets
+	}
+
+	result := z.Find(z.GetOrigin(), g53.RR_NS, zone.DefaultFind).GetResult()
+	if result.Type != zone.FRSuccess {
+		return targets
+	}
+
+	mname := soa.Rdatas[0].(*g53.SOA).MName
+	for _, rdata := range result.RRset.Rdatas {
+		name := rdata.(*g53.NS).Name
+		if name.Equals(mname) {
+			continue
+		}
+
+		for _, ip := range nameServerAddrs(z, name) {
+			targets = appendTarget(targets, ip.String())
+		}
+	}
+	return targets
+}
+
+func appendTarget(targets []string, addr string) []string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), defaultDNSPort)
+	}
+
+	for _, target := range targets {
+		if target == addr {
+			return targets
+		}
+	}
+	return append(targets, addr)
+}
+
+func nameServerAddrs(z zone.Zone, name *g53.Name) []net.IP {
+	if name.IsSubDomain(z.GetOrigin()) {
+		var ips []net.IP
+		for _, typ := range []g53.RRType{g53.RR_A, g53.RR_AAAA} {
+			result := z.Find(name, typ, zone.GlueOkFind).GetResult()
+			if result.Type != zone.FRSuccess {
+				continue
+			}
+
+			for _, rdata := range result.RRset.Rdatas {
+				if a, ok := rdata.(*g53.A); ok {
+					ips = append(ips, a.Host)
+				} else {
+					ips = append(ips, rdata.(*g53.AAAA).Host)
+				}
+			}
+		}
+		return ips
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyResolveTime)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, name.String(true))
+	if err != nil {
+		logger.GetLogger().Warn("resolve name server %s failed:%s", name.String(false), err.Error())
+		return nil
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips
+}
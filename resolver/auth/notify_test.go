@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+const notifyTestZone = `example.com. 3600 IN SOA ns1.example.com. root.example.com. 10 7200 3600 1209600 3600
+example.com. 3600 IN NS ns1.example.com.
+example.com. 3600 IN NS ns2.example.com.
+ns1.example.com. 3600 IN A 10.0.0.1
+ns2.example.com. 3600 IN A 10.0.0.2
+`
+
+func TestNotifyTargets(t *testing.T) {
+	z := loadZone(g53.NameFromStringUnsafe("example.com."), notifyTestZone)
+	soa := z.Find(z.GetOrigin(), g53.RR_SOA, zone.DefaultFind).GetResult().RRset
+
+	z.SetNotify(zone.NotifyYes, []string{"10.0.0.3", "10.0.0.4:5353", "10.0.0.2"})
+	ut.Equal(t, notifyTargets(z, soa), []string{"10.0.0.3:53", "10.0.0.4:5353", "10.0.0.2:53"})
+
+	z.SetNotify(zone.NotifyExplicit, []string{"10.0.0.3"})
+	ut.Equal(t, notifyTargets(z, soa), []string{"10.0.0.3:53"})
+
+	z.SetNotify(zone.NotifyNo, []string{"10.0.0.3"})
+	ut.Equal(t, len(notifyTargets(z, soa)), 0)
+}
+
+type notifyReceiver struct {
+	conn    *net.UDPConn
+	lock    sync.Mutex
+	serials []uint32
+}
+
+// the first notify is dropped to make notifier retry
+func (r *notifyReceiver) run() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		notify, err := g53.MessageFromWire(util.NewInputBuffer(buf[:n]))
+		if err != nil || notify.Header.Opcode != g53.OP_NOTIFY ||
+			notify.Header.GetFlag(g53.FLAG_AA) == false {
+			continue
+		}
+
+		r.lock.Lock()
+		r.serials = append(r.serials, notify.Sections[g53.AnswerSection][0].Rdatas[0].(*g53.SOA).Serial)
+		received := len(r.serials)
+		r.lock.Unlock()
+		if received == 1 {
+			continue
+		}
+
+		render := g53.NewMsgRender()
+		notify.MakeResponse().Rend(render)
+		r.conn.WriteToUDP(render.Data(), addr)
+	}
+}
+
+func (r *notifyReceiver) receivedSerials() []uint32 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]uint32(nil), r.serials...)
+}
+
+func TestNotifyRetry(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	ut.Assert(t, err == nil, "listen udp shouldn't fail")
+	defer conn.Close()
+	receiver := &notifyReceiver{conn: conn}
+	go receiver.run()
+
+	z := loadZone(g53.NameFromStringUnsafe("example.com."), notifyTestZone)
+	z.SetNotify(zone.NotifyExplicit, []string{conn.LocalAddr().String()})
+
+	n := newNotifier()
+	n.timeout = 100 * time.Millisecond
+	n.retryInterval = 10 * time.Millisecond
+	n.Notify("default", z)
+
+	for i := 0; i < 100 && len(receiver.receivedSerials()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ut.Equal(t, receiver.receivedSerials(), []uint32{10, 10})
+
+	key := notifyKey{view: "default", zone: "example.com.", target: conn.LocalAddr().String()}
+	for i := 0; i < 100 && n.isObsoleted(key, 10) == false; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ut.Equal(t, n.isObsoleted(key, 10), true)
+
+	soa, _ := g53.RRsetFromString("example.com. 3600 IN SOA ns1.example.com. root.example.com. 11 7200 3600 1209600 3600")
+	ut.Equal(t, n.addNotify(key, soa), true)
+	ut.Equal(t, n.isObsoleted(key, 10), true)
+	ut.Equal(t, n.addNotify(key, soa), false)
+}
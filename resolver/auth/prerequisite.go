@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+	view "github.com/zdnscloud/vanguard/viewselector"
+)
+
+var (
+	errUpdateFormat   = errors.New("update message format is invalid")
+	errNameNotInUse   = errors.New("prerequisite name isn't in use")
+	errNameInUse      = errors.New("prerequisite name is in use")
+	errRRsetNotExists = errors.New("prerequisite rrset doesn't exist")
+	errRRsetExists    = errors.New("prerequisite rrset exists")
+)
+
+// zone section should has exactly one soa question with class in,
+// RFC 2136 3.1
+func validateZoneSection(request *g53.Message) error {
+	question := request.Question
+	if question == nil || question.Type != g53.RR_SOA {
+		return errUpdateFormat
+	}
+
+	if question.Class != g53.CLASS_IN {
+		return view.ErrNoAuthUpdate
+	}
+
+	return nil
+}
+
+// prerequisites are checked against the zone data in the transaction, so
+// no other update could be applied between the check and the update,
+// RFC 2136 3.2
+func checkPrerequisites(updator zone.ZoneUpdator, tx zone.Transaction, origin *g53.Name, prereqs []*g53.RRset) error {
+	var valueDependent []*g53.RRset
+	for _, prereq := range prereqs {
+		if prereq.Ttl != 0 {
+			return errUpdateFormat
+		}
+
+		if prereq.Name.IsSubDomain(origin) == false {
+			return zone.ErrOutOfZone
+		}
+
+		switch prereq.Class {
+		case g53.CLASS_ANY:
+			if len(prereq.Rdatas) != 0 {
+				return errUpdateFormat
+			}
+
+			rrsets := updator.GetRRsets(tx, prereq.Name)
+			if prereq.Type == g53.RR_ANY {
+				if len(rrsets) == 0 {
+					return errNameNotInUse
+				}
+			} else if findRRset(rrsets, prereq.Type) == nil {
+				return errRRsetNotExists
+			}
+		case g53.CLASS_NONE:
+			if len(prereq.Rdatas) != 0 {
+				return errUpdateFormat
+			}
+
+			rrsets := updator.GetRRsets(tx, prereq.Name)
+			if prereq.Type == g53.RR_ANY {
+				if len(rrsets) != 0 {
+					return errNameInUse
+				}
+			} else if findRRset(rrsets, prereq.Type) != nil {
+				return errRRsetExists
+			}
+		case g53.CLASS_IN:
+			valueDependent = mergeRRset(valueDependent, prereq)
+		default:
+			return errUpdateFormat
+		}
+	}
+
+	for _, expect := range valueDependent {
+		rrset := findRRset(updator.GetRRsets(tx, expect.Name), expect.Type)
+		if rrset == nil || isSameRdatas(rrset.Rdatas, expect.Rdatas) == false {
+			return errRRsetNotExists
+		}
+	}
+
+	return nil
+}
+
+// update section is checked before any modification, RFC 2136 3.4.1
+func prescanUpdateSection(origin *g53.Name, rrsets []*g53.RRset) error {
+	for _, rrset := range rrsets {
+		if rrset.Name.IsSubDomain(origin) == false {
+			return zone.ErrOutOfZone
+		}
+
+		switch rrset.Class {
+		case g53.CLASS_IN:
+			if isMetaType(rrset.Type) {
+				return errUpdateFormat
+			}
+		case g53.CLASS_ANY:
+			if rrset.Ttl != 0 || len(rrset.Rdatas) != 0 {
+				return errUpdateFormat
+			}
+			if rrset.Type != g53.RR_ANY && isMetaType(rrset.Type) {
+				return errUpdateFormat
+			}
+		case g53.CLASS_NONE:
+			if rrset.Ttl != 0 || isMetaType(rrset.Type) {
+				return errUpdateFormat
+			}
+		default:
+			return errUpdateFormat
+		}
+	}
+	return nil
+}
+
+func isMetaType(typ g53.RRType) bool {
+	switch typ {
+	case g53.RR_ANY, g53.RR_AXFR, g53.RR_IXFR, g53.RR_OPT, g53.RR_TSIG:
+		return true
+	default:
+		return false
+	}
+}
+
+func findRRset(rrsets []*g53.RRset, typ g53.RRType) *g53.RRset {
+	for _, rrset := range rrsets {
+		if rrset.Type == typ {
+			return rrset
+		}
+	}
+	return nil
+}
+
+// rrs with same name and type in prerequisite may not be adjacent
+func mergeRRset(rrsets []*g53.RRset, rrset *g53.RRset) []*g53.RRset {
+	for _, old := range rrsets {
+		if old.Name.Equals(rrset.Name) && old.Type == rrset.Type {
+			old.Rdatas = append(old.Rdatas, rrset.Rdatas...)
+			return rrsets
+		}
+	}
+	return append(rrsets, rrset.Clone())
+}
+
+func isSameRdatas(first, second []g53.Rdata) bool {
+	return len(rdatasNotIn(first, second)) == 0 && len(rdatasNotIn(second, first)) == 0
+}
+
+func rdatasNotIn(first, second []g53.Rdata) []g53.Rdata {
+	var left []g53.Rdata
+	for _, src := range first {
+		found := false
+		for _, target := range second {
+			if src.Compare(target) == 0 {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			left = append(left, src)
+		}
+	}
+	return left
+}
@@ -15,6 +15,7 @@ type Query struct {
 	answers     []*g53.RRset
 	additionals []*g53.RRset
 	authorities []*g53.RRset
+	dnssecOK    bool
 }
 
 func NewQuery(matchType domaintree.SearchResult, request *g53.Message, finder zone.Zone) *Query {
@@ -23,6 +24,7 @@ func NewQuery(matchType domaintree.SearchResult, request *g53.Message, finder zo
 		finder:    finder,
 		request:   request,
 		response:  request.MakeResponse(),
+		dnssecOK:  request.Edns != nil && request.Edns.DnssecAware,
 	}
 }
 
@@ -36,11 +38,13 @@ func (q *Query) Process() {
 	switch result.Type {
 	case zone.FRCname:
 		logger.GetLogger().Debug("auth find cname")
-		q.answers = append(q.answers, result.RRset)
+		q.answers = append(q.answers, q.withSignatures(ctx, result.RRset)...)
+		q.authorities = append(q.authorities, q.denial(ctx)...)
 	case zone.FRSuccess:
 		logger.GetLogger().Debug("auth find exact rrset")
-		q.answers = append(q.answers, result.RRset)
-		q.additionals = append(q.additionals, ctx.GetAdditional()...)
+		q.answers = append(q.answers, q.withSignatures(ctx, result.RRset)...)
+		q.authorities = append(q.authorities, q.denial(ctx)...)
+		q.additionals = append(q.additionals, q.withSignatures(ctx, ctx.GetAdditional()...)...)
 		if q.matchType != domaintree.ExactMatch || question.Type != g53.RR_NS {
 			q.addAuthAdditional()
 		}
@@ -48,14 +52,17 @@ func (q *Query) Process() {
 		logger.GetLogger().Debug("auth find delegation")
 		q.response.Header.SetFlag(g53.FLAG_AA, false)
 		q.authorities = append(q.authorities, result.RRset)
+		q.addDS(result.RRset.Name)
 		q.additionals = append(q.additionals, ctx.GetAdditional()...)
 	case zone.FRNXDomain:
 		logger.GetLogger().Debug("auth find no name")
 		q.response.Header.Rcode = g53.R_NXDOMAIN
 		q.addSOA()
+		q.authorities = append(q.authorities, q.denial(ctx)...)
 	case zone.FRNXRRset:
 		logger.GetLogger().Debug("auth find no rrset")
 		q.addSOA()
+		q.authorities = append(q.authorities, q.denial(ctx)...)
 	case zone.FRServFail:
 		logger.GetLogger().Debug("auth find empty zone")
 		q.response.Header.Rcode = g53.R_SERVFAIL
@@ -82,16 +89,55 @@ func (q *Query) addAuthAdditional() {
 	if result.Type != zone.FRSuccess {
 		panic("zone short of apex ns")
 	}
-	q.authorities = append(q.authorities, result.RRset)
-	q.additionals = append(q.additionals, ctx.GetAdditional()...)
+	q.authorities = append(q.authorities, q.withSignatures(ctx, result.RRset)...)
+	q.additionals = append(q.additionals, q.withSignatures(ctx, ctx.GetAdditional()...)...)
 }
 
 func (q *Query) addSOA() {
-	result := q.finder.Find(q.finder.GetOrigin(), g53.RR_SOA, zone.DefaultFind).GetResult()
+	ctx := q.finder.Find(q.finder.GetOrigin(), g53.RR_SOA, zone.DefaultFind)
+	result := ctx.GetResult()
 	if result.Type != zone.FRSuccess {
 		panic("zone short of soa")
 	}
-	q.authorities = append(q.authorities, result.RRset)
+	q.authorities = append(q.authorities, q.withSignatures(ctx, result.RRset)...)
+}
+
+// signed referral has ds of the child zone, or proof that there is no ds
+func (q *Query) addDS(name *g53.Name) {
+	if q.dnssecOK == false {
+		return
+	}
+
+	ctx := q.finder.Find(name, g53.RR_DS, zone.DefaultFind)
+	if result := ctx.GetResult(); result.Type == zone.FRSuccess {
+		q.authorities = append(q.authorities, q.withSignatures(ctx, result.RRset)...)
+	} else {
+		q.authorities = append(q.authorities, q.denial(ctx)...)
+	}
+}
+
+// rrsets are followed by their rrsigs if DO bit is set and zone is signed
+func (q *Query) withSignatures(ctx zone.FinderContext, rrsets ...*g53.RRset) []*g53.RRset {
+	signedCtx, ok := ctx.(zone.SignedFinderContext)
+	if q.dnssecOK == false || ok == false {
+		return rrsets
+	}
+
+	var result []*g53.RRset
+	for _, rrset := range rrsets {
+		result = append(result, rrset)
+		if sigs := signedCtx.GetSignatures(rrset); sigs != nil {
+			result = append(result, sigs)
+		}
+	}
+	return result
+}
+
+func (q *Query) denial(ctx zone.FinderContext) []*g53.RRset {
+	if signedCtx, ok := ctx.(zone.SignedFinderContext); ok && q.dnssecOK {
+		return signedCtx.GetDenial()
+	}
+	return nil
 }
 
 func (q *Query) GetResponse() *g53.Message {
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"net"
 
 	"github.com/zdnscloud/cement/domaintree"
@@ -11,26 +12,63 @@ import (
 	view "github.com/zdnscloud/vanguard/viewselector"
 )
 
+var errUpdateRefused = errors.New("update isn't allowed for client")
+
 func (ds *AuthDataSource) HandleUpdate(ctx *core.Context) {
+	client := &ctx.Client
+	if client.Response == nil {
+		client.Response = client.Request.MakeResponse()
+	}
+
 	if err := ds.handleUpdate(ctx); err != nil {
-		if err == zone.ErrServFail {
-			ctx.Client.Response.Header.Rcode = g53.R_SERVFAIL
-		} else {
-			ctx.Client.Response.Header.Rcode = g53.R_NOTAUTH
-		}
+		client.Response.Header.Rcode = updateErrorRcode(err)
 		logger.GetLogger().Error("Update failed: %s", err.Error())
 	}
 }
 
+func updateErrorRcode(err error) g53.Rcode {
+	switch err {
+	case errUpdateFormat:
+		return g53.R_FORMERR
+	case errNameNotInUse:
+		return g53.R_NXDOMAIN
+	case errNameInUse:
+		return g53.R_YXDOMAIN
+	case errRRsetNotExists:
+		return g53.R_NXRRSET
+	case errRRsetExists:
+		return g53.R_YXRRSET
+	case view.ErrNoAuthUpdate:
+		return g53.R_NOTAUTH
+	case zone.ErrServFail:
+		return g53.R_SERVFAIL
+	case zone.ErrOutOfZone:
+		return g53.R_NOTZONE
+	default:
+		return g53.R_REFUSED
+	}
+}
+
 func (ds *AuthDataSource) handleUpdate(ctx *core.Context) error {
 	client := &ctx.Client
+	request := client.Request
+	if err := validateZoneSection(request); err != nil {
+		return err
+	}
+
+	rrsets := request.GetSection(g53.AuthSection)
+	if err := prescanUpdateSection(request.Question.Name, rrsets); err != nil {
+		return err
+	}
+
 	return ds.handleDynamicRRsets(client.View,
-		client.Request.Question.Name,
+		request.Question.Name,
 		client.IP(),
-		client.Request.GetSection(g53.AuthSection))
+		request.GetSection(g53.AnswerSection),
+		rrsets)
 }
 
-func (ds *AuthDataSource) handleDynamicRRsets(viewName string, zoneName *g53.Name, clientIP net.IP, rrsets []*g53.RRset) error {
+func (ds *AuthDataSource) handleDynamicRRsets(viewName string, zoneName *g53.Name, clientIP net.IP, prereqs, rrsets []*g53.RRset) error {
 	updator, err := ds.getUpdator(viewName, zoneName, clientIP)
 	if err != nil {
 		return err
@@ -41,6 +79,11 @@ func (ds *AuthDataSource) handleDynamicRRsets(viewName string, zoneName *g53.Nam
 		return view.ErrNoAuthUpdate
 	}
 
+	if err := checkPrerequisites(updator, tx, zoneName, prereqs); err != nil {
+		tx.RollBack()
+		return err
+	}
+
 	explicitUpdateSOA := false
 	hasRRModified := false
 	for _, rrset := range rrsets {
@@ -76,7 +119,13 @@ func (ds *AuthDataSource) handleDynamicRRsets(viewName string, zoneName *g53.Nam
 		if explicitUpdateSOA == false {
 			updator.IncreaseSerialNumber(tx)
 		}
-		return tx.Commit()
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if z, result := ds.GetZone(viewName, zoneName); result == domaintree.ExactMatch {
+			ds.NotifyZone(viewName, z)
+		}
+		return nil
 	}
 }
 
@@ -89,6 +138,6 @@ func (ds *AuthDataSource) getUpdator(viewName string, origin *g53.Name, clientIP
 	if updator, ok := zone.GetUpdator(clientIP, false); ok {
 		return updator, nil
 	} else {
-		return nil, view.ErrNoAuthUpdate
+		return nil, errUpdateRefused
 	}
 }
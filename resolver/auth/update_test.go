@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"net"
+	"testing"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/acl"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/rdata"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+func makeUpdate(zoneName string, rrs ...string) *g53.Message {
+	msg := g53.MakeQuery(g53.NameFromStringUnsafe(zoneName), g53.RR_SOA, 512, false)
+	msg.Header.Opcode = g53.OP_UPDATE
+	msg.Edns = nil
+	for _, rr := range rrs {
+		rrset, _ := rdata.RRsetFromString(rr)
+		msg.AddRRset(g53.AuthSection, rrset)
+	}
+	return msg
+}
+
+func sendUpdate(auth *AuthDataSource, update *g53.Message) g53.Rcode {
+	ctx := core.NewContext()
+	ctx.Client.View = "default"
+	ctx.Client.Addr = &net.UDPAddr{IP: net.ParseIP("1.1.1.1"), Port: 5353}
+	ctx.Client.Request = update
+	auth.HandleUpdate(ctx)
+	return ctx.Client.Response.Header.Rcode
+}
+
+func TestHandleUpdate(t *testing.T) {
+	auth := setupTestZone()
+	origin := g53.NameFromStringUnsafe("example.com.")
+	zoneData, _ := auth.GetZone("default", origin)
+	name := g53.NameFromStringUnsafe("dhcp.example.com.")
+
+	update := makeUpdate("example.com.", "dhcp.example.com. 300 IN A 10.0.0.1")
+	ut.Equal(t, sendUpdate(auth, update), g53.R_REFUSED)
+	ut.Equal(t, zoneData.Find(name, g53.RR_A, zone.DefaultFind).GetResult().Type, zone.FRNXDomain)
+
+	ut.Equal(t, sendUpdate(auth, makeUpdate("example.org.", "dhcp.example.org. 300 IN A 10.0.0.1")), g53.R_NOTAUTH)
+
+	zoneData.SetAcls([]string{acl.AnyAcl})
+	ut.Equal(t, sendUpdate(auth, update), g53.R_NOERROR)
+	result := zoneData.Find(name, g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+	ut.Equal(t, result.RRset.Rdatas[0].String(), "10.0.0.1")
+
+	update = makeUpdate("example.com.", "dhcp.example.org. 300 IN A 10.0.0.1")
+	ut.Equal(t, sendUpdate(auth, update), g53.R_NOTZONE)
+
+	update = makeUpdate("example.com.")
+	update.Question = nil
+	ut.Equal(t, sendUpdate(auth, update), g53.R_FORMERR)
+}
+
+func TestUpdateModernTypes(t *testing.T) {
+	auth := setupTestZone()
+	zoneData, _ := auth.GetZone("default", g53.NameFromStringUnsafe("example.com."))
+	zoneData.SetAcls([]string{acl.AnyAcl})
+
+	//update is parsed from wire as server does
+	update := makeUpdate("example.com.",
+		"example.com. 300 IN CAA 0 issue \"ca.example.net\"",
+		"svc.example.com. 300 IN HTTPS 1 . alpn=\"h2\" port=8443",
+		"svc.example.com. 300 IN TYPE65534 \\# 2 0102")
+	update.RecalculateSectionRRCount()
+	render := g53.NewMsgRender()
+	update.Rend(render)
+	update, err := rdata.MessageFromWire(util.NewInputBuffer(render.Data()))
+	ut.Assert(t, err == nil, "parse update shouldn't fail")
+	ut.Equal(t, sendUpdate(auth, update), g53.R_NOERROR)
+
+	for _, c := range []struct {
+		name  string
+		typ   g53.RRType
+		rdata string
+	}{
+		{"example.com.", g53.RR_CAA, "0 issue \"ca.example.net\""},
+		{"svc.example.com.", rdata.RR_HTTPS, "1 . alpn=\"h2\" port=8443"},
+		{"svc.example.com.", g53.RRType(65534), "\\# 2 0102"},
+	} {
+		result := zoneData.Find(g53.NameFromStringUnsafe(c.name), c.typ, zone.DefaultFind).GetResult()
+		ut.Equal(t, result.Type, zone.FRSuccess)
+		ut.Equal(t, result.RRset.Rdatas[0].String(), c.rdata)
+	}
+
+	update = makeUpdate("example.com.", "example.com. 0 NONE CAA 0 issue \"ca.example.net\"")
+	ut.Equal(t, sendUpdate(auth, update), g53.R_NOERROR)
+	result := zoneData.Find(g53.NameFromStringUnsafe("example.com."), g53.RR_CAA, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRNXRRset)
+}
+
+func makePrereq(name string, typ g53.RRType, class g53.RRClass, rdatas ...string) *g53.RRset {
+	rrset := &g53.RRset{
+		Name:  g53.NameFromStringUnsafe(name),
+		Type:  typ,
+		Class: class,
+	}
+	for _, rdata := range rdatas {
+		rd, _ := g53.RdataFromString(typ, rdata)
+		rrset.Rdatas = append(rrset.Rdatas, rd)
+	}
+	return rrset
+}
+
+func TestUpdatePrerequisite(t *testing.T) {
+	auth := setupTestZone()
+	origin := g53.NameFromStringUnsafe("example.com.")
+	zoneData, _ := auth.GetZone("default", origin)
+	zoneData.SetAcls([]string{acl.AnyAcl})
+	name := g53.NameFromStringUnsafe("dhcp.example.com.")
+
+	add := "dhcp.example.com. 300 IN A 10.0.0.1"
+	cases := []struct {
+		prereq *g53.RRset
+		rcode  g53.Rcode
+	}{
+		{makePrereq("dhcp.example.com.", g53.RR_ANY, g53.CLASS_ANY), g53.R_NXDOMAIN},
+		{makePrereq("dhcp.example.com.", g53.RR_A, g53.CLASS_ANY), g53.R_NXRRSET},
+		{makePrereq("dhcp.example.com.", g53.RR_A, g53.CLASS_IN, "10.0.0.1"), g53.R_NXRRSET},
+		{makePrereq("dhcp.example.org.", g53.RR_ANY, g53.CLASS_NONE), g53.R_NOTZONE},
+		{makePrereq("dhcp.example.com.", g53.RR_A, g53.CLASS_NONE, "10.0.0.1"), g53.R_FORMERR},
+		{makePrereq("dhcp.example.com.", g53.RR_ANY, g53.CLASS_NONE), g53.R_NOERROR},
+		{makePrereq("dhcp.example.com.", g53.RR_ANY, g53.CLASS_NONE), g53.R_YXDOMAIN},
+		{makePrereq("dhcp.example.com.", g53.RR_A, g53.CLASS_NONE), g53.R_YXRRSET},
+		{makePrereq("dhcp.example.com.", g53.RR_TXT, g53.CLASS_ANY), g53.R_NXRRSET},
+		{makePrereq("dhcp.example.com.", g53.RR_A, g53.CLASS_IN, "10.0.0.2"), g53.R_NXRRSET},
+	}
+
+	for _, c := range cases {
+		update := makeUpdate("example.com.", add)
+		update.AddRRset(g53.AnswerSection, c.prereq)
+		ut.Equal(t, sendUpdate(auth, update), c.rcode)
+	}
+
+	result := zoneData.Find(name, g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+	ut.Equal(t, len(result.RRset.Rdatas), 1)
+
+	update := makeUpdate("example.com.", "dhcp.example.com. 300 IN A 10.0.0.2")
+	update.AddRRset(g53.AnswerSection, makePrereq("dhcp.example.com.", g53.RR_A, g53.CLASS_IN, "10.0.0.1"))
+	update.AddRRset(g53.AnswerSection, makePrereq("dhcp.example.com.", g53.RR_ANY, g53.CLASS_ANY))
+	update.AddRRset(g53.AnswerSection, makePrereq("dhcp.example.com.", g53.RR_A, g53.CLASS_IN, "10.0.0.1"))
+	ut.Equal(t, sendUpdate(auth, update), g53.R_NOERROR)
+	result = zoneData.Find(name, g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, len(result.RRset.Rdatas), 2)
+
+	update = makeUpdate("example.com.")
+	update.Question.Type = g53.RR_A
+	ut.Equal(t, sendUpdate(auth, update), g53.R_FORMERR)
+}
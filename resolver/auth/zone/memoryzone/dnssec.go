@@ -0,0 +1,526 @@
+package memoryzone
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/domaintree"
+	"github.com/zdnscloud/vanguard/dnssec"
+	rd "github.com/zdnscloud/vanguard/rdata"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+// signature is valid from a while before signing to tolerate clock skew
+const signInceptionOffset = time.Hour
+
+type rrsetKey struct {
+	name string
+	typ  g53.RRType
+}
+
+func newRRsetKey(name *g53.Name, typ g53.RRType) rrsetKey {
+	return rrsetKey{strings.ToLower(name.String(false)), typ}
+}
+
+type signedRRset struct {
+	rrset *g53.RRset
+	sigs  *g53.RRset
+}
+
+// dnssec records generated for signed zone, they are kept out of zone data,
+// so they aren't saved into zone file or journal
+type signatures struct {
+	policy     *zone.SignPolicy
+	dnskey     *g53.RRset
+	nsec3param *g53.RRset
+	signed     map[rrsetKey]*signedRRset
+	//authoritative names in canonical order
+	names []*g53.Name
+	//nsec or nsec3 rrsets in canonical order of owner names, hashes of
+	//nsec3 owners are in the same order
+	chain     []*g53.RRset
+	hashes    [][]byte
+	refreshAt time.Time
+}
+
+// names in zone which have authoritative data or are delegation points
+type zoneName struct {
+	name  *g53.Name
+	node  NameNode
+	isCut bool
+}
+
+// records generated by signer aren't taken from zone data
+func isDNSSECType(typ g53.RRType) bool {
+	return typ == g53.RR_RRSIG || typ == g53.RR_NSEC || typ == g53.RR_NSEC3 || typ == g53.RR_NSEC3PARAM
+}
+
+// signatures of rrsets which aren't changed and won't expire soon are taken
+// from the old ones
+func signZone(z *MemoryZone, policy *zone.SignPolicy, old *signatures, now time.Time) (*signatures, error) {
+	soa := z.getSOA()
+	if soa == nil {
+		return nil, zone.ErrShortOfSOA
+	}
+	if old != nil && old.policy != policy {
+		old = nil
+	}
+
+	s := &signatures{
+		policy: policy,
+		signed: make(map[rrsetKey]*signedRRset),
+	}
+	s.dnskey = z.dnskeyRRset(policy, soa)
+	if policy.NSEC3 {
+		s.nsec3param = &g53.RRset{
+			Name:  z.origin,
+			Type:  g53.RR_NSEC3PARAM,
+			Class: soa.Class,
+			Rdatas: []g53.Rdata{&rd.NSEC3PARAM{
+				Algorithm:  rd.NSEC3SHA1,
+				Iterations: policy.Iterations,
+				Salt:       policy.Salt,
+			}},
+		}
+	}
+
+	names := z.authoritativeNames()
+	for _, n := range names {
+		s.names = append(s.names, n.name)
+	}
+	//RFC 9077, ttl of nsec is the smaller one of soa ttl and minimum
+	ttl := soa.Ttl
+	if minimum := g53.RRTTL(soa.Rdatas[0].(*g53.SOA).Minimum); minimum < ttl {
+		ttl = minimum
+	}
+	if policy.NSEC3 {
+		s.buildNSEC3Chain(names, z.origin, soa.Class, ttl)
+	} else {
+		s.buildNSECChain(names, z.origin, soa.Class, ttl)
+	}
+
+	rrsets := []*g53.RRset{s.dnskey}
+	if s.nsec3param != nil {
+		rrsets = append(rrsets, s.nsec3param)
+	}
+	for _, n := range names {
+		for typ, rrset := range n.node {
+			if isDNSSECType(typ) || (n.isCut && typ != g53.RR_DS) || (typ == g53.RR_DNSKEY && n.name.Equals(z.origin)) {
+				continue
+			}
+			rrsets = append(rrsets, rrset)
+		}
+	}
+	rrsets = append(rrsets, s.chain...)
+
+	for _, rrset := range rrsets {
+		if err := s.sign(rrset, old, now); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// keys in policy and dnskeys added into zone, which could be keys to be
+// rolled over
+func (z *MemoryZone) dnskeyRRset(policy *zone.SignPolicy, soa *g53.RRset) *g53.RRset {
+	dnskey := &g53.RRset{
+		Name:  z.origin,
+		Type:  g53.RR_DNSKEY,
+		Class: soa.Class,
+		Ttl:   soa.Ttl,
+	}
+	if rrset, ok := z.originNode.Data().(NameNode)[g53.RR_DNSKEY]; ok {
+		dnskey.Ttl = rrset.Ttl
+		dnskey.Rdatas = append(dnskey.Rdatas, rrset.Rdatas...)
+	}
+	for _, key := range policy.Keys {
+		dnskey.AddRdata(key.DNSKEY)
+	}
+	return dnskey
+}
+
+// names below zone cut are glue, which isn't authoritative
+func (z *MemoryZone) authoritativeNames() []*zoneName {
+	var names []*zoneName
+	cuts := make(map[string]bool)
+	z.domains.ForEach(func(node *domaintree.Node) {
+		if node.IsEmpty() {
+			return
+		}
+		nameNode := node.Data().(NameNode)
+		for _, rrset := range nameNode {
+			_, hasNS := nameNode[g53.RR_NS]
+			n := &zoneName{
+				name:  dnssec.CanonicalName(rrset.Name),
+				node:  nameNode,
+				isCut: hasNS && rrset.Name.Equals(z.origin) == false,
+			}
+			if n.isCut {
+				cuts[n.name.String(false)] = true
+			}
+			names = append(names, n)
+			break
+		}
+	})
+
+	authNames := names[:0]
+	for _, n := range names {
+		if z.isOccluded(n.name, cuts) == false {
+			authNames = append(authNames, n)
+		}
+	}
+	sort.Slice(authNames, func(i, j int) bool {
+		return authNames[i].name.Compare(authNames[j].name, false).Order < 0
+	})
+	return authNames
+}
+
+func (z *MemoryZone) isOccluded(name *g53.Name, cuts map[string]bool) bool {
+	for i := uint(1); name.LabelCount()-i > z.origin.LabelCount(); i++ {
+		parent, _ := name.Parent(i)
+		if cuts[parent.String(false)] {
+			return true
+		}
+	}
+	return false
+}
+
+// types of the name shown in nsec or nsec3, rrsets at zone cut aren't
+// signed except ds
+func (s *signatures) nodeTypes(n *zoneName, isApex bool) []g53.RRType {
+	var types []g53.RRType
+	signed := false
+	for typ := range n.node {
+		if isDNSSECType(typ) {
+			continue
+		}
+		types = append(types, typ)
+		if n.isCut == false || typ == g53.RR_DS {
+			signed = true
+		}
+	}
+
+	if isApex {
+		types = append(types, g53.RR_DNSKEY)
+		if s.nsec3param != nil {
+			types = append(types, g53.RR_NSEC3PARAM)
+		}
+	}
+	if signed {
+		types = append(types, g53.RR_RRSIG)
+	}
+	return types
+}
+
+func (s *signatures) buildNSECChain(names []*zoneName, origin *g53.Name, class g53.RRClass, ttl g53.RRTTL) {
+	for i, n := range names {
+		types := append(s.nodeTypes(n, n.name.Equals(origin)), g53.RR_NSEC, g53.RR_RRSIG)
+		s.chain = append(s.chain, &g53.RRset{
+			Name:  n.name,
+			Type:  g53.RR_NSEC,
+			Class: class,
+			Ttl:   ttl,
+			Rdatas: []g53.Rdata{&rd.NSEC{
+				NextName: names[(i+1)%len(names)].name,
+				Types:    rd.SortTypes(types),
+			}},
+		})
+	}
+}
+
+// empty non-terminals have nsec3 without types, RFC 5155 7.1
+func (s *signatures) buildNSEC3Chain(names []*zoneName, origin *g53.Name, class g53.RRClass, ttl g53.RRTTL) {
+	typesOfHash := make(map[string][]g53.RRType)
+	exists := make(map[string]bool)
+	for _, n := range names {
+		exists[n.name.String(false)] = true
+	}
+
+	for _, n := range names {
+		hash := s.hashName(n.name)
+		typesOfHash[string(hash)] = rd.SortTypes(s.nodeTypes(n, n.name.Equals(origin)))
+		for i := uint(1); n.name.LabelCount()-i > origin.LabelCount(); i++ {
+			parent, _ := n.name.Parent(i)
+			if exists[parent.String(false)] == false {
+				exists[parent.String(false)] = true
+				typesOfHash[string(s.hashName(parent))] = nil
+			}
+		}
+	}
+
+	for hash := range typesOfHash {
+		s.hashes = append(s.hashes, []byte(hash))
+	}
+	sort.Slice(s.hashes, func(i, j int) bool { return bytes.Compare(s.hashes[i], s.hashes[j]) < 0 })
+
+	for i, hash := range s.hashes {
+		owner, _ := g53.NameFromString(strings.ToLower(rd.Base32Hex.EncodeToString(hash)) + "." + origin.String(false))
+		s.chain = append(s.chain, &g53.RRset{
+			Name:  owner,
+			Type:  g53.RR_NSEC3,
+			Class: class,
+			Ttl:   ttl,
+			Rdatas: []g53.Rdata{&rd.NSEC3{
+				Algorithm:  rd.NSEC3SHA1,
+				Iterations: s.policy.Iterations,
+				Salt:       s.policy.Salt,
+				NextHash:   s.hashes[(i+1)%len(s.hashes)],
+				Types:      typesOfHash[string(hash)],
+			}},
+		})
+	}
+}
+
+func (s *signatures) hashName(name *g53.Name) []byte {
+	return dnssec.HashName(name, s.policy.Iterations, s.policy.Salt)
+}
+
+func (s *signatures) sign(rrset *g53.RRset, old *signatures, now time.Time) error {
+	key := newRRsetKey(rrset.Name, rrset.Type)
+	if old != nil {
+		if prev, ok := old.signed[key]; ok && sameRRset(prev.rrset, rrset) {
+			if refreshAt := s.refreshTime(prev.sigs); now.Before(refreshAt) {
+				s.signed[key] = &signedRRset{rrset: rrset, sigs: prev.sigs}
+				s.updateRefreshAt(refreshAt)
+				return nil
+			}
+		}
+	}
+
+	sigs := &g53.RRset{
+		Name:  rrset.Name,
+		Type:  g53.RR_RRSIG,
+		Class: rrset.Class,
+		Ttl:   rrset.Ttl,
+	}
+	for _, k := range signingKeys(s.policy, rrset.Type) {
+		sig, err := dnssec.Sign(rrset, k, now.Add(-signInceptionOffset), now.Add(s.policy.Validity))
+		if err != nil {
+			return err
+		}
+		sigs.Rdatas = append(sigs.Rdatas, sig)
+	}
+	s.signed[key] = &signedRRset{rrset: rrset, sigs: sigs}
+	s.updateRefreshAt(s.refreshTime(sigs))
+	return nil
+}
+
+// signatures are refreshed before the earliest one expires
+func (s *signatures) refreshTime(sigs *g53.RRset) time.Time {
+	var expiration uint32
+	for i, sig := range sigs.Rdatas {
+		if e := sig.(*rd.RRSIG).Expiration; i == 0 || e < expiration {
+			expiration = e
+		}
+	}
+	return time.Unix(int64(expiration), 0).Add(-s.policy.Refresh)
+}
+
+func (s *signatures) updateRefreshAt(t time.Time) {
+	if s.refreshAt.IsZero() || t.Before(s.refreshAt) {
+		s.refreshAt = t
+	}
+}
+
+// ksk only signs dnskey, zsk signs the others
+func signingKeys(policy *zone.SignPolicy, typ g53.RRType) []*dnssec.Key {
+	var ksks, zsks []*dnssec.Key
+	for _, key := range policy.Keys {
+		if key.IsKSK() {
+			ksks = append(ksks, key)
+		} else {
+			zsks = append(zsks, key)
+		}
+	}
+
+	if typ == g53.RR_DNSKEY && len(ksks) > 0 {
+		return ksks
+	} else if typ != g53.RR_DNSKEY && len(zsks) > 0 {
+		return zsks
+	}
+	return policy.Keys
+}
+
+func sameRRset(a, b *g53.RRset) bool {
+	if a == b {
+		return true
+	}
+	if a.Name.Equals(b.Name) == false || a.Ttl != b.Ttl || a.Class != b.Class || len(a.Rdatas) != len(b.Rdatas) {
+		return false
+	}
+	//soa rdatas always equal with Compare, serial change must be re-signed
+	if a.Type == g53.RR_SOA {
+		return a.Rdatas[0].String() == b.Rdatas[0].String()
+	}
+	for i, rdata := range a.Rdatas {
+		if rdata.Compare(b.Rdatas[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// dnskey and nsec3param are generated at apex
+func (s *signatures) apexRRset(typ g53.RRType) *g53.RRset {
+	if typ == g53.RR_DNSKEY {
+		return s.dnskey
+	} else if typ == g53.RR_NSEC3PARAM && s.nsec3param != nil {
+		return s.nsec3param
+	}
+	return nil
+}
+
+func (s *signatures) getSignatures(name *g53.Name, typ g53.RRType) *g53.RRset {
+	if signed, ok := s.signed[newRRsetKey(name, typ)]; ok {
+		return signed.sigs
+	}
+	return nil
+}
+
+// generated records which are transferred with zone data
+func (s *signatures) rrsets() []*g53.RRset {
+	rrsets := []*g53.RRset{s.dnskey}
+	if s.nsec3param != nil {
+		rrsets = append(rrsets, s.nsec3param)
+	}
+	rrsets = append(rrsets, s.chain...)
+	for _, signed := range s.signed {
+		rrsets = append(rrsets, signed.sigs)
+	}
+	return rrsets
+}
+
+// zone data with dnssec records for transfer, so secondaries serve the
+// zone signed, dnskey in zone data is replaced by the generated one which
+// includes it
+func (z *MemoryZone) dumpSigned() ([]*g53.RRset, error) {
+	rrsets, err := z.dump()
+	if err != nil || z.signatures == nil {
+		return rrsets, err
+	}
+
+	data := make([]*g53.RRset, 0, len(rrsets))
+	for _, rrset := range rrsets {
+		if isDNSSECType(rrset.Type) || (rrset.Type == g53.RR_DNSKEY && rrset.Name.Equals(z.origin)) {
+			continue
+		}
+		data = append(data, rrset)
+	}
+	return append(data, z.signatures.rrsets()...), nil
+}
+
+// name exists if it has authoritative data or it's empty non-terminal,
+// subdomains of name follow it in canonical order
+func (s *signatures) nameExists(name *g53.Name) bool {
+	i := sort.Search(len(s.names), func(i int) bool {
+		return s.names[i].Compare(name, false).Order >= 0
+	})
+	return i < len(s.names) && s.names[i].IsSubDomain(name)
+}
+
+func (s *signatures) closestEncloser(name *g53.Name, origin *g53.Name) *g53.Name {
+	for i := uint(1); name.LabelCount()-i > origin.LabelCount(); i++ {
+		parent, _ := name.Parent(i)
+		if s.nameExists(parent) {
+			return parent
+		}
+	}
+	return origin
+}
+
+// nsec which matches or covers the name, owner of the last nsec is the
+// greatest name in zone
+func (s *signatures) findNSEC(name *g53.Name) *g53.RRset {
+	i := sort.Search(len(s.chain), func(i int) bool {
+		return s.chain[i].Name.Compare(name, false).Order > 0
+	})
+	if i == 0 {
+		i = len(s.chain)
+	}
+	return s.chain[i-1]
+}
+
+// nsec3 whose hash matches or covers the hash of name
+func (s *signatures) findNSEC3(name *g53.Name) *g53.RRset {
+	hash := s.hashName(name)
+	i := sort.Search(len(s.hashes), func(i int) bool {
+		return bytes.Compare(s.hashes[i], hash) > 0
+	})
+	if i == 0 {
+		i = len(s.hashes)
+	}
+	return s.chain[i-1]
+}
+
+// nsec or nsec3 rrsets for names with their signatures, duplicate ones
+// are ignored
+func (s *signatures) proofs(names ...*g53.Name) []*g53.RRset {
+	var rrsets []*g53.RRset
+	for _, name := range names {
+		var proof *g53.RRset
+		if s.policy.NSEC3 {
+			proof = s.findNSEC3(name)
+		} else {
+			proof = s.findNSEC(name)
+		}
+
+		duplicate := false
+		for _, rrset := range rrsets {
+			if rrset == proof {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate == false {
+			rrsets = append(rrsets, proof, s.getSignatures(proof.Name, proof.Type))
+		}
+	}
+	return rrsets
+}
+
+// RFC 4035 3.1.3 and RFC 5155 7.2, name is the query name, wildcard is
+// the source of synthesis if name is expanded from it
+func (s *signatures) denial(result zone.ResultType, name, wildcard, origin *g53.Name) []*g53.RRset {
+	switch result {
+	case zone.FRNXDomain:
+		ce := s.closestEncloser(name, origin)
+		if s.policy.NSEC3 {
+			return s.proofs(ce, nextCloser(name, ce), wildcardOf(ce))
+		}
+		return s.proofs(name, wildcardOf(ce))
+	case zone.FRNXRRset:
+		if wildcard == nil {
+			return s.proofs(name)
+		}
+		if s.policy.NSEC3 {
+			ce, _ := wildcard.Parent(1)
+			return s.proofs(ce, nextCloser(name, ce), wildcard)
+		}
+		return s.proofs(name, wildcard)
+	case zone.FRSuccess, zone.FRCname:
+		if wildcard == nil {
+			return nil
+		}
+		if s.policy.NSEC3 {
+			ce, _ := wildcard.Parent(1)
+			return s.proofs(nextCloser(name, ce))
+		}
+		return s.proofs(name)
+	}
+	return nil
+}
+
+// the name one label longer than closest encloser
+func nextCloser(name, ce *g53.Name) *g53.Name {
+	next, _ := name.Parent(name.LabelCount() - ce.LabelCount() - 1)
+	return next
+}
+
+func wildcardOf(name *g53.Name) *g53.Name {
+	wildcard, _ := g53.NameFromStringUnsafe("*").Concat(name)
+	return wildcard
+}
@@ -0,0 +1,199 @@
+package memoryzone
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/dnssec"
+	"github.com/zdnscloud/vanguard/rdata"
+	zn "github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+var signedZoneData []string = []string{
+	"cn. 300 IN SOA a.dns.cn. root.cnnic.cn. 2023300522 7200 3600 2419200 21600",
+	"cn. 300 IN NS ns.cn.",
+	"ns.cn. 300 IN A 1.1.1.1",
+	"a.cn. 300 IN A 1.1.1.1",
+	"c.cn. 300 IN A 1.1.1.1",
+	"*.w.cn. 300 IN TXT \"wildcard\"",
+	"sub.cn. 300 IN NS ns.sub.cn.",
+	"sub.cn. 300 IN DS 12345 13 2 2BB183AF5F22588179A53B0A98631FAD1A292118",
+	"ns.sub.cn. 300 IN A 2.2.2.2",
+}
+
+func createSignedZone(t *testing.T, nsec3 bool) (*DynamicZone, *dnssec.Key, *dnssec.Key) {
+	origin := g53.NameFromStringUnsafe("cn.")
+	ksk, _ := dnssec.GenerateKey(origin, dnssec.AlgorithmED25519, true)
+	zsk, _ := dnssec.GenerateKey(origin, dnssec.AlgorithmED25519, false)
+	zone := createDynamicZone("cn.", signedZoneData)
+	err := zone.EnableDNSSEC(&zn.SignPolicy{
+		Keys:       []*dnssec.Key{ksk, zsk},
+		NSEC3:      nsec3,
+		Iterations: 1,
+		Salt:       []byte{0xab},
+		Validity:   24 * time.Hour,
+		Refresh:    6 * time.Hour,
+	})
+	ut.Assert(t, err == nil, "sign zone failed: %v", err)
+	return zone, ksk, zsk
+}
+
+func verifySignatures(t *testing.T, rrset, sigs *g53.RRset, key *dnssec.Key) {
+	ut.Assert(t, sigs != nil, "rrset %s should be signed", rrset.Name.String(false))
+	ut.Equal(t, sigs.Type, g53.RR_RRSIG)
+	ut.Equal(t, len(sigs.Rdatas), 1)
+	err := dnssec.Verify(rrset, sigs.Rdatas[0].(*rdata.RRSIG), key.Owner, key.DNSKEY)
+	ut.Assert(t, err == nil, "verify %s failed: %v", rrset.Name.String(false), err)
+}
+
+func denialTypes(rrsets []*g53.RRset) []g53.RRType {
+	var types []g53.RRType
+	for _, rrset := range rrsets {
+		types = append(types, rrset.Type)
+	}
+	return types
+}
+
+func TestSignedFind(t *testing.T) {
+	zone, ksk, zsk := createSignedZone(t, false)
+
+	ctx := zone.Find(g53.NameFromStringUnsafe("a.cn."), g53.RR_A, zn.DefaultFind).(zn.SignedFinderContext)
+	result := ctx.GetResult()
+	ut.Equal(t, result.Type, zn.FRSuccess)
+	verifySignatures(t, result.RRset, ctx.GetSignatures(result.RRset), zsk)
+	ut.Equal(t, len(ctx.GetDenial()), 0)
+
+	ctx = zone.Find(g53.NameFromStringUnsafe("cn."), g53.RR_DNSKEY, zn.DefaultFind).(zn.SignedFinderContext)
+	result = ctx.GetResult()
+	ut.Equal(t, result.Type, zn.FRSuccess)
+	ut.Equal(t, len(result.RRset.Rdatas), 2)
+	verifySignatures(t, result.RRset, ctx.GetSignatures(result.RRset), ksk)
+
+	//b.cn is covered by a.cn nsec, no wildcard under cn is covered by cn nsec
+	ctx = zone.Find(g53.NameFromStringUnsafe("b.cn."), g53.RR_A, zn.DefaultFind).(zn.SignedFinderContext)
+	ut.Equal(t, ctx.GetResult().Type, zn.FRNXDomain)
+	denial := ctx.GetDenial()
+	ut.Equal(t, denialTypes(denial), []g53.RRType{g53.RR_NSEC, g53.RR_RRSIG, g53.RR_NSEC, g53.RR_RRSIG})
+	ut.Equal(t, denial[0].Name.String(false), "a.cn.")
+	ut.Equal(t, denial[0].Rdatas[0].String(), "c.cn. A RRSIG NSEC")
+	ut.Equal(t, denial[2].Name.String(false), "cn.")
+	verifySignatures(t, denial[0], denial[1], zsk)
+
+	ctx = zone.Find(g53.NameFromStringUnsafe("a.cn."), g53.RR_MX, zn.DefaultFind).(zn.SignedFinderContext)
+	ut.Equal(t, ctx.GetResult().Type, zn.FRNXRRset)
+	ut.Equal(t, denialTypes(ctx.GetDenial()), []g53.RRType{g53.RR_NSEC, g53.RR_RRSIG})
+
+	//signature of wildcard answer is renamed to query name
+	ctx = zone.Find(g53.NameFromStringUnsafe("x.w.cn."), g53.RR_TXT, zn.DefaultFind).(zn.SignedFinderContext)
+	result = ctx.GetResult()
+	ut.Equal(t, result.Type, zn.FRSuccess)
+	verifySignatures(t, result.RRset, ctx.GetSignatures(result.RRset), zsk)
+	ut.Equal(t, ctx.GetSignatures(result.RRset).Name.String(false), "x.w.cn.")
+	ut.Equal(t, denialTypes(ctx.GetDenial()), []g53.RRType{g53.RR_NSEC, g53.RR_RRSIG})
+
+	//ds at zone cut is answered by the zone, ns isn't signed
+	ctx = zone.Find(g53.NameFromStringUnsafe("sub.cn."), g53.RR_DS, zn.DefaultFind).(zn.SignedFinderContext)
+	result = ctx.GetResult()
+	ut.Equal(t, result.Type, zn.FRSuccess)
+	verifySignatures(t, result.RRset, ctx.GetSignatures(result.RRset), zsk)
+	ctx = zone.Find(g53.NameFromStringUnsafe("www.sub.cn."), g53.RR_A, zn.DefaultFind).(zn.SignedFinderContext)
+	result = ctx.GetResult()
+	ut.Equal(t, result.Type, zn.FRDelegation)
+	ut.Assert(t, ctx.GetSignatures(result.RRset) == nil, "delegation ns shouldn't be signed")
+}
+
+func TestNSEC3Denial(t *testing.T) {
+	zone, _, zsk := createSignedZone(t, true)
+
+	ctx := zone.Find(g53.NameFromStringUnsafe("cn."), g53.RR_NSEC3PARAM, zn.DefaultFind).(zn.SignedFinderContext)
+	result := ctx.GetResult()
+	ut.Equal(t, result.Type, zn.FRSuccess)
+	ut.Equal(t, result.RRset.Rdatas[0].String(), "1 0 1 AB")
+
+	ctx = zone.Find(g53.NameFromStringUnsafe("x.y.cn."), g53.RR_A, zn.DefaultFind).(zn.SignedFinderContext)
+	ut.Equal(t, ctx.GetResult().Type, zn.FRNXDomain)
+	denial := ctx.GetDenial()
+	ut.Assert(t, len(denial) >= 4 && len(denial) <= 6, "closest encloser proof needs 2 or 3 nsec3")
+	for i := 0; i < len(denial); i += 2 {
+		ut.Equal(t, denial[i].Type, g53.RR_NSEC3)
+		verifySignatures(t, denial[i], denial[i+1], zsk)
+	}
+
+	//empty non-terminal w.cn has nsec3 without types
+	ctx = zone.Find(g53.NameFromStringUnsafe("w.cn."), g53.RR_A, zn.DefaultFind).(zn.SignedFinderContext)
+	ut.Equal(t, ctx.GetResult().Type, zn.FRNXRRset)
+	denial = ctx.GetDenial()
+	ut.Equal(t, denialTypes(denial), []g53.RRType{g53.RR_NSEC3, g53.RR_RRSIG})
+	hash := rdata.Base32Hex.EncodeToString(dnssec.HashName(g53.NameFromStringUnsafe("w.cn."), 1, []byte{0xab}))
+	ut.Equal(t, denial[0].Name.String(false), strings.ToLower(hash)+".cn.")
+	ut.Equal(t, len(denial[0].Rdatas[0].(*rdata.NSEC3).Types), 0)
+}
+
+func TestResignOnCommit(t *testing.T) {
+	zone, _, zsk := createSignedZone(t, false)
+
+	tx, _ := zone.Begin()
+	rrset, _ := rdata.RRsetFromString("b.cn. 300 IN A 3.3.3.3")
+	zone.Add(tx, rrset)
+	ut.Equal(t, tx.Commit(), nil)
+
+	ctx := zone.Find(g53.NameFromStringUnsafe("b.cn."), g53.RR_A, zn.DefaultFind).(zn.SignedFinderContext)
+	result := ctx.GetResult()
+	ut.Equal(t, result.Type, zn.FRSuccess)
+	verifySignatures(t, result.RRset, ctx.GetSignatures(result.RRset), zsk)
+
+	ctx = zone.Find(g53.NameFromStringUnsafe("a.cn."), g53.RR_NSEC, zn.DefaultFind).(zn.SignedFinderContext)
+	ut.Equal(t, ctx.GetResult().Type, zn.FRNXRRset)
+	ut.Equal(t, ctx.GetDenial()[0].Rdatas[0].String(), "b.cn. A RRSIG NSEC")
+
+	//signatures aren't regenerated before refresh time
+	ctx = zone.Find(g53.NameFromStringUnsafe("c.cn."), g53.RR_A, zn.DefaultFind).(zn.SignedFinderContext)
+	sigs := ctx.GetSignatures(ctx.GetResult().RRset)
+	ut.Equal(t, zone.Resign(), nil)
+	ctx = zone.Find(g53.NameFromStringUnsafe("c.cn."), g53.RR_A, zn.DefaultFind).(zn.SignedFinderContext)
+	ut.Equal(t, ctx.GetSignatures(ctx.GetResult().RRset).Rdatas[0].String(), sigs.Rdatas[0].String())
+}
+
+func TestResignIncreaseSerial(t *testing.T) {
+	zone, _, zsk := createSignedZone(t, false)
+	zone.MemoryZone.signatures.refreshAt = time.Now()
+	ut.Equal(t, zone.Resign(), nil)
+
+	ctx := zone.Find(g53.NameFromStringUnsafe("cn."), g53.RR_SOA, zn.DefaultFind).(zn.SignedFinderContext)
+	soa := ctx.GetResult().RRset
+	ut.Equal(t, soaSerial(soa), uint32(2023300523))
+	verifySignatures(t, soa, ctx.GetSignatures(soa), zsk)
+	ut.Equal(t, len(zone.History()), 1)
+
+	//secondary keeps serial of primary
+	zone, _, _ = createSignedZone(t, false)
+	zone.SetMasters([]string{"1.1.1.1:53"})
+	zone.MemoryZone.signatures.refreshAt = time.Now()
+	ut.Equal(t, zone.Resign(), nil)
+	soa = zone.Find(g53.NameFromStringUnsafe("cn."), g53.RR_SOA, zn.DefaultFind).GetResult().RRset
+	ut.Equal(t, soaSerial(soa), uint32(2023300522))
+}
+
+func TestDumpSignedZone(t *testing.T) {
+	zone, _, _ := createSignedZone(t, true)
+	rrsets, err := zone.Dump()
+	ut.Equal(t, err, nil)
+	ut.Equal(t, rrsets[0].Type, g53.RR_SOA)
+	types := make(map[g53.RRType]int)
+	for _, rrset := range rrsets {
+		types[rrset.Type] += 1
+	}
+	ut.Equal(t, types[g53.RR_DNSKEY], 1)
+	ut.Equal(t, types[g53.RR_NSEC3PARAM], 1)
+	ut.Assert(t, types[g53.RR_NSEC3] > 0, "nsec3 should be dumped")
+	ut.Assert(t, types[g53.RR_RRSIG] > 0, "signatures should be dumped")
+
+	//snapshot keeps zone data only
+	data, _ := zone.MemoryZone.dump()
+	for _, rrset := range data {
+		ut.Assert(t, isDNSSECType(rrset.Type) == false && rrset.Type != g53.RR_DNSKEY, "%s shouldn't be in zone data", rrset.Type)
+	}
+}
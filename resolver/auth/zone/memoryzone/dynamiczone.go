@@ -2,7 +2,9 @@ package memoryzone
 
 import (
 	"net"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/acl"
@@ -11,9 +13,10 @@ import (
 )
 
 type memoryTx struct {
-	owner *DynamicZone
-	tmp   *MemoryZone
-	lock  *sync.RWMutex
+	owner   *DynamicZone
+	tmp     *MemoryZone
+	lock    *sync.RWMutex
+	touched []*g53.Name
 }
 
 func (tx *memoryTx) Commit() error {
@@ -24,6 +27,16 @@ func (tx *memoryTx) Commit() error {
 	}
 
 	old := tx.owner.MemoryZone
+	if err := tx.owner.sign(tx.tmp, old); err != nil {
+		go tx.tmp.clean()
+		tx.tmp = nil
+		return err
+	}
+	if err := tx.owner.recordDiff(old, tx.tmp, tx.touched); err != nil {
+		go tx.tmp.clean()
+		tx.tmp = nil
+		return err
+	}
 	tx.owner.MemoryZone = tx.tmp
 	tx.tmp = nil
 	go old.clean()
@@ -52,15 +65,27 @@ func (ctx *emptyZoneFinderCtx) GetAdditional() []*g53.RRset {
 
 type DynamicZone struct {
 	*MemoryZone
-	lock    sync.RWMutex
-	masters []string
-	acls    []string
+	lock         sync.RWMutex
+	masters      []string
+	acls         []string
+	transferAcls []string
+	notifyMode   zone.NotifyMode
+	alsoNotify   []string
+	expired      bool
+	transferKey  *zone.TSIGKey
+	journal      *journal
+	journalFile  *journalFile
+	lastRefresh  time.Time
+	signPolicy   *zone.SignPolicy
 }
 
 func NewDynamicZone(origin *g53.Name) *DynamicZone {
 	dz := &DynamicZone{
-		MemoryZone: newMemoryZone(origin),
-		acls:       nil,
+		MemoryZone:   newMemoryZone(origin),
+		acls:         []string{acl.NoneAcl},
+		transferAcls: []string{acl.NoneAcl},
+		notifyMode:   zone.NotifyYes,
+		journal:      newJournal(defaultJournalSize),
 	}
 	return dz
 }
@@ -101,14 +126,296 @@ func (z *DynamicZone) Load(loadChan <-chan *g53.RRset, abortChan <-chan struct{}
 	logger.GetLogger().Info("load %d rrs in zone %s from master server", rrCount, z.origin.String(false))
 
 	z.lock.Lock()
+	if err := z.sign(newMemZone, z.MemoryZone); err != nil {
+		z.lock.Unlock()
+		return err
+	}
 	z.MemoryZone = newMemZone
+	z.journal.clear()
+	z.expired = false
+	if err := z.saveZone(newMemZone); err != nil {
+		logger.GetLogger().Error("save zone %s failed: %s", z.origin.String(false), err.Error())
+	}
 	z.lock.Unlock()
 
 	return nil
 }
 
+// dnssec records are dumped with zone data of signed zone
 func (z *DynamicZone) Dump() ([]*g53.RRset, error) {
-	return z.MemoryZone.dump()
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	return z.MemoryZone.dumpSigned()
+}
+
+// journal doesn't keep changes of dnssec records, so signed zone is always
+// transferred fully, which is allowed by RFC 1995 4
+func (z *DynamicZone) GetDiffs(serial uint32) ([]*zone.ZoneDiff, bool) {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	if z.MemoryZone.signatures != nil {
+		return nil, false
+	}
+	return z.journal.diffsSince(serial)
+}
+
+// History returns the diffs kept in journal in serial order
+func (z *DynamicZone) History() []*zone.ZoneDiff {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	diffs := make([]*zone.ZoneDiff, len(z.journal.diffs))
+	copy(diffs, z.journal.diffs)
+	return diffs
+}
+
+// Versions returns serials of the versions kept in journal from the oldest
+// to the current one
+func (z *DynamicZone) Versions() []uint32 {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	soa := z.MemoryZone.getSOA()
+	if soa == nil {
+		return nil
+	}
+	return z.journal.versions(soa)
+}
+
+func (z *DynamicZone) DiffVersions(from, to uint32) (*zone.ZoneDiff, error) {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	if diff, ok := z.journal.diffBetween(from, to); ok {
+		return diff, nil
+	} else {
+		return nil, zone.ErrUnknownVersion
+	}
+}
+
+// Rollback restores the zone content of an old version, rollback is a new
+// change with serial increased, so it's recorded in journal and could be
+// transferred incrementally
+func (z *DynamicZone) Rollback(serial uint32) error {
+	tx, _ := z.Begin()
+	mtx := tx.(*memoryTx)
+	current := mtx.tmp.getSOA()
+	if current == nil {
+		tx.RollBack()
+		return zone.ErrShortOfSOA
+	} else if soaSerial(current) == serial {
+		tx.RollBack()
+		return zone.ErrNoEffectiveUpdate
+	}
+
+	diff, ok := z.journal.diffBetween(soaSerial(current), serial)
+	if ok == false {
+		tx.RollBack()
+		return zone.ErrUnknownVersion
+	}
+
+	//other fields of soa are restored too
+	newSOA := diff.NewSOA.Clone()
+	rdata := *newSOA.Rdatas[0].(*g53.SOA)
+	rdata.Serial = soaSerial(current) + 1
+	newSOA.Rdatas[0] = &rdata
+	diff.NewSOA = newSOA
+
+	if err := mtx.tmp.applyDiff(diff); err != nil {
+		tx.RollBack()
+		return err
+	}
+	for _, rrset := range append(diff.Deleted, diff.Added...) {
+		mtx.touched = append(mtx.touched, rrset.Name)
+	}
+	return tx.Commit()
+}
+
+// caller should hold the write lock, journal file is written before the
+// change is visible, so change which fails to be saved is abandoned
+func (z *DynamicZone) recordDiff(old, new *MemoryZone, touched []*g53.Name) error {
+	oldSOA, newSOA := old.getSOA(), new.getSOA()
+	if oldSOA == nil || newSOA == nil {
+		z.journal.clear()
+		return z.saveZone(new)
+	}
+
+	diff := genZoneDiff(old, new, touched)
+	if soaSerial(oldSOA) == soaSerial(newSOA) {
+		//changes without serial increased can't be transferred incrementally
+		if len(diff.Deleted) != 0 || len(diff.Added) != 0 {
+			z.journal.clear()
+			return z.saveZone(new)
+		}
+	} else {
+		if z.journalFile != nil {
+			if err := z.journalFile.append(diff); err != nil {
+				return err
+			}
+		}
+		z.journal.append(diff)
+	}
+	return nil
+}
+
+// EnableJournal replays the journal file on the zone loaded from zone file
+// or snapshot, then each change is appended to the journal file, which is
+// merged into snapshot by Compact
+func (z *DynamicZone) EnableJournal(snapshot, journalFile string) error {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	soa := z.MemoryZone.getSOA()
+	if soa == nil {
+		//journal is useless without zone data, snapshot is written when
+		//zone is loaded
+		jf := newJournalFile(snapshot, journalFile)
+		jf.lock.Lock()
+		err := jf.rewrite(nil)
+		jf.lock.Unlock()
+		if err == nil {
+			z.journal.clear()
+			z.journalFile = jf
+		}
+		return err
+	}
+
+	diffs, err := readJournalFile(journalFile)
+	if err != nil {
+		return err
+	}
+
+	//diffs before the serial of loaded zone are kept for ixfr
+	tmp := z.MemoryZone.clone()
+	serial := soaSerial(soa)
+	applied := 0
+	for _, diff := range diffs {
+		if soaSerial(diff.OldSOA) != serial {
+			if applied > 0 {
+				return ErrJournalBroken
+			}
+			continue
+		}
+		if err := tmp.applyDiff(diff); err != nil {
+			return err
+		}
+		serial = soaSerial(diff.NewSOA)
+		applied += 1
+	}
+	if err := tmp.validate(); err != nil {
+		return err
+	}
+	if err := z.sign(tmp, z.MemoryZone); err != nil {
+		return err
+	}
+
+	journal := newJournal(z.journal.maxSize)
+	for _, diff := range diffs {
+		journal.append(diff)
+	}
+	if len(journal.diffs) > 0 && soaSerial(journal.diffs[len(journal.diffs)-1].NewSOA) != serial {
+		journal.clear()
+	}
+
+	jf := newJournalFile(snapshot, journalFile)
+	jf.lock.Lock()
+	err = jf.rewrite(journal.diffs)
+	jf.entries = applied
+	jf.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	old := z.MemoryZone
+	z.MemoryZone = tmp
+	z.journal = journal
+	z.journalFile = jf
+	go old.clean()
+	logger.GetLogger().Info("replay %d changes of zone %s from journal %s", applied, z.origin.String(false), journalFile)
+	return nil
+}
+
+// Compact writes the zone into snapshot if journal file isn't empty
+func (z *DynamicZone) Compact() error {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	if z.journalFile == nil || z.journalFile.pendingEntries() == 0 {
+		return nil
+	}
+	return z.saveZone(z.MemoryZone)
+}
+
+// write zone into snapshot and truncate journal file, caller should hold
+// the lock
+func (z *DynamicZone) saveZone(new *MemoryZone) error {
+	if z.journalFile == nil {
+		return nil
+	}
+
+	rrsets, err := new.dump()
+	if err != nil {
+		return err
+	}
+	return z.journalFile.compact(rrsets, z.journal.diffs)
+}
+
+// EnableDNSSEC signs the zone with keys in policy, zone is re-signed with
+// it whenever zone data is changed
+func (z *DynamicZone) EnableDNSSEC(policy *zone.SignPolicy) error {
+	if len(policy.Keys) == 0 {
+		return zone.ErrNoSigningKey
+	}
+	for _, key := range policy.Keys {
+		if key.Owner.Equals(z.origin) == false {
+			return zone.ErrSigningKeyOwner
+		}
+	}
+
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	z.signPolicy = policy
+	if z.MemoryZone.isEmpty() {
+		return nil
+	}
+	return z.sign(z.MemoryZone, nil)
+}
+
+// Resign regenerates signatures which will expire in refresh time of the
+// policy, signatures of unchanged rrsets are reused, serial of primary zone
+// is increased so secondaries transfer the new signatures
+func (z *DynamicZone) Resign() error {
+	z.lock.RLock()
+	sigs := z.MemoryZone.signatures
+	isPrimary := len(z.masters) == 0
+	z.lock.RUnlock()
+	if sigs == nil || time.Now().Before(sigs.refreshAt) {
+		return nil
+	}
+
+	if isPrimary {
+		tx, _ := z.Begin()
+		z.IncreaseSerialNumber(tx)
+		return tx.Commit()
+	}
+
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	return z.sign(z.MemoryZone, z.MemoryZone)
+}
+
+// dnssec records of new zone are generated with the ones of old zone
+// reused, caller should hold the write lock
+func (z *DynamicZone) sign(new, old *MemoryZone) error {
+	if z.signPolicy == nil {
+		return nil
+	}
+
+	var oldSigs *signatures
+	if old != nil {
+		oldSigs = old.signatures
+	}
+	sigs, err := signZone(new, z.signPolicy, oldSigs, time.Now())
+	if err != nil {
+		return err
+	}
+	new.signatures = sigs
+	return nil
 }
 
 func (z *DynamicZone) GetUpdator(ip net.IP, force bool) (zone.ZoneUpdator, bool) {
@@ -158,14 +465,94 @@ func (z *DynamicZone) Masters() []string {
 	}
 }
 
+func (z *DynamicZone) SetTransferKey(key *zone.TSIGKey) {
+	z.lock.Lock()
+	z.transferKey = key
+	z.lock.Unlock()
+}
+
+func (z *DynamicZone) TransferKey() *zone.TSIGKey {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	return z.transferKey
+}
+
+func (z *DynamicZone) SetNotify(mode zone.NotifyMode, alsoNotify []string) {
+	z.lock.Lock()
+	z.notifyMode = mode
+	z.alsoNotify = alsoNotify
+	z.lock.Unlock()
+}
+
+func (z *DynamicZone) Notify() (zone.NotifyMode, []string) {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	addrs := make([]string, len(z.alsoNotify))
+	copy(addrs, z.alsoNotify)
+	return z.notifyMode, addrs
+}
+
+// secondary zone is expired when master can't be reached in expire time
+func (z *DynamicZone) SetExpired(expired bool) {
+	z.lock.Lock()
+	z.expired = expired
+	z.lock.Unlock()
+}
+
+func (z *DynamicZone) IsExpired() bool {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	return z.expired
+}
+
+// time when secondary zone is confirmed with master last time, it's kept
+// as the modification time of snapshot, zero if zone isn't refreshed
+func (z *DynamicZone) SetLastRefresh(t time.Time) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	z.lastRefresh = t
+	if z.journalFile != nil {
+		if err := z.journalFile.touch(t); err != nil && os.IsNotExist(err) == false {
+			logger.GetLogger().Warn("touch snapshot of %s failed: %s", z.origin.String(false), err.Error())
+		}
+	}
+}
+
+func (z *DynamicZone) LastRefresh() time.Time {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	return z.lastRefresh
+}
+
 func (z *DynamicZone) SetAcls(acls []string) {
 	z.lock.Lock()
 	z.acls = acls
 	z.lock.Unlock()
 }
 
+func (z *DynamicZone) IsTransferAllowed(ip net.IP) bool {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	if ip == nil || len(z.transferAcls) == 0 {
+		return true
+	}
+
+	for _, aclName := range z.transferAcls {
+		if acl.GetAclManager().Find(aclName, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (z *DynamicZone) SetTransferAcls(acls []string) {
+	z.lock.Lock()
+	z.transferAcls = acls
+	z.lock.Unlock()
+}
+
 func (z *DynamicZone) Find(name *g53.Name, typ g53.RRType, option zone.FindOption) zone.FinderContext {
-	if z.MemoryZone.isEmpty() {
+	if z.MemoryZone.isEmpty() || z.IsExpired() {
 		return &emptyZoneFinderCtx{
 			result: zone.FindResult{Type: zone.FRServFail},
 		}
@@ -197,21 +584,29 @@ func (z *DynamicZone) Begin() (zone.Transaction, error) {
 }
 
 func (z *DynamicZone) Add(tx zone.Transaction, rrset *g53.RRset) error {
-	return tx.(*memoryTx).tmp.addRRset(rrset)
+	mtx := tx.(*memoryTx)
+	mtx.touched = append(mtx.touched, rrset.Name)
+	return mtx.tmp.addRRset(rrset)
 }
 
 func (z *DynamicZone) DeleteRRset(tx zone.Transaction, rrset *g53.RRset) error {
-	_, err := tx.(*memoryTx).tmp.deleteRRset(rrset)
+	mtx := tx.(*memoryTx)
+	mtx.touched = append(mtx.touched, rrset.Name)
+	_, err := mtx.tmp.deleteRRset(rrset)
 	return err
 }
 
 func (z *DynamicZone) DeleteDomain(tx zone.Transaction, name *g53.Name) error {
-	_, err := tx.(*memoryTx).tmp.deleteDomain(name)
+	mtx := tx.(*memoryTx)
+	mtx.touched = append(mtx.touched, name)
+	_, err := mtx.tmp.deleteDomain(name)
 	return err
 }
 
 func (z *DynamicZone) DeleteRr(tx zone.Transaction, rrset *g53.RRset) error {
-	_, err := tx.(*memoryTx).tmp.deleteRr(rrset)
+	mtx := tx.(*memoryTx)
+	mtx.touched = append(mtx.touched, rrset.Name)
+	_, err := mtx.tmp.deleteRr(rrset)
 	return err
 }
 
@@ -219,6 +614,10 @@ func (z *DynamicZone) IncreaseSerialNumber(tx zone.Transaction) {
 	tx.(*memoryTx).tmp.increaseSerialNumber()
 }
 
+func (z *DynamicZone) GetRRsets(tx zone.Transaction, name *g53.Name) []*g53.RRset {
+	return tx.(*memoryTx).tmp.getRRsets(name)
+}
+
 func (z *DynamicZone) GetOrigin() *g53.Name {
 	return z.MemoryZone.getOrigin()
 }
@@ -234,6 +633,18 @@ type dynamicZoneFinderCtx struct {
 	zone *DynamicZone
 }
 
+func (ctx *dynamicZoneFinderCtx) GetSignatures(rrset *g53.RRset) *g53.RRset {
+	ctx.zone.lock.RLock()
+	defer ctx.zone.lock.RUnlock()
+	return ctx.memoryZoneFinderCtx.GetSignatures(rrset)
+}
+
+func (ctx *dynamicZoneFinderCtx) GetDenial() []*g53.RRset {
+	ctx.zone.lock.RLock()
+	defer ctx.zone.lock.RUnlock()
+	return ctx.memoryZoneFinderCtx.GetDenial()
+}
+
 func (ctx *dynamicZoneFinderCtx) GetAdditional() []*g53.RRset {
 	ctx.zone.lock.RLock()
 	rrsets := ctx.memoryZoneFinderCtx.GetAdditional()
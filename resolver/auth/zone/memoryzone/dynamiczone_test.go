@@ -8,6 +8,7 @@ import (
 	ut "github.com/zdnscloud/cement/unittest"
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
 	zn "github.com/zdnscloud/vanguard/resolver/auth/zone"
 )
 
@@ -28,7 +29,7 @@ func createDynamicZone(name string, data []string) *DynamicZone {
 	zone := NewDynamicZone(g53.NameFromStringUnsafe(name))
 	tx, _ := zone.Begin()
 	for _, rr := range data {
-		rrset, err := g53.RRsetFromString(rr)
+		rrset, err := rdata.RRsetFromString(rr)
 		if err != nil {
 			panic(fmt.Sprintf("rr %s isn't valid %vs", rr, err.Error()))
 		}
@@ -129,3 +130,104 @@ func TestTransaction(t *testing.T) {
 	tx.Commit()
 	zoneHasARRset(t, dzone, "a.cn.", []string{})
 }
+
+func TestDump(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	dzone := createDynamicZone("cn", dynamicZoneData)
+
+	rrsets, err := dzone.Dump()
+	ut.Assert(t, err == nil, "dump zone shouldn't fail")
+	ut.Equal(t, rrsets[0].Type, g53.RR_SOA)
+	ut.Equal(t, len(rrsets), len(dynamicZoneData))
+	for _, rrset := range rrsets[1:] {
+		ut.Assert(t, rrset.Type != g53.RR_SOA, "soa should only be the first rrset")
+	}
+
+	_, err = NewDynamicZone(g53.NameFromStringUnsafe("cn")).Dump()
+	ut.Equal(t, err, zn.ErrShortOfSOA)
+}
+
+func TestJournal(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	dzone := createDynamicZone("cn", dynamicZoneData)
+	_, ok := dzone.GetDiffs(2023300522)
+	ut.Equal(t, ok, false)
+
+	tx, _ := dzone.Begin()
+	rrset, _ := g53.RRsetFromString("a.cn. 300 IN A 2.2.2.2")
+	dzone.Add(tx, rrset)
+	rrset, _ = g53.RRsetFromString("b.cn. 300 IN A 1.1.1.1")
+	dzone.DeleteRRset(tx, rrset)
+	dzone.IncreaseSerialNumber(tx)
+	tx.Commit()
+
+	tx, _ = dzone.Begin()
+	rrset, _ = g53.RRsetFromString("c.cn. 300 IN A 1.1.1.1")
+	dzone.DeleteRr(tx, rrset)
+	dzone.IncreaseSerialNumber(tx)
+	tx.Commit()
+
+	diffs, ok := dzone.GetDiffs(2023300522)
+	ut.Equal(t, ok, true)
+	ut.Equal(t, len(diffs), 2)
+	ut.Equal(t, soaSerial(diffs[0].OldSOA), uint32(2023300522))
+	ut.Equal(t, soaSerial(diffs[0].NewSOA), uint32(2023300523))
+	ut.Equal(t, len(diffs[0].Deleted), 1)
+	ut.Equal(t, diffs[0].Deleted[0].Name.String(false), "b.cn.")
+	ut.Equal(t, len(diffs[0].Added), 1)
+	ut.Equal(t, diffs[0].Added[0].Rdatas[0].String(), "2.2.2.2")
+	ut.Equal(t, soaSerial(diffs[1].NewSOA), uint32(2023300524))
+	ut.Equal(t, diffs[1].Deleted[0].Name.String(false), "c.cn.")
+	ut.Equal(t, len(diffs[1].Added), 0)
+
+	diffs, ok = dzone.GetDiffs(2023300523)
+	ut.Equal(t, ok, true)
+	ut.Equal(t, len(diffs), 1)
+
+	//change without serial increased breaks the journal
+	tx, _ = dzone.Begin()
+	rrset, _ = g53.RRsetFromString("d.cn. 300 IN A 1.1.1.1")
+	dzone.DeleteRRset(tx, rrset)
+	tx.Commit()
+	_, ok = dzone.GetDiffs(2023300522)
+	ut.Equal(t, ok, false)
+}
+
+func TestRollback(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	dzone := createDynamicZone("cn", dynamicZoneData)
+	updateZone(dzone, []string{"a.cn. 300 IN A 1.1.1.1"}, []string{"a.cn. 300 IN A 2.2.2.2"}, true)
+	updateZone(dzone, []string{"a.cn. 300 IN A 2.2.2.2"}, []string{"a.cn. 300 IN A 3.3.3.3", "g.cn. 300 IN A 4.4.4.4"}, true)
+	ut.Equal(t, dzone.Versions(), []uint32{2023300522, 2023300523, 2023300524})
+
+	diff, err := dzone.DiffVersions(2023300522, 2023300524)
+	ut.Assert(t, err == nil, "diff versions shouldn't fail")
+	ut.Equal(t, soaSerial(diff.OldSOA), uint32(2023300522))
+	ut.Equal(t, soaSerial(diff.NewSOA), uint32(2023300524))
+	ut.Equal(t, len(diff.Deleted), 1)
+	ut.Equal(t, diff.Deleted[0].Rdatas[0].String(), "1.1.1.1")
+	ut.Equal(t, len(diff.Added), 2)
+	ut.Equal(t, diff.Added[0].Rdatas[0].String(), "3.3.3.3")
+
+	diff, _ = dzone.DiffVersions(2023300524, 2023300523)
+	ut.Equal(t, len(diff.Deleted), 2)
+	ut.Equal(t, len(diff.Added), 1)
+	ut.Equal(t, diff.Added[0].Rdatas[0].String(), "2.2.2.2")
+
+	_, err = dzone.DiffVersions(2023300521, 2023300524)
+	ut.Equal(t, err, zn.ErrUnknownVersion)
+
+	ut.Equal(t, dzone.Rollback(2023300524), zn.ErrNoEffectiveUpdate)
+	ut.Equal(t, dzone.Rollback(1), zn.ErrUnknownVersion)
+	ut.Assert(t, dzone.Rollback(2023300522) == nil, "rollback shouldn't fail")
+	zoneHasARRset(t, dzone, "a.cn.", []string{"1.1.1.1"})
+	zoneHasARRset(t, dzone, "g.cn.", []string{})
+	ut.Equal(t, soaSerial(dzone.getSOA()), uint32(2023300525))
+
+	//rollback could be transferred incrementally
+	diffs, ok := dzone.GetDiffs(2023300524)
+	ut.Equal(t, ok, true)
+	ut.Equal(t, len(diffs), 1)
+	ut.Equal(t, len(diffs[0].Deleted), 2)
+	ut.Equal(t, len(diffs[0].Added), 1)
+}
@@ -0,0 +1,212 @@
+package memoryzone
+
+import (
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+const defaultJournalSize = 100
+
+// journal keeps the latest zone diffs in serial order, each diff begins with
+// the serial which the previous one ends with
+type journal struct {
+	diffs   []*zone.ZoneDiff
+	maxSize int
+}
+
+func newJournal(maxSize int) *journal {
+	return &journal{
+		maxSize: maxSize,
+	}
+}
+
+func (j *journal) append(diff *zone.ZoneDiff) {
+	if len(j.diffs) > 0 && soaSerial(j.diffs[len(j.diffs)-1].NewSOA) != soaSerial(diff.OldSOA) {
+		j.clear()
+	}
+
+	j.diffs = append(j.diffs, diff)
+	if len(j.diffs) > j.maxSize {
+		j.diffs = j.diffs[len(j.diffs)-j.maxSize:]
+	}
+}
+
+func (j *journal) clear() {
+	j.diffs = nil
+}
+
+func (j *journal) diffsSince(serial uint32) ([]*zone.ZoneDiff, bool) {
+	for i, diff := range j.diffs {
+		if soaSerial(diff.OldSOA) == serial {
+			diffs := make([]*zone.ZoneDiff, len(j.diffs)-i)
+			copy(diffs, j.diffs[i:])
+			return diffs, true
+		}
+	}
+	return nil, false
+}
+
+// serials of the versions which could be restored, the last one is the
+// current version
+func (j *journal) versions(current *g53.RRset) []uint32 {
+	versions := make([]uint32, 0, len(j.diffs)+1)
+	for _, diff := range j.diffs {
+		versions = append(versions, soaSerial(diff.OldSOA))
+	}
+	return append(versions, soaSerial(current))
+}
+
+// changes from one version to another, version could be older or newer
+func (j *journal) diffBetween(from, to uint32) (*zone.ZoneDiff, bool) {
+	i, ok := j.versionIndex(from)
+	if ok == false {
+		return nil, false
+	}
+	k, ok := j.versionIndex(to)
+	if ok == false {
+		return nil, false
+	}
+
+	if i <= k {
+		return composeDiffs(j.versionSOA(i), j.versionSOA(k), j.diffs[i:k]), true
+	} else {
+		return invertDiff(composeDiffs(j.versionSOA(k), j.versionSOA(i), j.diffs[k:i])), true
+	}
+}
+
+// version i is the zone before diff i is applied, and version len(diffs)
+// is the current one
+func (j *journal) versionIndex(serial uint32) (int, bool) {
+	for i, diff := range j.diffs {
+		if soaSerial(diff.OldSOA) == serial {
+			return i, true
+		}
+	}
+	if len(j.diffs) > 0 && soaSerial(j.diffs[len(j.diffs)-1].NewSOA) == serial {
+		return len(j.diffs), true
+	}
+	return 0, false
+}
+
+func (j *journal) versionSOA(i int) *g53.RRset {
+	if i < len(j.diffs) {
+		return j.diffs[i].OldSOA
+	}
+	return j.diffs[i-1].NewSOA
+}
+
+// merge successive diffs into one, rr deleted then added again or added
+// then deleted again is no change
+func composeDiffs(oldSOA, newSOA *g53.RRset, diffs []*zone.ZoneDiff) *zone.ZoneDiff {
+	deleted, added := newRRSet(), newRRSet()
+	for _, diff := range diffs {
+		for _, rr := range splitRRsets(diff.Deleted) {
+			if added.remove(rr) == false {
+				deleted.add(rr)
+			}
+		}
+		for _, rr := range splitRRsets(diff.Added) {
+			if deleted.remove(rr) == false {
+				added.add(rr)
+			}
+		}
+	}
+
+	return &zone.ZoneDiff{
+		OldSOA:  oldSOA,
+		Deleted: deleted.rrs(),
+		NewSOA:  newSOA,
+		Added:   added.rrs(),
+	}
+}
+
+func invertDiff(diff *zone.ZoneDiff) *zone.ZoneDiff {
+	return &zone.ZoneDiff{
+		OldSOA:  diff.NewSOA,
+		Deleted: diff.Added,
+		NewSOA:  diff.OldSOA,
+		Added:   diff.Deleted,
+	}
+}
+
+func splitRRsets(rrsets []*g53.RRset) []*g53.RRset {
+	var rrs []*g53.RRset
+	for _, rrset := range rrsets {
+		for _, rdata := range rrset.Rdatas {
+			rrs = append(rrs, rrsetWithRdatas(rrset, []g53.Rdata{rdata}))
+		}
+	}
+	return rrs
+}
+
+// rrs with one rdata in insertion order
+type rrSet struct {
+	keys  []string
+	rrMap map[string]*g53.RRset
+}
+
+func newRRSet() *rrSet {
+	return &rrSet{
+		rrMap: make(map[string]*g53.RRset),
+	}
+}
+
+func (s *rrSet) add(rr *g53.RRset) {
+	key := rr.String()
+	if _, ok := s.rrMap[key]; ok == false {
+		s.keys = append(s.keys, key)
+		s.rrMap[key] = rr
+	}
+}
+
+func (s *rrSet) remove(rr *g53.RRset) bool {
+	key := rr.String()
+	if _, ok := s.rrMap[key]; ok {
+		delete(s.rrMap, key)
+		return true
+	}
+	return false
+}
+
+func (s *rrSet) rrs() []*g53.RRset {
+	//key is appended again if rr is removed then added
+	var rrs []*g53.RRset
+	visited := make(map[string]struct{})
+	for _, key := range s.keys {
+		if _, ok := visited[key]; ok {
+			continue
+		}
+		visited[key] = struct{}{}
+		if rr, ok := s.rrMap[key]; ok {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+func soaSerial(soa *g53.RRset) uint32 {
+	return soa.Rdatas[0].(*g53.SOA).Serial
+}
+
+func genZoneDiff(old, new *MemoryZone, names []*g53.Name) *zone.ZoneDiff {
+	diff := &zone.ZoneDiff{
+		OldSOA: old.getSOA(),
+		NewSOA: new.getSOA(),
+	}
+
+	visited := make(map[string]struct{})
+	for _, name := range names {
+		key := strings.ToLower(name.String(false))
+		if _, ok := visited[key]; ok {
+			continue
+		}
+		visited[key] = struct{}{}
+
+		deleted, added := rrsetsDiff(old.getRRsets(name), new.getRRsets(name))
+		diff.Deleted = append(diff.Deleted, deleted...)
+		diff.Added = append(diff.Added, added...)
+	}
+	return diff
+}
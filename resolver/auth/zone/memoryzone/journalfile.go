@@ -0,0 +1,285 @@
+package memoryzone
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/rdata"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+var (
+	ErrInvalidJournal = errors.New("journal file is corrupted")
+	ErrJournalBroken  = errors.New("journal doesn't follow the serial of zone")
+)
+
+// each transaction is a block in journal file, the old soa and deleted rrs
+// are prefixed with -, the new soa and added rrs are prefixed with +, a
+// block isn't complete without the end line, which is left by crash
+// during write
+//
+//	begin 1 2
+//	- example.com. 3600 IN SOA ...
+//	- a.example.com. 3600 IN A 1.1.1.1
+//	+ example.com. 3600 IN SOA ...
+//	+ a.example.com. 3600 IN A 2.2.2.2
+//	end
+const (
+	journalBegin   = "begin"
+	journalEnd     = "end"
+	journalDeleted = "- "
+	journalAdded   = "+ "
+)
+
+// snapshot and journal of zone, journal is merged into snapshot when
+// compacted, snapshot is owned by server, it's the backup file of secondary
+// zone, zone file written by hand isn't used as snapshot since comments and
+// directives in it would be lost
+type journalFile struct {
+	snapshot string
+	path     string
+	lock     sync.Mutex
+	//diffs written since last compaction
+	entries int
+}
+
+func newJournalFile(snapshot, path string) *journalFile {
+	return &journalFile{
+		snapshot: snapshot,
+		path:     path,
+	}
+}
+
+func (jf *journalFile) pendingEntries() int {
+	jf.lock.Lock()
+	defer jf.lock.Unlock()
+	return jf.entries
+}
+
+func (jf *journalFile) append(diff *zone.ZoneDiff) error {
+	jf.lock.Lock()
+	defer jf.lock.Unlock()
+
+	f, err := os.OpenFile(jf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(encodeDiff(diff)); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	jf.entries += 1
+	return nil
+}
+
+// write zone into snapshot and replace journal with diffs which are kept
+// for ixfr and history, each file is replaced atomically
+func (jf *journalFile) compact(rrsets []*g53.RRset, diffs []*zone.ZoneDiff) error {
+	jf.lock.Lock()
+	defer jf.lock.Unlock()
+
+	var zoneBuf bytes.Buffer
+	for _, rrset := range rrsets {
+		zoneBuf.WriteString(rdata.RRsetString(rrset))
+	}
+	if err := replaceFile(jf.snapshot, zoneBuf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := jf.rewrite(diffs); err != nil {
+		return err
+	}
+	jf.entries = 0
+	return nil
+}
+
+func (jf *journalFile) touch(t time.Time) error {
+	jf.lock.Lock()
+	defer jf.lock.Unlock()
+	return os.Chtimes(jf.snapshot, t, t)
+}
+
+// caller should hold the lock
+func (jf *journalFile) rewrite(diffs []*zone.ZoneDiff) error {
+	var buf bytes.Buffer
+	for _, diff := range diffs {
+		buf.Write(encodeDiff(diff))
+	}
+	return replaceFile(jf.path, buf.Bytes())
+}
+
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func encodeDiff(diff *zone.ZoneDiff) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d %d\n", journalBegin, soaSerial(diff.OldSOA), soaSerial(diff.NewSOA))
+	encodeRRsets(&buf, journalDeleted, append([]*g53.RRset{diff.OldSOA}, diff.Deleted...))
+	encodeRRsets(&buf, journalAdded, append([]*g53.RRset{diff.NewSOA}, diff.Added...))
+	buf.WriteString(journalEnd)
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func encodeRRsets(buf *bytes.Buffer, prefix string, rrsets []*g53.RRset) {
+	for _, rrset := range rrsets {
+		for _, line := range strings.Split(strings.TrimSpace(rdata.RRsetString(rrset)), "\n") {
+			buf.WriteString(prefix)
+			buf.WriteString(line)
+			buf.WriteString("\n")
+		}
+	}
+}
+
+// read diffs in journal file, nonexistent file has no diff, incomplete
+// block at the end is ignored
+func readJournalFile(path string) ([]*zone.ZoneDiff, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var diffs []*zone.ZoneDiff
+	var current *zone.ZoneDiff
+	var lastRRset *g53.RRset
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum += 1
+		line := scanner.Text()
+		if current == nil {
+			if err := parseBlockBegin(line); err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNum, err.Error())
+			}
+			current = &zone.ZoneDiff{}
+			lastRRset = nil
+			continue
+		}
+
+		if line == journalEnd {
+			if current.OldSOA == nil || current.NewSOA == nil {
+				return nil, fmt.Errorf("line %d: %s", lineNum, ErrInvalidJournal.Error())
+			}
+			diffs = append(diffs, current)
+			current = nil
+			continue
+		}
+
+		var isAdded bool
+		if strings.HasPrefix(line, journalAdded) {
+			isAdded = true
+		} else if strings.HasPrefix(line, journalDeleted) == false {
+			return nil, fmt.Errorf("line %d: %s", lineNum, ErrInvalidJournal.Error())
+		}
+		rrset, err := rdata.RRsetFromString(line[len(journalAdded):])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err.Error())
+		}
+
+		//rrs of same rrset are on adjacent lines
+		if lastRRset != nil && lastRRset.IsSameRRset(rrset) && lastRRset.Type != g53.RR_SOA {
+			lastRRset.Rdatas = append(lastRRset.Rdatas, rrset.Rdatas[0])
+			continue
+		}
+		lastRRset = rrset
+		if err := addToDiff(current, rrset, isAdded); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+func parseBlockBegin(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0] != journalBegin {
+		return ErrInvalidJournal
+	}
+	for _, serial := range fields[1:] {
+		if _, err := strconv.ParseUint(serial, 10, 32); err != nil {
+			return ErrInvalidJournal
+		}
+	}
+	return nil
+}
+
+// the first deleted and the first added rr are the old and new soa
+func addToDiff(diff *zone.ZoneDiff, rrset *g53.RRset, isAdded bool) error {
+	if isAdded {
+		if diff.NewSOA == nil {
+			if rrset.Type != g53.RR_SOA || diff.OldSOA == nil {
+				return ErrInvalidJournal
+			}
+			diff.NewSOA = rrset
+		} else {
+			diff.Added = append(diff.Added, rrset)
+		}
+	} else {
+		if diff.OldSOA == nil {
+			if rrset.Type != g53.RR_SOA {
+				return ErrInvalidJournal
+			}
+			diff.OldSOA = rrset
+		} else if diff.NewSOA != nil {
+			return ErrInvalidJournal
+		} else {
+			diff.Deleted = append(diff.Deleted, rrset)
+		}
+	}
+	return nil
+}
+
+// apply diff to zone whose serial is the old serial of diff, zone
+// integrity is checked after all diffs are applied
+func (z *MemoryZone) applyDiff(diff *zone.ZoneDiff) error {
+	for _, rrset := range diff.Deleted {
+		if _, err := z.removeRdatas(rrset); err != nil {
+			return err
+		}
+	}
+
+	for _, rrset := range diff.Added {
+		if err := z.addRRset(rrset.Clone()); err != nil {
+			return err
+		}
+	}
+
+	z.originNode.Data().(NameNode)[g53.RR_SOA] = diff.NewSOA.Clone()
+	return nil
+}
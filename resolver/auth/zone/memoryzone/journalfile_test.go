@@ -0,0 +1,110 @@
+package memoryzone
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
+	zn "github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+func updateZone(zone *DynamicZone, deleted, added []string, increaseSerial bool) error {
+	tx, _ := zone.Begin()
+	for _, rr := range deleted {
+		rrset, _ := rdata.RRsetFromString(rr)
+		zone.DeleteRr(tx, rrset)
+	}
+	for _, rr := range added {
+		rrset, _ := rdata.RRsetFromString(rr)
+		zone.Add(tx, rrset)
+	}
+	if increaseSerial {
+		zone.IncreaseSerialNumber(tx)
+	}
+	return tx.Commit()
+}
+
+func TestJournalReplay(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	dir, _ := ioutil.TempDir("", "journal")
+	defer os.RemoveAll(dir)
+	zoneFile, journalFile := filepath.Join(dir, "cn"), filepath.Join(dir, "cn.jnl")
+
+	dzone := createDynamicZone("cn", dynamicZoneData)
+	ut.Assert(t, dzone.EnableJournal(zoneFile, journalFile) == nil, "enable journal shouldn't fail")
+	ut.Assert(t, updateZone(dzone, []string{"a.cn. 300 IN A 1.1.1.1"}, []string{"a.cn. 300 IN A 2.2.2.2", "txt.cn. 300 IN TXT \"a b\" \"c\""}, true) == nil, "update zone shouldn't fail")
+	ut.Assert(t, updateZone(dzone, nil, []string{"cn. 300 IN NS ns2.cn.", "ns2.cn. 300 IN A 3.3.3.3", "cn. 300 IN CAA 0 issue \"ca.cn\"", "cn. 300 IN TYPE65534 \\# 2 0102"}, true) == nil, "update zone shouldn't fail")
+	ut.Equal(t, len(dzone.History()), 2)
+
+	//incomplete block is left by crash
+	f, _ := os.OpenFile(journalFile, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("begin 2023300524 2023300525\n- cn.\t300\tIN\tSOA\ta.dns.cn. root.cnnic.cn. 2023300524 7200 3600 2419200 21600\n")
+	f.Close()
+
+	replayed := createDynamicZone("cn", dynamicZoneData)
+	ut.Assert(t, replayed.EnableJournal(zoneFile, journalFile) == nil, "replay journal shouldn't fail")
+	zoneHasARRset(t, replayed, "a.cn.", []string{"2.2.2.2"})
+	zoneHasARRset(t, replayed, "ns2.cn.", []string{"3.3.3.3"})
+	result := replayed.Find(g53.NameFromStringUnsafe("cn."), g53.RR_NS, zn.DefaultFind).GetResult()
+	ut.Equal(t, result.RRset.RRCount(), 2)
+	result = replayed.Find(g53.NameFromStringUnsafe("txt.cn."), g53.RR_TXT, zn.DefaultFind).GetResult()
+	ut.Equal(t, result.RRset.Rdatas[0].String(), "\"a b\" \"c\"")
+	result = replayed.Find(g53.NameFromStringUnsafe("cn."), g53.RR_CAA, zn.DefaultFind).GetResult()
+	ut.Equal(t, result.RRset.Rdatas[0].String(), "0 issue \"ca.cn\"")
+	result = replayed.Find(g53.NameFromStringUnsafe("cn."), g53.RRType(65534), zn.DefaultFind).GetResult()
+	ut.Equal(t, result.RRset.Rdatas[0].String(), "\\# 2 0102")
+	diffs, ok := replayed.GetDiffs(2023300522)
+	ut.Equal(t, ok, true)
+	ut.Equal(t, len(diffs), 2)
+	ut.Equal(t, soaSerial(diffs[1].NewSOA), uint32(2023300524))
+
+	//incomplete block is dropped when journal is replayed
+	diffs, err := readJournalFile(journalFile)
+	ut.Assert(t, err == nil, "read journal shouldn't fail")
+	ut.Equal(t, len(diffs), 2)
+	content, _ := ioutil.ReadFile(journalFile)
+	ut.Equal(t, strings.Contains(string(content), "2023300525"), false)
+
+	//diffs before serial of zone file aren't replayed
+	ut.Assert(t, replayed.Compact() == nil, "compact shouldn't fail")
+	content, _ = ioutil.ReadFile(zoneFile)
+	ut.Equal(t, strings.Contains(string(content), "a.cn.\t300\tIN\tA\t2.2.2.2"), true)
+	rrsets, _ := replayed.Dump()
+	var rrs []string
+	for _, rrset := range rrsets {
+		rrs = append(rrs, strings.Split(strings.TrimSpace(rdata.RRsetString(rrset)), "\n")...)
+	}
+	compacted := createDynamicZone("cn", rrs)
+	ut.Assert(t, compacted.EnableJournal(zoneFile, journalFile) == nil, "replay journal shouldn't fail")
+	zoneHasARRset(t, compacted, "a.cn.", []string{"2.2.2.2"})
+	_, ok = compacted.GetDiffs(2023300522)
+	ut.Equal(t, ok, true)
+
+	//change without serial increased is saved into zone file directly
+	ut.Assert(t, updateZone(compacted, nil, []string{"b.cn. 300 IN A 4.4.4.4"}, false) == nil, "update zone shouldn't fail")
+	ut.Equal(t, len(compacted.History()), 0)
+	content, _ = ioutil.ReadFile(zoneFile)
+	ut.Equal(t, strings.Contains(string(content), "b.cn.\t300\tIN\tA\t4.4.4.4"), true)
+	content, _ = ioutil.ReadFile(journalFile)
+	ut.Equal(t, len(content), 0)
+}
+
+func TestJournalBroken(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	dir, _ := ioutil.TempDir("", "journal")
+	defer os.RemoveAll(dir)
+	zoneFile, journalFile := filepath.Join(dir, "cn"), filepath.Join(dir, "cn.jnl")
+
+	ioutil.WriteFile(journalFile, []byte("begin 1 2\n+ a.cn. 300 IN A 1.1.1.1\nend\n"), 0644)
+	dzone := createDynamicZone("cn", dynamicZoneData)
+	ut.Assert(t, dzone.EnableJournal(zoneFile, journalFile) != nil, "journal without soa should be rejected")
+
+	ioutil.WriteFile(journalFile, []byte("not a journal\n"), 0644)
+	ut.Assert(t, dzone.EnableJournal(zoneFile, journalFile) != nil, "invalid journal should be rejected")
+}
@@ -1,8 +1,11 @@
 package memoryzone
 
 import (
+	"sort"
+
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/g53/domaintree"
+	rd "github.com/zdnscloud/vanguard/rdata"
 	"github.com/zdnscloud/vanguard/resolver/auth/zone"
 )
 
@@ -22,12 +25,16 @@ type MemoryZone struct {
 	origin     *g53.Name
 	originNode *domaintree.Node
 	domains    *domaintree.DomainTree
+	signatures *signatures
 }
 
 type memoryZoneFinderCtx struct {
 	result zone.FindResult
 	node   NameNode
 	finder *MemoryZone
+	name   *g53.Name
+	//wildcard name if result is synthesized from it
+	wildcard *g53.Name
 }
 
 func (ctx *memoryZoneFinderCtx) GetResult() *zone.FindResult {
@@ -45,12 +52,52 @@ func (ctx *memoryZoneFinderCtx) GetAdditional() []*g53.RRset {
 				addrs = append(addrs, ctx.finder.getAdditioanlAddrs(rdata.(*g53.MX).Exchange)...)
 			} else if rrset.Type == g53.RR_SRV {
 				addrs = append(addrs, ctx.finder.getAdditioanlAddrs(rdata.(*g53.SRV).Target)...)
+			} else if rrset.Type == rd.RR_SVCB || rrset.Type == rd.RR_HTTPS {
+				if target := svcbTarget(rrset.Name, rdata.(*rd.SVCB)); target != nil {
+					addrs = append(addrs, ctx.finder.getAdditioanlAddrs(target)...)
+				}
 			}
 		}
 	}
 	return addrs
 }
 
+// rrsig of synthesized rrset is the one of wildcard with owner replaced
+func (ctx *memoryZoneFinderCtx) GetSignatures(rrset *g53.RRset) *g53.RRset {
+	if ctx.finder.signatures == nil {
+		return nil
+	}
+
+	if ctx.wildcard == nil || rrset != ctx.result.RRset {
+		return ctx.finder.signatures.getSignatures(rrset.Name, rrset.Type)
+	}
+	sigs := ctx.finder.signatures.getSignatures(ctx.wildcard, rrset.Type)
+	if sigs == nil {
+		return nil
+	}
+	synthesis := *sigs
+	synthesis.Name = rrset.Name
+	return &synthesis
+}
+
+func (ctx *memoryZoneFinderCtx) GetDenial() []*g53.RRset {
+	if ctx.finder.signatures == nil {
+		return nil
+	}
+	return ctx.finder.signatures.denial(ctx.result.Type, ctx.name, ctx.wildcard, ctx.finder.origin)
+}
+
+// root target is the owner name in ServiceMode, and means the service
+// doesn't exist in AliasMode
+func svcbTarget(owner *g53.Name, svcb *rd.SVCB) *g53.Name {
+	if svcb.Target.IsRoot() == false {
+		return svcb.Target
+	} else if svcb.IsAliasMode() {
+		return nil
+	}
+	return owner
+}
+
 type findState struct {
 	zonecut NameNode
 	rrset   *g53.RRset
@@ -93,8 +140,34 @@ func zoneCutCallback(node *domaintree.Node, param interface{}) bool {
 	return state.option != zone.GlueOkFind
 }
 
+// soa is the first rrset, which is required by axfr
 func (z *MemoryZone) dump() ([]*g53.RRset, error) {
-	return nil, nil
+	soa := z.getSOA()
+	if soa == nil {
+		return nil, zone.ErrShortOfSOA
+	}
+
+	rrsets := []*g53.RRset{soa}
+	z.domains.ForEach(func(node *domaintree.Node) {
+		if node.IsEmpty() {
+			return
+		}
+
+		for typ, rrset := range node.Data().(NameNode) {
+			if typ != g53.RR_SOA || node != z.originNode {
+				rrsets = append(rrsets, rrset)
+			}
+		}
+	})
+	return rrsets, nil
+}
+
+func (z *MemoryZone) getSOA() *g53.RRset {
+	data := z.originNode.Data()
+	if data == nil {
+		return nil
+	}
+	return data.(NameNode)[g53.RR_SOA]
 }
 
 func (z *MemoryZone) find(name *g53.Name, typ g53.RRType, option zone.FindOption) *memoryZoneFinderCtx {
@@ -105,6 +178,7 @@ func (z *MemoryZone) find(name *g53.Name, typ g53.RRType, option zone.FindOption
 
 	ctx := &memoryZoneFinderCtx{
 		finder: z,
+		name:   name,
 	}
 	node, ret := z.domains.SearchExt(name, nodePath, zoneCutCallback, findState)
 	switch ret {
@@ -131,6 +205,7 @@ func (z *MemoryZone) find(name *g53.Name, typ g53.RRType, option zone.FindOption
 			}
 
 			nameNode := wildcard.Data().(NameNode)
+			ctx.wildcard = wildcardName
 			if rrset, ok := nameNode[typ]; ok {
 				synthesis := *rrset
 				synthesis.Name = name
@@ -172,7 +247,18 @@ func (z *MemoryZone) find(name *g53.Name, typ g53.RRType, option zone.FindOption
 
 	nameNode := node.Data().(NameNode)
 	ctx.node = nameNode
-	if node.GetFlag(domaintree.NF_CALLBACK) && node != z.originNode {
+	if node == z.originNode && z.signatures != nil {
+		if rrset := z.signatures.apexRRset(typ); rrset != nil {
+			ctx.result = zone.FindResult{
+				Type:  zone.FRSuccess,
+				RRset: rrset,
+			}
+			return ctx
+		}
+	}
+
+	//ds at zone cut belongs to parent zone, RFC 4035 3.1.4.1
+	if node.GetFlag(domaintree.NF_CALLBACK) && node != z.originNode && typ != g53.RR_DS {
 		if ns, ok := nameNode[g53.RR_NS]; ok {
 			ctx.result = zone.FindResult{
 				Type:  zone.FRDelegation,
@@ -388,6 +474,21 @@ func (z *MemoryZone) getNode(name *g53.Name) (*domaintree.Node, error) {
 	return node, nil
 }
 
+func (z *MemoryZone) getRRsets(name *g53.Name) []*g53.RRset {
+	node, err := z.getNode(name)
+	if err != nil {
+		return nil
+	}
+
+	var rrsets []*g53.RRset
+	for _, rrset := range node.Data().(NameNode) {
+		rrsets = append(rrsets, rrset)
+	}
+	//keep diff and dump of the name stable
+	sort.Slice(rrsets, func(i, j int) bool { return rrsets[i].Type < rrsets[j].Type })
+	return rrsets
+}
+
 func (z *MemoryZone) deleteNode(name *g53.Name) {
 	z.domains.Remove(name)
 	if name.IsWildCard() {
@@ -446,7 +547,12 @@ func (z *MemoryZone) deleteRr(rrset *g53.RRset) (*domaintree.Node, error) {
 	if err := z.checkRRsetCouldBeDeleted(rrset); err != nil {
 		return nil, err
 	}
+	return z.removeRdatas(rrset)
+}
 
+// remove rdatas without checking zone integrity, which is checked after
+// the whole change is done
+func (z *MemoryZone) removeRdatas(rrset *g53.RRset) (*domaintree.Node, error) {
 	node, err := z.getNode(rrset.Name)
 	if err != nil {
 		return nil, err
@@ -510,7 +616,68 @@ func (z *MemoryZone) increaseSerialNumber() {
 		panic("zone soa rr isn't one")
 	}
 
-	soa.Rdatas[0].(*g53.SOA).Serial += 1
+	//soa is shared with the zone before clone, so modify a copy of it
+	newSOA := soa.Clone()
+	rdata := *soa.Rdatas[0].(*g53.SOA)
+	rdata.Serial += 1
+	newSOA.Rdatas[0] = &rdata
+	data.(NameNode)[g53.RR_SOA] = newSOA
+}
+
+// rrsets which are deleted from old ones and added in new ones, soa isn't
+// included, rrset with ttl modified is deleted and then added
+func rrsetsDiff(old, new []*g53.RRset) ([]*g53.RRset, []*g53.RRset) {
+	var deleted, added []*g53.RRset
+	for _, oldRRset := range old {
+		if oldRRset.Type == g53.RR_SOA {
+			continue
+		}
+
+		newRRset := findRRsetWithType(new, oldRRset.Type)
+		if newRRset == nil || newRRset.Ttl != oldRRset.Ttl {
+			deleted = append(deleted, oldRRset)
+			continue
+		}
+
+		if rdatas := rdatasDiff(oldRRset.Rdatas, newRRset.Rdatas); len(rdatas) > 0 {
+			deleted = append(deleted, rrsetWithRdatas(oldRRset, rdatas))
+		}
+		if rdatas := rdatasDiff(newRRset.Rdatas, oldRRset.Rdatas); len(rdatas) > 0 {
+			added = append(added, rrsetWithRdatas(newRRset, rdatas))
+		}
+	}
+
+	for _, newRRset := range new {
+		if newRRset.Type == g53.RR_SOA {
+			continue
+		}
+
+		oldRRset := findRRsetWithType(old, newRRset.Type)
+		if oldRRset == nil || oldRRset.Ttl != newRRset.Ttl {
+			added = append(added, newRRset)
+		}
+	}
+
+	return deleted, added
+}
+
+func findRRsetWithType(rrsets []*g53.RRset, typ g53.RRType) *g53.RRset {
+	for _, rrset := range rrsets {
+		if rrset.Type == typ {
+			return rrset
+		}
+	}
+	return nil
+}
+
+func rrsetWithRdatas(rrset *g53.RRset, rdatas []g53.Rdata) *g53.RRset {
+	return &g53.RRset{
+		Name:   rrset.Name,
+		Type:   rrset.Type,
+		Class:  rrset.Class,
+		Ttl:    rrset.Ttl,
+		Rdatas: rdatas,
+	}
 }
 
 func cloneNode(v interface{}) interface{} {
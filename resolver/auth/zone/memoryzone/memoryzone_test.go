@@ -6,6 +6,7 @@ import (
 
 	ut "github.com/zdnscloud/cement/unittest"
 	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/rdata"
 	zn "github.com/zdnscloud/vanguard/resolver/auth/zone"
 )
 
@@ -31,7 +32,7 @@ var zoneData = []string{
 func createZone(name string, data []string) *MemoryZone {
 	zone := newMemoryZone(g53.NameFromStringUnsafe(name))
 	for _, rr := range data {
-		rrset, err := g53.RRsetFromString(rr)
+		rrset, err := rdata.RRsetFromString(rr)
 		if err != nil {
 			panic(fmt.Sprintf("rr %s isn't valid %vs", rr, err.Error()))
 		}
@@ -316,3 +317,35 @@ func TestGlueFind(t *testing.T) {
 	ut.Equal(t, glue[0].Type, g53.RR_A)
 	ut.Equal(t, glue[0].Rdatas[0].String(), "1.1.1.4")
 }
+
+func TestSVCBAdditional(t *testing.T) {
+	var zoneData = []string{
+		"example.org. 300 IN SOA xxx.net. ns.example.org. 100 1800 900 604800 86400",
+		"example.org. 300 IN NS ns.example.org.",
+		"ns.example.org. 300 IN A 192.0.2.2",
+		"example.org. 300 IN HTTPS 0 svc.example.org.",
+		"svc.example.org. 300 IN HTTPS 1 . alpn=\"h2\"",
+		"svc.example.org. 300 IN AAAA 2001:db8::1",
+		"_dns.example.org. 300 IN SVCB 1 ns.example.org. alpn=\"dot\"",
+		"none.example.org. 300 IN HTTPS 0 .",
+	}
+	zone := createZone("example.org.", zoneData)
+	for _, c := range []struct {
+		name       string
+		typ        g53.RRType
+		additional string
+	}{
+		{"example.org.", rdata.RR_HTTPS, "svc.example.org."},
+		{"svc.example.org.", rdata.RR_HTTPS, "svc.example.org."},
+		{"_dns.example.org.", rdata.RR_SVCB, "ns.example.org."},
+	} {
+		ctx := zone.find(g53.NameFromStringUnsafe(c.name), c.typ, zn.DefaultFind)
+		ut.Equal(t, ctx.GetResult().Type, zn.FRSuccess)
+		additional := ctx.GetAdditional()
+		ut.Equal(t, len(additional), 1)
+		ut.Equal(t, additional[0].Name.String(false), c.additional)
+	}
+
+	ctx := zone.find(g53.NameFromStringUnsafe("none.example.org."), rdata.RR_HTTPS, zn.DefaultFind)
+	ut.Equal(t, len(ctx.GetAdditional()), 0)
+}
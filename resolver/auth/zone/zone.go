@@ -3,8 +3,12 @@ package zone
 import (
 	"errors"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/dnssec"
+	"github.com/zdnscloud/vanguard/rdata"
 )
 
 var (
@@ -24,6 +28,10 @@ var (
 	ErrNoZonesUpdateAcls          = errors.New("no such zone for update acls")
 	ErrNoZonesUpdateRole          = errors.New("no such zone for update role")
 	ErrAbortLoad                  = errors.New("data invalid and abandon")
+	ErrUnknownNotifyMode          = errors.New("notify mode should be yes, explicit or no")
+	ErrUnknownVersion             = errors.New("zone version isn't kept in journal")
+	ErrNoSigningKey               = errors.New("no key to sign zone")
+	ErrSigningKeyOwner            = errors.New("signing key doesn't belong to zone")
 )
 
 var SupportRRTypes = []g53.RRType{
@@ -40,6 +48,16 @@ var SupportRRTypes = []g53.RRType{
 	g53.RR_NAPTR,
 	g53.RR_OPT,
 	g53.RR_DNAME,
+	g53.RR_CAA,
+	g53.RR_SSHFP,
+	g53.RR_TLSA,
+	g53.RR_DS,
+	g53.RR_DNSKEY,
+	rdata.RR_SVCB,
+	rdata.RR_HTTPS,
+	g53.RR_URI,
+	g53.RR_LOC,
+	g53.RR_CERT,
 }
 
 type ResultType int
@@ -70,6 +88,17 @@ type FinderContext interface {
 	GetAdditional() []*g53.RRset
 }
 
+// context returned by signed zone, which provides dnssec records for
+// requests with DO bit set
+type SignedFinderContext interface {
+	FinderContext
+	// rrsig of the rrset found in zone, nil if rrset isn't signed
+	GetSignatures(*g53.RRset) *g53.RRset
+	// nsec or nsec3 rrsets with their rrsigs, which prove the name or type
+	// doesn't exist, or there is no closer match than the wildcard
+	GetDenial() []*g53.RRset
+}
+
 type ZoneFinder interface {
 	GetOrigin() *g53.Name
 	Find(*g53.Name, g53.RRType, FindOption) FinderContext
@@ -87,6 +116,7 @@ type ZoneUpdator interface {
 	DeleteDomain(Transaction, *g53.Name) error
 	DeleteRr(Transaction, *g53.RRset) error
 	IncreaseSerialNumber(Transaction)
+	GetRRsets(Transaction, *g53.Name) []*g53.RRset
 }
 
 type ZoneLoader interface {
@@ -97,11 +127,95 @@ type ZoneTransfer interface {
 	IsMaster() bool
 	Masters() []string
 	SetMasters([]string)
+	Notify() (NotifyMode, []string)
+	SetNotify(NotifyMode, []string)
+	IsExpired() bool
+	SetExpired(bool)
+	TransferKey() *TSIGKey
+	SetTransferKey(*TSIGKey)
+	LastRefresh() time.Time
+	SetLastRefresh(time.Time)
+}
+
+// key to sign transfer request sent to masters
+type TSIGKey struct {
+	Name      string
+	Secret    string
+	Algorithm string
+}
+
+// which secondaries are notified when zone changes, explicit means only the
+// also notify addresses
+type NotifyMode string
+
+const (
+	NotifyYes      NotifyMode = "yes"
+	NotifyExplicit NotifyMode = "explicit"
+	NotifyNo       NotifyMode = "no"
+)
+
+func NotifyModeFromString(s string) (NotifyMode, error) {
+	switch mode := NotifyMode(strings.ToLower(s)); mode {
+	case "", NotifyYes:
+		return NotifyYes, nil
+	case NotifyExplicit, NotifyNo:
+		return mode, nil
+	default:
+		return "", ErrUnknownNotifyMode
+	}
 }
 
 type SafeZone interface {
 	GetUpdator(net.IP, bool) (ZoneUpdator, bool)
 	SetAcls([]string)
+	IsTransferAllowed(net.IP) bool
+	SetTransferAcls([]string)
+}
+
+// changes between two serial numbers, in the order of ixfr response
+type ZoneDiff struct {
+	OldSOA  *g53.RRset
+	Deleted []*g53.RRset
+	NewSOA  *g53.RRset
+	Added   []*g53.RRset
+}
+
+type ZoneDumper interface {
+	Dump() ([]*g53.RRset, error)
+	GetDiffs(serial uint32) ([]*ZoneDiff, bool)
+}
+
+// changes are appended to journal file and merged into snapshot when
+// compacted, so they survive restart, versions in journal are identified
+// by soa serial
+type ZoneJournal interface {
+	EnableJournal(snapshot, journalFile string) error
+	History() []*ZoneDiff
+	Compact() error
+	Versions() []uint32
+	DiffVersions(from, to uint32) (*ZoneDiff, error)
+	Rollback(serial uint32) error
+}
+
+// zone is signed with keys when dnssec is enabled, it's re-signed when
+// changes are committed, and signatures are refreshed by Resign before
+// they expire
+type ZoneSigner interface {
+	EnableDNSSEC(*SignPolicy) error
+	Resign() error
+}
+
+// ksk signs dnskey rrset, zsk signs other rrsets, key signs both if there
+// is only one kind of keys, nsec3 is used if NSEC3 is set
+type SignPolicy struct {
+	Keys       []*dnssec.Key
+	NSEC3      bool
+	Iterations uint16
+	Salt       []byte
+	// signatures are valid between an hour before signing and Validity
+	// after signing, they are regenerated when less than Refresh is left
+	Validity time.Duration
+	Refresh  time.Duration
 }
 
 type Zone interface {
@@ -109,13 +223,17 @@ type Zone interface {
 	ZoneLoader
 	ZoneTransfer
 	SafeZone
+	ZoneDumper
+	ZoneJournal
+	ZoneSigner
 }
 
+// unknown types are kept in RFC 3597 generic format
 func IsRRsetTypeSupport(typ g53.RRType) bool {
 	for _, typ_ := range SupportRRTypes {
 		if typ == typ_ {
 			return true
 		}
 	}
-	return false
+	return rdata.IsUnknownType(typ)
 }
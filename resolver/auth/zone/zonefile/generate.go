@@ -0,0 +1,144 @@
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxGenerateCount = 65536
+
+var (
+	ErrInvalidRange      = errors.New("invalid $GENERATE range")
+	ErrInvalidSubstitute = errors.New("invalid $GENERATE substitution")
+)
+
+// $GENERATE start-stop[/step] lhs [ttl] [class] type rhs, which is a BIND
+// extension, $ in lhs and rhs is replaced with the iterator
+func (p *parser) generate(args []token) error {
+	if len(args) < 4 {
+		return ErrDirectiveArgument
+	}
+
+	start, stop, step, err := parseRange(args[0].text)
+	if err != nil {
+		return err
+	}
+
+	lhs, rest := args[1], args[2:]
+	for i := start; i <= stop; i += step {
+		name, err := substitute(lhs.text, i)
+		if err != nil {
+			return err
+		}
+		owner, err := resolveName(name, p.origin)
+		if err != nil {
+			return err
+		}
+
+		tokens := append([]token(nil), rest...)
+		rhs := &tokens[len(tokens)-1]
+		if rhs.text, err = substitute(rhs.text, i); err != nil {
+			return err
+		}
+
+		rrset, err := p.parseRR(owner, tokens)
+		if err != nil {
+			return err
+		}
+		if err := p.emit(rrset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseRange(s string) (int, int, int, error) {
+	step := 1
+	if i := strings.IndexByte(s, '/'); i != -1 {
+		var err error
+		if step, err = strconv.Atoi(s[i+1:]); err != nil || step <= 0 {
+			return 0, 0, 0, ErrInvalidRange
+		}
+		s = s[:i]
+	}
+
+	bounds := strings.Split(s, "-")
+	if len(bounds) != 2 {
+		return 0, 0, 0, ErrInvalidRange
+	}
+	start, err := strconv.Atoi(bounds[0])
+	if err != nil || start < 0 {
+		return 0, 0, 0, ErrInvalidRange
+	}
+	stop, err := strconv.Atoi(bounds[1])
+	if err != nil || stop < start || (stop-start)/step >= maxGenerateCount {
+		return 0, 0, 0, ErrInvalidRange
+	}
+	return start, stop, step, nil
+}
+
+// $ is the iterator, ${offset[,width[,base]]} formats iterator plus offset
+// with base d, o, x or X, \$ is a literal $
+func substitute(s string, iterator int) (string, error) {
+	var result strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			result.WriteByte('$')
+			i += 1
+			continue
+		} else if c != '$' {
+			result.WriteByte(c)
+			continue
+		}
+
+		if i+1 == len(s) || s[i+1] != '{' {
+			result.WriteString(strconv.Itoa(iterator))
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end == -1 {
+			return "", ErrInvalidSubstitute
+		}
+		formatted, err := formatIterator(s[i+2:i+end], iterator)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(formatted)
+		i += end
+	}
+	return result.String(), nil
+}
+
+func formatIterator(modifier string, iterator int) (string, error) {
+	fields := strings.Split(modifier, ",")
+	if len(fields) > 3 {
+		return "", ErrInvalidSubstitute
+	}
+
+	offset, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return "", ErrInvalidSubstitute
+	}
+
+	width := 0
+	if len(fields) > 1 {
+		if width, err = strconv.Atoi(fields[1]); err != nil || width < 0 {
+			return "", ErrInvalidSubstitute
+		}
+	}
+
+	base := "d"
+	if len(fields) > 2 {
+		base = fields[2]
+	}
+	switch base {
+	case "d", "o", "x", "X":
+	default:
+		return "", ErrInvalidSubstitute
+	}
+	return fmt.Sprintf("%0*"+base, width, iterator+offset), nil
+}
@@ -0,0 +1,175 @@
+package zonefile
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrUnbalancedParen   = errors.New("parentheses aren't in pair")
+	ErrUnterminatedQuote = errors.New("quote isn't closed")
+)
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// one logical record of master file, which could span multiple lines
+// with parentheses
+type record struct {
+	tokens []token
+	line   int
+	//owner is omitted when line begins with blank
+	blankStart bool
+}
+
+type lexer struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func newLexer(r io.Reader) *lexer {
+	return &lexer{
+		reader: bufio.NewReader(r),
+		line:   1,
+	}
+}
+
+// nil record is returned at the end of input, empty lines and lines with
+// only comment are skipped
+func (l *lexer) next() (*record, error) {
+	for {
+		r, err := l.nextRecord()
+		if err != nil || r == nil || len(r.tokens) > 0 {
+			return r, err
+		}
+	}
+}
+
+func (l *lexer) nextRecord() (*record, error) {
+	r := &record{line: l.line}
+	parenDepth := 0
+	atLineStart := true
+	var current strings.Builder
+	inToken := false
+
+	endToken := func() {
+		if inToken {
+			r.tokens = append(r.tokens, token{text: current.String()})
+			current.Reset()
+			inToken = false
+		}
+	}
+
+	for {
+		c, _, err := l.reader.ReadRune()
+		if err == io.EOF {
+			endToken()
+			if parenDepth != 0 {
+				return nil, ErrUnbalancedParen
+			}
+			if len(r.tokens) == 0 && atLineStart {
+				return nil, nil
+			}
+			return r, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch c {
+		case '\n':
+			endToken()
+			l.line += 1
+			if parenDepth == 0 {
+				return r, nil
+			}
+		case ' ', '\t', '\r':
+			if atLineStart {
+				r.blankStart = true
+			}
+			endToken()
+		case ';':
+			endToken()
+			if err := l.skipComment(); err != nil {
+				return nil, err
+			}
+		case '(':
+			endToken()
+			parenDepth += 1
+		case ')':
+			endToken()
+			if parenDepth == 0 {
+				return nil, ErrUnbalancedParen
+			}
+			parenDepth -= 1
+		case '"':
+			endToken()
+			text, err := l.readQuoted()
+			if err != nil {
+				return nil, err
+			}
+			r.tokens = append(r.tokens, token{text: text, quoted: true})
+		case '\\':
+			current.WriteRune(c)
+			inToken = true
+			escaped, _, err := l.reader.ReadRune()
+			if err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			current.WriteRune(escaped)
+		default:
+			current.WriteRune(c)
+			inToken = true
+		}
+		atLineStart = false
+	}
+}
+
+func (l *lexer) skipComment() error {
+	for {
+		c, _, err := l.reader.ReadRune()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if c == '\n' {
+			return l.reader.UnreadRune()
+		}
+	}
+}
+
+// escape is kept in quoted string, quoted string could span lines
+func (l *lexer) readQuoted() (string, error) {
+	var text strings.Builder
+	for {
+		c, _, err := l.reader.ReadRune()
+		if err != nil {
+			return "", ErrUnterminatedQuote
+		}
+
+		switch c {
+		case '"':
+			return text.String(), nil
+		case '\\':
+			text.WriteRune(c)
+			escaped, _, err := l.reader.ReadRune()
+			if err != nil {
+				return "", ErrUnterminatedQuote
+			}
+			text.WriteRune(escaped)
+			if escaped == '\n' {
+				l.line += 1
+			}
+		case '\n':
+			l.line += 1
+			text.WriteRune(c)
+		default:
+			text.WriteRune(c)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+const maxIncludeDepth = 16
+
+var (
+	ErrNoOwner           = errors.New("owner name is omitted in the first record")
+	ErrNoTTL             = errors.New("ttl is omitted and no default ttl is set")
+	ErrInvalidTTL        = errors.New("invalid ttl")
+	ErrShortOfType       = errors.New("rr type is missing")
+	ErrShortOfRdata      = errors.New("rdata is missing")
+	ErrUnknownDirective  = errors.New("unknown directive")
+	ErrDirectiveArgument = errors.New("invalid directive arguments")
+	ErrIncludeTooDeep    = errors.New("$INCLUDE is nested too deep")
+)
+
+// error with the position where it occurs
+type ParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err.Error())
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err.Error())
+}
+
+type RRsetHandler func(*g53.RRset) error
+
+// ErrorHandler is called with the error of invalid record, the record is
+// skipped if it returns nil, otherwise parsing stops with the returned error
+type ErrorHandler func(*ParseError) error
+
+// error returned by handlers stops parsing and is returned as it is
+type handlerError struct {
+	err error
+}
+
+func (e handlerError) Error() string {
+	return e.err.Error()
+}
+
+// rdata fields which are domain names, relative names in them are
+// completed with origin
+var nameFields = map[g53.RRType][]int{
+	g53.RR_NS:      []int{0},
+	g53.RR_CNAME:   []int{0},
+	g53.RR_DNAME:   []int{0},
+	g53.RR_PTR:     []int{0},
+	g53.RR_MX:      []int{1},
+	g53.RR_SRV:     []int{3},
+	g53.RR_SOA:     []int{0, 1},
+	g53.RR_NAPTR:   []int{5},
+	g53.RR_RP:      []int{0, 1},
+	rdata.RR_SVCB:  []int{1},
+	rdata.RR_HTTPS: []int{1},
+}
+
+// refresh, retry, expire and minimum of soa could have time unit as ttl
+var soaTimerFields = []int{3, 4, 5, 6}
+
+type parser struct {
+	origin       *g53.Name
+	defaultTTL   g53.RRTTL
+	hasTTL       bool
+	lastTTL      g53.RRTTL
+	hasLastTTL   bool
+	lastOwner    *g53.Name
+	handler      RRsetHandler
+	errHandler   ErrorHandler
+	includeDepth int
+}
+
+// Parse reads rrs in master file format, RFC 1035 5, each rr is passed to
+// handler in the order of the file, $INCLUDE file is relative to current
+// directory, parsing stops at the first invalid record if errHandler is nil,
+// unbalanced parentheses and quotes always stop parsing
+func Parse(r io.Reader, origin *g53.Name, handler RRsetHandler, errHandler ErrorHandler) error {
+	p := &parser{
+		origin:     origin,
+		handler:    handler,
+		errHandler: errHandler,
+	}
+	return unwrapHandlerError(p.parse(r, ""))
+}
+
+// ParseFile is same as Parse, except $INCLUDE file is relative to the
+// directory of the zone file
+func ParseFile(path string, origin *g53.Name, handler RRsetHandler, errHandler ErrorHandler) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p := &parser{
+		origin:     origin,
+		handler:    handler,
+		errHandler: errHandler,
+	}
+	return unwrapHandlerError(p.parse(f, path))
+}
+
+func unwrapHandlerError(err error) error {
+	if e, ok := err.(handlerError); ok {
+		return e.err
+	}
+	return err
+}
+
+func (p *parser) parse(r io.Reader, file string) error {
+	l := newLexer(r)
+	for {
+		rec, err := l.next()
+		if err != nil {
+			return &ParseError{File: file, Line: l.line, Err: err}
+		} else if rec == nil {
+			return nil
+		}
+
+		err = p.parseRecord(rec, file)
+		switch err.(type) {
+		case nil:
+			continue
+		case handlerError, *ParseError:
+			return err
+		}
+
+		perr := &ParseError{File: file, Line: rec.line, Err: err}
+		if p.errHandler == nil {
+			return perr
+		} else if err := p.errHandler(perr); err != nil {
+			return handlerError{err}
+		}
+	}
+}
+
+func (p *parser) emit(rrset *g53.RRset) error {
+	if err := p.handler(rrset); err != nil {
+		return handlerError{err}
+	}
+	return nil
+}
+
+func (p *parser) parseRecord(rec *record, file string) error {
+	tokens := rec.tokens
+	if rec.blankStart == false && tokens[0].quoted == false && strings.HasPrefix(tokens[0].text, "$") {
+		return p.parseDirective(tokens, file)
+	}
+
+	var owner *g53.Name
+	if rec.blankStart {
+		if p.lastOwner == nil {
+			return ErrNoOwner
+		}
+		owner = p.lastOwner
+	} else {
+		var err error
+		if owner, err = resolveName(tokens[0].text, p.origin); err != nil {
+			return err
+		}
+		tokens = tokens[1:]
+	}
+
+	rrset, err := p.parseRR(owner, tokens)
+	if err != nil {
+		return err
+	}
+	p.lastOwner = owner
+	return p.emit(rrset)
+}
+
+// ttl and class could be omitted and are in any order
+func (p *parser) parseRR(owner *g53.Name, tokens []token) (*g53.RRset, error) {
+	var ttl g53.RRTTL
+	hasTTL, hasClass := false, false
+	class := g53.CLASS_IN
+	for len(tokens) > 0 && tokens[0].quoted == false {
+		if hasTTL == false {
+			if t, err := parseTTL(tokens[0].text); err == nil {
+				ttl, hasTTL = t, true
+				tokens = tokens[1:]
+				continue
+			}
+		}
+
+		if hasClass == false {
+			if c, err := g53.ClassFromString(tokens[0].text); err == nil {
+				class, hasClass = c, true
+				tokens = tokens[1:]
+				continue
+			}
+		}
+		break
+	}
+
+	if len(tokens) == 0 {
+		return nil, ErrShortOfType
+	}
+	typ, err := rdata.TypeFromString(tokens[0].text)
+	if err != nil {
+		return nil, fmt.Errorf("unknown rr type %s", tokens[0].text)
+	}
+
+	if len(tokens) == 1 {
+		return nil, ErrShortOfRdata
+	}
+	s, err := p.rdataString(typ, tokens[1:])
+	if err != nil {
+		return nil, err
+	}
+	rd, err := rdata.FromString(typ, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s rdata \"%s\": %s", rdata.TypeString(typ), s, err.Error())
+	}
+
+	if hasTTL {
+		p.lastTTL, p.hasLastTTL = ttl, true
+	} else if p.hasTTL {
+		ttl = p.defaultTTL
+	} else if typ == g53.RR_SOA {
+		//RFC 2308 4, use soa minimum before $TTL is introduced
+		ttl = g53.RRTTL(rd.(*g53.SOA).Minimum)
+		p.lastTTL, p.hasLastTTL = ttl, true
+	} else if p.hasLastTTL {
+		ttl = p.lastTTL
+	} else {
+		return nil, ErrNoTTL
+	}
+
+	return &g53.RRset{
+		Name:   owner,
+		Type:   typ,
+		Class:  class,
+		Ttl:    ttl,
+		Rdatas: []g53.Rdata{rd},
+	}, nil
+}
+
+func (p *parser) rdataString(typ g53.RRType, tokens []token) (string, error) {
+	fields := make([]string, 0, len(tokens))
+	//rdata in RFC 3597 generic format has no name or quoted string
+	if tokens[0].quoted == false && tokens[0].text == rdata.GenericMark {
+		for _, t := range tokens {
+			fields = append(fields, t.text)
+		}
+		return strings.Join(fields, " "), nil
+	}
+
+	for _, t := range tokens {
+		if t.quoted || typ == g53.RR_TXT || typ == g53.RR_SPF {
+			fields = append(fields, "\""+t.text+"\"")
+		} else {
+			fields = append(fields, t.text)
+		}
+	}
+
+	for _, i := range nameFields[typ] {
+		if i >= len(tokens) || tokens[i].quoted {
+			continue
+		}
+		name, err := resolveName(tokens[i].text, p.origin)
+		if err != nil {
+			return "", err
+		}
+		fields[i] = name.String(false)
+	}
+
+	if typ == g53.RR_SOA {
+		for _, i := range soaTimerFields {
+			if i >= len(tokens) {
+				continue
+			}
+			timer, err := parseTTL(tokens[i].text)
+			if err != nil {
+				return "", err
+			}
+			fields[i] = strconv.FormatUint(uint64(timer), 10)
+		}
+	}
+	return strings.Join(fields, " "), nil
+}
+
+func (p *parser) parseDirective(tokens []token, file string) error {
+	args := tokens[1:]
+	switch strings.ToUpper(tokens[0].text) {
+	case "$ORIGIN":
+		if len(args) != 1 {
+			return ErrDirectiveArgument
+		}
+		origin, err := resolveName(args[0].text, p.origin)
+		if err != nil {
+			return err
+		}
+		p.origin = origin
+	case "$TTL":
+		if len(args) != 1 {
+			return ErrDirectiveArgument
+		}
+		ttl, err := parseTTL(args[0].text)
+		if err != nil {
+			return err
+		}
+		p.defaultTTL, p.hasTTL = ttl, true
+	case "$INCLUDE":
+		return p.include(args, file)
+	case "$GENERATE":
+		return p.generate(args)
+	default:
+		return fmt.Errorf("%s %s", ErrUnknownDirective.Error(), tokens[0].text)
+	}
+	return nil
+}
+
+// origin and owner of including file aren't changed by the included file
+func (p *parser) include(args []token, file string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return ErrDirectiveArgument
+	}
+
+	if p.includeDepth == maxIncludeDepth {
+		return ErrIncludeTooDeep
+	}
+
+	origin := p.origin
+	if len(args) == 2 {
+		var err error
+		if origin, err = resolveName(args[1].text, p.origin); err != nil {
+			return err
+		}
+	}
+
+	path := args[0].text
+	if filepath.IsAbs(path) == false && file != "" {
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	savedOrigin, savedOwner := p.origin, p.lastOwner
+	p.origin = origin
+	p.includeDepth += 1
+	err = p.parse(f, path)
+	p.includeDepth -= 1
+	p.origin, p.lastOwner = savedOrigin, savedOwner
+	return err
+}
+
+func resolveName(s string, origin *g53.Name) (*g53.Name, error) {
+	if s == "@" {
+		return origin, nil
+	}
+
+	if isAbsolute(s) == false {
+		if origin.IsRoot() {
+			s = s + "."
+		} else {
+			s = s + "." + origin.String(false)
+		}
+	}
+	return g53.NameFromString(s)
+}
+
+// name ends with dot which isn't escaped
+func isAbsolute(s string) bool {
+	if strings.HasSuffix(s, ".") == false {
+		return false
+	}
+
+	escapes := 0
+	for i := len(s) - 2; i >= 0 && s[i] == '\\'; i-- {
+		escapes += 1
+	}
+	return escapes%2 == 0
+}
+
+// ttl is seconds or with units like 1w2d3h4m5s
+func parseTTL(s string) (g53.RRTTL, error) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, ErrInvalidTTL
+	}
+
+	var total, value uint64
+	hasValue := false
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			value = value*10 + uint64(c-'0')
+			hasValue = true
+			if value > math.MaxUint32 {
+				return 0, ErrInvalidTTL
+			}
+			continue
+		}
+
+		if hasValue == false {
+			return 0, ErrInvalidTTL
+		}
+		switch c {
+		case 'w':
+			value *= 7 * 24 * 3600
+		case 'd':
+			value *= 24 * 3600
+		case 'h':
+			value *= 3600
+		case 'm':
+			value *= 60
+		case 's':
+		default:
+			return 0, ErrInvalidTTL
+		}
+		total += value
+		value, hasValue = 0, false
+	}
+
+	total += value
+	if total > math.MaxUint32 {
+		return 0, ErrInvalidTTL
+	}
+	return g53.RRTTL(total), nil
+}
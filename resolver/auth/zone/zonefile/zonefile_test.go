@@ -0,0 +1,206 @@
+package zonefile
+
+import (
+	"strings"
+	"testing"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+func parseString(content string) ([]*g53.RRset, error) {
+	var rrsets []*g53.RRset
+	err := Parse(strings.NewReader(content), g53.NameFromStringUnsafe("example.com."), func(rrset *g53.RRset) error {
+		rrsets = append(rrsets, rrset)
+		return nil
+	}, nil)
+	return rrsets, err
+}
+
+func TestParseFile(t *testing.T) {
+	var rrs []string
+	err := ParseFile("testdata/example.com", g53.NameFromStringUnsafe("example.com."), func(rrset *g53.RRset) error {
+		rrs = append(rrs, strings.TrimSpace(rrset.String()))
+		return nil
+	}, nil)
+	ut.Assert(t, err == nil, "parse zone file failed:%v", err)
+	ut.Equal(t, rrs, []string{
+		"example.com.\t3600\tIN\tSOA\tns1.example.com. hostmaster.example.com. 2019120101 10800 900 604800 86400",
+		"example.com.\t3600\tIN\tNS\tns1.example.com.",
+		"example.com.\t3600\tIN\tNS\tns2.example.net.",
+		"ns1.example.com.\t300\tIN\tA\t10.0.0.1",
+		"ns1.example.com.\t3600\tIN\tAAAA\t2001:db8::1",
+		"www.example.com.\t3600\tIN\tCNAME\texample.com.",
+		"mail.example.com.\t3600\tIN\tMX\t10 mx.example.com.",
+		"mx.example.com.\t3600\tIN\tA\t10.0.0.2",
+		"txt.example.com.\t3600\tIN\tTXT\t\"hello world\" \"semicolon ; in quote\" \"unquoted\"",
+		"_sip._tcp.example.com.\t3600\tIN\tSRV\t0 5 5060 sip.example.com.",
+		"sub.example.com.\t600\tIN\tA\t10.0.0.4",
+		"a.sub.example.com.\t600\tIN\tA\t10.0.0.5",
+		"after.example.com.\t600\tIN\tA\t10.0.0.3",
+		"host1.example.com.\t600\tIN\tA\t10.0.1.1",
+		"host2.example.com.\t600\tIN\tA\t10.0.1.2",
+		"host3.example.com.\t600\tIN\tA\t10.0.1.3",
+		"001.example.com.\t600\tIN\tPTR\thost-00.example.com.",
+		"009.example.com.\t600\tIN\tPTR\thost-08.example.com.",
+		"017.example.com.\t600\tIN\tPTR\thost-10.example.com.",
+	})
+}
+
+func TestDefaultTTL(t *testing.T) {
+	rrsets, err := parseString(`@ IN SOA ns1 root 1 3600 900 604800 300
+ns1 600 A 10.0.0.1
+ns2 A 10.0.0.2
+`)
+	ut.Assert(t, err == nil, "parse zone failed:%v", err)
+	ut.Equal(t, rrsets[0].Ttl, g53.RRTTL(300))
+	ut.Equal(t, rrsets[1].Ttl, g53.RRTTL(600))
+	ut.Equal(t, rrsets[2].Ttl, g53.RRTTL(600))
+
+	_, err = parseString("a A 10.0.0.1\n")
+	ut.Equal(t, err.(*ParseError).Err, ErrNoTTL)
+}
+
+func TestParseError(t *testing.T) {
+	for _, c := range []struct {
+		content string
+		line    int
+		err     error
+	}{
+		{"$TTL 3600\n\n  A 10.0.0.1\n", 3, ErrNoOwner},
+		{"$TTL 3600\na A 10.0.0.1\nb (A\n10.0.0.2\n", 5, ErrUnbalancedParen},
+		{"$TTL 3600\na TXT \"unclosed\n", 3, ErrUnterminatedQuote},
+		{"$TTL 3600\na\n", 2, ErrShortOfType},
+		{"$TTL 3600\na A\n", 2, ErrShortOfRdata},
+		{"$TTL 1x\n", 1, ErrInvalidTTL},
+		{"$UNKNOWN a\n", 1, nil},
+		{"$TTL 3600\n$GENERATE 3-1 a$ A 10.0.0.$\n", 2, ErrInvalidRange},
+		{"$TTL 3600\n; comment\na (\n A 10.0.0.256 )\n", 3, nil},
+	} {
+		_, err := parseString(c.content)
+		perr, ok := err.(*ParseError)
+		ut.Assert(t, ok, "%s should fail", c.content)
+		ut.Equal(t, perr.Line, c.line)
+		if c.err != nil {
+			ut.Equal(t, perr.Err, c.err)
+		}
+	}
+}
+
+func TestSkipInvalidRecord(t *testing.T) {
+	var rrsets []*g53.RRset
+	var errLines []int
+	content := "$TTL 3600\na A 10.0.0.256\nb A 10.0.0.2\nc AAA ::1\n$TTL 1x\nd A 10.0.0.4\n"
+	err := Parse(strings.NewReader(content), g53.NameFromStringUnsafe("example.com."), func(rrset *g53.RRset) error {
+		rrsets = append(rrsets, rrset)
+		return nil
+	}, func(err *ParseError) error {
+		errLines = append(errLines, err.Line)
+		return nil
+	})
+	ut.Assert(t, err == nil, "invalid records should be skipped:%v", err)
+	ut.Equal(t, errLines, []int{2, 4, 5})
+	ut.Equal(t, len(rrsets), 2)
+	ut.Equal(t, rrsets[0].Name.String(false), "b.example.com.")
+	ut.Equal(t, rrsets[1].Name.String(false), "d.example.com.")
+
+	//unbalanced parentheses can't be skipped
+	err = Parse(strings.NewReader("$TTL 3600\na (A 10.0.0.1\n"), g53.NameFromStringUnsafe("example.com."), func(*g53.RRset) error {
+		return nil
+	}, func(*ParseError) error {
+		return nil
+	})
+	ut.Equal(t, err.(*ParseError).Err, ErrUnbalancedParen)
+}
+
+func TestParseTTL(t *testing.T) {
+	for s, ttl := range map[string]g53.RRTTL{
+		"0":       0,
+		"3600":    3600,
+		"1h":      3600,
+		"1H30M":   5400,
+		"1w2d3h":  788400,
+		"2d10":    172810,
+		"1m1s":    61,
+		"1d12h1s": 129601,
+	} {
+		v, err := parseTTL(s)
+		ut.Assert(t, err == nil, "parse ttl %s failed", s)
+		ut.Equal(t, v, ttl)
+	}
+
+	for _, s := range []string{"", "h", "1y", "99999999999", "-1"} {
+		_, err := parseTTL(s)
+		ut.Equal(t, err, ErrInvalidTTL)
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	for _, c := range []struct {
+		s        string
+		iterator int
+		result   string
+	}{
+		{"host-$", 10, "host-10"},
+		{"${-1}", 10, "9"},
+		{"${0,4}", 10, "0010"},
+		{"${0,3,x}", 255, "0ff"},
+		{"${16,0,X}", 255, "10F"},
+		{"${0,3,o}", 8, "010"},
+		{"\\$-$", 1, "$-1"},
+	} {
+		result, err := substitute(c.s, c.iterator)
+		ut.Assert(t, err == nil, "substitute %s failed", c.s)
+		ut.Equal(t, result, c.result)
+	}
+
+	for _, s := range []string{"${", "${a}", "${0,3,z}", "${0,1,d,1}"} {
+		_, err := substitute(s, 1)
+		ut.Equal(t, err, ErrInvalidSubstitute)
+	}
+}
+
+func TestParseModernTypes(t *testing.T) {
+	rrsets, err := parseString(`$TTL 3600
+@ CAA 0 issue "letsencrypt.org"
+  CAA 0 iodef "mailto:security@example.com"
+  HTTPS 1 . alpn="h2,h3" ipv4hint=192.0.2.1
+_dns SVCB 1 dns alpn= "dot" port=853
+ssh SSHFP 1 1 dd465c09ce35c47e
+_443._tcp TLSA 3 1 1 ( 0c72ac70b745ac19998811b131d662c9
+                      ac69dbdbe7cb23e5b514b56664c5d3d6 )
+key DNSKEY 257 3 8 ( AwEAAag/
+                     Ue4x )
+@ DS 60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118
+www URI 10 1 "https://www.example.com/"
+loc LOC 52 22 23.000 N 4 53 32.000 E -2.00m
+cert CERT PGP 0 0 AwEAAag=
+unknown TYPE65534 \# 4 0a000001
+ns NS \# 17 036e7331076578616d706c6503636f6d00
+`)
+	ut.Assert(t, err == nil, "parse zone failed:%v", err)
+
+	var rrs []string
+	for _, rrset := range rrsets {
+		rrs = append(rrs, strings.TrimSpace(rdata.RRsetString(rrset)))
+	}
+	ut.Equal(t, rrs, []string{
+		"example.com.\t3600\tIN\tCAA\t0 issue \"letsencrypt.org\"",
+		"example.com.\t3600\tIN\tCAA\t0 iodef \"mailto:security@example.com\"",
+		"example.com.\t3600\tIN\tHTTPS\t1 . alpn=\"h2,h3\" ipv4hint=192.0.2.1",
+		"_dns.example.com.\t3600\tIN\tSVCB\t1 dns.example.com. alpn=\"dot\" port=853",
+		"ssh.example.com.\t3600\tIN\tSSHFP\t1 1 DD465C09CE35C47E",
+		"_443._tcp.example.com.\t3600\tIN\tTLSA\t3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6",
+		"key.example.com.\t3600\tIN\tDNSKEY\t257 3 8 AwEAAag/Ue4x",
+		"example.com.\t3600\tIN\tDS\t60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+		"www.example.com.\t3600\tIN\tURI\t10 1 \"https://www.example.com/\"",
+		"loc.example.com.\t3600\tIN\tLOC\t52 22 23.000 N 4 53 32.000 E -2.00m 1.00m 10000.00m 10.00m",
+		"cert.example.com.\t3600\tIN\tCERT\tPGP 0 0 AwEAAag=",
+		"unknown.example.com.\t3600\tIN\tTYPE65534\t\\# 4 0A000001",
+		"ns.example.com.\t3600\tIN\tNS\tns1.example.com.",
+	})
+
+	_, err = parseString("$TTL 3600\n@ TYPE65534 0a000001\n")
+	ut.Assert(t, err != nil, "unknown type should be in generic format")
+}
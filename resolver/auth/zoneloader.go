@@ -1,25 +1,77 @@
 package auth
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/zdnscloud/g53"
 	util "github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/dnssec"
 	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
 	z "github.com/zdnscloud/vanguard/resolver/auth/zone"
 	"github.com/zdnscloud/vanguard/resolver/auth/zone/memoryzone"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone/zonefile"
 )
 
 func loadZone(origin *g53.Name, content string) z.Zone {
+	return loadZoneWithParser(origin, func(handler zonefile.RRsetHandler, errHandler zonefile.ErrorHandler) error {
+		return zonefile.Parse(strings.NewReader(content), origin, handler, errHandler)
+	})
+}
+
+func loadZoneFile(origin *g53.Name, file string) z.Zone {
+	return loadZoneWithParser(origin, func(handler zonefile.RRsetHandler, errHandler zonefile.ErrorHandler) error {
+		return zonefile.ParseFile(file, origin, handler, errHandler)
+	})
+}
+
+// invalid rrs are logged and skipped, unsupported rrs are ignored, zone
+// isn't loaded if the file can't be tokenized
+func loadZoneWithParser(origin *g53.Name, parse func(zonefile.RRsetHandler, zonefile.ErrorHandler) error) z.Zone {
 	zone := memoryzone.NewDynamicZone(origin)
 	loadChan := make(chan *g53.RRset)
 	abortChan := make(chan struct{})
-	go parseZoneContent(content, loadChan)
+	stopChan := make(chan struct{})
+	go func() {
+		err := parse(func(rrset *g53.RRset) error {
+			if z.IsRRsetTypeSupport(rrset.Type) == false {
+				logger.GetLogger().Debug("rr \"%s\" isn't supported", rdata.RRsetString(rrset))
+				return nil
+			}
+
+			select {
+			case loadChan <- rrset:
+				return nil
+			case <-stopChan:
+				return z.ErrAbortLoad
+			}
+		}, func(err *zonefile.ParseError) error {
+			logger.GetLogger().Error("rr in zone %s parse failed:%s", origin.String(false), err.Error())
+			return nil
+		})
+
+		if err == nil {
+			close(loadChan)
+			return
+		}
+
+		select {
+		case abortChan <- struct{}{}:
+			logger.GetLogger().Error("parse zone %s failed: %s", origin.String(false), err.Error())
+		case <-stopChan:
+		}
+	}()
 
 	if err := zone.Load(loadChan, abortChan); err != nil {
 		logger.GetLogger().Error("load zone %s with failed: %s", origin.String(false), err.Error())
 	}
+	close(stopChan)
 
 	return zone
 }
@@ -27,6 +79,12 @@ func loadZone(origin *g53.Name, content string) z.Zone {
 func loadZoneFromMaster(origin *g53.Name, view string, masters []string) z.Zone {
 	zone := memoryzone.NewDynamicZone(origin)
 	zone.SetMasters(masters)
+	transferZoneFromMaster(zone, view, masters)
+	return zone
+}
+
+func transferZoneFromMaster(zone z.Zone, view string, masters []string) {
+	origin := zone.GetOrigin()
 	abortChan := make(chan struct{})
 	for _, master := range masters {
 		loadChan := make(chan *g53.RRset)
@@ -44,9 +102,192 @@ func loadZoneFromMaster(origin *g53.Name, view string, masters []string) z.Zone
 			break
 		}
 	}
+}
+
+// secondary zone with file is loaded from the backup file if it isn't
+// expired, zone is saved into the file after each transfer, signed transfer
+// is left to xfr runner
+func loadSecondaryZone(origin *g53.Name, view string, conf config.AuthZoneConf, key *z.TSIGKey) z.Zone {
+	var zone z.Zone
+	if conf.File != "" {
+		zone = loadBackupZone(origin, view, conf.File, journalPath(conf))
+	}
+
+	if zone == nil {
+		zone = memoryzone.NewDynamicZone(origin)
+		if conf.File != "" {
+			if err := zone.EnableJournal(conf.File, journalPath(conf)); err != nil {
+				panic("open journal " + journalPath(conf) + " failed " + err.Error())
+			}
+		}
+		if key == nil {
+			transferZoneFromMaster(zone, view, conf.Masters)
+		}
+	}
+
+	zone.SetMasters(conf.Masters)
+	zone.SetTransferKey(key)
+	return zone
+}
+
+// nil is returned if backup file doesn't exist, is invalid or expired,
+// modification time of backup file is the last time zone is refreshed
+func loadBackupZone(origin *g53.Name, view, file, journal string) z.Zone {
+	info, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			logger.GetLogger().Warn("open backup of zone %s in view %s failed: %s", origin.String(false), view, err.Error())
+		}
+		return nil
+	}
+
+	zone := loadZoneFile(origin, file)
+	result := zone.Find(origin, g53.RR_SOA, z.DefaultFind).GetResult()
+	if result.Type != z.FRSuccess {
+		return nil
+	}
+
+	expire := time.Duration(result.RRset.Rdatas[0].(*g53.SOA).Expire) * time.Second
+	if time.Now().After(info.ModTime().Add(expire)) {
+		logger.GetLogger().Warn("backup of zone %s in view %s is expired", origin.String(false), view)
+		return nil
+	}
+
+	if err := zone.EnableJournal(file, journal); err != nil {
+		logger.GetLogger().Warn("replay journal of zone %s in view %s failed: %s", origin.String(false), view, err.Error())
+		return nil
+	}
+
+	zone.SetLastRefresh(info.ModTime())
+	logger.GetLogger().Info("load zone %s in view %s from backup %s", origin.String(false), view, file)
 	return zone
 }
 
+func journalPath(conf config.AuthZoneConf) string {
+	if conf.Journal != "" {
+		return conf.Journal
+	}
+	return conf.File + ".jnl"
+}
+
+// changes of master zone are compacted into snapshot, zone file is never
+// rewritten by server
+func snapshotPath(conf config.AuthZoneConf) string {
+	return journalPath(conf) + ".snapshot"
+}
+
+// snapshot is loaded instead of zone file if its serial is newer, otherwise
+// zone file is edited after the last compaction and snapshot is stale
+func loadMasterZone(origin *g53.Name, view string, conf config.AuthZoneConf) z.Zone {
+	zone := loadZoneFile(origin, conf.File)
+	snapshot := snapshotPath(conf)
+	if _, err := os.Stat(snapshot); err != nil {
+		return zone
+	}
+
+	saved := loadZoneFile(origin, snapshot)
+	savedSerial, ok := zoneSerial(saved)
+	if ok == false {
+		logger.GetLogger().Warn("snapshot %s of zone %s in view %s is invalid", snapshot, origin.String(false), view)
+		return zone
+	}
+	if serial, ok := zoneSerial(zone); ok && isSerialNewer(serial, savedSerial) {
+		logger.GetLogger().Info("zone file of %s in view %s is newer than snapshot", origin.String(false), view)
+		return zone
+	}
+	logger.GetLogger().Info("load zone %s in view %s from snapshot %s", origin.String(false), view, snapshot)
+	return saved
+}
+
+func zoneSerial(zone z.Zone) (uint32, bool) {
+	result := zone.Find(zone.GetOrigin(), g53.RR_SOA, z.DefaultFind).GetResult()
+	if result.Type != z.FRSuccess {
+		return 0, false
+	}
+	return result.RRset.Rdatas[0].(*g53.SOA).Serial, true
+}
+
+// serial number arithmetic, RFC 1982
+func isSerialNewer(s1, s2 uint32) bool {
+	return s1 != s2 && int32(s1-s2) > 0
+}
+
+// nil is returned if key isn't configured for the zone, invalid key is
+// reported when zone is loaded
+func transferKey(conf config.AuthZoneConf) (*z.TSIGKey, error) {
+	if conf.KeyName == "" {
+		return nil, nil
+	}
+
+	if _, err := g53.NewTSIG(conf.KeyName, conf.KeySecret, conf.KeyAlgorithm); err != nil {
+		return nil, err
+	}
+
+	return &z.TSIGKey{
+		Name:      conf.KeyName,
+		Secret:    conf.KeySecret,
+		Algorithm: conf.KeyAlgorithm,
+	}, nil
+}
+
+const (
+	defaultSignatureValidity = 14 * 24 * time.Hour
+	defaultSignatureRefresh  = defaultSignatureValidity / 4
+)
+
+var ErrSignatureRefresh = errors.New("signature refresh should be less than validity")
+
+// nil is returned if no key is configured for the zone
+func signPolicy(conf config.AuthZoneConf) (*z.SignPolicy, error) {
+	dnssecConf := conf.DNSSEC
+	if len(dnssecConf.Keys) == 0 {
+		return nil, nil
+	}
+
+	policy := &z.SignPolicy{
+		NSEC3:      dnssecConf.NSEC3,
+		Iterations: dnssecConf.NSEC3Iterations,
+		Validity:   defaultSignatureValidity,
+		Refresh:    defaultSignatureRefresh,
+	}
+	if dnssecConf.NSEC3Salt != "" && dnssecConf.NSEC3Salt != "-" {
+		salt, err := hex.DecodeString(dnssecConf.NSEC3Salt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nsec3 salt %s", dnssecConf.NSEC3Salt)
+		}
+		policy.Salt = salt
+	}
+	if dnssecConf.SignatureValidity != 0 {
+		policy.Validity = time.Duration(dnssecConf.SignatureValidity) * time.Second
+		policy.Refresh = policy.Validity / 4
+	}
+	if dnssecConf.SignatureRefresh != 0 {
+		policy.Refresh = time.Duration(dnssecConf.SignatureRefresh) * time.Second
+	}
+	if policy.Refresh >= policy.Validity {
+		return nil, ErrSignatureRefresh
+	}
+
+	for _, path := range dnssecConf.Keys {
+		key, err := dnssec.LoadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("load key %s failed: %s", path, err.Error())
+		}
+		policy.Keys = append(policy.Keys, key)
+	}
+	return policy, nil
+}
+
+// ds of key signing keys should be added into parent zone
+func logDS(origin *g53.Name, view string, policy *z.SignPolicy) {
+	for _, key := range policy.Keys {
+		if key.IsKSK() {
+			logger.GetLogger().Info("zone %s in view %s is signed, ds of key %d is \"%s\"",
+				origin.String(false), view, key.Tag, dnssec.DS(origin, key.DNSKEY).String())
+		}
+	}
+}
+
 func genAXFRQueryData(origin *g53.Name) []byte {
 	render := g53.NewMsgRender()
 	query := g53.MakeQuery(origin, g53.RR_AXFR, 1024, false)
@@ -74,7 +315,7 @@ func doAXFR(zone *g53.Name, master string, loadChan chan<- *g53.RRset) error {
 			return err
 		}
 
-		axfr, err := g53.MessageFromWire(util.NewInputBuffer(buf))
+		axfr, err := rdata.MessageFromWire(util.NewInputBuffer(buf))
 		if err != nil {
 			return err
 		}
@@ -112,21 +353,3 @@ func doAXFR(zone *g53.Name, master string, loadChan chan<- *g53.RRset) error {
 
 	return nil
 }
-
-func parseZoneContent(content string, loadChan chan<- *g53.RRset) {
-	for _, line := range strings.Split(content, "\n") {
-		line = strings.TrimRight(line, "\r\n ")
-		if line == "" {
-			continue
-		}
-
-		if rrset, err := g53.RRsetFromString(line); err != nil {
-			logger.GetLogger().Error("rr \"%s\" parse failed:%s", line, err.Error())
-		} else if z.IsRRsetTypeSupport(rrset.Type) == false {
-			logger.GetLogger().Debug("rr \"%s\" isn't supported", line)
-		} else {
-			loadChan <- rrset
-		}
-	}
-	close(loadChan)
-}
@@ -97,6 +97,10 @@ type Context struct {
 	response         *g53.Message
 	client           *core.Client
 	namechain        []*g53.Name
+	//status of all the links, and the servfail of bogus link
+	security      core.SecurityStatus
+	authenticated bool
+	bogus         *g53.Message
 }
 
 func newCNameContext(client *core.Client) *Context {
@@ -105,6 +109,8 @@ func newCNameContext(client *core.Client) *Context {
 		client:           client,
 		response:         client.Response,
 		namechain:        []*g53.Name{client.Request.Question.Name},
+		security:         client.Security,
+		authenticated:    client.Response.Header.GetFlag(g53.FLAG_AD),
 	}
 }
 
@@ -114,6 +120,7 @@ func (ctx *Context) makeRedirectQuery() error {
 		return ErrCNameChainIsTooLong
 	}
 	ctx.client.Response = nil
+	ctx.client.Security = core.SecurityUnchecked
 	logger.GetLogger().Debug("cname redirect for query %s is detected and query the alias", ctx.client.Request.Question.String())
 	ctx.client.Request.Question = &g53.Question{ctx.namechain[len(ctx.namechain)-1],
 		ctx.originalQuestion.Type,
@@ -127,6 +134,12 @@ func (ctx *Context) mergeResponse(response *g53.Message) {
 		return
 	}
 
+	ctx.security = ctx.security.Combine(ctx.client.Security)
+	ctx.authenticated = ctx.authenticated && response.Header.GetFlag(g53.FLAG_AD)
+	if ctx.client.Security == core.SecurityBogus {
+		ctx.bogus = response
+	}
+
 	for _, answer := range response.Sections[g53.AnswerSection] {
 		ctx.response.AddRRset(g53.AnswerSection, answer)
 	}
@@ -134,7 +147,15 @@ func (ctx *Context) mergeResponse(response *g53.Message) {
 	ctx.response.Header.Rcode = response.Header.Rcode
 }
 
+// answer is authenticated only if every link is authenticated, servfail
+// with extended error of bogus link is returned if any link is bogus
 func (ctx *Context) assembleFinalResponse() {
+	if ctx.bogus != nil {
+		ctx.response = ctx.bogus
+	}
+	ctx.response.Header.SetFlag(g53.FLAG_AD, ctx.authenticated && ctx.bogus == nil)
+	ctx.client.Security = ctx.security
+
 	request := ctx.client.Request
 	request.Question = ctx.originalQuestion
 	ctx.response.Header.Id = request.Header.Id
@@ -9,12 +9,14 @@ import (
 	"github.com/zdnscloud/vanguard/core"
 	"github.com/zdnscloud/vanguard/logger"
 	"github.com/zdnscloud/vanguard/resolver/chain"
+	"github.com/zdnscloud/vanguard/util"
 )
 
 type dumbHander struct {
 	chain.DefaultResolver
 	index    int
 	response []*g53.Message
+	security []core.SecurityStatus
 	t        *testing.T
 }
 
@@ -25,6 +27,9 @@ func (dumb *dumbHander) Resolve(client *core.Client) {
 			" diff from resp question name "+response.Question.Name.String(false))
 
 	client.Response = &response
+	if dumb.security != nil {
+		client.Security = dumb.security[dumb.index]
+	}
 	dumb.index += 1
 }
 
@@ -183,3 +188,52 @@ func TestCNameReDirect(t *testing.T) {
 	ut.Equal(t, answers[3].Rdatas[0].String(), "a5.cn.")
 	ut.Equal(t, answers[4].Rdatas[0].String(), "5.5.5.5")
 }
+
+func TestCNameChainSecurity(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	newDumb := func(security []core.SecurityStatus) *dumbHander {
+		dumb := &dumbHander{t: t, security: security}
+		dumb.response = []*g53.Message{
+			buildResponse("a1.cn.", buildCNameRRset("a1.cn.", "a2.cn.")),
+			buildResponse("a2.cn.", buildCNameRRset("a2.cn.", "a3.cn.")),
+			buildResponse("a3.cn.", buildARRset("a3.cn.", "3.3.3.3")),
+		}
+		for i, response := range dumb.response {
+			response.Header.SetFlag(g53.FLAG_AD, security[i] == core.SecuritySecure)
+		}
+		return dumb
+	}
+	resolve := func(dumb *dumbHander) *core.Client {
+		var client core.Client
+		client.Request = g53.MakeQuery(g53.NameFromStringUnsafe("a1.cn."), g53.RR_A, 512, true)
+		NewCNameHandler(dumb, &config.VanguardConf{}).Resolve(&client)
+		return &client
+	}
+
+	client := resolve(newDumb([]core.SecurityStatus{core.SecuritySecure, core.SecuritySecure, core.SecuritySecure}))
+	ut.Equal(t, len(client.Response.Sections[g53.AnswerSection]), 3)
+	ut.Equal(t, client.Response.Header.GetFlag(g53.FLAG_AD), true)
+	ut.Equal(t, client.Security, core.SecuritySecure)
+
+	//insecure target in the middle of the chain
+	client = resolve(newDumb([]core.SecurityStatus{core.SecuritySecure, core.SecurityInsecure, core.SecuritySecure}))
+	ut.Equal(t, len(client.Response.Sections[g53.AnswerSection]), 3)
+	ut.Equal(t, client.Response.Header.GetFlag(g53.FLAG_AD), false)
+	ut.Equal(t, client.Security, core.SecurityInsecure)
+
+	dumb := newDumb([]core.SecurityStatus{core.SecuritySecure, core.SecurityBogus, core.SecuritySecure})
+	servfail := g53.MakeQuery(g53.NameFromStringUnsafe("a2.cn."), g53.RR_A, 512, true).MakeResponse()
+	servfail.Header.Rcode = g53.R_SERVFAIL
+	servfail.Edns = &g53.EDNS{
+		UdpSize: 4096,
+		Options: []g53.Option{&util.ExtendedErrorOpt{InfoCode: util.EDE_DNSSEC_BOGUS}},
+	}
+	dumb.response[1] = servfail
+	client = resolve(dumb)
+	ut.Equal(t, client.Response.Header.Rcode, g53.R_SERVFAIL)
+	ut.Equal(t, client.Response.Header.GetFlag(g53.FLAG_AD), false)
+	ut.Equal(t, len(client.Response.Sections[g53.AnswerSection]), 0)
+	ut.Equal(t, len(client.Response.Edns.Options), 1)
+	ut.Equal(t, client.Response.Question.Name.String(false), "a1.cn.")
+	ut.Equal(t, client.Security, core.SecurityBogus)
+}
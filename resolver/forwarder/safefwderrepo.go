@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/zdnscloud/vanguard/config"
+	vutil "github.com/zdnscloud/vanguard/util"
 )
 
 const (
@@ -17,8 +18,9 @@ type SafeFwderRepo struct {
 	fwderTimeout   time.Duration
 	timeoutLasting time.Duration
 
-	fwders map[string]SafeFwder
-	prober *Prober
+	fwders         map[string]SafeFwder
+	prober         *Prober
+	caseRandomizer *vutil.CaseRandomizer
 }
 
 func NewSafeFwderRepo(conf *config.ForwardProberConf) *SafeFwderRepo {
@@ -60,6 +62,7 @@ func (repo *SafeFwderRepo) GetOrCreateFwder(addr string) (fwder SafeFwder, err e
 	} else {
 		udpFwder, err := NewSafeUDPFwder(addr, repo.fwderTimeout, repo.timeoutLasting)
 		if err == nil {
+			udpFwder.randomizeCase = repo.caseRandomizer.Enabled(addr)
 			fwder := NewRecoverableFwder(udpFwder, repo.prober)
 			repo.fwders[addr] = fwder
 			return fwder, nil
@@ -13,9 +13,12 @@ import (
 type SafeUDPFwder struct {
 	fwder *vutil.SafeUDPSender
 
-	remoteAddr   string
-	lastRtt      time.Duration
-	fwderTimeout time.Duration
+	remoteAddr string
+	capability vutil.ServerCapability
+	//query name is sent with random case
+	randomizeCase bool
+	lastRtt       time.Duration
+	fwderTimeout  time.Duration
 
 	bearableFailInterval int64 //seconds
 	lastFailTime         int64 //unix seconds format
@@ -44,7 +47,14 @@ func (f *SafeUDPFwder) SetQuerySource(ip string) error {
 func (f *SafeUDPFwder) Forward(query *g53.Message) (*g53.Message, time.Duration, error) {
 	originalQueryId := query.Header.Id
 	query.Header.Id = util.GenMessageId()
-	resp, rtt, err := f.fwder.Query(f.remoteAddr, query)
+	var resp *g53.Message
+	var rtt time.Duration
+	var err error
+	if f.randomizeCase {
+		resp, rtt, err = f.fwder.QueryWithRandomCase(f.remoteAddr, query, &f.capability)
+	} else {
+		resp, rtt, err = f.fwder.QueryServer(f.remoteAddr, query, &f.capability)
+	}
 	atomic.StoreInt64((*int64)(&f.lastRtt), int64(rtt))
 	f.checkStatus(err)
 	query.Header.Id = originalQueryId
@@ -6,6 +6,7 @@ import (
 	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/config"
 	"github.com/zdnscloud/vanguard/httpcmd"
+	vutil "github.com/zdnscloud/vanguard/util"
 	view "github.com/zdnscloud/vanguard/viewselector"
 )
 
@@ -41,6 +42,10 @@ func (mgr *ViewFwderMgr) ReloadConfig(conf *config.VanguardConf) {
 	} else {
 		mgr.repo.ReloadConf(&conf.Forwarder.Prober)
 	}
+	mgr.repo.caseRandomizer = nil
+	if conf.Resolver.CaseRandomization.Enable {
+		mgr.repo.caseRandomizer = vutil.NewCaseRandomizer(conf.Resolver.CaseRandomization.Exceptions)
+	}
 
 	viewFwders := make(map[string]*ViewFwder)
 	for view, _ := range view.GetViewAndIds() {
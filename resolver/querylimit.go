@@ -34,12 +34,13 @@ func (limit *QueryLimit) reloadConfig(conf *config.VanguardConf) {
 type resolveResponse struct {
 	resp        *g53.Message
 	cacheAnswer bool
+	security    core.SecurityStatus
 }
 
 func (limit *QueryLimit) Resolve(client *core.Client) {
 	r_, err := limit.outQueryGroup.Do(client.QueryKey(), func() (interface{}, error) {
 		limit.resolver.Resolve(client)
-		return resolveResponse{client.Response, client.CacheAnswer}, nil
+		return resolveResponse{client.Response, client.CacheAnswer, client.Security}, nil
 	})
 
 	if err != nil {
@@ -61,6 +62,7 @@ func (limit *QueryLimit) Resolve(client *core.Client) {
 		respCopy.Header.Id = client.Request.Header.Id
 		client.Response = &respCopy
 		client.CacheAnswer = r.cacheAnswer
+		client.Security = r.security
 	} else {
 		limit.Resolve(client)
 	}
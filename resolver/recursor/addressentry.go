@@ -4,11 +4,14 @@ import (
 	"math"
 	"sync/atomic"
 	"time"
+
+	"github.com/zdnscloud/vanguard/util"
 )
 
 type AddressEntry struct {
-	addr string
-	rtt  int64
+	addr       string
+	rtt        int64
+	capability util.ServerCapability
 }
 
 func newAddressEntry(addr string, rtt time.Duration) *AddressEntry {
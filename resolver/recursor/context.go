@@ -15,6 +15,12 @@ type RecursorCtx struct {
 	depth         uint32
 	startTime     time.Time
 	nameServers   []*NameServer
+	dnssecOK      bool
+	zone          *g53.Name
+	//qname minimisation state, RFC 9156
+	qnameMinimisation bool
+	minimisedName     *g53.Name
+	minimiseCount     int
 }
 
 func (ctx *RecursorCtx) init(queryTimeout time.Duration, querySource string, clientAddress string, question *g53.Question, nameServers []*NameServer) {
@@ -27,6 +33,31 @@ func (ctx *RecursorCtx) init(queryTimeout time.Duration, querySource string, cli
 	ctx.depth = 0
 	ctx.startTime = time.Now()
 	ctx.nameServers = nameServers
+	ctx.dnssecOK = false
+	ctx.zone = nil
+	ctx.qnameMinimisation = false
+	ctx.minimisedName = nil
+	ctx.minimiseCount = 0
+}
+
+// nextMinimisedName returns the ancestor of query name which has one more
+// label than the zone cut or the last minimised name, nil means the full
+// name should be queried
+func (ctx *RecursorCtx) nextMinimisedName(zone *g53.Name) *g53.Name {
+	if ctx.qnameMinimisation == false || ctx.minimiseCount >= maxMinimiseCount {
+		return nil
+	}
+
+	labels := zone.LabelCount() + 1
+	if ctx.minimisedName != nil && ctx.minimisedName.LabelCount() >= labels {
+		labels = ctx.minimisedName.LabelCount() + 1
+	}
+	qname := ctx.question.Name
+	if labels >= qname.LabelCount() {
+		return nil
+	}
+	name, _ := qname.Parent(qname.LabelCount() - labels)
+	return name
 }
 
 type RecursorCtxPool struct {
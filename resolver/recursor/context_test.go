@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
 )
 
 func TestCtxPool(t *testing.T) {
@@ -37,3 +38,29 @@ func TestCtxPool(t *testing.T) {
 		ut.Assert(t, p.getCtx() == ctx, "")
 	}
 }
+
+func TestNextMinimisedName(t *testing.T) {
+	ctx := &RecursorCtx{}
+	ctx.init(singleQueryTimeout, "", "", &g53.Question{
+		Name:  g53.NameFromStringUnsafe("a.b.c.example.com."),
+		Type:  g53.RR_AAAA,
+		Class: g53.CLASS_IN,
+	}, nil)
+	ut.Assert(t, ctx.nextMinimisedName(g53.Root) == nil, "minimisation is disabled by default")
+
+	ctx.qnameMinimisation = true
+	ut.Equal(t, ctx.nextMinimisedName(g53.Root).String(false), "com.")
+	ut.Equal(t, ctx.nextMinimisedName(g53.NameFromStringUnsafe("com.")).String(false), "example.com.")
+
+	//empty non-terminal continues with one more label in same zone
+	zone := g53.NameFromStringUnsafe("example.com.")
+	ut.Equal(t, ctx.nextMinimisedName(zone).String(false), "c.example.com.")
+	ctx.minimisedName = g53.NameFromStringUnsafe("c.example.com.")
+	ut.Equal(t, ctx.nextMinimisedName(zone).String(false), "b.c.example.com.")
+	ctx.minimisedName = g53.NameFromStringUnsafe("b.c.example.com.")
+	ut.Assert(t, ctx.nextMinimisedName(zone) == nil, "full name should be queried")
+
+	ctx.minimisedName = nil
+	ctx.minimiseCount = maxMinimiseCount
+	ut.Assert(t, ctx.nextMinimisedName(zone) == nil, "minimisation count is limited")
+}
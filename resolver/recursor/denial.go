@@ -0,0 +1,332 @@
+package recursor
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/dnssec"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+// nsec3 with more iterations is treated as insecure, RFC 9276 3.2
+const maxNSEC3Iterations = 150
+
+// validated nsec or nsec3 rrsets in a response, proofs return secure if
+// the nonexistence is proved, insecure for opt-out nsec3 or nsec3 with
+// unsupported parameters, otherwise bogus
+type denialProof struct {
+	nsecs  []*g53.RRset
+	nsec3s []*g53.RRset
+}
+
+func newDenialProof(rrsets []*g53.RRset) *denialProof {
+	proof := &denialProof{}
+	for _, rrset := range rrsets {
+		if len(rrset.Rdatas) != 1 {
+			continue
+		}
+		if rrset.Type == g53.RR_NSEC {
+			proof.nsecs = append(proof.nsecs, rrset)
+		} else if rrset.Type == g53.RR_NSEC3 {
+			proof.nsec3s = append(proof.nsec3s, rrset)
+		}
+	}
+	return proof
+}
+
+// RFC 4035 5.4 and RFC 5155 8.4
+func (p *denialProof) nxdomain(name *g53.Name) securityStatus {
+	if len(p.nsec3s) > 0 {
+		ce, cover, status := p.nsec3ClosestEncloser(name)
+		if status != statusSecure {
+			return status
+		}
+		if p.nsec3Cover(wildcardOf(ce)) == nil {
+			return statusBogus
+		}
+		return optOutStatus(cover)
+	}
+
+	cover := p.nsecCover(name)
+	if cover == nil {
+		return statusBogus
+	}
+	if p.nsecCover(wildcardOf(nsecClosestEncloser(name, cover))) == nil {
+		return statusBogus
+	}
+	return statusSecure
+}
+
+// RFC 4035 5.4 and RFC 5155 8.5 to 8.7, name may be empty non-terminal or
+// expanded from wildcard
+func (p *denialProof) nodata(name *g53.Name, typ g53.RRType) securityStatus {
+	if len(p.nsec3s) > 0 {
+		if status := p.nsec3Params(); status != statusSecure {
+			return status
+		}
+		if nsec3 := p.nsec3Match(name); nsec3 != nil {
+			return typesStatus(nsec3.Rdatas[0].(*rdata.NSEC3).Types, typ)
+		}
+
+		ce, cover, status := p.nsec3ClosestEncloser(name)
+		if status != statusSecure {
+			return status
+		}
+		//ds isn't expanded from wildcard, RFC 5155 8.6
+		if typ == g53.RR_DS {
+			if optOutStatus(cover) == statusInsecure {
+				return statusInsecure
+			}
+			return statusBogus
+		}
+		if nsec3 := p.nsec3Match(wildcardOf(ce)); nsec3 != nil {
+			return typesStatus(nsec3.Rdatas[0].(*rdata.NSEC3).Types, typ)
+		}
+		return statusBogus
+	}
+
+	for _, nsec := range p.nsecs {
+		if nsec.Name.Equals(name) {
+			return typesStatus(nsec.Rdatas[0].(*rdata.NSEC).Types, typ)
+		}
+	}
+	//empty non-terminal or wildcard can't prove nonexistence of ds
+	if typ == g53.RR_DS {
+		return statusBogus
+	}
+	cover := p.nsecCover(name)
+	if cover == nil {
+		return statusBogus
+	}
+	if next := cover.Rdatas[0].(*rdata.NSEC).NextName; next.IsSubDomain(name) {
+		return statusSecure
+	}
+	wildcard := wildcardOf(nsecClosestEncloser(name, cover))
+	for _, nsec := range p.nsecs {
+		if nsec.Name.Equals(wildcard) {
+			return typesStatus(nsec.Rdatas[0].(*rdata.NSEC).Types, typ)
+		}
+	}
+	return statusBogus
+}
+
+// delegation without ds is proved by nsec or nsec3 of the delegation point
+// which has ns but no ds or soa, or by opt-out nsec3 which covers it,
+// insecure is returned if it's proved, otherwise bogus, RFC 4035 5.2 and
+// RFC 5155 8.9
+func (p *denialProof) insecureDelegation(name *g53.Name) securityStatus {
+	if len(p.nsec3s) > 0 {
+		if status := p.nsec3Params(); status != statusSecure {
+			return status
+		}
+		if nsec3 := p.nsec3Match(name); nsec3 != nil {
+			return delegationTypesStatus(nsec3.Rdatas[0].(*rdata.NSEC3).Types)
+		}
+
+		_, cover, status := p.nsec3ClosestEncloser(name)
+		if status != statusSecure || optOutStatus(cover) != statusInsecure {
+			return statusBogus
+		}
+		return statusInsecure
+	}
+
+	for _, nsec := range p.nsecs {
+		if nsec.Name.Equals(name) {
+			return delegationTypesStatus(nsec.Rdatas[0].(*rdata.NSEC).Types)
+		}
+	}
+	return statusBogus
+}
+
+func delegationTypesStatus(types []g53.RRType) securityStatus {
+	hasNS := false
+	for _, t := range types {
+		switch t {
+		case g53.RR_DS, g53.RR_SOA:
+			return statusBogus
+		case g53.RR_NS:
+			hasNS = true
+		}
+	}
+	if hasNS {
+		return statusInsecure
+	}
+	return statusBogus
+}
+
+// name expanded from wildcard shouldn't exist, RFC 4035 5.3.4 and RFC
+// 5155 8.8
+func (p *denialProof) wildcardAnswer(name *g53.Name, sig *rdata.RRSIG) securityStatus {
+	if len(p.nsec3s) > 0 {
+		if status := p.nsec3Params(); status != statusSecure {
+			return status
+		}
+		ce, _ := name.StripLeft(name.LabelCount() - 1 - uint(sig.Labels))
+		return optOutStatus(p.nsec3Cover(nextCloser(name, ce)))
+	}
+
+	if p.nsecCover(name) == nil {
+		return statusBogus
+	}
+	return statusSecure
+}
+
+// types of existing name shouldn't include type and cname, ds in child
+// zone or nsec of delegation point can't prove other types
+func typesStatus(types []g53.RRType, typ g53.RRType) securityStatus {
+	hasSOA, hasNS := false, false
+	for _, t := range types {
+		switch t {
+		case typ, g53.RR_CNAME:
+			return statusBogus
+		case g53.RR_SOA:
+			hasSOA = true
+		case g53.RR_NS:
+			hasNS = true
+		}
+	}
+
+	if typ == g53.RR_DS && hasSOA {
+		return statusBogus
+	} else if typ != g53.RR_DS && hasNS && hasSOA == false {
+		return statusBogus
+	}
+	return statusSecure
+}
+
+func (p *denialProof) nsecCover(name *g53.Name) *g53.RRset {
+	for _, nsec := range p.nsecs {
+		if nsecCovers(nsec, name) {
+			return nsec
+		}
+	}
+	return nil
+}
+
+// owner < name < next in canonical order, next of the last nsec is apex
+func nsecCovers(nsec *g53.RRset, name *g53.Name) bool {
+	next := nsec.Rdatas[0].(*rdata.NSEC).NextName
+	if nsec.Name.Compare(name, false).Order >= 0 {
+		return false
+	}
+	if next.Compare(nsec.Name, false).Order <= 0 {
+		return name.IsSubDomain(next)
+	}
+	return name.Compare(next, false).Order < 0
+}
+
+// the longest ancestor of name which shares with owner or next name of
+// the covering nsec
+func nsecClosestEncloser(name *g53.Name, nsec *g53.RRset) *g53.Name {
+	common := name.Compare(nsec.Name, false).CommonLabelCount
+	next := nsec.Rdatas[0].(*rdata.NSEC).NextName
+	if c := name.Compare(next, false).CommonLabelCount; c > common {
+		common = c
+	}
+	ce, _ := name.Parent(name.LabelCount() - uint(common))
+	return ce
+}
+
+// closest provable encloser of name and the nsec3 which covers next
+// closer name, RFC 5155 8.3
+func (p *denialProof) nsec3ClosestEncloser(name *g53.Name) (*g53.Name, *g53.RRset, securityStatus) {
+	if status := p.nsec3Params(); status != statusSecure {
+		return nil, nil, status
+	}
+
+	zone, _ := p.nsec3s[0].Name.Parent(1)
+	for ce := name; ce.IsSubDomain(zone); ce, _ = ce.Parent(1) {
+		if p.nsec3Match(ce) == nil {
+			if ce.Equals(zone) {
+				break
+			}
+			continue
+		}
+		if ce.Equals(name) {
+			return nil, nil, statusBogus
+		}
+		cover := p.nsec3Cover(nextCloser(name, ce))
+		if cover == nil {
+			return nil, nil, statusBogus
+		}
+		return ce, cover, statusSecure
+	}
+	return nil, nil, statusBogus
+}
+
+// only SHA-1 is defined for nsec3, and too many iterations is expensive
+func (p *denialProof) nsec3Params() securityStatus {
+	for _, rrset := range p.nsec3s {
+		nsec3 := rrset.Rdatas[0].(*rdata.NSEC3)
+		if nsec3.Algorithm != rdata.NSEC3SHA1 || nsec3.Iterations > maxNSEC3Iterations {
+			return statusInsecure
+		}
+	}
+	return statusSecure
+}
+
+func (p *denialProof) nsec3Match(name *g53.Name) *g53.RRset {
+	for _, rrset := range p.nsec3s {
+		if owner, ok := nsec3OwnerHash(rrset, name); ok && bytes.Equal(owner, nsec3Hash(rrset, name)) {
+			return rrset
+		}
+	}
+	return nil
+}
+
+// hash of owner < hash of name < next hash, the last nsec3 wraps around
+func (p *denialProof) nsec3Cover(name *g53.Name) *g53.RRset {
+	for _, rrset := range p.nsec3s {
+		owner, ok := nsec3OwnerHash(rrset, name)
+		if ok == false {
+			continue
+		}
+		hash := nsec3Hash(rrset, name)
+		next := rrset.Rdatas[0].(*rdata.NSEC3).NextHash
+		if bytes.Compare(next, owner) > 0 {
+			if bytes.Compare(owner, hash) < 0 && bytes.Compare(hash, next) < 0 {
+				return rrset
+			}
+		} else if bytes.Compare(owner, hash) < 0 || bytes.Compare(hash, next) < 0 {
+			return rrset
+		}
+	}
+	return nil
+}
+
+// hash in first label of nsec3 owner, the nsec3 should be in zone of name
+func nsec3OwnerHash(rrset *g53.RRset, name *g53.Name) ([]byte, bool) {
+	zone, err := rrset.Name.Parent(1)
+	if err != nil || name.IsSubDomain(zone) == false {
+		return nil, false
+	}
+	label, _ := rrset.Name.Split(0, 1)
+	hash, err := rdata.Base32Hex.DecodeString(strings.ToUpper(label.String(true)))
+	return hash, err == nil
+}
+
+func nsec3Hash(rrset *g53.RRset, name *g53.Name) []byte {
+	nsec3 := rrset.Rdatas[0].(*rdata.NSEC3)
+	return dnssec.HashName(name, nsec3.Iterations, nsec3.Salt)
+}
+
+// opt-out nsec3 doesn't prove the name is secure, RFC 5155 6
+func optOutStatus(cover *g53.RRset) securityStatus {
+	if cover == nil {
+		return statusBogus
+	} else if cover.Rdatas[0].(*rdata.NSEC3).Flags&rdata.NSEC3OptOut != 0 {
+		return statusInsecure
+	}
+	return statusSecure
+}
+
+func nextCloser(name, ce *g53.Name) *g53.Name {
+	next, _ := name.Parent(name.LabelCount() - ce.LabelCount() - 1)
+	return next
+}
+
+func wildcardOf(name *g53.Name) *g53.Name {
+	wildcard, _ := g53.NameFromStringUnsafe("*").Concat(name)
+	return wildcard
+}
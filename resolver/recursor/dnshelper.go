@@ -11,17 +11,22 @@ var errAuthSectionIsNotValid = errors.New("auth section should has one ns rrset"
 
 func getAuthAndGlues(zone *g53.Name, msg *g53.Message) (*g53.RRset, []*g53.RRset, error) {
 	var auth g53.Section
-	if msg.Question.Type == g53.RR_NS && len(msg.Sections[g53.AnswerSection]) == 1 {
+	if msg.Question.Type == g53.RR_NS && len(withoutSignatures(msg.Sections[g53.AnswerSection])) == 1 {
 		auth = msg.Sections[g53.AnswerSection]
 	} else {
 		auth = msg.Sections[g53.AuthSection]
-		if len(auth) != 1 {
+	}
+
+	//ds and its proof in referral is ignored
+	var nsRRset *g53.RRset
+	for _, rrset := range auth {
+		if rrset.Type == g53.RR_NS && nsRRset == nil {
+			nsRRset = rrset
+		} else if isDNSSECType(rrset.Type) == false {
 			return nil, nil, errAuthSectionIsNotValid
 		}
 	}
-
-	nsRRset := auth[0]
-	if nsRRset.Type != g53.RR_NS {
+	if nsRRset == nil {
 		return nil, nil, errAuthSectionIsNotValid
 	}
 
@@ -48,6 +53,25 @@ func getAuthAndGlues(zone *g53.Name, msg *g53.Message) (*g53.RRset, []*g53.RRset
 	return nsRRset, validGlues, nil
 }
 
+func isDNSSECType(typ g53.RRType) bool {
+	switch typ {
+	case g53.RR_DS, g53.RR_RRSIG, g53.RR_NSEC, g53.RR_NSEC3:
+		return true
+	default:
+		return false
+	}
+}
+
+func withoutSignatures(section g53.Section) g53.Section {
+	var rrsets g53.Section
+	for _, rrset := range section {
+		if rrset.Type != g53.RR_RRSIG {
+			rrsets = append(rrsets, rrset)
+		}
+	}
+	return rrsets
+}
+
 func isValidResponse(msg *g53.Message) bool {
 	return msg.Header.Rcode == g53.R_NOERROR || msg.Header.Rcode == g53.R_NXDOMAIN
 }
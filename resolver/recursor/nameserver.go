@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/util"
 )
 
 var errNameServerNoAddr = errors.New("name server doesn't have any addr")
@@ -15,10 +16,11 @@ var errUnknownNameServer = errors.New("name server is unknown")
 var errAddrIsUnknown = errors.New("addr is unknown")
 
 type NameServer struct {
-	zone *g53.Name
-	name *g53.Name
-	addr string
-	rtt  time.Duration
+	zone       *g53.Name
+	name       *g53.Name
+	addr       string
+	rtt        time.Duration
+	capability *util.ServerCapability
 }
 
 func (ns *NameServer) String() string {
@@ -57,10 +59,11 @@ func (ns *NameServerEntry) getNameServers(zone *g53.Name) []*NameServer {
 	nameServers := make([]*NameServer, len(ns.addrEntrys))
 	for i := 0; i < len(ns.addrEntrys); i++ {
 		nameServers[i] = &NameServer{
-			zone: zone,
-			name: ns.name,
-			addr: ns.addrEntrys[i].addr,
-			rtt:  ns.addrEntrys[i].getRtt(),
+			zone:       zone,
+			name:       ns.name,
+			addr:       ns.addrEntrys[i].addr,
+			rtt:        ns.addrEntrys[i].getRtt(),
+			capability: &ns.addrEntrys[i].capability,
 		}
 	}
 	return nameServers
@@ -78,9 +81,10 @@ func (ns *NameServerEntry) selectNameServer() *NameServer {
 	}
 
 	return &NameServer{
-		name: ns.name,
-		addr: selectEntry.addr,
-		rtt:  minRtt,
+		name:       ns.name,
+		addr:       selectEntry.addr,
+		rtt:        minRtt,
+		capability: &selectEntry.capability,
 	}
 }
 
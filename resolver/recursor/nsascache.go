@@ -131,6 +131,26 @@ func (nc *NsasCache) selectNameServers(zone *g53.Name) []*NameServer {
 	}
 }
 
+// GetZoneCut returns the closest cached zone which is ancestor of name
+func (nc *NsasCache) GetZoneCut(name *g53.Name) *g53.Name {
+	nc.zonesLock.Lock()
+	defer nc.zonesLock.Unlock()
+	for {
+		_, node, searchResult := nc.zones.Search(name)
+		if searchResult == domaintree.NotFound {
+			return nil
+		}
+
+		e := node.(*list.Element).Value.(*ZoneEntry)
+		if e.isExpired() == false {
+			return e.zone
+		} else if e.zone.IsRoot() {
+			return nil
+		}
+		name, _ = e.zone.Parent(1)
+	}
+}
+
 func (nc *NsasCache) removeZone(elem *list.Element) {
 	e := elem.Value.(*ZoneEntry)
 	nc.zones.Delete(e.zone)
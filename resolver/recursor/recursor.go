@@ -21,6 +21,7 @@ var errTooDepQuery = errors.New("query exceed depth limit")
 var errInvalidResponse = errors.New("response is invalid")
 var errQueryTimeout = errors.New("query time out")
 var errDumbNameServer = errors.New("auth name server is dumb")
+var errTooManyQuery = errors.New("out recusive query exceed limit")
 
 const maxQueryDep = 20
 const maxInflightQuery = 100
@@ -28,6 +29,7 @@ const singleQueryTimeout = 3 * time.Second
 const queryTimeout = 15 * time.Second
 const batchQueryCount = 3 //max server to query in parallel
 const memoryCheckInterval = 10 * time.Second
+const maxMinimiseCount = 10 //max minimised queries for one name, RFC 9156 2.3
 
 var rootServers = map[string]string{
 	"a.root-servers.net.": "198.41.0.4:53",
@@ -51,6 +53,9 @@ type Recursor struct {
 	ednsSubnetEnable map[string]bool
 	resolverEnable   map[string]bool
 	rootForView      map[string][]*NameServer
+	validators       map[string]*validator
+	qnameMinimise    map[string]bool
+	caseRandomizer   *util.CaseRandomizer
 	ctxPool          *RecursorCtxPool
 	stopCh           chan struct{}
 }
@@ -69,9 +74,20 @@ func (r *Recursor) ReloadConfig(conf *config.VanguardConf) {
 	ednsSubnetEnable := make(map[string]bool)
 	resolverEnable := make(map[string]bool)
 	rootServers := make(map[string][]*NameServer)
+	validators := make(map[string]*validator)
+	qnameMinimise := make(map[string]bool)
 	for _, c := range conf.Recursor {
 		resolverEnable[c.View] = c.Enable
 		ednsSubnetEnable[c.View] = c.EdnsSubnetEnable
+		qnameMinimise[c.View] = c.QnameMinimisation
+
+		if c.DNSSECValidation {
+			anchors, err := LoadTrustAnchors(c.TrustAnchorFile)
+			if err != nil {
+				panic("load trust anchors failed:" + err.Error())
+			}
+			validators[c.View] = newValidator(anchors, r.getZoneCut)
+		}
 
 		if c.RootHintFile != "" {
 			f, err := os.OpenFile(c.RootHintFile, os.O_RDONLY, 0755)
@@ -100,6 +116,12 @@ func (r *Recursor) ReloadConfig(conf *config.VanguardConf) {
 	r.ednsSubnetEnable = ednsSubnetEnable
 	r.rootForView = rootServers
 	r.resolverEnable = resolverEnable
+	r.validators = validators
+	r.qnameMinimise = qnameMinimise
+	r.caseRandomizer = nil
+	if conf.Resolver.CaseRandomization.Enable {
+		r.caseRandomizer = util.NewCaseRandomizer(conf.Resolver.CaseRandomization.Exceptions)
+	}
 	r.nsasCache = NewNsasCache(0)
 	go r.enforceMemoryUsage(r.stopCh)
 }
@@ -131,6 +153,9 @@ func (r *Recursor) resolver(client *core.Client) {
 	}
 
 	ctx.init(singleQueryTimeout, querysource.GetQuerySource(client.View), clientAddress, client.Request.Question, r.getRootServers(client.View))
+	validator := r.validators[client.View]
+	ctx.dnssecOK = validator != nil
+	ctx.qnameMinimisation = r.qnameMinimise[client.View]
 
 	var response *g53.Message
 	var err error
@@ -141,6 +166,10 @@ func (r *Recursor) resolver(client *core.Client) {
 		response, err = r.handleQuery(ctx)
 	}
 
+	if err == nil && validator != nil {
+		response = r.validateResponse(ctx, validator, client, response)
+	}
+
 	if err == nil {
 		finalResponse := *response
 		finalResponse.Header.Id = client.Request.Header.Id
@@ -151,6 +180,63 @@ func (r *Recursor) resolver(client *core.Client) {
 	}
 }
 
+// answer isn't validated if client sets CD bit, which shouldn't be cached
+// for other clients, bogus answer is replaced by servfail with extended
+// dns error
+func (r *Recursor) validateResponse(ctx *RecursorCtx, v *validator, client *core.Client, response *g53.Message) *g53.Message {
+	if client.Request.Header.GetFlag(g53.FLAG_CD) {
+		client.CacheAnswer = false
+		return response
+	}
+
+	status, err := v.validate(response, ctx.zone, func(name *g53.Name, typ g53.RRType) (*g53.Message, error) {
+		return r.lookup(ctx, name, typ)
+	})
+	switch status {
+	case statusSecure:
+		client.Security = core.SecuritySecure
+		response.Header.SetFlag(g53.FLAG_AD, true)
+	case statusInsecure:
+		client.Security = core.SecurityInsecure
+	case statusBogus:
+		client.Security = core.SecurityBogus
+		logger.GetLogger().Warn("answer of %s is bogus: %s", client.Request.Question.String(), err.Error())
+		servfail := client.Request.MakeResponse()
+		servfail.Header.Rcode = g53.R_SERVFAIL
+		servfail.Edns = &g53.EDNS{
+			UdpSize: 4096,
+			Options: []g53.Option{&util.ExtendedErrorOpt{InfoCode: err.code, ExtraText: err.reason}},
+		}
+		servfail.RecalculateSectionRRCount()
+		return servfail
+	}
+	return response
+}
+
+// lookup resolves keys and ds needed by validation with DO bit set
+func (r *Recursor) lookup(ctx *RecursorCtx, name *g53.Name, typ g53.RRType) (*g53.Message, error) {
+	newCtx := r.ctxPool.getCtx()
+	if newCtx == nil {
+		return nil, errTooManyQuery
+	}
+	defer r.ctxPool.putCtx(newCtx)
+
+	newCtx.init(singleQueryTimeout, ctx.sender.GetQuerySource(), ctx.clientAddress,
+		&g53.Question{
+			Name:  name,
+			Type:  typ,
+			Class: g53.CLASS_IN,
+		}, cloneNameServers(ctx.nameServers))
+	newCtx.depth = ctx.depth
+	newCtx.dnssecOK = true
+	newCtx.qnameMinimisation = ctx.qnameMinimisation
+	return r.handleQuery(newCtx)
+}
+
+func (r *Recursor) getZoneCut(name *g53.Name) *g53.Name {
+	return r.nsasCache.GetZoneCut(name)
+}
+
 func (r *Recursor) getRootServers(view string) []*NameServer {
 	nameServers, ok := r.rootForView[view]
 	if ok == false {
@@ -165,17 +251,32 @@ func (r *Recursor) handleQuery(ctx *RecursorCtx) (*g53.Message, error) {
 		return nil, errTooDepQuery
 	}
 
-	nameServers := r.nsasCache.SelectNameServers(ctx.question.Name)
+	//ds is answered by parent zone
+	zone := ctx.question.Name
+	if ctx.question.Type == g53.RR_DS && zone.IsRoot() == false {
+		zone, _ = zone.Parent(1)
+	}
+	nameServers := r.nsasCache.SelectNameServers(zone)
 	if nameServers == nil {
 		nameServers = ctx.nameServers
 	}
 
-	request := g53.MakeQuery(ctx.question.Name, ctx.question.Type, 4096, false)
+	//only the zone cut and one more label is sent to name server
+	qname, qtype := ctx.question.Name, ctx.question.Type
+	minimisedName := ctx.nextMinimisedName(nameServers[0].zone)
+	if minimisedName != nil {
+		qname, qtype = minimisedName, g53.RR_A
+		ctx.minimiseCount += 1
+	}
+
+	request := g53.MakeQuery(qname, qtype, 4096, ctx.dnssecOK)
 	request.Edns.AddSubnetV4(ctx.clientAddress)
 	request.Header.SetFlag(g53.FLAG_RD, false)
 	request.RecalculateSectionRRCount()
 	response, err := r.doQuery(ctx.sender, nameServers, request)
-	if err == nil {
+	if minimisedName != nil {
+		return r.handleMinimisedResponse(ctx, nameServers[0].zone, minimisedName, response, err)
+	} else if err == nil {
 		return r.handleResponse(ctx, nameServers[0].zone, response)
 	} else {
 		return r.handleQuery(ctx)
@@ -221,21 +322,21 @@ func (r *Recursor) doQuery(sender *util.SafeUDPSender, servers []*NameServer, re
 func (r *Recursor) doSingleQuery(sender *util.SafeUDPSender, server *NameServer, request *g53.Message) (*g53.Message, error) {
 	logger.GetLogger().Debug("send query %s to name server %s", request.Question.String(), server.String())
 
-	response, rtt, err := sender.Query(server.addr, request)
+	var response *g53.Message
+	var rtt time.Duration
+	var err error
+	if r.caseRandomizer.Enabled(server.addr) {
+		response, rtt, err = sender.QueryWithRandomCase(server.addr, request, server.capability)
+	} else {
+		response, rtt, err = sender.QueryServer(server.addr, request, server.capability)
+	}
 	if err != nil {
 		logger.GetLogger().Error("send query %s to name server %s get err %s", request.Question.String(), server.String(), err.Error())
 	}
 
-	if response != nil {
-		if response.Header.Rcode == g53.R_FORMERR {
-			requstWithoutEdns := *request
-			requstWithoutEdns.Edns = nil
-			requstWithoutEdns.RecalculateSectionRRCount()
-			response, rtt, err = sender.Query(server.addr, &requstWithoutEdns)
-		} else if isValidResponse(response) == false {
-			rtt = queryTimeout
-			err = errDumbNameServer
-		}
+	if response != nil && isValidResponse(response) == false {
+		rtt = queryTimeout
+		err = errDumbNameServer
 	}
 
 	r.nsasCache.UpdateRtt(server, rtt)
@@ -247,9 +348,10 @@ func getDefaultRootServers() []*NameServer {
 	for name, addr := range rootServers {
 		serverName, _ := g53.NameFromString(name)
 		roots = append(roots, &NameServer{
-			zone: g53.Root,
-			name: serverName,
-			addr: addr,
+			zone:       g53.Root,
+			name:       serverName,
+			addr:       addr,
+			capability: &util.ServerCapability{},
 		})
 	}
 	return roots
@@ -266,9 +368,29 @@ func (r *Recursor) handleResponse(ctx *RecursorCtx, zone *g53.Name, response *g5
 	}
 }
 
+// referral moves to the child zone, name without delegation continues with
+// one more label, since broken servers return nxdomain or error for empty
+// non-terminal, full name is queried in other cases, RFC 9156 2.3
+func (r *Recursor) handleMinimisedResponse(ctx *RecursorCtx, zone, name *g53.Name, response *g53.Message, err error) (*g53.Message, error) {
+	if err == nil {
+		switch util.ClassifyResponse(response) {
+		case util.REFERRAL:
+			return r.handleReferal(ctx, zone, response)
+		case util.ANSWER, util.NXRRSET:
+			ctx.minimisedName = name
+			return r.handleQuery(ctx)
+		}
+	}
+
+	logger.GetLogger().Debug("disable qname minimisation for %s", ctx.question.String())
+	ctx.qnameMinimisation = false
+	return r.handleQuery(ctx)
+}
+
 func (r *Recursor) handleFinalAnswer(ctx *RecursorCtx, zone *g53.Name, response *g53.Message) (*g53.Message, error) {
 	r.nsasCache.AddZoneNameServer(zone, response)
 	response.Question = ctx.question
+	ctx.zone = zone
 	return response, nil
 }
 
@@ -301,6 +423,7 @@ func (r *Recursor) getMissingNameServer(ctx *RecursorCtx, serverNames []*g53.Nam
 				Class: g53.CLASS_IN,
 			}, cloneNameServers(ctx.nameServers))
 		newCtx.depth = queryDepth
+		newCtx.qnameMinimisation = ctx.qnameMinimisation
 		outQuery += 1
 		go func(ctx_ *RecursorCtx) {
 			defer r.ctxPool.putCtx(ctx_)
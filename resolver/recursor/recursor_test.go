@@ -2,20 +2,23 @@ package recursor
 
 import (
 	"bufio"
-	//"fmt"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	ut "github.com/zdnscloud/cement/unittest"
 	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
 	"github.com/zdnscloud/vanguard/config"
 	"github.com/zdnscloud/vanguard/core"
 	"github.com/zdnscloud/vanguard/logger"
 	"github.com/zdnscloud/vanguard/resolver/querysource"
+	vutil "github.com/zdnscloud/vanguard/util"
 	view "github.com/zdnscloud/vanguard/viewselector"
 )
 
@@ -81,3 +84,170 @@ func TestRecursive(t *testing.T) {
 
 	ut.Assert(t, len(failedNames) == 0, "failed names is %v", failedNames)
 }
+
+// upstream on loopback which answers queries with the answer function and
+// records query names
+type fakeServer struct {
+	conn   *net.UDPConn
+	lock   sync.Mutex
+	qnames []string
+}
+
+func runFakeServer(t *testing.T, answer func(*g53.Message) *g53.Message) *fakeServer {
+	udpAddr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	conn, err := net.ListenUDP("udp", udpAddr)
+	ut.Assert(t, err == nil, "listen udp failed: %v", err)
+
+	s := &fakeServer{conn: conn}
+	go func() {
+		buf := make([]byte, 4096)
+		render := g53.NewMsgRender()
+		for {
+			n, client, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			query, err := g53.MessageFromWire(util.NewInputBuffer(buf[:n]))
+			if err != nil {
+				continue
+			}
+			s.lock.Lock()
+			s.qnames = append(s.qnames, query.Question.Name.String(false))
+			s.lock.Unlock()
+			resp := answer(query)
+			resp.RecalculateSectionRRCount()
+			render.Clear()
+			resp.Rend(render)
+			conn.WriteTo(render.Data(), client)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *fakeServer) queries() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.qnames...)
+}
+
+func (s *fakeServer) stop() {
+	s.conn.Close()
+}
+
+func answerA(query *g53.Message) *g53.Message {
+	resp := query.MakeResponse()
+	resp.Header.SetFlag(g53.FLAG_AA, true)
+	rrset, _ := g53.RRsetFromString(query.Question.Name.String(false) + " 300 IN A 1.1.1.1")
+	resp.AddRRset(g53.AnswerSection, rrset)
+	return resp
+}
+
+func answerNoData(zone string) func(*g53.Message) *g53.Message {
+	return func(query *g53.Message) *g53.Message {
+		resp := query.MakeResponse()
+		resp.Header.SetFlag(g53.FLAG_AA, true)
+		soa, _ := g53.RRsetFromString(zone + " 300 IN SOA ns.test. root.test. 1 7200 3600 2419200 300")
+		resp.AddRRset(g53.AuthSection, soa)
+		return resp
+	}
+}
+
+func newTestRecursor() *Recursor {
+	return &Recursor{
+		nsasCache: NewNsasCache(0),
+		ctxPool:   newRecursorCtxPool(maxInflightQuery),
+	}
+}
+
+func minimisedQuery(r *Recursor, root *fakeServer, name string) (*g53.Message, error) {
+	ctx := &RecursorCtx{}
+	ctx.init(singleQueryTimeout, "", "", &g53.Question{
+		Name:  g53.NameFromStringUnsafe(name),
+		Type:  g53.RR_A,
+		Class: g53.CLASS_IN,
+	}, []*NameServer{&NameServer{
+		zone:       g53.Root,
+		name:       g53.NameFromStringUnsafe("ns.test."),
+		addr:       root.addr(),
+		capability: &vutil.ServerCapability{},
+	}})
+	ctx.qnameMinimisation = true
+	return r.handleQuery(ctx)
+}
+
+func TestMinimisedQueryFallback(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	qname := "a.b.example.com."
+	for _, rcode := range []g53.Rcode{g53.R_NXDOMAIN, g53.R_SERVFAIL, g53.R_REFUSED} {
+		root := runFakeServer(t, func(query *g53.Message) *g53.Message {
+			if query.Question.Name.String(false) == qname {
+				return answerA(query)
+			}
+			resp := query.MakeResponse()
+			resp.Header.Rcode = rcode
+			return resp
+		})
+
+		response, err := minimisedQuery(newTestRecursor(), root, qname)
+		root.stop()
+		ut.Assert(t, err == nil, "query with %s failed: %v", rcode.String(), err)
+		ut.Equal(t, vutil.ClassifyResponse(response), vutil.ANSWER)
+		ut.Equal(t, root.queries(), []string{"com.", qname})
+	}
+}
+
+func TestMinimisedQueryReferral(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	qname := "a.b.example.com."
+	com := runFakeServer(t, func(query *g53.Message) *g53.Message {
+		if query.Question.Name.String(false) == qname {
+			return answerA(query)
+		}
+		return answerNoData("com.")(query)
+	})
+	defer com.stop()
+	root := runFakeServer(t, func(query *g53.Message) *g53.Message {
+		resp := query.MakeResponse()
+		ns, _ := g53.RRsetFromString("com. 300 IN NS ns.com.test.")
+		resp.AddRRset(g53.AuthSection, ns)
+		return resp
+	})
+	defer root.stop()
+
+	r := newTestRecursor()
+	//address of out of zone server is known, so referral has no glue
+	r.nsasCache.nameServers.addNameServer(g53.NameFromStringUnsafe("ns.com.test."), time.Hour, []string{com.addr()}, FromAuth)
+	response, err := minimisedQuery(r, root, qname)
+	ut.Assert(t, err == nil, "query failed: %v", err)
+	ut.Equal(t, vutil.ClassifyResponse(response), vutil.ANSWER)
+	ut.Equal(t, root.queries(), []string{"com."})
+	ut.Equal(t, com.queries(), []string{"example.com.", "b.example.com.", qname})
+}
+
+func TestMinimisedQueryLimit(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	labels := make([]string, 15)
+	for i := 0; i < len(labels); i++ {
+		labels[i] = fmt.Sprintf("l%d", len(labels)-i)
+	}
+	qname := strings.Join(labels, ".") + "."
+	root := runFakeServer(t, func(query *g53.Message) *g53.Message {
+		if query.Question.Name.String(false) == qname {
+			return answerA(query)
+		}
+		return answerNoData(".")(query)
+	})
+	defer root.stop()
+
+	response, err := minimisedQuery(newTestRecursor(), root, qname)
+	ut.Assert(t, err == nil, "query failed: %v", err)
+	ut.Equal(t, vutil.ClassifyResponse(response), vutil.ANSWER)
+	queries := root.queries()
+	ut.Equal(t, len(queries), maxMinimiseCount+1)
+	ut.Equal(t, queries[maxMinimiseCount-1], strings.Join(labels[len(labels)-maxMinimiseCount:], ".")+".")
+	ut.Equal(t, queries[maxMinimiseCount], qname)
+}
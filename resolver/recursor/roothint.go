@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/util"
 )
 
 var (
@@ -30,10 +31,11 @@ func loadRootServer(content string) ([]*NameServer, error) {
 			}
 		} else if rrset.Type == g53.RR_A {
 			nameServers = append(nameServers, &NameServer{
-				zone: g53.Root,
-				name: rrset.Name,
-				addr: rrset.Rdatas[0].String() + ":53",
-				rtt:  time.Duration(rrset.Ttl) * time.Second,
+				zone:       g53.Root,
+				name:       rrset.Name,
+				addr:       rrset.Rdatas[0].String() + ":53",
+				rtt:        time.Duration(rrset.Ttl) * time.Second,
+				capability: &util.ServerCapability{},
 			})
 		} else {
 			return nil, errUnsupportRRType
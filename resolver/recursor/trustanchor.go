@@ -0,0 +1,335 @@
+package recursor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/dnssec"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+var (
+	errInvalidTrustAnchor = errors.New("trust anchor should be ds or dnskey")
+	errNoTrustedKey       = errors.New("dnskey isn't signed by trusted key")
+)
+
+// new key is trusted after it's seen for 30 days, RFC 5011 2.4.1
+const addHoldDown = 30 * 24 * time.Hour
+
+// ttl of anchors saved into file, which isn't used
+const anchorTtl = 172800
+
+// pending keys are saved in comment lines with this prefix, followed by
+// the time the key is first seen
+const pendingKeyPrefix = ";pending"
+
+// root ksks published by iana, used if trust anchor file isn't specified
+var defaultTrustAnchors = []string{
+	". 172800 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". 172800 IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+type pendingKey struct {
+	key       *rdata.DNSKEY
+	firstSeen time.Time
+}
+
+type trustAnchor struct {
+	zone    *g53.Name
+	ds      []*g53.DS
+	keys    []*rdata.DNSKEY
+	pending []*pendingKey
+}
+
+// TrustAnchors are ds or dnskey of secure entry points, keys of anchor
+// zone are tracked by RFC 5011 and saved back into the anchor file
+type TrustAnchors struct {
+	path    string
+	anchors map[string]*trustAnchor
+	lock    sync.Mutex
+}
+
+// LoadTrustAnchors reads anchors from file which has one rr each line,
+// lines start with ; are comments, default root anchors are used if path
+// is empty
+func LoadTrustAnchors(path string) (*TrustAnchors, error) {
+	ta := &TrustAnchors{
+		path:    path,
+		anchors: make(map[string]*trustAnchor),
+	}
+	if path == "" {
+		for _, line := range defaultTrustAnchors {
+			if err := ta.addLine(line); err != nil {
+				return nil, err
+			}
+		}
+		return ta, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := ta.addLine(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ta.anchors) == 0 {
+		return nil, errInvalidTrustAnchor
+	}
+	return ta, nil
+}
+
+func (ta *TrustAnchors) addLine(line string) error {
+	line = strings.TrimSpace(line)
+	var firstSeen time.Time
+	if strings.HasPrefix(line, pendingKeyPrefix) {
+		fields := strings.SplitN(strings.TrimSpace(line[len(pendingKeyPrefix):]), " ", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid pending key %s", line)
+		}
+		seconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid pending key %s", line)
+		}
+		firstSeen, line = time.Unix(seconds, 0), fields[1]
+	} else if line == "" || strings.HasPrefix(line, ";") {
+		return nil
+	}
+
+	rrset, err := rdata.RRsetFromString(line)
+	if err != nil {
+		return fmt.Errorf("invalid trust anchor %s:%s", line, err.Error())
+	}
+	anchor := ta.getOrCreate(rrset.Name)
+	switch rd := rrset.Rdatas[0].(type) {
+	case *g53.DS:
+		anchor.ds = append(anchor.ds, rd)
+	case *rdata.DNSKEY:
+		if firstSeen.IsZero() {
+			anchor.keys = append(anchor.keys, rd)
+		} else {
+			anchor.pending = append(anchor.pending, &pendingKey{key: rd, firstSeen: firstSeen})
+		}
+	default:
+		return errInvalidTrustAnchor
+	}
+	return nil
+}
+
+func (ta *TrustAnchors) getOrCreate(zone *g53.Name) *trustAnchor {
+	key := zone.String(false)
+	anchor, ok := ta.anchors[key]
+	if ok == false {
+		anchor = &trustAnchor{zone: zone}
+		ta.anchors[key] = anchor
+	}
+	return anchor
+}
+
+// IsAnchor returns whether zone is a secure entry point
+func (ta *TrustAnchors) IsAnchor(zone *g53.Name) bool {
+	ta.lock.Lock()
+	defer ta.lock.Unlock()
+	_, ok := ta.anchors[zone.String(false)]
+	return ok
+}
+
+// HasAnchorFor returns whether name is under any secure entry point
+func (ta *TrustAnchors) HasAnchorFor(name *g53.Name) bool {
+	ta.lock.Lock()
+	defer ta.lock.Unlock()
+	for _, anchor := range ta.anchors {
+		if name.IsSubDomain(anchor.zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyKeys checks dnskey rrset of anchor zone is signed by trusted key
+func (ta *TrustAnchors) VerifyKeys(dnskeys *g53.RRset, sigs []*rdata.RRSIG, now time.Time) error {
+	ta.lock.Lock()
+	anchor, ok := ta.anchors[dnskeys.Name.String(false)]
+	var trusted []*rdata.DNSKEY
+	if ok {
+		for _, rd := range dnskeys.Rdatas {
+			if key := rd.(*rdata.DNSKEY); anchor.isTrusted(key) {
+				trusted = append(trusted, key)
+			}
+		}
+	}
+	ta.lock.Unlock()
+
+	if len(trusted) == 0 {
+		return errNoTrustedKey
+	}
+	if _, err := verifySignatures(dnskeys, sigs, trusted, now); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (anchor *trustAnchor) isTrusted(key *rdata.DNSKEY) bool {
+	if key.Flags&dnssec.FlagRevoke != 0 {
+		return false
+	}
+	for _, k := range anchor.keys {
+		if k.Compare(key) == 0 {
+			return true
+		}
+	}
+	for _, ds := range anchor.ds {
+		if dnssec.MatchDS(anchor.zone, key, ds) {
+			return true
+		}
+	}
+	return false
+}
+
+// Update tracks keys of anchor zone with the validated dnskey rrset, new
+// ksk is trusted after hold down time, and trusted key is removed once
+// it's revoked by itself, RFC 5011 2
+func (ta *TrustAnchors) Update(dnskeys *g53.RRset, sigs []*rdata.RRSIG, now time.Time) {
+	ta.lock.Lock()
+	defer ta.lock.Unlock()
+	anchor, ok := ta.anchors[dnskeys.Name.String(false)]
+	if ok == false {
+		return
+	}
+
+	changed := false
+	var pending []*pendingKey
+	for _, rd := range dnskeys.Rdatas {
+		key := rd.(*rdata.DNSKEY)
+		if key.Flags&dnssec.FlagSEP == 0 {
+			continue
+		}
+
+		if key.Flags&dnssec.FlagRevoke != 0 {
+			if anchor.revoke(key, dnskeys, sigs, now) {
+				logger.GetLogger().Info("trust anchor %d of %s is revoked", dnssec.KeyTag(key), anchor.zone.String(false))
+				changed = true
+			}
+			continue
+		}
+
+		if anchor.hasKey(key) {
+			continue
+		} else if anchor.isTrusted(key) {
+			anchor.keys = append(anchor.keys, key)
+			changed = true
+			continue
+		}
+
+		p := anchor.getPending(key)
+		if p == nil {
+			p = &pendingKey{key: key, firstSeen: now}
+			changed = true
+		}
+		if now.Sub(p.firstSeen) >= addHoldDown {
+			logger.GetLogger().Info("key %d of %s becomes trust anchor", dnssec.KeyTag(key), anchor.zone.String(false))
+			anchor.keys = append(anchor.keys, key)
+			changed = true
+		} else {
+			pending = append(pending, p)
+		}
+	}
+
+	//pending key which is removed from zone is forgotten
+	if len(pending) != len(anchor.pending) {
+		changed = true
+	}
+	anchor.pending = pending
+	if changed && ta.path != "" {
+		if err := ta.save(); err != nil {
+			logger.GetLogger().Error("save trust anchors to %s failed: %s", ta.path, err.Error())
+		}
+	}
+}
+
+func (anchor *trustAnchor) hasKey(key *rdata.DNSKEY) bool {
+	for _, k := range anchor.keys {
+		if k.Compare(key) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (anchor *trustAnchor) getPending(key *rdata.DNSKEY) *pendingKey {
+	for _, p := range anchor.pending {
+		if p.key.Compare(key) == 0 {
+			return p
+		}
+	}
+	return nil
+}
+
+// revoked key should sign the dnskey rrset by itself, RFC 5011 2.1
+func (anchor *trustAnchor) revoke(revoked *rdata.DNSKEY, dnskeys *g53.RRset, sigs []*rdata.RRSIG, now time.Time) bool {
+	key := *revoked
+	key.Flags &^= dnssec.FlagRevoke
+	if anchor.isTrusted(&key) == false {
+		return false
+	}
+	if _, err := verifySignatures(dnskeys, sigs, []*rdata.DNSKEY{revoked}, now); err != nil {
+		return false
+	}
+
+	var keys []*rdata.DNSKEY
+	for _, k := range anchor.keys {
+		if k.Compare(&key) != 0 {
+			keys = append(keys, k)
+		}
+	}
+	var ds []*g53.DS
+	for _, d := range anchor.ds {
+		if dnssec.MatchDS(anchor.zone, &key, d) == false {
+			ds = append(ds, d)
+		}
+	}
+	anchor.keys, anchor.ds = keys, ds
+	return true
+}
+
+// one rr each line, pending keys are in comments
+func (ta *TrustAnchors) save() error {
+	var buf bytes.Buffer
+	buf.WriteString("; trust anchors maintained by RFC 5011\n")
+	for _, anchor := range ta.anchors {
+		for _, ds := range anchor.ds {
+			fmt.Fprintf(&buf, "%s %d IN DS %s\n", anchor.zone.String(false), anchorTtl, ds.String())
+		}
+		for _, key := range anchor.keys {
+			fmt.Fprintf(&buf, "%s %d IN DNSKEY %s\n", anchor.zone.String(false), anchorTtl, key.String())
+		}
+		for _, p := range anchor.pending {
+			fmt.Fprintf(&buf, "%s %d %s %d IN DNSKEY %s\n", pendingKeyPrefix, p.firstSeen.Unix(),
+				anchor.zone.String(false), anchorTtl, p.key.String())
+		}
+	}
+
+	tmp := ta.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ta.path)
+}
@@ -0,0 +1,107 @@
+package recursor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/dnssec"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+func signedKeys(t *testing.T, now time.Time, keys []*dnssec.Key, signers ...*dnssec.Key) (*g53.RRset, []*rdata.RRSIG) {
+	rrset := &g53.RRset{
+		Name:  g53.Root,
+		Type:  g53.RR_DNSKEY,
+		Class: g53.CLASS_IN,
+		Ttl:   g53.RRTTL(300),
+	}
+	for _, key := range keys {
+		rrset.AddRdata(key.DNSKEY)
+	}
+
+	var sigs []*rdata.RRSIG
+	for _, signer := range signers {
+		sig, err := dnssec.Sign(rrset, signer, now.Add(-time.Hour), now.Add(time.Hour))
+		ut.Assert(t, err == nil, "sign dnskey failed: %v", err)
+		sigs = append(sigs, sig)
+	}
+	return rrset, sigs
+}
+
+func TestTrustAnchorRollover(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	dir, err := ioutil.TempDir("", "trustanchor")
+	ut.Assert(t, err == nil, "create temp dir failed: %v", err)
+	defer os.RemoveAll(dir)
+
+	oldKey, _ := dnssec.GenerateKey(g53.Root, dnssec.AlgorithmECDSAP256SHA256, true)
+	newKey, _ := dnssec.GenerateKey(g53.Root, dnssec.AlgorithmED25519, true)
+	zsk, _ := dnssec.GenerateKey(g53.Root, dnssec.AlgorithmED25519, false)
+	path := filepath.Join(dir, "root.key")
+	content := "; root anchor\n. 172800 IN DS " + dnssec.DS(g53.Root, oldKey.DNSKEY).String() + "\n"
+	ioutil.WriteFile(path, []byte(content), 0644)
+
+	anchors, err := LoadTrustAnchors(path)
+	ut.Assert(t, err == nil, "load trust anchors failed: %v", err)
+	ut.Equal(t, anchors.IsAnchor(g53.Root), true)
+	ut.Equal(t, anchors.HasAnchorFor(g53.NameFromStringUnsafe("cn.")), true)
+
+	now := time.Now()
+	dnskeys, sigs := signedKeys(t, now, []*dnssec.Key{oldKey, newKey, zsk}, oldKey)
+	ut.Equal(t, anchors.VerifyKeys(dnskeys, sigs, now), nil)
+	anchors.Update(dnskeys, sigs, now)
+
+	//new key is pending in hold down time, which is kept after reload
+	anchors, err = LoadTrustAnchors(path)
+	ut.Assert(t, err == nil, "load saved trust anchors failed: %v", err)
+	anchor := anchors.anchors["."]
+	ut.Equal(t, len(anchor.keys), 1)
+	ut.Equal(t, len(anchor.pending), 1)
+	ut.Equal(t, anchor.pending[0].firstSeen.Unix(), now.Unix())
+	_, onlyNewSig := signedKeys(t, now, []*dnssec.Key{oldKey, newKey, zsk}, newKey)
+	ut.Assert(t, anchors.VerifyKeys(dnskeys, onlyNewSig, now) != nil, "pending key shouldn't be trusted")
+
+	later := now.Add(addHoldDown + time.Hour)
+	dnskeys, sigs = signedKeys(t, later, []*dnssec.Key{oldKey, newKey, zsk}, oldKey)
+	anchors.Update(dnskeys, sigs, later)
+	dnskeys, sigs = signedKeys(t, later, []*dnssec.Key{oldKey, newKey, zsk}, newKey)
+	ut.Equal(t, anchors.VerifyKeys(dnskeys, sigs, later), nil)
+
+	//revoked key signs the key set by itself
+	revoked := *oldKey
+	revokedKey := *oldKey.DNSKEY
+	revokedKey.Flags |= dnssec.FlagRevoke
+	revoked.DNSKEY = &revokedKey
+	revoked.Tag = dnssec.KeyTag(&revokedKey)
+	dnskeys, sigs = signedKeys(t, later, []*dnssec.Key{&revoked, newKey, zsk}, &revoked, newKey)
+	ut.Equal(t, anchors.VerifyKeys(dnskeys, sigs, later), nil)
+	anchors.Update(dnskeys, sigs, later)
+
+	anchors, _ = LoadTrustAnchors(path)
+	anchor = anchors.anchors["."]
+	ut.Equal(t, len(anchor.ds), 0)
+	ut.Equal(t, len(anchor.keys), 1)
+	ut.Equal(t, anchor.keys[0].Compare(newKey.DNSKEY), 0)
+	dnskeys, sigs = signedKeys(t, later, []*dnssec.Key{oldKey, newKey, zsk}, oldKey)
+	ut.Assert(t, anchors.VerifyKeys(dnskeys, sigs, later) != nil, "revoked key shouldn't be trusted")
+}
+
+func TestDefaultTrustAnchors(t *testing.T) {
+	anchors, err := LoadTrustAnchors("")
+	ut.Assert(t, err == nil, "load default trust anchors failed: %v", err)
+	ut.Equal(t, len(anchors.anchors["."].ds), 2)
+	ut.Equal(t, anchors.HasAnchorFor(g53.NameFromStringUnsafe("example.com.")), true)
+
+	dir, _ := ioutil.TempDir("", "trustanchor")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bad.key")
+	ioutil.WriteFile(path, []byte(". 172800 IN NS a.root-servers.net.\n"), 0644)
+	_, err = LoadTrustAnchors(path)
+	ut.Equal(t, err, errInvalidTrustAnchor)
+}
@@ -0,0 +1,468 @@
+package recursor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/dnssec"
+	"github.com/zdnscloud/vanguard/rdata"
+	"github.com/zdnscloud/vanguard/util"
+)
+
+type securityStatus uint8
+
+// status is ordered from the most secure one
+const (
+	statusSecure securityStatus = iota
+	statusInsecure
+	statusBogus
+)
+
+const (
+	maxKeyCacheTime   = time.Hour
+	bogusKeyCacheTime = time.Minute
+	maxKeyCacheSize   = 4096
+)
+
+// reason of bogus answer, which is sent to client as extended dns error
+type bogusError struct {
+	code   uint16
+	reason string
+}
+
+func newBogusError(code uint16, format string, args ...interface{}) *bogusError {
+	return &bogusError{
+		code:   code,
+		reason: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *bogusError) Error() string {
+	return e.reason
+}
+
+// lookupFunc gets response of query with DO bit set, the response isn't
+// validated
+type lookupFunc func(name *g53.Name, typ g53.RRType) (*g53.Message, error)
+
+// validated keys of a zone, keys is empty for insecure or bogus zone
+type zoneKeys struct {
+	keys       []*rdata.DNSKEY
+	insecure   bool
+	err        *bogusError
+	expireTime time.Time
+}
+
+// validator walks chain of trust from trust anchors to the zone which signs
+// the answer, RFC 4035 5, keys of zones in the chain are cached
+type validator struct {
+	anchors *TrustAnchors
+	zoneCut func(*g53.Name) *g53.Name
+	keys    map[string]*zoneKeys
+	lock    sync.Mutex
+}
+
+// zoneCut returns the closest known zone which is ancestor of name
+func newValidator(anchors *TrustAnchors, zoneCut func(*g53.Name) *g53.Name) *validator {
+	return &validator{
+		anchors: anchors,
+		zoneCut: zoneCut,
+		keys:    make(map[string]*zoneKeys),
+	}
+}
+
+// validate checks the final answer from zone, rrsets without signature
+// are checked with keys of the zone, rrsets out of zone are removed from
+// response, cname target in other zone is queried again by cname handler
+func (v *validator) validate(response *g53.Message, zone *g53.Name, lookup lookupFunc) (securityStatus, *bogusError) {
+	if zone == nil {
+		zone = g53.Root
+	}
+	dropOutOfZone(response, zone)
+	if v.anchors.HasAnchorFor(response.Question.Name) == false {
+		return statusInsecure, nil
+	}
+
+	now := time.Now()
+	status := statusSecure
+	name := response.Question.Name
+	hasAnswer := false
+	var wildcards []*rdata.RRSIG
+	var expanded []*g53.Name
+	answers := response.Sections[g53.AnswerSection]
+	for _, rrset := range answers {
+		if rrset.Type == g53.RR_RRSIG {
+			continue
+		}
+
+		s, sig, err := v.verifyRRset(rrset, signaturesOf(answers, rrset), zone, lookup, now)
+		if err != nil {
+			return statusBogus, err
+		}
+		if s > status {
+			status = s
+		}
+		if sig != nil && int(sig.Labels) < int(rrset.Name.LabelCount())-1 {
+			wildcards = append(wildcards, sig)
+			expanded = append(expanded, rrset.Name)
+		}
+
+		if rrset.Name.Equals(name) {
+			if rrset.Type == g53.RR_CNAME {
+				name = rrset.Rdatas[0].(*g53.CName).Name
+			} else if rrset.Type == response.Question.Type {
+				hasAnswer = true
+			}
+		}
+	}
+
+	var denial []*g53.RRset
+	auths := response.Sections[g53.AuthSection]
+	for _, rrset := range auths {
+		if rrset.Type != g53.RR_SOA && rrset.Type != g53.RR_NSEC && rrset.Type != g53.RR_NSEC3 {
+			continue
+		}
+
+		s, _, err := v.verifyRRset(rrset, signaturesOf(auths, rrset), zone, lookup, now)
+		if err != nil {
+			return statusBogus, err
+		}
+		if s > status {
+			status = s
+		}
+		if rrset.Type != g53.RR_SOA {
+			denial = append(denial, rrset)
+		}
+	}
+	if status != statusSecure {
+		return status, nil
+	}
+
+	proof := newDenialProof(denial)
+	for i, sig := range wildcards {
+		if s := proof.wildcardAnswer(expanded[i], sig); s != statusSecure {
+			return v.proofStatus(s, expanded[i])
+		}
+	}
+	if response.Header.Rcode == g53.R_NXDOMAIN {
+		return v.proofStatus(proof.nxdomain(name), name)
+	} else if hasAnswer == false && name.Equals(response.Question.Name) {
+		return v.proofStatus(proof.nodata(name, response.Question.Type), name)
+	}
+	return statusSecure, nil
+}
+
+// server may return records of other zones it hosts, which aren't trusted
+// even if they are signed, RFC 2181 5.4.1
+func dropOutOfZone(response *g53.Message, zone *g53.Name) {
+	dropped := false
+	for _, section := range []g53.SectionType{g53.AnswerSection, g53.AuthSection} {
+		var rrsets g53.Section
+		for _, rrset := range response.Sections[section] {
+			if rrset.Name.IsSubDomain(zone) {
+				rrsets = append(rrsets, rrset)
+			} else {
+				dropped = true
+			}
+		}
+		response.Sections[section] = rrsets
+	}
+	if dropped {
+		response.RecalculateSectionRRCount()
+	}
+}
+
+func (v *validator) proofStatus(status securityStatus, name *g53.Name) (securityStatus, *bogusError) {
+	if status == statusBogus {
+		return status, newBogusError(util.EDE_NSEC_MISSING, "no proof of nonexistence of %s", name.String(false))
+	}
+	return status, nil
+}
+
+// rrset without signature is checked with keys of zone, signature which
+// validates the rrset is returned, signer in rrsig isn't trusted, it should
+// be the zone which answers or a zone under it, whose delegation is proved
+// by ds or proof of insecure delegation from the zone
+func (v *validator) verifyRRset(rrset *g53.RRset, sigs []*rdata.RRSIG, zone *g53.Name, lookup lookupFunc, now time.Time) (securityStatus, *rdata.RRSIG, *bogusError) {
+	signer := zone
+	if len(sigs) > 0 {
+		signer = sigs[0].Signer
+		if rrset.Name.IsSubDomain(signer) == false {
+			return statusBogus, nil, newBogusError(util.EDE_DNSSEC_BOGUS, "%s isn't signed by its ancestor", rrsetName(rrset))
+		} else if signer.IsSubDomain(zone) == false {
+			return statusBogus, nil, newBogusError(util.EDE_DNSSEC_BOGUS, "%s is signed by %s which isn't zone %s",
+				rrsetName(rrset), signer.String(false), zone.String(false))
+		}
+	}
+
+	zk := v.getZoneKeys(signer, lookup, now)
+	if zk.err != nil {
+		return statusBogus, nil, zk.err
+	} else if zk.insecure {
+		return statusInsecure, nil, nil
+	}
+
+	sig, err := verifySignatures(rrset, sigs, zk.keys, now)
+	if err != nil {
+		return statusBogus, nil, err
+	}
+	return statusSecure, sig, nil
+}
+
+func (v *validator) getZoneKeys(zone *g53.Name, lookup lookupFunc, now time.Time) *zoneKeys {
+	key := zone.String(false)
+	v.lock.Lock()
+	zk, ok := v.keys[key]
+	v.lock.Unlock()
+	if ok && zk.expireTime.After(now) {
+		return zk
+	}
+
+	zk = v.fetchZoneKeys(zone, lookup, now)
+	v.lock.Lock()
+	if len(v.keys) >= maxKeyCacheSize {
+		v.keys = make(map[string]*zoneKeys)
+	}
+	v.keys[key] = zk
+	v.lock.Unlock()
+	return zk
+}
+
+// keys of trust anchor are validated by anchor, other zone's keys are
+// validated by ds in parent zone
+func (v *validator) fetchZoneKeys(zone *g53.Name, lookup lookupFunc, now time.Time) *zoneKeys {
+	if v.anchors.IsAnchor(zone) {
+		dnskeys, sigs, err := lookupRRset(zone, g53.RR_DNSKEY, lookup)
+		if err != nil {
+			return bogusKeys(err, now)
+		}
+		if err := v.anchors.VerifyKeys(dnskeys, sigs, now); err != nil {
+			return bogusKeys(newBogusError(util.EDE_DNSSEC_BOGUS, "dnskey of trust anchor %s is bogus: %s",
+				zone.String(false), err.Error()), now)
+		}
+		v.anchors.Update(dnskeys, sigs, now)
+		return secureKeys(dnskeys, now)
+	} else if zone.IsRoot() || v.anchors.HasAnchorFor(zone) == false {
+		return insecureKeys(now)
+	}
+
+	response, err := lookup(zone, g53.RR_DS)
+	if err != nil {
+		return bogusKeys(newBogusError(util.EDE_DNSSEC_BOGUS, "lookup ds of %s failed: %s", zone.String(false), err.Error()), now)
+	}
+
+	ds, sigs := answerRRset(response, zone, g53.RR_DS)
+	if ds != nil {
+		pk := v.getZoneKeys(v.parentZone(zone, sigs), lookup, now)
+		if pk.err != nil || pk.insecure {
+			return pk
+		}
+		if _, err := verifySignatures(ds, sigs, pk.keys, now); err != nil {
+			return bogusKeys(err, now)
+		}
+		return v.matchDS(zone, ds, lookup, now)
+	}
+
+	//delegation without ds should be proved by parent zone
+	auths := response.Sections[g53.AuthSection]
+	var authSigs []*rdata.RRSIG
+	for _, rrset := range auths {
+		if rrset.Type == g53.RR_RRSIG {
+			for _, rd := range rrset.Rdatas {
+				if sig, ok := rd.(*rdata.RRSIG); ok {
+					authSigs = append(authSigs, sig)
+				}
+			}
+		}
+	}
+	pk := v.getZoneKeys(v.parentZone(zone, authSigs), lookup, now)
+	if pk.err != nil || pk.insecure {
+		return pk
+	}
+
+	var denial []*g53.RRset
+	for _, rrset := range auths {
+		if rrset.Type == g53.RR_NSEC || rrset.Type == g53.RR_NSEC3 {
+			if _, err := verifySignatures(rrset, signaturesOf(auths, rrset), pk.keys, now); err != nil {
+				return bogusKeys(err, now)
+			}
+			denial = append(denial, rrset)
+		}
+	}
+	if newDenialProof(denial).insecureDelegation(zone) == statusBogus {
+		return bogusKeys(newBogusError(util.EDE_NSEC_MISSING, "no proof of insecure delegation %s", zone.String(false)), now)
+	}
+	return insecureKeys(now)
+}
+
+// signer of ds or its proof is the parent zone, otherwise use the
+// closest known zone cut
+func (v *validator) parentZone(zone *g53.Name, sigs []*rdata.RRSIG) *g53.Name {
+	for _, sig := range sigs {
+		if zone.IsSubDomain(sig.Signer) && zone.Equals(sig.Signer) == false {
+			return sig.Signer
+		}
+	}
+
+	parent, _ := zone.Parent(1)
+	if cut := v.zoneCut(parent); cut != nil {
+		return cut
+	}
+	return g53.Root
+}
+
+// zone with only unsupported ds is treated as insecure, RFC 4035 5.2
+func (v *validator) matchDS(zone *g53.Name, ds *g53.RRset, lookup lookupFunc, now time.Time) *zoneKeys {
+	var supported []*g53.DS
+	for _, rd := range ds.Rdatas {
+		d := rd.(*g53.DS)
+		if dnssec.IsSupportedAlgorithm(d.Algorithm) && dnssec.IsSupportedDigest(d.DigestType) {
+			supported = append(supported, d)
+		}
+	}
+	if len(supported) == 0 {
+		return insecureKeys(now)
+	}
+
+	dnskeys, sigs, err := lookupRRset(zone, g53.RR_DNSKEY, lookup)
+	if err != nil {
+		return bogusKeys(err, now)
+	}
+	var entries []*rdata.DNSKEY
+	for _, rd := range dnskeys.Rdatas {
+		key := rd.(*rdata.DNSKEY)
+		for _, d := range supported {
+			if dnssec.MatchDS(zone, key, d) {
+				entries = append(entries, key)
+				break
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return bogusKeys(newBogusError(util.EDE_DNSKEY_MISSING, "no dnskey of %s matches ds", zone.String(false)), now)
+	}
+	if _, err := verifySignatures(dnskeys, sigs, entries, now); err != nil {
+		return bogusKeys(err, now)
+	}
+	return secureKeys(dnskeys, now)
+}
+
+func lookupRRset(name *g53.Name, typ g53.RRType, lookup lookupFunc) (*g53.RRset, []*rdata.RRSIG, *bogusError) {
+	response, err := lookup(name, typ)
+	if err != nil {
+		return nil, nil, newBogusError(util.EDE_DNSKEY_MISSING, "lookup %s %s failed: %s",
+			name.String(false), rdata.TypeString(typ), err.Error())
+	}
+	rrset, sigs := answerRRset(response, name, typ)
+	if rrset == nil {
+		return nil, nil, newBogusError(util.EDE_DNSKEY_MISSING, "no %s of %s", rdata.TypeString(typ), name.String(false))
+	}
+	return rrset, sigs, nil
+}
+
+// revoked keys and keys without zone flag can't sign the zone
+func secureKeys(dnskeys *g53.RRset, now time.Time) *zoneKeys {
+	var keys []*rdata.DNSKEY
+	for _, rd := range dnskeys.Rdatas {
+		key := rd.(*rdata.DNSKEY)
+		if key.Flags&dnssec.FlagZone != 0 && key.Flags&dnssec.FlagRevoke == 0 {
+			keys = append(keys, key)
+		}
+	}
+
+	ttl := time.Duration(dnskeys.Ttl) * time.Second
+	if ttl > maxKeyCacheTime {
+		ttl = maxKeyCacheTime
+	}
+	return &zoneKeys{
+		keys:       keys,
+		expireTime: now.Add(ttl),
+	}
+}
+
+func insecureKeys(now time.Time) *zoneKeys {
+	return &zoneKeys{
+		insecure:   true,
+		expireTime: now.Add(maxKeyCacheTime),
+	}
+}
+
+func bogusKeys(err *bogusError, now time.Time) *zoneKeys {
+	return &zoneKeys{
+		err:        err,
+		expireTime: now.Add(bogusKeyCacheTime),
+	}
+}
+
+// verifySignatures returns the signature which validates rrset with one of
+// the keys, ttl of rrset is capped by the signature, RFC 4035 5.3.3
+func verifySignatures(rrset *g53.RRset, sigs []*rdata.RRSIG, keys []*rdata.DNSKEY, now time.Time) (*rdata.RRSIG, *bogusError) {
+	if len(sigs) == 0 {
+		return nil, newBogusError(util.EDE_RRSIGS_MISSING, "no rrsig of %s", rrsetName(rrset))
+	}
+
+	err := newBogusError(util.EDE_DNSKEY_MISSING, "no dnskey for rrsig of %s", rrsetName(rrset))
+	t := uint32(now.Unix())
+	for _, sig := range sigs {
+		if dnssec.IsSupportedAlgorithm(sig.Algorithm) == false {
+			err = newBogusError(util.EDE_UNSUPPORTED_DNSKEY_ALGORITHM, "algorithm %d of %s isn't supported", sig.Algorithm, rrsetName(rrset))
+			continue
+		}
+		//serial number arithmetic, RFC 4034 3.1.5
+		if int32(sig.Expiration-t) < 0 {
+			err = newBogusError(util.EDE_SIGNATURE_EXPIRED, "rrsig of %s is expired", rrsetName(rrset))
+			continue
+		} else if int32(t-sig.Inception) < 0 {
+			err = newBogusError(util.EDE_SIGNATURE_NOT_YET_VALID, "rrsig of %s isn't valid yet", rrsetName(rrset))
+			continue
+		}
+
+		for _, key := range keys {
+			if key.Algorithm != sig.Algorithm || dnssec.KeyTag(key) != sig.Tag {
+				continue
+			}
+			if dnssec.Verify(rrset, sig, sig.Signer, key) == nil {
+				if uint32(rrset.Ttl) > sig.OriginalTtl {
+					rrset.Ttl = g53.RRTTL(sig.OriginalTtl)
+				}
+				if uint32(rrset.Ttl) > sig.Expiration-t {
+					rrset.Ttl = g53.RRTTL(sig.Expiration - t)
+				}
+				return sig, nil
+			}
+			err = newBogusError(util.EDE_DNSSEC_BOGUS, "rrsig of %s is invalid", rrsetName(rrset))
+		}
+	}
+	return nil, err
+}
+
+func signaturesOf(section g53.Section, rrset *g53.RRset) []*rdata.RRSIG {
+	var sigs []*rdata.RRSIG
+	for _, s := range section {
+		if s.Type != g53.RR_RRSIG || s.Name.Equals(rrset.Name) == false {
+			continue
+		}
+		for _, rd := range s.Rdatas {
+			if sig, ok := rd.(*rdata.RRSIG); ok && sig.Covered == rrset.Type {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	return sigs
+}
+
+func answerRRset(response *g53.Message, name *g53.Name, typ g53.RRType) (*g53.RRset, []*rdata.RRSIG) {
+	answers := response.Sections[g53.AnswerSection]
+	for _, rrset := range answers {
+		if rrset.Type == typ && rrset.Name.Equals(name) {
+			return rrset, signaturesOf(answers, rrset)
+		}
+	}
+	return nil, nil
+}
+
+func rrsetName(rrset *g53.RRset) string {
+	return rrset.Name.String(false) + " " + rdata.TypeString(rrset.Type)
+}
@@ -0,0 +1,349 @@
+package recursor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zdnscloud/cement/domaintree"
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/dnssec"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
+	"github.com/zdnscloud/vanguard/resolver/auth"
+	zn "github.com/zdnscloud/vanguard/resolver/auth/zone"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone/memoryzone"
+	vutil "github.com/zdnscloud/vanguard/util"
+)
+
+type testZone struct {
+	origin string
+	nsec3  bool
+	signed bool
+	data   []string
+}
+
+// signed zones with ds of children in parent, answers are returned by
+// auth query as from the authoritative servers
+type testHierarchy struct {
+	zones   []*memoryzone.DynamicZone
+	rootKSK *dnssec.Key
+}
+
+func soaAndNS(origin string) []string {
+	ns := "ns." + strings.TrimPrefix(origin, ".")
+	return []string{
+		origin + " 300 IN SOA " + ns + " root." + ns + " 1 7200 3600 2419200 300",
+		origin + " 300 IN NS " + ns,
+		ns + " 300 IN A 1.1.1.1",
+	}
+}
+
+func newTestHierarchy(t *testing.T) *testHierarchy {
+	zones := []testZone{
+		{"example.com.", false, true, []string{
+			"www.example.com. 300 IN A 2.2.2.2",
+			"alias.example.com. 300 IN CNAME www.example.com.",
+			"sibling.example.com. 300 IN CNAME www.nsec3.com.",
+			"*.w.example.com. 300 IN TXT \"wildcard\"",
+		}},
+		{"nsec3.com.", true, true, []string{
+			"www.nsec3.com. 300 IN A 3.3.3.3",
+			"*.w.nsec3.com. 300 IN TXT \"wildcard\"",
+		}},
+		{"badds.com.", false, true, []string{
+			"www.badds.com. 300 IN A 4.4.4.4",
+		}},
+		{"insecure.com.", false, false, []string{
+			"www.insecure.com. 300 IN A 5.5.5.5",
+		}},
+		{"com.", false, true, nil},
+		{".", false, true, nil},
+	}
+
+	h := &testHierarchy{}
+	var ds []string
+	for _, z := range zones {
+		origin := g53.NameFromStringUnsafe(z.origin)
+		data := append(soaAndNS(z.origin), z.data...)
+		for _, child := range h.zones {
+			if parent, _ := child.GetOrigin().Parent(1); parent.Equals(origin) {
+				data = append(data, child.GetOrigin().String(false)+" 300 IN NS ns."+child.GetOrigin().String(false))
+			}
+		}
+
+		zone := memoryzone.NewDynamicZone(origin)
+		tx, _ := zone.Begin()
+		for _, rr := range data {
+			rrset, err := rdata.RRsetFromString(rr)
+			ut.Assert(t, err == nil, "invalid rr %s: %v", rr, err)
+			zone.Add(tx, rrset)
+		}
+		ut.Equal(t, tx.Commit(), nil)
+
+		if z.signed {
+			ksk, _ := dnssec.GenerateKey(origin, dnssec.AlgorithmECDSAP256SHA256, true)
+			zsk, _ := dnssec.GenerateKey(origin, dnssec.AlgorithmED25519, false)
+			err := zone.EnableDNSSEC(&zn.SignPolicy{
+				Keys:       []*dnssec.Key{ksk, zsk},
+				NSEC3:      z.nsec3,
+				Iterations: 1,
+				Salt:       []byte{0xab},
+				Validity:   24 * time.Hour,
+				Refresh:    6 * time.Hour,
+			})
+			ut.Assert(t, err == nil, "sign zone %s failed: %v", z.origin, err)
+
+			dsKey := ksk
+			if z.origin == "badds.com." {
+				dsKey, _ = dnssec.GenerateKey(origin, dnssec.AlgorithmECDSAP256SHA256, true)
+			}
+			if origin.IsRoot() {
+				h.rootKSK = ksk
+			} else {
+				ds = append(ds, z.origin+" 300 IN DS "+dnssec.DS(origin, dsKey.DNSKEY).String())
+			}
+		}
+		h.zones = append(h.zones, zone)
+	}
+
+	//parent zone is created after children, add ds of children to it
+	for _, zone := range h.zones {
+		tx, _ := zone.Begin()
+		for _, d := range ds {
+			rrset, _ := rdata.RRsetFromString(d)
+			if parent, _ := rrset.Name.Parent(1); parent.Equals(zone.GetOrigin()) {
+				zone.Add(tx, rrset)
+			}
+		}
+		ut.Equal(t, tx.Commit(), nil)
+	}
+	return h
+}
+
+func (h *testHierarchy) zoneCut(name *g53.Name) *g53.Name {
+	var cut *g53.Name
+	for _, zone := range h.zones {
+		if origin := zone.GetOrigin(); name.IsSubDomain(origin) && (cut == nil || origin.LabelCount() > cut.LabelCount()) {
+			cut = origin
+		}
+	}
+	return cut
+}
+
+func (h *testHierarchy) findZone(name *g53.Name) *memoryzone.DynamicZone {
+	cut := h.zoneCut(name)
+	for _, zone := range h.zones {
+		if zone.GetOrigin().Equals(cut) {
+			return zone
+		}
+	}
+	return nil
+}
+
+func (h *testHierarchy) query(name *g53.Name, typ g53.RRType) (*g53.Message, *g53.Name) {
+	zoneName := name
+	if typ == g53.RR_DS && name.IsRoot() == false {
+		zoneName, _ = name.Parent(1)
+	}
+	zone := h.findZone(zoneName)
+	matchType := domaintree.ClosestEncloser
+	if zone.GetOrigin().Equals(name) {
+		matchType = domaintree.ExactMatch
+	}
+
+	q := auth.NewQuery(matchType, g53.MakeQuery(name, typ, 4096, true), zone)
+	q.Process()
+	render := g53.NewMsgRender()
+	q.GetResponse().Rend(render)
+	response, err := rdata.MessageFromWire(util.NewInputBuffer(render.Data()))
+	if err != nil {
+		panic("parse response failed:" + err.Error())
+	}
+	return response, zone.GetOrigin()
+}
+
+func (h *testHierarchy) lookup(name *g53.Name, typ g53.RRType) (*g53.Message, error) {
+	response, _ := h.query(name, typ)
+	return response, nil
+}
+
+func (h *testHierarchy) newValidator() *validator {
+	anchors := &TrustAnchors{anchors: make(map[string]*trustAnchor)}
+	anchors.addLine(". 300 IN DNSKEY " + h.rootKSK.DNSKEY.String())
+	return newValidator(anchors, h.zoneCut)
+}
+
+func (h *testHierarchy) validate(v *validator, name string, typ g53.RRType) (*g53.Message, securityStatus, *bogusError) {
+	response, zone := h.query(g53.NameFromStringUnsafe(name), typ)
+	status, err := v.validate(response, zone, h.lookup)
+	return response, status, err
+}
+
+func removeSignatures(section g53.Section) g53.Section {
+	var rrsets g53.Section
+	for _, rrset := range section {
+		if rrset.Type != g53.RR_RRSIG {
+			rrsets = append(rrsets, rrset)
+		}
+	}
+	return rrsets
+}
+
+func TestValidateAnswer(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	h := newTestHierarchy(t)
+	v := h.newValidator()
+
+	for _, q := range []struct {
+		name   string
+		typ    g53.RRType
+		rcode  g53.Rcode
+		status securityStatus
+	}{
+		{"www.example.com.", g53.RR_A, g53.R_NOERROR, statusSecure},
+		{"alias.example.com.", g53.RR_A, g53.R_NOERROR, statusSecure},
+		{"no.example.com.", g53.RR_A, g53.R_NXDOMAIN, statusSecure},
+		{"www.example.com.", g53.RR_MX, g53.R_NOERROR, statusSecure},
+		{"a.w.example.com.", g53.RR_TXT, g53.R_NOERROR, statusSecure},
+		{"a.w.example.com.", g53.RR_MX, g53.R_NOERROR, statusSecure},
+		{"www.nsec3.com.", g53.RR_A, g53.R_NOERROR, statusSecure},
+		{"no.nsec3.com.", g53.RR_A, g53.R_NXDOMAIN, statusSecure},
+		{"www.nsec3.com.", g53.RR_MX, g53.R_NOERROR, statusSecure},
+		{"a.w.nsec3.com.", g53.RR_TXT, g53.R_NOERROR, statusSecure},
+		{"www.insecure.com.", g53.RR_A, g53.R_NOERROR, statusInsecure},
+		{"no.insecure.com.", g53.RR_A, g53.R_NXDOMAIN, statusInsecure},
+	} {
+		response, status, err := h.validate(v, q.name, q.typ)
+		ut.Equal(t, response.Header.Rcode, q.rcode)
+		ut.Assert(t, err == nil, "validate %s failed: %v", q.name, err)
+		ut.Equal(t, status, q.status)
+	}
+
+	_, status, err := h.validate(v, "www.badds.com.", g53.RR_A)
+	ut.Equal(t, status, statusBogus)
+	ut.Equal(t, err.code, uint16(vutil.EDE_DNSKEY_MISSING))
+}
+
+func TestValidateBogusAnswer(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	h := newTestHierarchy(t)
+	v := h.newValidator()
+
+	response, zone := h.query(g53.NameFromStringUnsafe("www.example.com."), g53.RR_A)
+	response.Sections[g53.AnswerSection][0].Rdatas[0], _ = g53.AFromString("6.6.6.6")
+	status, err := v.validate(response, zone, h.lookup)
+	ut.Equal(t, status, statusBogus)
+	ut.Equal(t, err.code, uint16(vutil.EDE_DNSSEC_BOGUS))
+
+	response, zone = h.query(g53.NameFromStringUnsafe("www.example.com."), g53.RR_A)
+	response.Sections[g53.AnswerSection] = removeSignatures(response.Sections[g53.AnswerSection])
+	status, err = v.validate(response, zone, h.lookup)
+	ut.Equal(t, status, statusBogus)
+	ut.Equal(t, err.code, uint16(vutil.EDE_RRSIGS_MISSING))
+
+	//nxdomain without nsec
+	response, zone = h.query(g53.NameFromStringUnsafe("no.example.com."), g53.RR_A)
+	response.Sections[g53.AuthSection] = response.Sections[g53.AuthSection][:2]
+	status, err = v.validate(response, zone, h.lookup)
+	ut.Equal(t, status, statusBogus)
+	ut.Equal(t, err.code, uint16(vutil.EDE_NSEC_MISSING))
+
+	//wildcard answer without proof of nonexistence of query name
+	response, zone = h.query(g53.NameFromStringUnsafe("a.w.nsec3.com."), g53.RR_TXT)
+	response.Sections[g53.AuthSection] = nil
+	status, err = v.validate(response, zone, h.lookup)
+	ut.Equal(t, status, statusBogus)
+	ut.Equal(t, err.code, uint16(vutil.EDE_NSEC_MISSING))
+
+	//answer from unsigned zone under signed delegation
+	response, zone = h.query(g53.NameFromStringUnsafe("www.nsec3.com."), g53.RR_A)
+	response.Sections[g53.AnswerSection] = removeSignatures(response.Sections[g53.AnswerSection])
+	status, err = v.validate(response, zone, h.lookup)
+	ut.Equal(t, status, statusBogus)
+	ut.Equal(t, err.code, uint16(vutil.EDE_RRSIGS_MISSING))
+}
+
+// forged answer claims to be signed by a name which isn't zone cut, which
+// has nodata proof of ds but isn't an insecure delegation
+func forgeSigner(t *testing.T, h *testHierarchy, v *validator, name string, typ g53.RRType, signer string) {
+	response, zone := h.query(g53.NameFromStringUnsafe(name), typ)
+	answers := response.Sections[g53.AnswerSection]
+	answers[0].Rdatas[0], _ = g53.AFromString("6.6.6.6")
+	for _, rrset := range answers {
+		if rrset.Type == g53.RR_RRSIG {
+			sig := *rrset.Rdatas[0].(*rdata.RRSIG)
+			sig.Signer = g53.NameFromStringUnsafe(signer)
+			rrset.Rdatas[0] = &sig
+		}
+	}
+	status, err := v.validate(response, zone, h.lookup)
+	ut.Equal(t, status, statusBogus)
+	ut.Assert(t, err != nil, "forged signer %s should be bogus", signer)
+}
+
+func TestValidateForgedSigner(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	h := newTestHierarchy(t)
+	v := h.newValidator()
+	forgeSigner(t, h, v, "www.example.com.", g53.RR_A, "www.example.com.")
+	forgeSigner(t, h, v, "www.nsec3.com.", g53.RR_A, "www.nsec3.com.")
+	//signer above the zone which answers
+	forgeSigner(t, h, v, "www.example.com.", g53.RR_A, "com.")
+
+	//proof of empty non-terminal or nonexistent name isn't insecure delegation
+	for _, name := range []string{"w.example.com.", "no.example.com.", "w.nsec3.com.", "www.example.com."} {
+		response, _ := h.query(g53.NameFromStringUnsafe(name), g53.RR_DS)
+		var denial []*g53.RRset
+		for _, rrset := range response.Sections[g53.AuthSection] {
+			if rrset.Type == g53.RR_NSEC || rrset.Type == g53.RR_NSEC3 {
+				denial = append(denial, rrset)
+			}
+		}
+		ut.Equal(t, newDenialProof(denial).insecureDelegation(g53.NameFromStringUnsafe(name)), statusBogus)
+	}
+
+	response, _ := h.query(g53.NameFromStringUnsafe("insecure.com."), g53.RR_DS)
+	ut.Equal(t, newDenialProof(response.Sections[g53.AuthSection]).insecureDelegation(g53.NameFromStringUnsafe("insecure.com.")), statusInsecure)
+}
+
+// server hosts both zones returns signed records of cname target in
+// sibling zone, which are dropped instead of making the answer bogus
+func TestValidateOutOfZoneAnswer(t *testing.T) {
+	logger.UseDefaultLogger("error")
+	h := newTestHierarchy(t)
+	v := h.newValidator()
+
+	response, zone := h.query(g53.NameFromStringUnsafe("sibling.example.com."), g53.RR_A)
+	target, _ := h.query(g53.NameFromStringUnsafe("www.nsec3.com."), g53.RR_A)
+	for _, rrset := range target.Sections[g53.AnswerSection] {
+		response.AddRRset(g53.AnswerSection, rrset)
+	}
+	response.RecalculateSectionRRCount()
+	status, err := v.validate(response, zone, h.lookup)
+	ut.Assert(t, err == nil, "out of zone records shouldn't make answer bogus: %v", err)
+	ut.Equal(t, status, statusSecure)
+	answers := response.Sections[g53.AnswerSection]
+	ut.Equal(t, len(answers), 2)
+	ut.Equal(t, int(response.Header.ANCount), 2)
+	for _, rrset := range answers {
+		ut.Equal(t, rrset.Name.String(false), "sibling.example.com.")
+	}
+}
+
+func TestValidateWithoutAnchor(t *testing.T) {
+	h := newTestHierarchy(t)
+	anchors := &TrustAnchors{anchors: make(map[string]*trustAnchor)}
+	anchors.addLine("example.com. 300 IN DS " + dnssec.DS(g53.NameFromStringUnsafe("example.com."), h.rootKSK.DNSKEY).String())
+	v := newValidator(anchors, h.zoneCut)
+	_, status, err := h.validate(v, "www.insecure.com.", g53.RR_A)
+	ut.Assert(t, err == nil, "name without anchor shouldn't be bogus")
+	ut.Equal(t, status, statusInsecure)
+
+	//anchor doesn't match the key of zone
+	_, status, err = h.validate(v, "www.example.com.", g53.RR_A)
+	ut.Equal(t, status, statusBogus)
+	ut.Equal(t, err.code, uint16(vutil.EDE_DNSSEC_BOGUS))
+}
@@ -21,13 +21,16 @@ const sendTimeout = 3 * time.Second
 
 type StubZoneManager struct {
 	chain.DefaultResolver
-	stubZones map[string]*domaintree.DomainTree
-	sender    *util.SafeUDPSender
-	lock      sync.RWMutex
+	stubZones    map[string]*domaintree.DomainTree
+	sender       *util.SafeUDPSender
+	capabilities *util.ServerCapabilities
+	lock         sync.RWMutex
 }
 
 func NewStubZoneManager(conf *config.VanguardConf) *StubZoneManager {
-	stub := &StubZoneManager{}
+	stub := &StubZoneManager{
+		capabilities: util.NewServerCapabilities(),
+	}
 	stub.ReloadConfig(conf)
 	httpcmd.RegisterHandler(stub, []httpcmd.Command{&AddStubZone{}, &DeleteStubZone{}, &UpdateStubZone{}})
 	return stub
@@ -108,12 +111,12 @@ func (z *StubZoneManager) getMasters(viewName string, name *g53.Name) ([]string,
 func (z *StubZoneManager) handleQuery(request *g53.Message, masters []string) (response *g53.Message, err error) {
 	masterLen := len(masters)
 	if masterLen == 1 {
-		response, _, err = z.sender.Query(masters[0], request)
+		response, _, err = z.sender.QueryServer(masters[0], request, z.capabilities.Get(masters[0]))
 	} else {
 		resultChan := make(chan *g53.Message, masterLen)
 		for _, master := range masters {
 			go func(addr string) {
-				resp, _, err := z.sender.Query(addr, request)
+				resp, _, err := z.sender.QueryServer(addr, request, z.capabilities.Get(addr))
 				if err == nil {
 					resultChan <- resp
 				} else {
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	g53util "github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/logger"
+)
+
+const (
+	defaultDoHPath    = "/dns-query"
+	dohMediaType      = "application/dns-message"
+	dohQueryParam     = "dns"
+	dohForwardHeader  = "X-Forwarded-For"
+	dohMaxMessageSize = 65535
+	dohTimeout        = 5 * time.Second
+)
+
+var (
+	errDoHEmptyQuery   = errors.New("doh request has no dns message")
+	errDoHMediaType    = errors.New("doh request content type isn't " + dohMediaType)
+	errDoHTooLarge     = errors.New("doh request message is too large")
+	errDoHInvalidProxy = errors.New("doh trusted proxy isn't valid ip or network")
+)
+
+type dohHandler struct {
+	messageChan chan<- message
+	proxies     []*net.IPNet
+}
+
+func newDoHHandler(proxies []string) (*dohHandler, error) {
+	h := &dohHandler{}
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") == false {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errDoHInvalidProxy
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errDoHInvalidProxy
+		}
+		h.proxies = append(h.proxies, network)
+	}
+	return h, nil
+}
+
+func (h *dohHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query, err := readDoHQuery(r)
+	if err != nil {
+		if err == errDoHMediaType {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		} else if err == errDoHTooLarge {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	addr, err := h.clientAddr(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	destAddr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if _, ok := destAddr.(*net.TCPAddr); ok == false {
+		destAddr = &net.TCPAddr{}
+	}
+
+	responseChan := make(chan []byte, 1)
+	select {
+	case h.messageChan <- message{
+		transport:    core.TransportHTTPS,
+		addr:         addr,
+		destAddr:     destAddr,
+		buf:          query,
+		responseChan: responseChan,
+	}:
+	case <-r.Context().Done():
+		return
+	case <-time.After(dohTimeout):
+		logger.GetLogger().Warn("!!!doh message buffer is full")
+		http.Error(w, "server is busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	var response []byte
+	select {
+	case response = <-responseChan:
+	case <-r.Context().Done():
+		return
+	}
+
+	if response == nil {
+		http.Error(w, "no response for query", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", dohMediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(response)))
+	if ttl, ok := responseCacheTtl(response); ok {
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(ttl)))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Write(response)
+}
+
+func readDoHQuery(r *http.Request) ([]byte, error) {
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get(dohQueryParam)
+		if param == "" {
+			return nil, errDoHEmptyQuery
+		}
+		if base64.RawURLEncoding.DecodedLen(len(param)) > dohMaxMessageSize {
+			return nil, errDoHTooLarge
+		}
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+	case http.MethodPost:
+		if mediaType := r.Header.Get("Content-Type"); mediaType != dohMediaType {
+			return nil, errDoHMediaType
+		}
+		buf, err := ioutil.ReadAll(io.LimitReader(r.Body, dohMaxMessageSize+1))
+		if err != nil {
+			return nil, err
+		} else if len(buf) > dohMaxMessageSize {
+			return nil, errDoHTooLarge
+		} else if len(buf) == 0 {
+			return nil, errDoHEmptyQuery
+		}
+		return buf, nil
+	default:
+		return nil, errors.New("doh only support get and post method")
+	}
+}
+
+// when request comes from trusted proxy, walk X-Forwarded-For from right to
+// left, the first address which isn't a trusted proxy is the real client
+func (h *dohHandler) clientAddr(r *http.Request) (*net.TCPAddr, error) {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.isTrustedProxy(addr.IP) == false {
+		return addr, nil
+	}
+
+	var forwarded []string
+	for _, header := range r.Header[dohForwardHeader] {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+
+		addr = &net.TCPAddr{IP: ip}
+		if h.isTrustedProxy(ip) == false {
+			break
+		}
+	}
+	return addr, nil
+}
+
+func (h *dohHandler) isTrustedProxy(ip net.IP) bool {
+	for _, network := range h.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// cache lifetime is the minimum ttl of answer section, for negative answer
+// it is the smaller one of soa ttl and soa minimum
+func responseCacheTtl(response []byte) (uint32, bool) {
+	msg, err := g53.MessageFromWire(g53util.NewInputBuffer(response))
+	if err != nil {
+		return 0, false
+	}
+
+	if rcode := msg.Header.Rcode; rcode != g53.R_NOERROR && rcode != g53.R_NXDOMAIN {
+		return 0, false
+	}
+
+	var minTtl uint32
+	found := false
+	for _, rrset := range msg.Sections[g53.AnswerSection] {
+		if found == false || uint32(rrset.Ttl) < minTtl {
+			minTtl = uint32(rrset.Ttl)
+			found = true
+		}
+	}
+
+	if found == false {
+		for _, rrset := range msg.Sections[g53.AuthSection] {
+			if rrset.Type == g53.RR_SOA && len(rrset.Rdatas) == 1 {
+				minTtl = uint32(rrset.Ttl)
+				if minimum := rrset.Rdatas[0].(*g53.SOA).Minimum; minimum < minTtl {
+					minTtl = minimum
+				}
+				found = true
+				break
+			}
+		}
+	}
+
+	return minTtl, found
+}
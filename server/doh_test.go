@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+)
+
+func renderMessage(msg *g53.Message) []byte {
+	render := g53.NewMsgRender()
+	msg.RecalculateSectionRRCount()
+	msg.Rend(render)
+	return render.Data()
+}
+
+func TestDoHReadQuery(t *testing.T) {
+	query := renderMessage(g53.MakeQuery(g53.NameFromStringUnsafe("www.knet.cn."), g53.RR_A, 1232, false))
+
+	req := httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+	buf, err := readDoHQuery(req)
+	ut.Assert(t, err == nil, "get query should be accepted but get %v", err)
+	ut.Equal(t, buf, query)
+
+	req = httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.URLEncoding.EncodeToString(query), nil)
+	buf, err = readDoHQuery(req)
+	ut.Assert(t, err == nil, "padding in get query should be tolerated but get %v", err)
+	ut.Equal(t, buf, query)
+
+	req = httptest.NewRequest(http.MethodGet, "/dns-query", nil)
+	_, err = readDoHQuery(req)
+	ut.Equal(t, err, errDoHEmptyQuery)
+
+	req = httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(query))
+	req.Header.Set("Content-Type", dohMediaType)
+	buf, err = readDoHQuery(req)
+	ut.Assert(t, err == nil, "post query should be accepted but get %v", err)
+	ut.Equal(t, buf, query)
+
+	req = httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(query))
+	req.Header.Set("Content-Type", "text/plain")
+	_, err = readDoHQuery(req)
+	ut.Equal(t, err, errDoHMediaType)
+}
+
+func TestDoHClientAddr(t *testing.T) {
+	h, err := newDoHHandler([]string{"10.0.0.1", "192.168.0.0/16"})
+	ut.Assert(t, err == nil, "valid proxies should be accepted")
+
+	req := httptest.NewRequest(http.MethodGet, "/dns-query", nil)
+	req.RemoteAddr = "1.1.1.1:5000"
+	req.Header.Set(dohForwardHeader, "2.2.2.2")
+	addr, err := h.clientAddr(req)
+	ut.Assert(t, err == nil, "")
+	ut.Equal(t, addr.IP.String(), "1.1.1.1")
+	ut.Equal(t, addr.Port, 5000)
+
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set(dohForwardHeader, "3.3.3.3, 2.2.2.2, 192.168.1.1")
+	addr, err = h.clientAddr(req)
+	ut.Assert(t, err == nil, "")
+	ut.Equal(t, addr.IP.String(), "2.2.2.2")
+
+	req.Header.Del(dohForwardHeader)
+	addr, err = h.clientAddr(req)
+	ut.Assert(t, err == nil, "")
+	ut.Equal(t, addr.IP.String(), "10.0.0.1")
+
+	_, err = newDoHHandler([]string{"10.0.0"})
+	ut.Equal(t, err, errDoHInvalidProxy)
+}
+
+func TestDoHCacheTtl(t *testing.T) {
+	query := g53.MakeQuery(g53.NameFromStringUnsafe("www.knet.cn."), g53.RR_A, 1232, false)
+	resp := query.MakeResponse()
+	a, _ := g53.RRsetFromString("www.knet.cn. 300 IN A 1.1.1.1")
+	cname, _ := g53.RRsetFromString("www.knet.cn. 60 IN CNAME knet.cn.")
+	resp.AddRRset(g53.AnswerSection, cname)
+	resp.AddRRset(g53.AnswerSection, a)
+	ttl, ok := responseCacheTtl(renderMessage(resp))
+	ut.Assert(t, ok, "positive answer should be cacheable")
+	ut.Equal(t, ttl, uint32(60))
+
+	resp = query.MakeResponse()
+	resp.Header.Rcode = g53.R_NXDOMAIN
+	soa, _ := g53.RRsetFromString("knet.cn. 3600 IN SOA ns.knet.cn. root.knet.cn. 1 3600 900 86400 600")
+	resp.AddRRset(g53.AuthSection, soa)
+	ttl, ok = responseCacheTtl(renderMessage(resp))
+	ut.Assert(t, ok, "negative answer should be cacheable")
+	ut.Equal(t, ttl, uint32(600))
+
+	resp = query.MakeResponse()
+	resp.Header.Rcode = g53.R_SERVFAIL
+	_, ok = responseCacheTtl(renderMessage(resp))
+	ut.Assert(t, ok == false, "servfail shouldn't be cached")
+}
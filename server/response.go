@@ -0,0 +1,105 @@
+package server
+
+import (
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/util"
+)
+
+const (
+	minUdpSize         = 512
+	defaultEdnsUdpSize = 1232
+)
+
+// response may be shared with cache, transport specific modification is
+// done on a shallow copy of it
+func (s *Server) rendResponse(q *message, client *core.Client, render *g53.MsgRender) {
+	client.Response.RecalculateSectionRRCount()
+	response := *client.Response
+	if dnssecOK(client.Request) == false {
+		stripDNSSECRecords(&response)
+		if client.Request.Header.GetFlag(g53.FLAG_AD) == false {
+			response.Header.SetFlag(g53.FLAG_AD, false)
+		}
+	}
+	if client.Request.Edns == nil {
+		response.Edns = nil
+	} else {
+		s.setResponseEdns(&response, client.Request.Edns)
+		if q.transport == core.TransportTCP || q.transport == core.TransportTLS {
+			s.addTCPKeepalive(&response)
+		}
+	}
+
+	util.RecalculateSectionRRCount(&response)
+	response.Rend(render)
+	if q.transport == core.TransportUDP {
+		if limit := s.transport.udpSizeLimit(client.Request); render.Len() > uint(limit) {
+			truncateResponse(&response, limit, render)
+		}
+	}
+}
+
+// response edns advertises the udp payload size of the server, DO bit is
+// copied from request, RFC 3225
+func (s *Server) setResponseEdns(response *g53.Message, requestEdns *g53.EDNS) {
+	var edns g53.EDNS
+	if response.Edns != nil {
+		edns = *response.Edns
+	}
+	edns.UdpSize = s.transport.maxUdpSize
+	edns.DnssecAware = requestEdns.DnssecAware
+	response.Edns = &edns
+}
+
+func dnssecOK(request *g53.Message) bool {
+	return request.Edns != nil && request.Edns.DnssecAware
+}
+
+// dnssec records are only returned to client which sets DO bit, unless
+// they are queried explicitly, RFC 4035 3.2.1, response like formerr may
+// have no question
+func stripDNSSECRecords(response *g53.Message) {
+	for i, section := range response.Sections {
+		var rrsets g53.Section
+		for _, rrset := range section {
+			if isDNSSECRecord(rrset.Type) == false || (response.Question != nil && rrset.Type == response.Question.Type) {
+				rrsets = append(rrsets, rrset)
+			}
+		}
+		if len(rrsets) != len(section) {
+			response.Sections[i] = rrsets
+		}
+	}
+}
+
+func isDNSSECRecord(typ g53.RRType) bool {
+	return typ == g53.RR_RRSIG || typ == g53.RR_NSEC || typ == g53.RR_NSEC3
+}
+
+func (s *Server) addTCPKeepalive(response *g53.Message) {
+	timeout := s.transport.tcpIdleTimeout / (100 * time.Millisecond)
+	util.AddEdnsOption(response, &util.TCPKeepaliveOpt{Timeout: uint16(timeout)})
+}
+
+// additional section is dropped first, since it isn't necessary for the
+// answer, if the response still doesn't fit, only the question is kept with
+// tc bit set, so client will retry over tcp
+func truncateResponse(response *g53.Message, limit uint16, render *g53.MsgRender) {
+	response.Sections[g53.AdditionalSection] = nil
+	util.RecalculateSectionRRCount(response)
+	render.Clear()
+	response.Rend(render)
+	if render.Len() <= uint(limit) {
+		return
+	}
+
+	response.Sections[g53.AnswerSection] = nil
+	response.Sections[g53.AuthSection] = nil
+	response.Header.SetFlag(g53.FLAG_TC, true)
+	util.RecalculateSectionRRCount(response)
+	render.Clear()
+	response.Rend(render)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/rdata"
+)
+
+func TestUdpSizeLimit(t *testing.T) {
+	trans := &Transport{maxUdpSize: 1232}
+	name := g53.NameFromStringUnsafe("www.knet.cn.")
+
+	ut.Equal(t, trans.udpSizeLimit(g53.MakeQuery(name, g53.RR_A, 4096, false)), uint16(1232))
+	ut.Equal(t, trans.udpSizeLimit(g53.MakeQuery(name, g53.RR_A, 1024, false)), uint16(1024))
+	ut.Equal(t, trans.udpSizeLimit(g53.MakeQuery(name, g53.RR_A, 256, false)), uint16(512))
+
+	query := g53.MakeQuery(name, g53.RR_A, 4096, false)
+	query.Edns = nil
+	ut.Equal(t, trans.udpSizeLimit(query), uint16(512))
+}
+
+func TestRendTruncatedResponse(t *testing.T) {
+	s := &Server{transport: &Transport{maxUdpSize: 1232}}
+	name := g53.NameFromStringUnsafe("www.knet.cn.")
+	query := g53.MakeQuery(name, g53.RR_TXT, 4096, false)
+	response := query.MakeResponse()
+	var answer *g53.RRset
+	for i := 0; i < 15; i++ {
+		rrset, _ := g53.RRsetFromString(fmt.Sprintf("www.knet.cn. 300 IN TXT \"%040d\"", i))
+		if answer == nil {
+			answer = rrset
+		} else {
+			answer.AddRdata(rrset.Rdatas[0])
+		}
+	}
+	response.AddRRset(g53.AnswerSection, answer)
+	ns, _ := g53.RRsetFromString("knet.cn. 300 IN NS ns.knet.cn.")
+	response.AddRRset(g53.AuthSection, ns)
+
+	client := &core.Client{Request: query, Response: response}
+	render := g53.NewMsgRender()
+	s.rendResponse(&message{transport: core.TransportTCP}, client, render)
+	ut.Assert(t, render.Len() > 512, "tcp response shouldn't be truncated")
+
+	render.Clear()
+	s.rendResponse(&message{transport: core.TransportUDP}, client, render)
+	ut.Assert(t, render.Len() > 512 && render.Len() <= 1232, "udp response should fit the edns size")
+	ut.Equal(t, render.Data()[2]&0x02, uint8(0))
+
+	query.Edns.UdpSize = 512
+	render.Clear()
+	s.rendResponse(&message{transport: core.TransportUDP}, client, render)
+	ut.Assert(t, render.Len() <= 512, "udp response should be truncated")
+	ut.Equal(t, render.Data()[2]&0x02, uint8(0x02))
+	ut.Equal(t, len(response.Sections[g53.AnswerSection]), 1)
+	ut.Equal(t, response.Header.GetFlag(g53.FLAG_TC), false)
+}
+
+func TestStripDNSSECRecords(t *testing.T) {
+	s := &Server{transport: &Transport{maxUdpSize: 1232}}
+	name := g53.NameFromStringUnsafe("www.knet.cn.")
+	query := g53.MakeQuery(name, g53.RR_A, 4096, false)
+	response := query.MakeResponse()
+	response.Header.SetFlag(g53.FLAG_AD, true)
+	a, _ := g53.RRsetFromString("www.knet.cn. 300 IN A 1.1.1.1")
+	response.AddRRset(g53.AnswerSection, a)
+	sig, _ := rdata.RRsetFromString("www.knet.cn. 300 IN RRSIG A 13 3 300 20261024000000 20260924000000 12345 knet.cn. YWJj")
+	response.AddRRset(g53.AnswerSection, sig)
+
+	client := &core.Client{Request: query, Response: response}
+	render := g53.NewMsgRender()
+	s.rendResponse(&message{transport: core.TransportUDP}, client, render)
+	msg, err := rdata.MessageFromWire(util.NewInputBuffer(render.Data()))
+	ut.Assert(t, err == nil, "parse response failed: %v", err)
+	ut.Equal(t, len(msg.Sections[g53.AnswerSection]), 1)
+	ut.Equal(t, msg.Header.GetFlag(g53.FLAG_AD), false)
+	ut.Equal(t, len(response.Sections[g53.AnswerSection]), 2)
+
+	query.Edns.DnssecAware = true
+	render.Clear()
+	s.rendResponse(&message{transport: core.TransportUDP}, client, render)
+	msg, _ = rdata.MessageFromWire(util.NewInputBuffer(render.Data()))
+	ut.Equal(t, len(msg.Sections[g53.AnswerSection]), 2)
+	ut.Equal(t, msg.Header.GetFlag(g53.FLAG_AD), true)
+
+	//response without question, like formerr
+	noQuestion := &g53.Message{Header: g53.Header{Rcode: g53.R_FORMERR}}
+	noQuestion.Header.SetFlag(g53.FLAG_QR, true)
+	noQuestion.AddRRset(g53.AuthSection, sig)
+	client = &core.Client{Request: &g53.Message{}, Response: noQuestion}
+	render.Clear()
+	s.rendResponse(&message{transport: core.TransportUDP}, client, render)
+	msg, err = rdata.MessageFromWire(util.NewInputBuffer(render.Data()))
+	ut.Assert(t, err == nil, "parse response failed: %v", err)
+	ut.Equal(t, msg.Header.Rcode, g53.R_FORMERR)
+	ut.Equal(t, len(msg.Sections[g53.AuthSection]), 0)
+}
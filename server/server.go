@@ -12,6 +12,7 @@ import (
 	"github.com/zdnscloud/vanguard/httpcmd"
 	"github.com/zdnscloud/vanguard/logger"
 	"github.com/zdnscloud/vanguard/metrics"
+	"github.com/zdnscloud/vanguard/rdata"
 )
 
 const (
@@ -19,26 +20,32 @@ const (
 )
 
 type message struct {
-	usingTCP bool
-	addr     net.Addr
-	destAddr net.Addr
-	conn     net.Conn
-	buf      []byte
+	transport    core.Transport
+	addr         net.Addr
+	destAddr     net.Addr
+	conn         net.Conn
+	buf          []byte
+	responseChan chan []byte
+}
+
+func (m *message) usingTCP() bool {
+	return m.transport != core.TransportUDP
 }
 
 type Server struct {
-	conf         *config.VanguardConf
-	transport    *Transport
-	queryHandler core.DNSQueryHandler
-	xfrHander    core.DNSQueryHandler
-	messageChan  chan message
+	conf          *config.VanguardConf
+	transport     *Transport
+	queryHandler  core.DNSQueryHandler
+	xfrHander     core.DNSQueryHandler
+	updateHandler core.DNSQueryHandler
+	messageChan   chan message
 
 	handlerRoutineCount int
 	stopChan            chan struct{}
 	wg                  sync.WaitGroup
 }
 
-func NewServer(conf *config.VanguardConf, queryHandler core.DNSQueryHandler, xfrHander core.DNSQueryHandler) (*Server, error) {
+func NewServer(conf *config.VanguardConf, queryHandler, xfrHander, updateHandler core.DNSQueryHandler) (*Server, error) {
 	handlerCount := conf.Server.HandlerCount
 	if handlerCount == 0 {
 		handlerCount = defaultHandlerCount
@@ -55,6 +62,7 @@ func NewServer(conf *config.VanguardConf, queryHandler core.DNSQueryHandler, xfr
 		messageChan:         make(chan message, handlerCount),
 		queryHandler:        queryHandler,
 		xfrHander:           xfrHander,
+		updateHandler:       updateHandler,
 		handlerRoutineCount: handlerCount,
 		stopChan:            make(chan struct{}),
 	}
@@ -72,6 +80,11 @@ func (s *Server) Run() {
 func (s *Server) Shutdown() {
 	s.transport.Close()
 	s.stop()
+	for h := s.queryHandler; h != nil; h = h.Next() {
+		if handler, ok := h.(core.ShutdownHandler); ok {
+			handler.Shutdown()
+		}
+	}
 }
 
 func (s *Server) startHandlerRoutine(handlerCount int) {
@@ -96,24 +109,36 @@ func (s *Server) startHandlerRoutine(handlerCount int) {
 					return
 				case message := <-s.messageChan:
 					inputBuff.SetData(message.buf)
-					err := request.FromWire(inputBuff)
+					err := requestFromWire(&request, inputBuff)
 					if err == nil {
 						ctx.Reset()
 						ctx.Client.Addr = message.addr
 						ctx.Client.DestAddr = message.destAddr
 						ctx.Client.Request = &request
-						ctx.Client.UsingTCP = message.usingTCP
+						ctx.Client.UsingTCP = message.usingTCP()
+						ctx.Client.Transport = message.transport
 						if request.Header.Opcode == g53.OP_QUERY {
-							s.queryHandler.HandleQuery(ctx)
+							if isTransferQuery(&request) && s.xfrHander != nil {
+								s.xfrHander.HandleQuery(ctx)
+							} else {
+								s.queryHandler.HandleQuery(ctx)
+							}
 						} else if request.Header.Opcode == g53.OP_NOTIFY && s.xfrHander != nil {
 							s.xfrHander.HandleQuery(ctx)
+						} else if request.Header.Opcode == g53.OP_UPDATE && s.updateHandler != nil {
+							s.updateHandler.HandleQuery(ctx)
 						} else {
 							logger.GetLogger().Error("invalid opcode")
+							ctx.Client.Response = request.MakeResponse()
+							ctx.Client.Response.Header.Rcode = g53.R_NOTIMP
 						}
 						metrics.RecordMetrics(ctx.Client)
-						if ctx.Client.Response != nil {
-							ctx.Client.Response.RecalculateSectionRRCount()
-							ctx.Client.Response.Rend(render)
+						if len(ctx.Client.RawResponses) > 0 {
+							for _, response := range ctx.Client.RawResponses {
+								s.transport.SendResponse(&message, response)
+							}
+						} else if ctx.Client.Response != nil {
+							s.rendResponse(&message, &ctx.Client, render)
 							s.transport.SendResponse(&message, render.Data())
 							render.Clear()
 						}
@@ -126,3 +151,25 @@ func (s *Server) startHandlerRoutine(handlerCount int) {
 		}()
 	}
 }
+
+// rrs with types unknown to g53 could be in dynamic update, message is
+// parsed again with them supported
+func requestFromWire(request *g53.Message, buf *util.InputBuffer) error {
+	pos := buf.Position()
+	if err := request.FromWire(buf); err == nil {
+		return nil
+	}
+
+	buf.SetPosition(pos)
+	msg, err := rdata.MessageFromWire(buf)
+	if err != nil {
+		return err
+	}
+	*request = *msg
+	return nil
+}
+
+func isTransferQuery(request *g53.Message) bool {
+	return request.Question != nil &&
+		(request.Question.Type == g53.RR_AXFR || request.Question.Type == g53.RR_IXFR)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	streamTimeout         = 5 * time.Second
+	maxPipelinedQueries   = 32
+	defaultTCPIdleTimeout = 10 * time.Second
+)
+
+// streamConn is a tcp or tls connection which is kept open to serve multiple
+// queries, queries are handled concurrently and responses are written back
+// in the order they complete. The connection is closed when the reader
+// stops and all the in-flight queries are finished.
+type streamConn struct {
+	net.Conn
+	ip        string
+	owner     *Transport
+	writeLock sync.Mutex
+	refs      int32
+	inFlight  chan struct{}
+}
+
+func newStreamConn(conn net.Conn, ip string, owner *Transport) *streamConn {
+	return &streamConn{
+		Conn:     conn,
+		ip:       ip,
+		owner:    owner,
+		refs:     1,
+		inFlight: make(chan struct{}, maxPipelinedQueries),
+	}
+}
+
+func (c *streamConn) read(idleTimeout time.Duration) ([]byte, error) {
+	return streamRead(c.Conn, idleTimeout)
+}
+
+func (c *streamConn) write(data []byte) error {
+	c.writeLock.Lock()
+	err := streamWrite(c.Conn, data)
+	c.writeLock.Unlock()
+	if err != nil {
+		c.Conn.Close()
+	}
+	return err
+}
+
+func (c *streamConn) startQuery() {
+	c.inFlight <- struct{}{}
+	atomic.AddInt32(&c.refs, 1)
+}
+
+func (c *streamConn) finishQuery() {
+	<-c.inFlight
+	c.release()
+}
+
+func (c *streamConn) release() {
+	if atomic.AddInt32(&c.refs, -1) == 0 {
+		c.Conn.Close()
+		c.owner.releaseConn(c.ip)
+	}
+}
+
+// dns message over tcp and tls is prefixed with two bytes length field,
+// idle timeout is used to wait the next message, once the length arrives
+// the message body should follow in time
+func streamRead(conn net.Conn, idleTimeout time.Duration) ([]byte, error) {
+	var lenBuf [2]byte
+	conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(streamTimeout))
+	buf := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// write length and message in one call, so tls won't split them into two records
+func streamWrite(conn net.Conn, data []byte) error {
+	buf := make([]byte, len(data)+2)
+	binary.BigEndian.PutUint16(buf, uint16(len(data)))
+	copy(buf[2:], data)
+	conn.SetWriteDeadline(time.Now().Add(streamTimeout))
+	_, err := conn.Write(buf)
+	return err
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/config"
+)
+
+// transport whose queries are answered by handler concurrently, handler
+// returns the response of query
+func runTestTransport(t *testing.T, conf *config.VanguardConf, handler func(*g53.Message) *g53.Message) *Transport {
+	trans, err := newTransport(conf, 64)
+	ut.Assert(t, err == nil, "create transport failed: %v", err)
+
+	messageChan := make(chan message, 64)
+	trans.run(messageChan)
+	go func() {
+		for m := range messageChan {
+			go func(m message) {
+				query, err := g53.MessageFromWire(util.NewInputBuffer(m.buf))
+				if err == nil {
+					trans.SendResponse(&m, renderMessage(handler(query)))
+				}
+				trans.FinishQuery(&m)
+			}(m)
+		}
+	}()
+	return trans
+}
+
+func answerQuery(query *g53.Message) *g53.Message {
+	response := query.MakeResponse()
+	a, _ := g53.RRsetFromString(query.Question.Name.String(false) + " 300 IN A 1.1.1.1")
+	response.AddRRset(g53.AnswerSection, a)
+	return response
+}
+
+func tcpConf() *config.VanguardConf {
+	conf := &config.VanguardConf{}
+	conf.Server.Addrs = []string{"127.0.0.1:0"}
+	conf.Server.EnableTCP = true
+	return conf
+}
+
+func sendStreamQuery(t *testing.T, conn net.Conn, name string, id uint16) {
+	query := g53.MakeQuery(g53.NameFromStringUnsafe(name), g53.RR_A, 1232, false)
+	query.Header.Id = id
+	ut.Assert(t, streamWrite(conn, renderMessage(query)) == nil, "send query %s failed", name)
+}
+
+func readStreamResponse(t *testing.T, conn net.Conn) *g53.Message {
+	buf, err := streamRead(conn, 2*time.Second)
+	ut.Assert(t, err == nil, "read response failed: %v", err)
+	response, err := g53.MessageFromWire(util.NewInputBuffer(buf))
+	ut.Assert(t, err == nil, "parse response failed: %v", err)
+	return response
+}
+
+func tcpConnCount(trans *Transport) int {
+	trans.tcpConnLock.Lock()
+	defer trans.tcpConnLock.Unlock()
+	return trans.tcpConnCount
+}
+
+func TestStreamPipelinedQueries(t *testing.T) {
+	trans := runTestTransport(t, tcpConf(), func(query *g53.Message) *g53.Message {
+		if query.Question.Name.String(false) == "slow.knet.cn." {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return answerQuery(query)
+	})
+	defer trans.Close()
+
+	conn, err := net.Dial("tcp", trans.tcpListeners[0].Addr().String())
+	ut.Assert(t, err == nil, "connect failed: %v", err)
+	defer conn.Close()
+
+	names := []string{"slow.knet.cn.", "www.knet.cn.", "mail.knet.cn."}
+	for i, name := range names {
+		sendStreamQuery(t, conn, name, uint16(i))
+	}
+
+	//response of slow query is sent after the others
+	var ids []uint16
+	for i := 0; i < len(names); i++ {
+		response := readStreamResponse(t, conn)
+		ut.Equal(t, response.Question.Name.String(false), names[response.Header.Id])
+		ids = append(ids, response.Header.Id)
+	}
+	ut.Equal(t, ids[len(ids)-1], uint16(0))
+}
+
+func TestStreamInFlightLimit(t *testing.T) {
+	release := make(chan struct{})
+	var handled int32
+	trans := runTestTransport(t, tcpConf(), func(query *g53.Message) *g53.Message {
+		atomic.AddInt32(&handled, 1)
+		<-release
+		return answerQuery(query)
+	})
+	defer trans.Close()
+
+	conn, err := net.Dial("tcp", trans.tcpListeners[0].Addr().String())
+	ut.Assert(t, err == nil, "connect failed: %v", err)
+	defer conn.Close()
+
+	queryCount := maxPipelinedQueries + 8
+	for i := 0; i < queryCount; i++ {
+		sendStreamQuery(t, conn, "www.knet.cn.", uint16(i))
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&handled) < maxPipelinedQueries; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	ut.Equal(t, int(atomic.LoadInt32(&handled)), maxPipelinedQueries)
+
+	close(release)
+	for i := 0; i < queryCount; i++ {
+		readStreamResponse(t, conn)
+	}
+	ut.Equal(t, int(atomic.LoadInt32(&handled)), queryCount)
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	conf := tcpConf()
+	conf.Server.TCPIdleTimeout = 1
+	trans := runTestTransport(t, conf, answerQuery)
+	defer trans.Close()
+
+	conn, err := net.Dial("tcp", trans.tcpListeners[0].Addr().String())
+	ut.Assert(t, err == nil, "connect failed: %v", err)
+	defer conn.Close()
+
+	sendStreamQuery(t, conn, "www.knet.cn.", 1)
+	readStreamResponse(t, conn)
+	ut.Equal(t, tcpConnCount(trans), 1)
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	ut.Equal(t, err, io.EOF)
+	ut.Assert(t, time.Since(start) < 2*time.Second, "idle connection should be closed after idle timeout")
+	time.Sleep(100 * time.Millisecond)
+	ut.Equal(t, tcpConnCount(trans), 0)
+}
+
+func TestStreamConnLimitPerIP(t *testing.T) {
+	conf := tcpConf()
+	conf.Server.MaxTCPConnPerIP = 2
+	trans := runTestTransport(t, conf, answerQuery)
+	defer trans.Close()
+	addr := trans.tcpListeners[0].Addr().String()
+
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", addr)
+		ut.Assert(t, err == nil, "connect failed: %v", err)
+		defer conn.Close()
+		sendStreamQuery(t, conn, "www.knet.cn.", uint16(i))
+		readStreamResponse(t, conn)
+		conns = append(conns, conn)
+	}
+
+	rejected, err := net.Dial("tcp", addr)
+	ut.Assert(t, err == nil, "connect failed: %v", err)
+	defer rejected.Close()
+	rejected.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = rejected.Read(make([]byte, 1))
+	ut.Assert(t, err != nil, "connection exceeds limit should be closed")
+	ut.Equal(t, tcpConnCount(trans), 2)
+
+	//connection is accepted again once one is closed
+	conns[0].Close()
+	time.Sleep(100 * time.Millisecond)
+	conn, err := net.Dial("tcp", addr)
+	ut.Assert(t, err == nil, "connect failed: %v", err)
+	defer conn.Close()
+	sendStreamQuery(t, conn, "www.knet.cn.", 3)
+	response := readStreamResponse(t, conn)
+	ut.Equal(t, response.Header.Id, uint16(3))
+}
@@ -1,32 +1,67 @@
 package server
 
 import (
+	"crypto/tls"
 	"net"
-	"sync/atomic"
+	"net/http"
+	"sync"
+	"time"
 
-	g53util "github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/core"
 	"github.com/zdnscloud/vanguard/logger"
 	"github.com/zdnscloud/vanguard/util"
 )
 
 const (
-	maxConcurrentTCPConn = 512
-	maxQueryLen          = 512
-	udpReceiveBuf        = 1024 * maxQueryLen
-	maxBufferFullCount   = 5
+	defaultMaxTCPConn      = 512
+	defaultMaxTCPConnPerIP = 64
+	udpReceiveBuf          = 512 * 1024
+	maxBufferFullCount     = 5
 )
 
 type Transport struct {
 	udpConns        []*net.UDPConn
 	tcpListeners    []*net.TCPListener
-	tcpConnCount    int32
+	tlsListeners    []net.Listener
+	dohListeners    []net.Listener
+	dohHandler      *dohHandler
+	dohServer       *http.Server
+	tcpConnCount    int
+	tcpConnPerIP    map[string]int
+	tcpConnLock     sync.Mutex
+	maxTCPConn      int
+	maxTCPConnPerIP int
+	tcpIdleTimeout  time.Duration
+	maxUdpSize      uint16
 	udpBufPool      *util.BytePool
 	bufferFullCount int
 }
 
 func newTransport(conf *config.VanguardConf, handlerCount int) (*Transport, error) {
-	t := &Transport{}
+	t := &Transport{
+		tcpConnPerIP:    make(map[string]int),
+		maxTCPConn:      conf.Server.MaxTCPConn,
+		maxTCPConnPerIP: conf.Server.MaxTCPConnPerIP,
+		tcpIdleTimeout:  time.Duration(conf.Server.TCPIdleTimeout) * time.Second,
+		maxUdpSize:      conf.Server.MaxUdpSize,
+	}
+	if t.maxTCPConn == 0 {
+		t.maxTCPConn = defaultMaxTCPConn
+	}
+	if t.maxTCPConnPerIP == 0 {
+		t.maxTCPConnPerIP = defaultMaxTCPConnPerIP
+	}
+	if t.tcpIdleTimeout == 0 {
+		t.tcpIdleTimeout = defaultTCPIdleTimeout
+	}
+	if t.maxUdpSize == 0 {
+		t.maxUdpSize = defaultEdnsUdpSize
+	} else if t.maxUdpSize < minUdpSize {
+		t.maxUdpSize = minUdpSize
+	}
+
 	if err := t.openUDP(conf); err != nil {
 		t.Close()
 		return nil, err
@@ -37,7 +72,18 @@ func newTransport(conf *config.VanguardConf, handlerCount int) (*Transport, erro
 		return nil, err
 	}
 
-	t.udpBufPool = util.NewBytePool(handlerCount, maxQueryLen)
+	if err := t.openTLS(conf); err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	if err := t.openDoH(conf); err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	// one more byte to detect query which is larger than max udp size
+	t.udpBufPool = util.NewBytePool(handlerCount, int(t.maxUdpSize)+1)
 	return t, nil
 }
 
@@ -84,11 +130,117 @@ func (t *Transport) openTCP(conf *config.VanguardConf) error {
 		return nil
 	}
 
+	tcpAddrs, err := resolveTCPAddrs(conf.Server.Addrs)
+	if err != nil {
+		return err
+	}
+
+	tcpListeners, err := bindTCPAddresses(tcpAddrs)
+	if err != nil {
+		return err
+	}
+	t.tcpListeners = tcpListeners
+	return nil
+}
+
+func (t *Transport) openTLS(conf *config.VanguardConf) error {
+	if len(conf.Server.TLSAddrs) == 0 {
+		return nil
+	}
+
+	tlsConf, err := loadTLSConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	tlsAddrs, err := resolveTCPAddrs(conf.Server.TLSAddrs)
+	if err != nil {
+		return err
+	}
+
+	tcpListeners, err := bindTCPAddresses(tlsAddrs)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range tcpListeners {
+		t.tlsListeners = append(t.tlsListeners, tls.NewListener(l, tlsConf))
+	}
+	return nil
+}
+
+// doh is served over plain http when no certificate is configured, which
+// is used when tls is terminated by proxy in front of vanguard
+func (t *Transport) openDoH(conf *config.VanguardConf) error {
+	if len(conf.Server.DoHAddrs) == 0 {
+		return nil
+	}
+
+	handler, err := newDoHHandler(conf.Server.DoHProxies)
+	if err != nil {
+		return err
+	}
+
+	var tlsConf *tls.Config
+	if conf.Server.TLSCertFile != "" {
+		if tlsConf, err = loadTLSConfig(conf); err != nil {
+			return err
+		}
+		tlsConf.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	dohAddrs, err := resolveTCPAddrs(conf.Server.DoHAddrs)
+	if err != nil {
+		return err
+	}
+
+	tcpListeners, err := bindTCPAddresses(dohAddrs)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range tcpListeners {
+		if tlsConf != nil {
+			t.dohListeners = append(t.dohListeners, tls.NewListener(l, tlsConf))
+		} else {
+			t.dohListeners = append(t.dohListeners, l)
+		}
+	}
+
+	path := conf.Server.DoHPath
+	if path == "" {
+		path = defaultDoHPath
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	t.dohHandler = handler
+	t.dohServer = &http.Server{
+		Handler:      mux,
+		TLSConfig:    tlsConf,
+		ReadTimeout:  dohTimeout,
+		WriteTimeout: 2 * dohTimeout,
+	}
+	return nil
+}
+
+func loadTLSConfig(conf *config.VanguardConf) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(conf.Server.TLSCertFile, conf.Server.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func resolveTCPAddrs(addrs []string) ([]*net.TCPAddr, error) {
 	var tcpAddrs []*net.TCPAddr
-	for _, addr := range conf.Server.Addrs {
+	for _, addr := range addrs {
 		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if tcpAddr.IP.IsUnspecified() {
@@ -103,67 +255,110 @@ func (t *Transport) openTCP(conf *config.VanguardConf) error {
 			tcpAddrs = append(tcpAddrs, tcpAddr)
 		}
 	}
-
-	return t.bindTCPAddresses(tcpAddrs)
+	return tcpAddrs, nil
 }
 
-func (t *Transport) bindTCPAddresses(addrs []*net.TCPAddr) error {
+func bindTCPAddresses(addrs []*net.TCPAddr) ([]*net.TCPListener, error) {
 	tcpListeners := []*net.TCPListener{}
 	for _, addr := range addrs {
 		listener, err := net.ListenTCP("tcp", addr)
 		if err != nil {
-			return err
+			for _, l := range tcpListeners {
+				l.Close()
+			}
+			return nil, err
 		}
 		tcpListeners = append(tcpListeners, listener)
 	}
-	t.tcpListeners = tcpListeners
-	return nil
+	return tcpListeners, nil
 }
 
 func (t *Transport) run(messageChan chan<- message) {
 	t.runTCP(messageChan)
+	t.runTLS(messageChan)
+	t.runDoH(messageChan)
 	t.runUDP(messageChan)
 }
 
 func (t *Transport) runTCP(messageChan chan<- message) {
 	for _, l := range t.tcpListeners {
-		go func(listener *net.TCPListener) {
-			for {
-				conn, err := listener.AcceptTCP()
-				if err != nil {
-					return
-				}
+		go t.acceptStreamConn(l, core.TransportTCP, messageChan)
+	}
+}
 
-				if atomic.LoadInt32(&t.tcpConnCount) < maxConcurrentTCPConn {
-					atomic.AddInt32(&t.tcpConnCount, 1)
-					go t.handleTCPConn(conn, messageChan)
-				} else {
-					conn.Close()
-				}
-			}
-		}(l)
+func (t *Transport) runTLS(messageChan chan<- message) {
+	for _, l := range t.tlsListeners {
+		go t.acceptStreamConn(l, core.TransportTLS, messageChan)
 	}
 }
 
-func (t *Transport) handleTCPConn(conn *net.TCPConn, messageChan chan<- message) {
-	buf, err := g53util.TCPRead(conn)
-	if err != nil {
-		t.releaseConn(conn)
+func (t *Transport) runDoH(messageChan chan<- message) {
+	if t.dohServer == nil {
 		return
 	}
 
-	messageChan <- message{
-		usingTCP: true,
-		addr:     conn.RemoteAddr(),
-		destAddr: conn.LocalAddr(),
-		conn:     conn,
-		buf:      buf,
+	t.dohHandler.messageChan = messageChan
+	for _, l := range t.dohListeners {
+		go t.dohServer.Serve(l)
 	}
 }
 
-func (t *Transport) releaseConn(conn *net.TCPConn) {
-	conn.Close()
-	atomic.AddInt32(&t.tcpConnCount, -1)
+func (t *Transport) acceptStreamConn(listener net.Listener, transport core.Transport, messageChan chan<- message) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if t.acquireConn(ip) {
+			go t.handleStreamConn(newStreamConn(conn, ip, t), transport, messageChan)
+		} else {
+			conn.Close()
+		}
+	}
+}
+
+func (t *Transport) handleStreamConn(conn *streamConn, transport core.Transport, messageChan chan<- message) {
+	for {
+		buf, err := conn.read(t.tcpIdleTimeout)
+		if err != nil {
+			break
+		}
+
+		conn.startQuery()
+		messageChan <- message{
+			transport: transport,
+			addr:      conn.RemoteAddr(),
+			destAddr:  conn.LocalAddr(),
+			conn:      conn,
+			buf:       buf,
+		}
+	}
+	conn.release()
+}
+
+func (t *Transport) acquireConn(ip string) bool {
+	t.tcpConnLock.Lock()
+	defer t.tcpConnLock.Unlock()
+	if t.tcpConnCount >= t.maxTCPConn || t.tcpConnPerIP[ip] >= t.maxTCPConnPerIP {
+		return false
+	}
+
+	t.tcpConnCount += 1
+	t.tcpConnPerIP[ip] += 1
+	return true
+}
+
+func (t *Transport) releaseConn(ip string) {
+	t.tcpConnLock.Lock()
+	defer t.tcpConnLock.Unlock()
+	t.tcpConnCount -= 1
+	if count := t.tcpConnPerIP[ip]; count <= 1 {
+		delete(t.tcpConnPerIP, ip)
+	} else {
+		t.tcpConnPerIP[ip] = count - 1
+	}
 }
 
 func (t *Transport) runUDP(messageChan chan<- message) {
@@ -172,21 +367,21 @@ func (t *Transport) runUDP(messageChan chan<- message) {
 			for {
 				buf := t.udpBufPool.Get()
 				n, addr, err := conn_.ReadFromUDP(buf)
-				if err == nil && n > 0 && n < maxQueryLen {
+				if err == nil && n > 0 && n <= int(t.maxUdpSize) {
 					select {
 					case messageChan <- message{
-						usingTCP: false,
-						addr:     addr,
-						destAddr: conn_.LocalAddr(),
-						conn:     conn_,
-						buf:      buf[0:n],
+						transport: core.TransportUDP,
+						addr:      addr,
+						destAddr:  conn_.LocalAddr(),
+						conn:      conn_,
+						buf:       buf[0:n],
 					}:
 					default:
 						logger.GetLogger().Warn("!!!udp buffer is full")
-						t.udpBufPool.Put(buf[:maxQueryLen])
+						t.udpBufPool.Put(buf[:t.udpBufPool.Width()])
 					}
 				} else {
-					t.udpBufPool.Put(buf[:maxQueryLen])
+					t.udpBufPool.Put(buf[:t.udpBufPool.Width()])
 				}
 			}
 		}(conn)
@@ -201,20 +396,53 @@ func (t *Transport) Close() {
 	for _, l := range t.tcpListeners {
 		l.Close()
 	}
+
+	for _, l := range t.tlsListeners {
+		l.Close()
+	}
+
+	if t.dohServer != nil {
+		t.dohServer.Close()
+	} else {
+		for _, l := range t.dohListeners {
+			l.Close()
+		}
+	}
 }
 
 func (t *Transport) SendResponse(q *message, response []byte) {
-	if q.usingTCP {
-		g53util.TCPWrite(response, q.conn.(*net.TCPConn))
-		t.releaseConn(q.conn.(*net.TCPConn))
-	} else {
+	switch q.transport {
+	case core.TransportUDP:
 		q.conn.(*net.UDPConn).WriteTo(response, q.addr)
+	case core.TransportHTTPS:
+		buf := make([]byte, len(response))
+		copy(buf, response)
+		q.responseChan <- buf
+	default:
+		q.conn.(*streamConn).write(response)
 	}
 }
 
 func (t *Transport) FinishQuery(q *message) {
-	if q.usingTCP == false {
-		t.udpBufPool.Put(q.buf[:maxQueryLen])
+	switch q.transport {
+	case core.TransportUDP:
+		t.udpBufPool.Put(q.buf[:t.udpBufPool.Width()])
+	case core.TransportHTTPS:
+		close(q.responseChan)
+	default:
+		q.conn.(*streamConn).finishQuery()
+	}
+}
+
+// without edns the response is limited to 512 bytes, otherwise it's limited
+// by the smaller one of requester and server udp payload size
+func (t *Transport) udpSizeLimit(request *g53.Message) uint16 {
+	if request.Edns == nil || request.Edns.UdpSize <= minUdpSize {
+		return minUdpSize
+	} else if request.Edns.UdpSize > t.maxUdpSize {
+		return t.maxUdpSize
+	} else {
+		return request.Edns.UdpSize
 	}
 }
 
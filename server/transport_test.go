@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/config"
+)
+
+// self signed certificate for 127.0.0.1, returns paths of cert and key
+func generateCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ut.Assert(t, err == nil, "generate key failed: %v", err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vanguard"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	ut.Assert(t, err == nil, "create cert failed: %v", err)
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	ut.Assert(t, err == nil, "marshal key failed: %v", err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return cert, certFile, keyFile
+}
+
+func TestTLSTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	ut.Assert(t, err == nil, "create temp dir failed: %v", err)
+	defer os.RemoveAll(dir)
+	cert, certFile, keyFile := generateCert(t, dir)
+
+	conf := &config.VanguardConf{}
+	conf.Server.TLSAddrs = []string{"127.0.0.1:0"}
+	conf.Server.TLSCertFile = certFile
+	conf.Server.TLSKeyFile = keyFile
+	trans := runTestTransport(t, conf, answerQuery)
+	defer trans.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	conn, err := tls.Dial("tcp", trans.tlsListeners[0].Addr().String(), &tls.Config{RootCAs: roots})
+	ut.Assert(t, err == nil, "tls handshake failed: %v", err)
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		sendStreamQuery(t, conn, "www.knet.cn.", uint16(i))
+		response := readStreamResponse(t, conn)
+		ut.Equal(t, response.Header.Id, uint16(i))
+		ut.Equal(t, response.Sections[g53.AnswerSection][0].Rdatas[0].String(), "1.1.1.1")
+	}
+
+	conf.Server.TLSKeyFile = filepath.Join(dir, "nonexist.pem")
+	_, err = newTransport(conf, 1)
+	ut.Assert(t, os.IsNotExist(err), "missing key should be reported but get %v", err)
+
+	conf.Server.TLSCertFile = filepath.Join(dir, "nonexist.pem")
+	conf.Server.TLSKeyFile = keyFile
+	_, err = newTransport(conf, 1)
+	ut.Assert(t, os.IsNotExist(err), "missing cert should be reported but get %v", err)
+}
@@ -0,0 +1,39 @@
+package update
+
+import (
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/resolver/auth"
+	"github.com/zdnscloud/vanguard/viewselector"
+)
+
+type UpdateHandler struct {
+	core.DefaultHandler
+
+	viewSelector *viewselector.SelectorMgr
+	auth         *auth.AuthDataSource
+}
+
+func NewUpdateHandler(viewselector *viewselector.SelectorMgr, auth *auth.AuthDataSource) *UpdateHandler {
+	return &UpdateHandler{
+		viewSelector: viewselector,
+		auth:         auth,
+	}
+}
+
+// if tsig verification fails, view selector has already made the response
+// with tsig error, otherwise client doesn't belong to any view
+func (h *UpdateHandler) HandleQuery(ctx *core.Context) {
+	if h.viewSelector.SelectView(ctx) {
+		h.auth.HandleUpdate(ctx)
+		return
+	}
+
+	client := &ctx.Client
+	if client.Response == nil {
+		client.Response = client.Request.MakeResponse()
+		client.Response.Header.Rcode = g53.R_REFUSED
+	} else {
+		client.Response.Header.Rcode = g53.R_NOTAUTH
+	}
+}
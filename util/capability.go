@@ -0,0 +1,51 @@
+package util
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// edns is tried again after this time for server which doesn't support it
+const ednsRetryInterval = time.Hour
+
+// ServerCapability is what a server supports, which is learned from its
+// responses and shared by queries to the server
+type ServerCapability struct {
+	noEdnsUntil int64 //unix nano
+}
+
+// SupportEdns returns true for nil capability
+func (c *ServerCapability) SupportEdns() bool {
+	return c == nil || atomic.LoadInt64(&c.noEdnsUntil) < time.Now().UnixNano()
+}
+
+func (c *ServerCapability) setNoEdns() {
+	if c != nil {
+		atomic.StoreInt64(&c.noEdnsUntil, time.Now().Add(ednsRetryInterval).UnixNano())
+	}
+}
+
+// ServerCapabilities keeps capability of servers by address, for servers
+// which are configured by address instead of learned from referrals
+type ServerCapabilities struct {
+	lock         sync.Mutex
+	capabilities map[string]*ServerCapability
+}
+
+func NewServerCapabilities() *ServerCapabilities {
+	return &ServerCapabilities{
+		capabilities: make(map[string]*ServerCapability),
+	}
+}
+
+func (s *ServerCapabilities) Get(addr string) *ServerCapability {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	capability, ok := s.capabilities[addr]
+	if ok == false {
+		capability = &ServerCapability{}
+		s.capabilities[addr] = capability
+	}
+	return capability
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"crypto/rand"
+	"net"
+
+	"github.com/zdnscloud/g53"
+)
+
+// CaseRandomizer decides which servers get query name with random case,
+// servers which don't copy the question into response are exceptions,
+// draft-vixie-dnsext-dns0x20
+type CaseRandomizer struct {
+	exceptions map[string]struct{}
+}
+
+// exceptions are ip of servers, nil randomizer disables case randomization
+func NewCaseRandomizer(exceptions []string) *CaseRandomizer {
+	c := &CaseRandomizer{
+		exceptions: make(map[string]struct{}),
+	}
+	for _, ip := range exceptions {
+		if addr := net.ParseIP(ip); addr != nil {
+			c.exceptions[addr.String()] = struct{}{}
+		}
+	}
+	return c
+}
+
+// Enabled returns whether case of query name sent to server with format
+// ip:port should be randomized
+func (c *CaseRandomizer) Enabled(server string) bool {
+	if c == nil {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		host = server
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	}
+	_, ok := c.exceptions[host]
+	return ok == false
+}
+
+// RandomizeCase flips case of each letter in name by random bits
+func RandomizeCase(name *g53.Name) *g53.Name {
+	s := []byte(name.String(false))
+	bits := make([]byte, (len(s)+7)/8)
+	rand.Read(bits)
+	for i, c := range s {
+		if bits[i/8]&(1<<uint(i%8)) == 0 {
+			continue
+		}
+		if c >= 'a' && c <= 'z' {
+			s[i] = c - 'a' + 'A'
+		} else if c >= 'A' && c <= 'Z' {
+			s[i] = c - 'A' + 'a'
+		}
+	}
+
+	randomized, err := g53.NewName(string(s), false)
+	if err != nil {
+		return name
+	}
+	return randomized
+}
+
+// response of query with random case has the question and owner names of
+// the original query
+func restoreCase(response *g53.Message, randomized *g53.Question, original *g53.Question) {
+	if response.Question != nil {
+		response.Question = original
+	}
+	for i, section := range response.Sections {
+		for j, rrset := range section {
+			if rrset.Name.CaseSensitiveEquals(randomized.Name) {
+				restored := *rrset
+				restored.Name = original.Name
+				response.Sections[i][j] = &restored
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+func TestRandomizeCase(t *testing.T) {
+	name := g53.NameFromStringUnsafe(strings.Repeat("abcdefghij", 6) + ".example.com.")
+	randomized := RandomizeCase(name)
+	ut.Equal(t, randomized.Equals(name), true)
+	ut.Equal(t, randomized.CaseSensitiveEquals(name), false)
+	ut.Equal(t, RandomizeCase(g53.Root).Equals(g53.Root), true)
+
+	randomizer := NewCaseRandomizer([]string{"1.1.1.1", "2001:db8::1", "bad"})
+	ut.Equal(t, randomizer.Enabled("1.1.1.1:53"), false)
+	ut.Equal(t, randomizer.Enabled("[2001:db8:0::1]:53"), false)
+	ut.Equal(t, randomizer.Enabled("2.2.2.2:53"), true)
+	var nilRandomizer *CaseRandomizer
+	ut.Equal(t, nilRandomizer.Enabled("2.2.2.2:53"), false)
+}
+
+// server answers with question in lower case if lowerCase is set
+func runCaseServer(t *testing.T, addr string, lowerCase bool) func() {
+	udpAddr, _ := net.ResolveUDPAddr("udp", addr)
+	conn, err := net.ListenUDP("udp", udpAddr)
+	ut.Assert(t, err == nil, "listen udp failed: %v", err)
+
+	go func() {
+		buf := make([]byte, 512)
+		render := g53.NewMsgRender()
+		for {
+			n, client, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			query, err := g53.MessageFromWire(util.NewInputBuffer(buf[:n]))
+			if err != nil {
+				continue
+			}
+			if lowerCase {
+				query.Question.Name = g53.NameFromStringUnsafe(query.Question.Name.String(false))
+			}
+			resp := query.MakeResponse()
+			a, _ := g53.AFromString("1.1.1.1")
+			resp.AddRRset(g53.AnswerSection, &g53.RRset{
+				Name:   query.Question.Name,
+				Type:   g53.RR_A,
+				Class:  g53.CLASS_IN,
+				Ttl:    g53.RRTTL(300),
+				Rdatas: []g53.Rdata{a},
+			})
+			resp.RecalculateSectionRRCount()
+			render.Clear()
+			resp.Rend(render)
+			conn.WriteTo(render.Data(), client)
+		}
+	}()
+	return func() { conn.Close() }
+}
+
+func TestQueryWithRandomCase(t *testing.T) {
+	addr := "127.0.0.1:5555"
+	sender, _ := NewSafeUDPSender("", 500*time.Millisecond)
+	qname, _ := g53.NewName("www.Example-Name-With-Letters.CN.", false)
+
+	stop := runCaseServer(t, addr, false)
+	query := g53.MakeQuery(qname, g53.RR_A, 1232, false)
+	resp, _, err := sender.QueryWithRandomCase(addr, query, nil)
+	stop()
+	ut.Assert(t, err == nil, "query server which copies question failed: %v", err)
+	ut.Equal(t, resp.Question.Name.CaseSensitiveEquals(qname), true)
+	ut.Equal(t, resp.Sections[g53.AnswerSection][0].Name.CaseSensitiveEquals(qname), true)
+	ut.Equal(t, query.Question.Name.CaseSensitiveEquals(qname), true)
+
+	stop = runCaseServer(t, addr, true)
+	defer stop()
+	_, _, err = sender.QueryWithRandomCase(addr, query, nil)
+	ut.Assert(t, err != nil, "response with mismatched case should be ignored")
+	resp, _, err = sender.QueryServer(addr, query, nil)
+	ut.Assert(t, err == nil, "query without random case failed: %v", err)
+	ut.Equal(t, resp.Header.Rcode, g53.R_NOERROR)
+}
@@ -0,0 +1,78 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/zdnscloud/g53"
+)
+
+const (
+	EDNS_TCP_KEEPALIVE = 11
+	EDNS_EDE           = 15
+)
+
+// info codes of extended dns error, RFC 8914 4
+const (
+	EDE_OTHER                        uint16 = 0
+	EDE_UNSUPPORTED_DNSKEY_ALGORITHM uint16 = 1
+	EDE_UNSUPPORTED_DS_DIGEST        uint16 = 2
+	EDE_STALE_ANSWER                 uint16 = 3
+	EDE_DNSSEC_BOGUS                 uint16 = 6
+	EDE_SIGNATURE_EXPIRED            uint16 = 7
+	EDE_SIGNATURE_NOT_YET_VALID      uint16 = 8
+	EDE_DNSKEY_MISSING               uint16 = 9
+	EDE_RRSIGS_MISSING               uint16 = 10
+	EDE_NO_ZONE_KEY_BIT_SET          uint16 = 11
+	EDE_NSEC_MISSING                 uint16 = 12
+)
+
+// timeout is in units of 100 milliseconds, RFC 7828
+type TCPKeepaliveOpt struct {
+	Timeout uint16
+}
+
+func (opt *TCPKeepaliveOpt) Rend(render *g53.MsgRender) {
+	render.WriteUint16(EDNS_TCP_KEEPALIVE)
+	render.WriteUint16(2)
+	render.WriteUint16(opt.Timeout)
+}
+
+func (opt *TCPKeepaliveOpt) String() string {
+	return fmt.Sprintf("; TCP KEEPALIVE: %d.%d secs\n", opt.Timeout/10, opt.Timeout%10)
+}
+
+// extended dns error, RFC 8914, extra text is for human
+type ExtendedErrorOpt struct {
+	InfoCode  uint16
+	ExtraText string
+}
+
+func (opt *ExtendedErrorOpt) Rend(render *g53.MsgRender) {
+	render.WriteUint16(EDNS_EDE)
+	render.WriteUint16(uint16(2 + len(opt.ExtraText)))
+	render.WriteUint16(opt.InfoCode)
+	render.WriteData([]byte(opt.ExtraText))
+}
+
+func (opt *ExtendedErrorOpt) String() string {
+	return fmt.Sprintf("; EDE: %d (%s)\n", opt.InfoCode, opt.ExtraText)
+}
+
+// response edns may be shared with cached message, so option is added to a
+// copy of it
+func AddEdnsOption(msg *g53.Message, opt g53.Option) {
+	edns := *msg.Edns
+	edns.Options = append(append([]g53.Option{}, edns.Options...), opt)
+	msg.Edns = &edns
+}
+
+// g53 counts each edns option as one rr, but all the options are in one opt
+// rr, so fix the additional count after recalculation
+func RecalculateSectionRRCount(msg *g53.Message) {
+	msg.RecalculateSectionRRCount()
+	if msg.Edns != nil {
+		if optCount := len(msg.Edns.Options); optCount > 1 {
+			msg.Header.ARCount -= uint16(optCount - 1)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package util
+
+import (
+	"testing"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+func TestAddEdnsOption(t *testing.T) {
+	msg := g53.MakeQuery(g53.NameFromStringUnsafe("www.knet.cn."), g53.RR_A, 1232, false)
+	msg.Edns.AddSubnetV4("1.1.1.1")
+	edns := msg.Edns
+
+	AddEdnsOption(msg, &TCPKeepaliveOpt{Timeout: 100})
+	ut.Equal(t, len(edns.Options), 1)
+	ut.Equal(t, len(msg.Edns.Options), 2)
+
+	RecalculateSectionRRCount(msg)
+	ut.Equal(t, msg.Header.ARCount, uint16(1))
+
+	render := g53.NewMsgRender()
+	msg.Rend(render)
+	data := render.Data()
+	ut.Equal(t, data[len(data)-6:], []byte{0, EDNS_TCP_KEEPALIVE, 0, 2, 0, 100})
+
+	msg, err := g53.MessageFromWire(util.NewInputBuffer(data))
+	ut.Assert(t, err == nil, "message with keepalive option should be parsed but get %v", err)
+	ut.Equal(t, msg.Header.ARCount, uint16(1))
+}
+
+func TestExtendedErrorOpt(t *testing.T) {
+	msg := g53.MakeQuery(g53.NameFromStringUnsafe("www.knet.cn."), g53.RR_A, 1232, false)
+	AddEdnsOption(msg, &ExtendedErrorOpt{InfoCode: EDE_DNSSEC_BOGUS, ExtraText: "bad"})
+	RecalculateSectionRRCount(msg)
+
+	render := g53.NewMsgRender()
+	msg.Rend(render)
+	data := render.Data()
+	ut.Equal(t, data[len(data)-9:], []byte{0, EDNS_EDE, 0, 5, 0, 6, 'b', 'a', 'd'})
+}
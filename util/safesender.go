@@ -30,12 +30,61 @@ func (f *SafeUDPSender) GetQuerySource() string {
 }
 
 func (f *SafeUDPSender) Query(server string, query *g53.Message) (*g53.Message, time.Duration, error) {
+	return f.QueryServer(server, query, nil)
+}
+
+// QueryServer sends query without edns if server doesn't support it, which
+// is learned from formerr response without opt, RFC 6891 7, truncated
+// response is retried with tcp, capability could be nil
+func (f *SafeUDPSender) QueryServer(server string, query *g53.Message, capability *ServerCapability) (*g53.Message, time.Duration, error) {
+	return f.queryServer(server, query, capability, false)
+}
+
+// QueryWithRandomCase sends query name with random case, response should
+// copy the question case sensitively, returned response has the case of
+// the original query, draft-vixie-dnsext-dns0x20
+func (f *SafeUDPSender) QueryWithRandomCase(server string, query *g53.Message, capability *ServerCapability) (*g53.Message, time.Duration, error) {
+	question := *query.Question
+	question.Name = RandomizeCase(query.Question.Name)
+	randomized := *query
+	randomized.Question = &question
+
+	resp, rtt, err := f.queryServer(server, &randomized, capability, true)
+	if err == nil {
+		restoreCase(resp, &question, query.Question)
+	}
+	return resp, rtt, err
+}
+
+func (f *SafeUDPSender) queryServer(server string, query *g53.Message, capability *ServerCapability, caseSensitive bool) (*g53.Message, time.Duration, error) {
+	if query.Edns != nil && capability.SupportEdns() == false {
+		query = withoutEdns(query)
+	}
+
 	render := f.getRender()
-	resp, rtt, err := f.sender.Query(server, render, query)
-	f.releaseRender(render)
+	defer f.releaseRender(render)
+	resp, rtt, err := f.sender.query(server, render, query, caseSensitive)
+	if err == nil && resp.Header.Rcode == g53.R_FORMERR && resp.Edns == nil && query.Edns != nil {
+		query = withoutEdns(query)
+		resp, rtt, err = f.sender.query(server, render, query, caseSensitive)
+		if err == nil && resp.Header.Rcode != g53.R_FORMERR {
+			capability.setNoEdns()
+		}
+	}
+
+	if err == nil && resp.Header.GetFlag(g53.FLAG_TC) {
+		resp, rtt, err = f.sender.queryTCP(server, render, query, caseSensitive)
+	}
 	return resp, rtt, err
 }
 
+func withoutEdns(query *g53.Message) *g53.Message {
+	q := *query
+	q.Edns = nil
+	q.RecalculateSectionRRCount()
+	return &q
+}
+
 func (f *SafeUDPSender) getRender() *g53.MsgRender {
 	f.renderLock.Lock()
 	defer f.renderLock.Unlock()
@@ -1,7 +1,10 @@
 package util
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
+	"net"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -9,6 +12,7 @@ import (
 
 	ut "github.com/zdnscloud/cement/unittest"
 	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
 	"github.com/zdnscloud/vanguard/testutil"
 )
 
@@ -68,3 +72,93 @@ func TestSafeUDPFwderFwdNonexist(t *testing.T) {
 	errCount = doParallelForward(unreachableDNSServer, sender, "www.knet.cn.", 2)
 	ut.Equal(t, errCount, uint32(2))
 }
+
+// server which doesn't support edns and truncates all udp responses
+func runLegacyServer(t *testing.T, addr string) func() {
+	udpAddr, _ := net.ResolveUDPAddr("udp", addr)
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	ut.Assert(t, err == nil, "listen udp failed: %v", err)
+	tcpListener, err := net.Listen("tcp", addr)
+	ut.Assert(t, err == nil, "listen tcp failed: %v", err)
+
+	answer := func(query *g53.Message) *g53.Message {
+		resp := query.MakeResponse()
+		rrset, _ := g53.RRsetFromString(query.Question.Name.String(false) + " 300 IN A 1.1.1.1")
+		resp.AddRRset(g53.AnswerSection, rrset)
+		resp.RecalculateSectionRRCount()
+		return resp
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		render := g53.NewMsgRender()
+		for {
+			n, client, err := udpConn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			query, err := g53.MessageFromWire(util.NewInputBuffer(buf[:n]))
+			if err != nil {
+				continue
+			}
+			resp := query.MakeResponse()
+			if query.Edns != nil {
+				resp.Header.Rcode = g53.R_FORMERR
+			} else {
+				resp.Header.SetFlag(g53.FLAG_TC, true)
+			}
+			render.Clear()
+			resp.Rend(render)
+			udpConn.WriteTo(render.Data(), client)
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := tcpListener.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			io.ReadFull(conn, length[:])
+			buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+			io.ReadFull(conn, buf)
+			query, _ := g53.MessageFromWire(util.NewInputBuffer(buf))
+			render := g53.NewMsgRender()
+			answer(query).Rend(render)
+			binary.BigEndian.PutUint16(length[:], uint16(render.Len()))
+			conn.Write(append(length[:], render.Data()...))
+			conn.Close()
+		}
+	}()
+
+	return func() {
+		udpConn.Close()
+		tcpListener.Close()
+	}
+}
+
+func TestQueryFallback(t *testing.T) {
+	addr := "127.0.0.1:5554"
+	stop := runLegacyServer(t, addr)
+	defer stop()
+
+	sender, _ := NewSafeUDPSender("", defaultTimeout)
+	//capability is shared by queries to the same address
+	capabilities := NewServerCapabilities()
+	qname := g53.NameFromStringUnsafe("www.knet.cn.")
+	for i := 0; i < 2; i++ {
+		query := g53.MakeQuery(qname, g53.RR_A, 1232, false)
+		resp, _, err := sender.QueryServer(addr, query, capabilities.Get(addr))
+		ut.Assert(t, err == nil, "query legacy server failed: %v", err)
+		ut.Equal(t, resp.Header.Rcode, g53.R_NOERROR)
+		ut.Equal(t, resp.Header.GetFlag(g53.FLAG_TC), false)
+		ut.Equal(t, len(resp.Sections[g53.AnswerSection]), 1)
+		ut.Equal(t, capabilities.Get(addr).SupportEdns(), false)
+		ut.Equal(t, capabilities.Get("127.0.0.1:5555").SupportEdns(), true)
+		ut.Assert(t, query.Edns != nil, "query shouldn't be modified")
+	}
+
+	var nilCapability *ServerCapability
+	ut.Equal(t, nilCapability.SupportEdns(), true)
+}
@@ -1,19 +1,29 @@
 package util
 
 import (
+	"encoding/binary"
 	"errors"
+	"io"
 	"net"
 	"time"
 
 	"github.com/zdnscloud/g53"
 	gutil "github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/rdata"
 )
 
-var errMalformedResponse = errors.New("response format error")
+var (
+	errMalformedResponse = errors.New("response format error")
+	errCaseMismatch      = errors.New("case of question in response doesn't match query")
+)
+
+// responses with dnssec records are usually larger than 1024 bytes
+const maxResponseSize = 4096
 
 type UDPSender struct {
-	dialer  *net.Dialer
-	timeout time.Duration
+	dialer    *net.Dialer
+	tcpDialer *net.Dialer
+	timeout   time.Duration
 }
 
 func NewUDPSender(querySource string, timeout time.Duration) (*UDPSender, error) {
@@ -21,6 +31,9 @@ func NewUDPSender(querySource string, timeout time.Duration) (*UDPSender, error)
 		dialer: &net.Dialer{
 			Timeout: timeout,
 		},
+		tcpDialer: &net.Dialer{
+			Timeout: timeout,
+		},
 		timeout: timeout,
 	}
 
@@ -34,12 +47,15 @@ func NewUDPSender(querySource string, timeout time.Duration) (*UDPSender, error)
 func (f *UDPSender) setQuerySource(source string) error {
 	if source == "" {
 		f.dialer.LocalAddr = nil
+		f.tcpDialer.LocalAddr = nil
 	} else {
 		localAddr, err := net.ResolveUDPAddr("udp", source)
 		if err != nil {
 			return err
 		}
 		f.dialer.LocalAddr = localAddr
+		//port of query source may be used by udp
+		f.tcpDialer.LocalAddr = &net.TCPAddr{IP: localAddr.IP, Zone: localAddr.Zone}
 	}
 	return nil
 }
@@ -66,6 +82,12 @@ func (f *UDPSender) SendQuery(server string, render *g53.MsgRender, query *g53.M
 }
 
 func (f *UDPSender) Query(server string, render *g53.MsgRender, query *g53.Message) (*g53.Message, time.Duration, error) {
+	return f.query(server, render, query, false)
+}
+
+// response whose question doesn't match query case sensitively is ignored
+// when caseSensitive is set, since it may be spoofed
+func (f *UDPSender) query(server string, render *g53.MsgRender, query *g53.Message, caseSensitive bool) (*g53.Message, time.Duration, error) {
 	conn, err := f.SendQuery(server, render, query)
 	if err != nil {
 		return nil, f.timeout, err
@@ -74,7 +96,7 @@ func (f *UDPSender) Query(server string, render *g53.MsgRender, query *g53.Messa
 
 	sendTime := time.Now()
 	conn.SetReadDeadline(sendTime.Add(f.timeout))
-	buf := make([]byte, 1024)
+	buf := make([]byte, maxResponseSize)
 
 retry:
 	n, _, err := conn.ReadFromUDP(buf)
@@ -83,10 +105,13 @@ retry:
 	}
 
 	buffer := gutil.NewInputBuffer(buf[0:n])
-	msg, err := g53.MessageFromWire(buffer)
+	msg, err := rdata.MessageFromWire(buffer)
 	if err != nil {
 		return nil, f.timeout, err
 	} else if msg.Header.Id == query.Header.Id {
+		if caseSensitive && isCaseMatched(query, msg) == false {
+			goto retry
+		}
 		rtt := time.Now().Sub(sendTime)
 		if err := isResponseValid(query, msg); err != nil {
 			return nil, rtt, err
@@ -94,11 +119,57 @@ retry:
 			return msg, rtt, nil
 		}
 	} else {
-		buf = buf[:0]
 		goto retry
 	}
 }
 
+// QueryTCP sends query with two bytes length prefix, it's used when udp
+// response is truncated, RFC 7766
+func (f *UDPSender) QueryTCP(server string, render *g53.MsgRender, query *g53.Message) (*g53.Message, time.Duration, error) {
+	return f.queryTCP(server, render, query, false)
+}
+
+func (f *UDPSender) queryTCP(server string, render *g53.MsgRender, query *g53.Message, caseSensitive bool) (*g53.Message, time.Duration, error) {
+	query.Rend(render)
+	buf := make([]byte, 2+render.Len())
+	binary.BigEndian.PutUint16(buf, uint16(render.Len()))
+	copy(buf[2:], render.Data())
+	render.Clear()
+
+	sendTime := time.Now()
+	conn, err := f.tcpDialer.Dial("tcp", server)
+	if err != nil {
+		return nil, f.timeout, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(sendTime.Add(f.timeout))
+	if _, err := conn.Write(buf); err != nil {
+		return nil, f.timeout, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, f.timeout, err
+	}
+	buf = make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, f.timeout, err
+	}
+
+	rtt := time.Now().Sub(sendTime)
+	msg, err := rdata.MessageFromWire(gutil.NewInputBuffer(buf))
+	if err != nil {
+		return nil, f.timeout, err
+	} else if msg.Header.Id != query.Header.Id {
+		return nil, rtt, errMalformedResponse
+	} else if err := isResponseValid(query, msg); err != nil {
+		return nil, rtt, err
+	} else if caseSensitive && isCaseMatched(query, msg) == false {
+		return nil, rtt, errCaseMismatch
+	}
+	return msg, rtt, nil
+}
+
 func isResponseValid(req *g53.Message, resp *g53.Message) error {
 	if resp.Header.Rcode == g53.R_FORMERR {
 		return nil
@@ -110,3 +181,8 @@ func isResponseValid(req *g53.Message, resp *g53.Message) error {
 		return nil
 	}
 }
+
+// formerr response may have no question
+func isCaseMatched(req *g53.Message, resp *g53.Message) bool {
+	return resp.Question == nil || resp.Question.Name.CaseSensitiveEquals(req.Question.Name)
+}
@@ -68,7 +68,9 @@ func (m *TSIGKeyBasedView) ViewForQuery(client *core.Client) (string, bool) {
 		return "", true
 	}
 
-	if err := req.Tsig.VerifyTsig(req, key.Secret, nil); err != nil {
+	//verification removes tsig from request
+	reqTsig := req.Tsig
+	if err := reqTsig.VerifyTsig(req, key.Secret, nil); err != nil {
 		client.Response.Tsig.Error = uint16(g53.R_BADSIG)
 		return "", true
 	}
@@ -77,11 +79,16 @@ func (m *TSIGKeyBasedView) ViewForQuery(client *core.Client) (string, bool) {
 	if err != nil {
 		panic("configure key invalid")
 	}
-	newTSIG.MAC = req.Tsig.MAC
+	newTSIG.MAC = reqTsig.MAC
 	client.Response.SetTSIG(newTSIG)
 	return key.View, true
 }
 
+func (m *TSIGKeyBasedView) GetKey(name string) (*TSIGKey, bool) {
+	key, ok := m.keys[name]
+	return key, ok
+}
+
 func (m *TSIGKeyBasedView) KeyForView(view string) *TSIGKey {
 	for _, key := range m.keys {
 		if key.View == view {
@@ -74,6 +74,15 @@ func (mgr *SelectorMgr) SelectView(ctx *core.Context) bool {
 	}
 }
 
+func (mgr *SelectorMgr) GetTSIGKey(name string) (*TSIGKey, bool) {
+	for _, vs := range mgr.selectors {
+		if tsigView, ok := vs.(*TSIGKeyBasedView); ok {
+			return tsigView.GetKey(name)
+		}
+	}
+	return nil, false
+}
+
 func (mgr *SelectorMgr) allocateIdForView() {
 	viewAndIds = map[string]uint16{DefaultView: uint16(0)}
 	id := uint16(1)
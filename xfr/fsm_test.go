@@ -48,6 +48,9 @@ func (u *dumpUpdator) DeleteRr(zone.Transaction, *g53.RRset) error {
 func (u *dumpUpdator) IncreaseSerialNumber(zone.Transaction) {
 	u.serialIncreaseCount += 1
 }
+func (u *dumpUpdator) GetRRsets(zone.Transaction, *g53.Name) []*g53.RRset {
+	return nil
+}
 func (u *dumpUpdator) Clean() error {
 	return nil
 }
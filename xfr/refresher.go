@@ -0,0 +1,204 @@
+package xfr
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/resolver/auth"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+	"github.com/zdnscloud/vanguard/util"
+)
+
+const (
+	refreshCheckInterval = time.Second
+	soaQueryTimeout      = 3 * time.Second
+	minTimerInterval     = 5 * time.Second
+	defaultRetryInterval = time.Minute
+)
+
+var errMasterNotAuth = errors.New("master isn't authoritative for zone")
+
+type refreshState struct {
+	nextRefresh time.Time
+	//zero means zone has never been loaded, which is already servfail
+	expireAt time.Time
+}
+
+// refresher polls soa of masters for secondary zones, RFC 1034 4.3.5,
+// transfer is started when the serial of master advances, and zone is
+// expired when no master could be reached in expire interval
+type refresher struct {
+	auth         *auth.AuthDataSource
+	runner       *XFRRunner
+	capabilities *util.ServerCapabilities
+
+	lock   sync.Mutex
+	states map[string]*refreshState
+}
+
+func newRefresher(auth *auth.AuthDataSource, runner *XFRRunner) *refresher {
+	return &refresher{
+		auth:         auth,
+		runner:       runner,
+		capabilities: util.NewServerCapabilities(),
+		states:       make(map[string]*refreshState),
+	}
+}
+
+func (r *refresher) run() {
+	ticker := time.NewTicker(refreshCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		r.check(now)
+	}
+}
+
+type secondaryZone struct {
+	view string
+	zone zone.Zone
+}
+
+func (r *refresher) check(now time.Time) {
+	var zones []secondaryZone
+	r.auth.ForEachZone(func(view string, z zone.Zone) {
+		if z.IsMaster() == false {
+			zones = append(zones, secondaryZone{view, z})
+		}
+	})
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	states := make(map[string]*refreshState)
+	for _, sz := range zones {
+		key := sz.view + "/" + sz.zone.GetOrigin().String(false)
+		state, ok := r.states[key]
+		if ok == false {
+			state = newRefreshState(sz.zone, now)
+		}
+		states[key] = state
+
+		if state.expireAt.IsZero() == false && now.After(state.expireAt) && sz.zone.IsExpired() == false {
+			logger.GetLogger().Error("zone %s in view %s is expired", sz.zone.GetOrigin().String(false), sz.view)
+			sz.zone.SetExpired(true)
+		}
+
+		if now.Before(state.nextRefresh) {
+			continue
+		}
+
+		if r.runner.addZoneToTransfer(sz.view, sz.zone.GetOrigin()) {
+			//avoid refreshing again before current one finishes
+			state.nextRefresh = now.Add(soaQueryTimeout * time.Duration(len(sz.zone.Masters())+1))
+			go r.refresh(sz.view, sz.zone, state)
+		}
+	}
+	r.states = states
+}
+
+// zone restored from backup is refreshed at once, and expires in the expire
+// interval after it's refreshed last time
+func newRefreshState(z zone.Zone, now time.Time) *refreshState {
+	state := &refreshState{nextRefresh: now}
+	if soa := zoneSOA(z); soa != nil {
+		if lastRefresh := z.LastRefresh(); lastRefresh.IsZero() == false {
+			state.expireAt = lastRefresh.Add(soaTimer(soa.Expire))
+		} else {
+			state.nextRefresh = now.Add(soaTimer(soa.Refresh))
+			state.expireAt = now.Add(soaTimer(soa.Expire))
+		}
+	}
+	return state
+}
+
+func (r *refresher) refresh(view string, z zone.Zone, state *refreshState) {
+	contacted, refreshed := r.refreshZone(view, z)
+	now := time.Now()
+	soa := zoneSOA(z)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if refreshed && soa != nil {
+		state.nextRefresh = now.Add(soaTimer(soa.Refresh))
+		state.expireAt = now.Add(soaTimer(soa.Expire))
+	} else if soa != nil {
+		state.nextRefresh = now.Add(soaTimer(soa.Retry))
+	} else {
+		state.nextRefresh = now.Add(defaultRetryInterval)
+	}
+
+	if contacted == false {
+		logger.GetLogger().Warn("refresh zone %s in view %s failed, no master could be reached",
+			z.GetOrigin().String(false), view)
+	}
+}
+
+// zone is in transfer list before it's called, and removed from it when
+// it returns
+func (r *refresher) refreshZone(view string, z zone.Zone) (contacted bool, refreshed bool) {
+	origin := z.GetOrigin()
+	for _, master := range z.Masters() {
+		serial, err := queryMasterSerial(origin, master, r.capabilities.Get(master))
+		if err != nil {
+			logger.GetLogger().Warn("query soa of zone %s from master %s failed:%s",
+				origin.String(false), master, err.Error())
+			continue
+		}
+
+		soa := zoneSOA(z)
+		if soa != nil && g53.CompareSerial(soa.Serial, serial) >= 0 {
+			r.runner.removeZoneFromTransfer(view, origin)
+			z.SetExpired(false)
+			z.SetLastRefresh(time.Now())
+			return true, true
+		}
+
+		logger.GetLogger().Info("serial of zone %s in view %s advanced to %d on master %s",
+			origin.String(false), view, serial, master)
+		return true, r.runner.doXFR(view, z, serial, master)
+	}
+
+	r.runner.removeZoneFromTransfer(view, origin)
+	return false, false
+}
+
+func queryMasterSerial(origin *g53.Name, master string, capability *util.ServerCapability) (uint32, error) {
+	sender, err := util.NewSafeUDPSender("", soaQueryTimeout)
+	if err != nil {
+		return 0, err
+	}
+
+	query := g53.MakeQuery(origin, g53.RR_SOA, 512, false)
+	resp, _, err := sender.QueryServer(master, query, capability)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.Header.Rcode != g53.R_NOERROR || resp.Header.GetFlag(g53.FLAG_AA) == false {
+		return 0, errMasterNotAuth
+	}
+
+	for _, rrset := range resp.Sections[g53.AnswerSection] {
+		if rrset.Type == g53.RR_SOA && rrset.Name.Equals(origin) && len(rrset.Rdatas) == 1 {
+			return rrset.Rdatas[0].(*g53.SOA).Serial, nil
+		}
+	}
+	return 0, errMasterNotAuth
+}
+
+// expired zone has no soa, since it's servfail
+func zoneSOA(z zone.Zone) *g53.SOA {
+	if soa := currentSOA(z); soa != nil {
+		return soa.Rdatas[0].(*g53.SOA)
+	}
+	return nil
+}
+
+func soaTimer(seconds uint32) time.Duration {
+	if d := time.Duration(seconds) * time.Second; d > minTimerInterval {
+		return d
+	}
+	return minTimerInterval
+}
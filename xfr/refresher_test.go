@@ -0,0 +1,101 @@
+package xfr
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+	"github.com/zdnscloud/vanguard/viewselector"
+)
+
+const testRefreshKey = viewselector.DefaultView + "/example.com."
+
+// answer soa query with the serial of test zone
+func runSOAServer(conn *net.UDPConn) {
+	buf := make([]byte, 512)
+	soa, _ := g53.RRsetFromString("example.com. 3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. 1 7200 3600 1209600 3600")
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		query, err := g53.MessageFromWire(util.NewInputBuffer(buf[:n]))
+		if err != nil || query.Question.Type != g53.RR_SOA {
+			continue
+		}
+
+		resp := query.MakeResponse()
+		resp.Header.SetFlag(g53.FLAG_AA, true)
+		resp.AddRRset(g53.AnswerSection, soa)
+		resp.RecalculateSectionRRCount()
+		render := g53.NewMsgRender()
+		resp.Rend(render)
+		conn.WriteToUDP(render.Data(), addr)
+	}
+}
+
+func TestZoneExpire(t *testing.T) {
+	h := newTestXFRHandler(config.ViewAcl{View: viewselector.DefaultView})
+	z := getTestZone(h)
+	z.SetMasters([]string{"127.0.0.1:1"})
+
+	r := newRefresher(h.auth, h.runner)
+	now := time.Now()
+	r.check(now)
+	ut.Equal(t, z.IsExpired(), false)
+	ut.Equal(t, r.states[testRefreshKey].nextRefresh, now.Add(7200*time.Second))
+
+	//hold the zone to keep refresh from running
+	h.runner.addZoneToTransfer(viewselector.DefaultView, z.GetOrigin())
+	r.check(now.Add(1209601 * time.Second))
+	ut.Equal(t, z.IsExpired(), true)
+	result := z.Find(g53.NameFromStringUnsafe("a.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRServFail)
+
+	contacted, refreshed := r.refreshZone(viewselector.DefaultView, z)
+	ut.Equal(t, contacted, false)
+	ut.Equal(t, refreshed, false)
+	ut.Equal(t, h.runner.addZoneToTransfer(viewselector.DefaultView, z.GetOrigin()), true)
+}
+
+func TestRefreshContactMaster(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	ut.Assert(t, err == nil, "listen udp shouldn't fail")
+	defer conn.Close()
+	go runSOAServer(conn)
+
+	h := newTestXFRHandler(config.ViewAcl{View: viewselector.DefaultView})
+	z := getTestZone(h)
+	z.SetMasters([]string{"127.0.0.1:1", conn.LocalAddr().String()})
+
+	r := newRefresher(h.auth, h.runner)
+	now := time.Now().Add(-7201 * time.Second)
+	r.check(now)
+	state := r.states[testRefreshKey]
+
+	h.runner.addZoneToTransfer(viewselector.DefaultView, z.GetOrigin())
+	r.refresh(viewselector.DefaultView, z, state)
+	ut.Equal(t, z.IsExpired(), false)
+	ut.Assert(t, state.nextRefresh.After(time.Now().Add(7100*time.Second)), "refresh timer should be reset")
+	ut.Assert(t, state.expireAt.After(now.Add(1209600*time.Second)), "expire timer should be reset")
+	ut.Equal(t, h.runner.addZoneToTransfer(viewselector.DefaultView, z.GetOrigin()), true)
+}
+
+func TestRefreshZoneFromBackup(t *testing.T) {
+	h := newTestXFRHandler(config.ViewAcl{View: viewselector.DefaultView})
+	z := getTestZone(h)
+	z.SetMasters([]string{"127.0.0.1:1"})
+	lastRefresh := time.Now().Add(-time.Hour)
+	z.SetLastRefresh(lastRefresh)
+
+	//zone restored from backup is refreshed at once
+	state := newRefreshState(z, time.Now())
+	ut.Assert(t, state.nextRefresh.After(time.Now()) == false, "zone should be refreshed at once")
+	ut.Equal(t, state.expireAt, lastRefresh.Add(1209600*time.Second))
+}
@@ -2,10 +2,10 @@ package xfr
 
 import (
 	"sync"
+	"time"
 
 	"github.com/zdnscloud/cement/domaintree"
 	"github.com/zdnscloud/g53"
-	"github.com/zdnscloud/g53/util"
 	"github.com/zdnscloud/vanguard/core"
 	"github.com/zdnscloud/vanguard/logger"
 	"github.com/zdnscloud/vanguard/resolver/auth"
@@ -59,6 +59,7 @@ func (h *XFRRunner) HandleNotify(ctx *core.Context) {
 	latestSerial := answers[0].Rdatas[0].(*g53.SOA).Serial
 	if targetZone.IsMaster() {
 		logger.GetLogger().Warn("zone: %s in view: %s is master", targetZoneName.String(false), view)
+		h.removeZoneFromTransfer(view, targetZoneName)
 		return
 	}
 
@@ -72,6 +73,7 @@ func (h *XFRRunner) HandleNotify(ctx *core.Context) {
 	}
 	if isKnownMaster == false {
 		logger.GetLogger().Warn("zone: %s in view: %s get notified from unknown master: %s", targetZoneName.String(false), view, master)
+		h.removeZoneFromTransfer(view, targetZoneName)
 		return
 	}
 
@@ -111,77 +113,82 @@ func (h *XFRRunner) removeZoneFromTransfer(view string, zone *g53.Name) {
 	h.inFlightIXFR[view] = zones
 }
 
-func (h *XFRRunner) doXFR(view string, z zone.Zone, latestSerial uint32, master string) {
+func (h *XFRRunner) doXFR(view string, z zone.Zone, latestSerial uint32, master string) bool {
 	name := z.GetOrigin()
 	defer h.removeZoneFromTransfer(view, name)
 
-	var request *g53.Message
-	var currentSerial uint32
-	var xfrType xfrType
-	soa := z.Find(name, g53.RR_SOA, zone.DefaultFind).GetResult().RRset
+	soa := currentSOA(z)
 	if soa == nil {
-		logger.GetLogger().Info("get notify for zone: %s in view: %s and vanguard have not data and will do axfr", name.String(false), view)
-		xfrType = AXFR
-		request = g53.MakeAXFR(name, nil)
+		logger.GetLogger().Info("zone: %s in view: %s has no data and will do axfr", name.String(false), view)
 	} else {
-		currentSerial = soa.Rdatas[0].(*g53.SOA).Serial
-		if g53.CompareSerial(currentSerial, latestSerial) != -1 {
+		if g53.CompareSerial(soaSerial(soa), latestSerial) != -1 {
 			logger.GetLogger().Warn("get notify for zone: %s in view: %s, which serial number is smaller than us", name.String(false), view)
-			return
+			return false
 		}
-		xfrType = IXFR
-		logger.GetLogger().Info("get notify for zone: %s in view: %s and vanguard will do ixfr", name.String(false), view)
-		request = g53.MakeIXFR(name, soa, nil)
-	}
 
-	conn, err := util.NewTCPConn(master)
-	if err != nil {
-		logger.GetLogger().Error("connect to server %s failed: %s", master, err.Error())
-		return
+		logger.GetLogger().Info("zone: %s in view: %s will do ixfr", name.String(false), view)
+		err := h.transferIn(view, IXFR, z, soa, master)
+		if err == nil {
+			return true
+		}
+		logger.GetLogger().Warn("ixfr zone: %s in view: %s from %s failed: %s, try axfr", name.String(false), view, master, err.Error())
 	}
 
-	render := g53.NewMsgRender()
-	request.Rend(render)
-	if err := util.TCPWrite(render.Data(), conn); err != nil {
-		logger.GetLogger().Error("send ixfr quer to server %s failed: %s", master, err.Error())
-		return
+	if err := h.transferIn(view, AXFR, z, nil, master); err != nil {
+		logger.GetLogger().Error("axfr zone: %s in view: %s from %s failed: %s", name.String(false), view, master, err.Error())
+		return false
 	}
+	return true
+}
 
-	answerBuffer, err := util.TCPRead(conn)
+func (h *XFRRunner) transferIn(view string, typ xfrType, z zone.Zone, soa *g53.RRset, master string) error {
+	stream, err := receiveTransfer(typ, z, soa, master)
 	if err != nil {
-		logger.GetLogger().Error("connect to server %s failed: %s", master, err.Error())
-		return
+		return err
+	}
+
+	if stream.isUpToDate() {
+		logger.GetLogger().Info("zone: %s in view: %s is up to date with %s", z.GetOrigin().String(false), view, master)
+		return nil
 	}
 
-	resp, err := g53.MessageFromWire(util.NewInputBuffer(answerBuffer))
-	answers := resp.Sections[g53.AnswerSection]
+	if stream.isAXFRFormat() {
+		err = loadZoneUseAXFR(z, stream.rrsets)
+	} else {
+		err = updateZoneUseIXFR(z, soaSerial(soa), stream.serial(), stream.rrsets)
+	}
 	if err != nil {
-		logger.GetLogger().Error("invalid %s response: %v", xfrType, err)
-	} else if len(answers) == 0 {
-		logger.GetLogger().Error("empty %s response", xfrType)
+		return err
 	}
 
-	h.updateZoneUseXFR(xfrType, z, currentSerial, latestSerial, answers)
+	logger.GetLogger().Info("%s zone: %s in view: %s to serial %d succeed", typ, z.GetOrigin().String(false), view, stream.serial())
+	z.SetExpired(false)
+	z.SetLastRefresh(time.Now())
+	h.auth.NotifyZone(view, z)
+	return nil
 }
 
-func (h *XFRRunner) updateZoneUseXFR(typ xfrType, z zone.Zone, currentSerial, latestSerial uint32, answers g53.Section) {
+// zone data is replaced by axfr, the closing soa is dropped
+func loadZoneUseAXFR(z zone.Zone, rrsets []*g53.RRset) error {
+	loadChan := make(chan *g53.RRset, len(rrsets))
+	for _, rrset := range rrsets[:len(rrsets)-1] {
+		loadChan <- rrset
+	}
+	close(loadChan)
+	return z.Load(loadChan, make(chan struct{}))
+}
+
+func updateZoneUseIXFR(z zone.Zone, currentSerial, latestSerial uint32, rrsets []*g53.RRset) error {
 	updator, _ := z.GetUpdator(nil, true)
 	tx, err := updator.Begin()
 	if err != nil {
-		logger.GetLogger().Error("get zone transaction failed: %s", err.Error())
-		return
+		return err
 	}
 
-	sm := newFSMGenerator(typ, currentSerial, latestSerial, updator, tx).GenStateMachine()
-	if err := sm.Run(answers); err == nil {
-		tx.Commit()
-		logger.GetLogger().Info("%s succeed", typ)
-	} else {
+	sm := newFSMGenerator(IXFR, currentSerial, latestSerial, updator, tx).GenStateMachine()
+	if err := sm.Run(rrsets); err != nil {
 		tx.RollBack()
-		logger.GetLogger().Warn("%s failed: %s", typ, err.Error())
-		if typ == IXFR {
-			logger.GetLogger().Info("IXFR failed try AXFR")
-			h.updateZoneUseXFR(AXFR, z, currentSerial, latestSerial, answers)
-		}
+		return err
 	}
+	return tx.Commit()
 }
@@ -0,0 +1,164 @@
+package xfr
+
+import (
+	"errors"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/rdata"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+var (
+	errTransferRefused    = errors.New("transfer is refused by master")
+	errTransferNoSOA      = errors.New("transfer response should begin with soa")
+	errTransferIDMismatch = errors.New("transfer response id doesn't match request")
+)
+
+// rrs of a transfer collected from all the messages, soa rrsets are split
+// into one rr per rrset, since adjacent soas in the same message are merged
+// when the message is parsed
+type transferStream struct {
+	typ          xfrType
+	clientSerial uint32
+	rrsets       []*g53.RRset
+	soaCount     int
+}
+
+func newTransferStream(typ xfrType, clientSerial uint32) *transferStream {
+	return &transferStream{
+		typ:          typ,
+		clientSerial: clientSerial,
+	}
+}
+
+func (s *transferStream) add(rrsets []*g53.RRset) error {
+	for _, rrset := range rrsets {
+		if rrset.Type != g53.RR_SOA {
+			if len(s.rrsets) == 0 {
+				return errTransferNoSOA
+			}
+			s.rrsets = append(s.rrsets, rrset)
+			continue
+		}
+
+		for _, rdata := range rrset.Rdatas {
+			soa := *rrset
+			soa.Rdatas = []g53.Rdata{rdata}
+			s.rrsets = append(s.rrsets, &soa)
+			s.soaCount += 1
+		}
+	}
+	return nil
+}
+
+func (s *transferStream) serial() uint32 {
+	return soaSerial(s.rrsets[0])
+}
+
+// ixfr response could be in axfr format, RFC 1995 4
+func (s *transferStream) isAXFRFormat() bool {
+	return s.typ == AXFR || (len(s.rrsets) > 1 && s.rrsets[1].Type != g53.RR_SOA)
+}
+
+// single soa means client is up to date
+func (s *transferStream) isUpToDate() bool {
+	return s.typ == IXFR && len(s.rrsets) == 1 &&
+		g53.CompareSerial(s.serial(), s.clientSerial) <= 0
+}
+
+// axfr ends with the soa which it begins with, ixfr has pairs of soa for
+// each difference between the first and the last soa
+func (s *transferStream) isComplete() bool {
+	if len(s.rrsets) == 0 {
+		return false
+	}
+
+	if s.isUpToDate() {
+		return true
+	}
+
+	last := s.rrsets[len(s.rrsets)-1]
+	if len(s.rrsets) == 1 || last.Type != g53.RR_SOA || soaSerial(last) != s.serial() {
+		return false
+	}
+	return s.isAXFRFormat() || s.soaCount%2 == 0
+}
+
+// request is sent to master and responses are read until the transfer is
+// complete, all the messages are verified if tsig key is configured
+func receiveTransfer(typ xfrType, z zone.Zone, currentSOA *g53.RRset, master string) (*transferStream, error) {
+	var tsig *g53.TSIG
+	key := z.TransferKey()
+	if key != nil {
+		var err error
+		if tsig, err = g53.NewTSIG(key.Name, key.Secret, key.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	var request *g53.Message
+	stream := newTransferStream(typ, 0)
+	if typ == IXFR {
+		request = g53.MakeIXFR(z.GetOrigin(), currentSOA, tsig)
+		stream.clientSerial = soaSerial(currentSOA)
+	} else {
+		request = g53.MakeAXFR(z.GetOrigin(), tsig)
+	}
+
+	conn, err := util.NewTCPConn(master)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	render := g53.NewMsgRender()
+	request.Rend(render)
+	if err := util.TCPWrite(render.Data(), conn); err != nil {
+		return nil, err
+	}
+
+	var verifier *tsigVerifier
+	if tsig != nil {
+		if verifier, err = newTSIGVerifier(request.Tsig, key.Secret); err != nil {
+			return nil, err
+		}
+	}
+
+	for stream.isComplete() == false {
+		data, err := util.TCPRead(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := rdata.MessageFromWire(util.NewInputBuffer(data))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Header.Id != request.Header.Id {
+			return nil, errTransferIDMismatch
+		}
+
+		if resp.Header.Rcode != g53.R_NOERROR {
+			return nil, errTransferRefused
+		}
+
+		if verifier != nil {
+			if err := verifier.verify(data, resp.Tsig); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := stream.add(resp.Sections[g53.AnswerSection]); err != nil {
+			return nil, err
+		}
+	}
+
+	if verifier != nil {
+		if err := verifier.finish(); err != nil {
+			return nil, err
+		}
+	}
+	return stream, nil
+}
@@ -0,0 +1,315 @@
+package xfr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/acl"
+	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/rdata"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+	"github.com/zdnscloud/vanguard/viewselector"
+)
+
+// master answers transfer with the zone of handler, ixfr is refused when
+// it's set
+type testMaster struct {
+	listener   *net.TCPListener
+	handler    *XFRHandler
+	refuseIXFR bool
+
+	lock     sync.Mutex
+	requests []g53.RRType
+}
+
+func newTestMaster(t *testing.T, handler *XFRHandler) *testMaster {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	ut.Assert(t, err == nil, "listen tcp shouldn't fail")
+	m := &testMaster{
+		listener: listener,
+		handler:  handler,
+	}
+	go m.run()
+	return m
+}
+
+func (m *testMaster) addr() string {
+	return m.listener.Addr().String()
+}
+
+func (m *testMaster) run() {
+	for {
+		conn, err := m.listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		m.serve(conn)
+		conn.Close()
+	}
+}
+
+func (m *testMaster) serve(conn *net.TCPConn) {
+	data, err := util.TCPRead(conn)
+	if err != nil {
+		return
+	}
+
+	request, err := g53.MessageFromWire(util.NewInputBuffer(data))
+	if err != nil {
+		return
+	}
+	m.lock.Lock()
+	m.requests = append(m.requests, request.Question.Type)
+	refuseIXFR := m.refuseIXFR
+	m.lock.Unlock()
+
+	ctx := core.NewContext()
+	ctx.Client.Request = request
+	ctx.Client.Transport = core.TransportTCP
+	ctx.Client.UsingTCP = true
+	ctx.Client.Addr = conn.RemoteAddr()
+	if refuseIXFR && request.Question.Type == g53.RR_IXFR {
+		ctx.Client.Response = request.MakeResponse()
+		ctx.Client.Response.Header.Rcode = g53.R_NOTIMP
+	} else {
+		m.handler.HandleQuery(ctx)
+	}
+
+	responses := ctx.Client.RawResponses
+	if len(responses) == 0 {
+		render := g53.NewMsgRender()
+		ctx.Client.Response.Rend(render)
+		responses = [][]byte{render.Data()}
+	}
+	for _, resp := range responses {
+		if util.TCPWrite(resp, conn) != nil {
+			return
+		}
+	}
+}
+
+func (m *testMaster) receivedRequests() []g53.RRType {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]g53.RRType(nil), m.requests...)
+}
+
+// add txt rrs to make transfer has multiple messages
+func addTXTs(z zone.Zone, start, count int) {
+	updator, _ := z.GetUpdator(nil, true)
+	tx, _ := updator.Begin()
+	for i := start; i < start+count; i++ {
+		rrset, _ := g53.RRsetFromString(fmt.Sprintf("txt%d.example.com. 3600 IN TXT \"%060d\"", i, i))
+		updator.Add(tx, rrset)
+	}
+	updator.IncreaseSerialNumber(tx)
+	tx.Commit()
+}
+
+func newTestSecondary(viewAcl config.ViewAcl, master string) (*XFRHandler, zone.Zone) {
+	h := newTestXFRHandler(viewAcl)
+	z := getTestZone(h)
+	z.SetMasters([]string{master})
+	z.SetNotify(zone.NotifyNo, nil)
+	return h, z
+}
+
+func transferIn(h *XFRHandler, z zone.Zone, serial uint32, master string) bool {
+	h.runner.addZoneToTransfer(viewselector.DefaultView, z.GetOrigin())
+	return h.runner.doXFR(viewselector.DefaultView, z, serial, master)
+}
+
+func findTXT(z zone.Zone, i int) zone.ResultType {
+	name := g53.NameFromStringUnsafe(fmt.Sprintf("txt%d.example.com.", i))
+	return z.Find(name, g53.RR_TXT, zone.DefaultFind).GetResult().Type
+}
+
+func TestTransferInMultiMessages(t *testing.T) {
+	viewAcl := config.ViewAcl{View: viewselector.DefaultView, Acls: []string{acl.AnyAcl}}
+	primary := newTestXFRHandler(viewAcl)
+	master := newTestMaster(t, primary)
+	defer master.listener.Close()
+	primaryZone := getTestZone(primary)
+	primaryZone.SetTransferAcls([]string{acl.AnyAcl})
+	addTXTs(primaryZone, 0, 500)
+
+	secondary, z := newTestSecondary(viewAcl, master.addr())
+	ut.Equal(t, transferIn(secondary, z, 2, master.addr()), true)
+	ut.Equal(t, master.receivedRequests(), []g53.RRType{g53.RR_IXFR})
+	ut.Equal(t, soaSerial(currentSOA(z)), uint32(2))
+	ut.Equal(t, findTXT(z, 0), zone.FRSuccess)
+	ut.Equal(t, findTXT(z, 499), zone.FRSuccess)
+
+	//refused ixfr falls back to axfr with a new connection
+	master.lock.Lock()
+	master.refuseIXFR = true
+	master.lock.Unlock()
+	addTXTs(primaryZone, 500, 500)
+	ut.Equal(t, transferIn(secondary, z, 3, master.addr()), true)
+	ut.Equal(t, master.receivedRequests(), []g53.RRType{g53.RR_IXFR, g53.RR_IXFR, g53.RR_AXFR})
+	ut.Equal(t, soaSerial(currentSOA(z)), uint32(3))
+	ut.Equal(t, findTXT(z, 999), zone.FRSuccess)
+
+	//axfr replaces the zone
+	z.SetExpired(true)
+	updator, _ := z.GetUpdator(nil, true)
+	tx, _ := updator.Begin()
+	rrset, _ := g53.RRsetFromString("stale.example.com. 3600 IN A 4.4.4.4")
+	updator.Add(tx, rrset)
+	tx.Commit()
+	ut.Equal(t, transferIn(secondary, z, 3, master.addr()), true)
+	ut.Equal(t, z.IsExpired(), false)
+	result := z.Find(g53.NameFromStringUnsafe("stale.example.com."), g53.RR_A, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRNXDomain)
+	ut.Equal(t, findTXT(z, 999), zone.FRSuccess)
+}
+
+func TestTransferInModernTypes(t *testing.T) {
+	viewAcl := config.ViewAcl{View: viewselector.DefaultView, Acls: []string{acl.AnyAcl}}
+	primary := newTestXFRHandler(viewAcl)
+	master := newTestMaster(t, primary)
+	defer master.listener.Close()
+	primaryZone := getTestZone(primary)
+	primaryZone.SetTransferAcls([]string{acl.AnyAcl})
+
+	rrs := map[g53.RRType]string{
+		g53.RR_CAA:        "0 issue \"ca.example.net\"",
+		rdata.RR_HTTPS:    "1 . alpn=\"h2\" port=8443",
+		g53.RRType(65534): "\\# 2 0102",
+	}
+	updator, _ := primaryZone.GetUpdator(nil, true)
+	tx, _ := updator.Begin()
+	for typ, rd := range rrs {
+		rrset, _ := rdata.RRsetFromString("svc.example.com. 3600 IN " + rdata.TypeString(typ) + " " + rd)
+		updator.Add(tx, rrset)
+	}
+	updator.IncreaseSerialNumber(tx)
+	tx.Commit()
+
+	secondary, z := newTestSecondary(viewAcl, master.addr())
+	ut.Equal(t, transferIn(secondary, z, 2, master.addr()), true)
+	for typ, rd := range rrs {
+		result := z.Find(g53.NameFromStringUnsafe("svc.example.com."), typ, zone.DefaultFind).GetResult()
+		ut.Equal(t, result.Type, zone.FRSuccess)
+		ut.Equal(t, result.RRset.Rdatas[0].String(), rd)
+	}
+
+	master.lock.Lock()
+	master.refuseIXFR = true
+	master.lock.Unlock()
+	addTXTs(primaryZone, 0, 1)
+	ut.Equal(t, transferIn(secondary, z, 3, master.addr()), true)
+	ut.Equal(t, master.receivedRequests(), []g53.RRType{g53.RR_IXFR, g53.RR_IXFR, g53.RR_AXFR})
+	result := z.Find(g53.NameFromStringUnsafe("svc.example.com."), g53.RR_CAA, zone.DefaultFind).GetResult()
+	ut.Equal(t, result.Type, zone.FRSuccess)
+}
+
+func TestTransferInWithTSIG(t *testing.T) {
+	viewAcl := config.ViewAcl{
+		View:         viewselector.DefaultView,
+		KeyName:      testKeyName,
+		KeySecret:    testKeySecret,
+		KeyAlgorithm: string(g53.HmacMD5),
+	}
+	primary := newTestXFRHandler(viewAcl)
+	master := newTestMaster(t, primary)
+	defer master.listener.Close()
+	primaryZone := getTestZone(primary)
+	primaryZone.SetTransferAcls([]string{acl.AnyAcl})
+	addTXTs(primaryZone, 0, 500)
+
+	secondary, z := newTestSecondary(config.ViewAcl{View: viewselector.DefaultView, Acls: []string{acl.AnyAcl}}, master.addr())
+	ut.Equal(t, transferIn(secondary, z, 2, master.addr()), false)
+	ut.Equal(t, soaSerial(currentSOA(z)), uint32(1))
+
+	z.SetTransferKey(&zone.TSIGKey{
+		Name:      testKeyName,
+		Secret:    "d3Jvbmcgc2VjcmV0",
+		Algorithm: string(g53.HmacMD5),
+	})
+	ut.Equal(t, transferIn(secondary, z, 2, master.addr()), false)
+
+	z.SetTransferKey(&zone.TSIGKey{
+		Name:      testKeyName,
+		Secret:    testKeySecret,
+		Algorithm: string(g53.HmacMD5),
+	})
+	ut.Equal(t, transferIn(secondary, z, 2, master.addr()), true)
+	ut.Equal(t, soaSerial(currentSOA(z)), uint32(2))
+	ut.Equal(t, findTXT(z, 499), zone.FRSuccess)
+}
+
+func TestTransferStream(t *testing.T) {
+	soa := func(serial uint32) *g53.RRset {
+		return rrsetFromString(fmt.Sprintf("example.com. 3600 IN SOA ns.example.com. root.example.com. %d 7200 3600 1209600 3600", serial))
+	}
+	a := rrsetFromString("a.example.com. 3600 IN A 1.1.1.1")
+
+	stream := newTransferStream(IXFR, 3)
+	stream.add([]*g53.RRset{soa(3)})
+	ut.Equal(t, stream.isUpToDate(), true)
+	ut.Equal(t, stream.isComplete(), true)
+
+	//ixfr with the last difference has no added rrs
+	stream = newTransferStream(IXFR, 1)
+	stream.add([]*g53.RRset{soa(3), soa(1), a, soa(2), soa(2), a})
+	ut.Equal(t, stream.isComplete(), false)
+	stream.add([]*g53.RRset{soa(3)})
+	ut.Equal(t, stream.isComplete(), false)
+	stream.add([]*g53.RRset{soa(3)})
+	ut.Equal(t, stream.isComplete(), true)
+	ut.Equal(t, stream.isAXFRFormat(), false)
+
+	stream = newTransferStream(IXFR, 1)
+	stream.add([]*g53.RRset{soa(3), a})
+	ut.Equal(t, stream.isComplete(), false)
+	stream.add([]*g53.RRset{soa(3)})
+	ut.Equal(t, stream.isComplete(), true)
+	ut.Equal(t, stream.isAXFRFormat(), true)
+
+	stream = newTransferStream(AXFR, 0)
+	ut.Equal(t, stream.add([]*g53.RRset{a}), errTransferNoSOA)
+}
+
+func TestTransferInSaveBackup(t *testing.T) {
+	viewAcl := config.ViewAcl{View: viewselector.DefaultView, Acls: []string{acl.AnyAcl}}
+	primary := newTestXFRHandler(viewAcl)
+	master := newTestMaster(t, primary)
+	defer master.listener.Close()
+	primaryZone := getTestZone(primary)
+	primaryZone.SetTransferAcls([]string{acl.AnyAcl})
+	addTXTs(primaryZone, 0, 10)
+
+	dir, _ := ioutil.TempDir(testDir, "")
+	backup := filepath.Join(dir, "example.com")
+	secondary, z := newTestSecondary(viewAcl, master.addr())
+	ut.Assert(t, z.EnableJournal(backup, backup+".jnl") == nil, "enable journal shouldn't fail")
+
+	//axfr is saved into backup file
+	master.lock.Lock()
+	master.refuseIXFR = true
+	master.lock.Unlock()
+	ut.Equal(t, transferIn(secondary, z, 2, master.addr()), true)
+	content, _ := ioutil.ReadFile(backup)
+	ut.Equal(t, strings.Contains(string(content), "txt9.example.com."), true)
+	ut.Equal(t, time.Since(z.LastRefresh()) < time.Minute, true)
+
+	//ixfr is appended to journal
+	master.lock.Lock()
+	master.refuseIXFR = false
+	master.lock.Unlock()
+	addTXTs(primaryZone, 10, 1)
+	ut.Equal(t, transferIn(secondary, z, 3, master.addr()), true)
+	content, _ = ioutil.ReadFile(backup + ".jnl")
+	ut.Equal(t, strings.Contains(string(content), "txt10.example.com."), true)
+}
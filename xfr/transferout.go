@@ -0,0 +1,187 @@
+package xfr
+
+import (
+	"github.com/zdnscloud/cement/domaintree"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+)
+
+// leave enough space for tsig, the whole message is limited to 64k
+const maxTransferMessageSize = 16384
+
+func (h *XFRHandler) handleTransfer(ctx *core.Context) {
+	client := &ctx.Client
+	if h.viewSelector.SelectView(ctx) == false {
+		if client.Response == nil {
+			client.Response = client.Request.MakeResponse()
+			client.Response.Header.Rcode = g53.R_REFUSED
+		} else {
+			client.Response.Header.Rcode = g53.R_NOTAUTH
+		}
+		return
+	}
+
+	request := client.Request
+	if client.Response == nil {
+		client.Response = request.MakeResponse()
+	}
+	response := client.Response
+	response.Header.SetFlag(g53.FLAG_AA, true)
+
+	zoneName := request.Question.Name
+	targetZone, matchType := h.auth.GetZone(client.View, zoneName)
+	if matchType != domaintree.ExactMatch {
+		response.Header.Rcode = g53.R_NOTAUTH
+		return
+	}
+
+	if targetZone.IsTransferAllowed(client.IP()) == false {
+		logger.GetLogger().Warn("transfer zone %s in view %s to %s is refused",
+			zoneName.String(false), client.View, client.IP().String())
+		response.Header.Rcode = g53.R_REFUSED
+		return
+	}
+
+	soa := currentSOA(targetZone)
+	if soa == nil {
+		response.Header.Rcode = g53.R_SERVFAIL
+		return
+	}
+
+	var rrs []*g53.RRset
+	if request.Question.Type == g53.RR_IXFR {
+		auths := request.Sections[g53.AuthSection]
+		if len(auths) != 1 || auths[0].Type != g53.RR_SOA || len(auths[0].Rdatas) != 1 {
+			response.Header.Rcode = g53.R_FORMERR
+			return
+		}
+
+		serial := auths[0].Rdatas[0].(*g53.SOA).Serial
+		if isStreamTransport(client.Transport) == false ||
+			g53.CompareSerial(serial, soaSerial(soa)) >= 0 {
+			//client is up to date or should retry over tcp, RFC 1995 4
+			response.AddRRset(g53.AnswerSection, soa)
+			return
+		}
+		rrs = ixfrRRsets(targetZone, serial, soa)
+	} else if isStreamTransport(client.Transport) == false {
+		response.Header.Rcode = g53.R_FORMERR
+		return
+	}
+
+	if rrs == nil {
+		rrsets, err := targetZone.Dump()
+		if err != nil {
+			logger.GetLogger().Error("dump zone %s in view %s failed:%s",
+				zoneName.String(false), client.View, err.Error())
+			response.Header.Rcode = g53.R_SERVFAIL
+			return
+		}
+		rrs = append(rrsets, rrsets[0])
+	}
+
+	signer, err := h.transferSigner(response.Tsig)
+	if err != nil {
+		logger.GetLogger().Error("sign transfer of zone %s in view %s failed:%s",
+			zoneName.String(false), client.View, err.Error())
+		response.Header.Rcode = g53.R_SERVFAIL
+		return
+	}
+
+	rendered := rendTransferMessages(splitTransferMessages(response, rrs), signer)
+	logger.GetLogger().Info("transfer zone %s in view %s to %s with %d messages",
+		zoneName.String(false), client.View, client.IP().String(), len(rendered))
+	client.RawResponses = rendered
+}
+
+func isStreamTransport(transport core.Transport) bool {
+	return transport == core.TransportTCP || transport == core.TransportTLS
+}
+
+func currentSOA(z zone.Zone) *g53.RRset {
+	result := z.Find(z.GetOrigin(), g53.RR_SOA, zone.DefaultFind).GetResult()
+	if result.Type != zone.FRSuccess {
+		return nil
+	}
+	return result.RRset
+}
+
+func soaSerial(soa *g53.RRset) uint32 {
+	return soa.Rdatas[0].(*g53.SOA).Serial
+}
+
+// incremental transfer is only available when the journal reaches the
+// current serial, otherwise nil is returned and full zone is transferred
+func ixfrRRsets(z zone.Zone, serial uint32, soa *g53.RRset) []*g53.RRset {
+	diffs, ok := z.GetDiffs(serial)
+	if ok == false || soaSerial(diffs[len(diffs)-1].NewSOA) != soaSerial(soa) {
+		return nil
+	}
+
+	rrs := []*g53.RRset{soa}
+	for _, diff := range diffs {
+		rrs = append(rrs, diff.OldSOA)
+		rrs = append(rrs, diff.Deleted...)
+		rrs = append(rrs, diff.NewSOA)
+		rrs = append(rrs, diff.Added...)
+	}
+	return append(rrs, soa)
+}
+
+// only the first message carries the question, rrsets are put into
+// messages in order, message size is estimated with rrset rendered alone
+func splitTransferMessages(first *g53.Message, rrs []*g53.RRset) []*g53.Message {
+	messages := []*g53.Message{first}
+	current := first
+	size := 0
+	render := g53.NewMsgRender()
+	for _, rrset := range rrs {
+		render.Clear()
+		rrset.Rend(render)
+		if size != 0 && size+int(render.Len()) > maxTransferMessageSize {
+			current = &g53.Message{Header: first.Header}
+			current.Header.QDCount = 0
+			messages = append(messages, current)
+			size = 0
+		}
+		current.AddRRset(g53.AnswerSection, rrset)
+		size += int(render.Len())
+	}
+	return messages
+}
+
+func (h *XFRHandler) transferSigner(tsig *g53.TSIG) (*tsigSigner, error) {
+	if tsig == nil {
+		return nil, nil
+	}
+
+	key, ok := h.viewSelector.GetTSIGKey(tsig.Header.Name.String(true))
+	if ok == false {
+		return nil, errUnknownKey
+	}
+	return newTSIGSigner(tsig, key.Secret)
+}
+
+func rendTransferMessages(messages []*g53.Message, signer *tsigSigner) [][]byte {
+	rendered := make([][]byte, 0, len(messages))
+	render := g53.NewMsgRender()
+	for i, message := range messages {
+		message.RecalculateSectionRRCount()
+		render.Clear()
+		message.Rend(render)
+		data := make([]byte, render.Len())
+		copy(data, render.Data())
+		if signer != nil {
+			//first message is signed when it's rendered
+			if i == 0 {
+				signer.setPrevMAC(message.Tsig.MAC)
+			} else {
+				data = signer.sign(data)
+			}
+		}
+		rendered = append(rendered, data)
+	}
+	return rendered
+}
@@ -0,0 +1,333 @@
+package xfr
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ut "github.com/zdnscloud/cement/unittest"
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+	"github.com/zdnscloud/vanguard/acl"
+	"github.com/zdnscloud/vanguard/config"
+	"github.com/zdnscloud/vanguard/core"
+	"github.com/zdnscloud/vanguard/dnssec"
+	"github.com/zdnscloud/vanguard/logger"
+	"github.com/zdnscloud/vanguard/rdata"
+	"github.com/zdnscloud/vanguard/resolver/auth"
+	"github.com/zdnscloud/vanguard/resolver/auth/zone"
+	"github.com/zdnscloud/vanguard/viewselector"
+)
+
+const (
+	testKeyName   = "xfr-key"
+	testKeySecret = "c2VjcmV0IGtleSBmb3IgeGZy"
+)
+
+// zone file is changed when zone is saved, so tests use copy of it in
+// testDir
+var testDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	if testDir, err = ioutil.TempDir("", "xfr"); err != nil {
+		panic("create test dir failed:" + err.Error())
+	}
+	code := m.Run()
+	os.RemoveAll(testDir)
+	os.Exit(code)
+}
+
+func copyTestZoneFile(file string) string {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		panic("read zone file failed:" + err.Error())
+	}
+
+	dir, err := ioutil.TempDir(testDir, "")
+	if err != nil {
+		panic("create zone dir failed:" + err.Error())
+	}
+	path := filepath.Join(dir, filepath.Base(file))
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		panic("write zone file failed:" + err.Error())
+	}
+	return path
+}
+
+func newTestXFRHandler(viewAcl config.ViewAcl) *XFRHandler {
+	logger.UseDefaultLogger("error")
+	conf := &config.VanguardConf{
+		Views: config.ViewConf{
+			ViewAcls: []config.ViewAcl{viewAcl},
+		},
+		Auth: []config.AuthZoneInView{
+			config.AuthZoneInView{
+				View: viewselector.DefaultView,
+				Zones: []config.AuthZoneConf{
+					config.AuthZoneConf{
+						Name: "example.com.",
+						File: copyTestZoneFile("../resolver/auth/testdata/example.com"),
+					},
+				},
+			},
+		},
+	}
+	selector := viewselector.NewSelectorMgr(conf).(*viewselector.SelectorMgr)
+	return NewXFRHandler(selector, auth.NewAuth(conf))
+}
+
+func getTestZone(h *XFRHandler) zone.Zone {
+	z, _ := h.auth.GetZone(viewselector.DefaultView, g53.NameFromStringUnsafe("example.com."))
+	return z
+}
+
+func sendTransfer(h *XFRHandler, request *g53.Message, transport core.Transport) *core.Context {
+	ctx := core.NewContext()
+	ctx.Client.Request = request
+	ctx.Client.Transport = transport
+	if transport == core.TransportUDP {
+		ctx.Client.Addr = &net.UDPAddr{IP: net.ParseIP("1.1.1.1"), Port: 5353}
+	} else {
+		ctx.Client.UsingTCP = true
+		ctx.Client.Addr = &net.TCPAddr{IP: net.ParseIP("1.1.1.1"), Port: 5353}
+	}
+	h.HandleQuery(ctx)
+	return ctx
+}
+
+func makeIXFR(serial uint32) *g53.Message {
+	request := g53.MakeQuery(g53.NameFromStringUnsafe("example.com."), g53.RR_IXFR, 512, false)
+	soa, _ := g53.RRsetFromString(fmt.Sprintf("example.com. 3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. %d 7200 3600 1209600 3600", serial))
+	request.AddRRset(g53.AuthSection, soa)
+	return request
+}
+
+// adjacent rrs with same name and type are merged when message is parsed,
+// split them to check the order of rrs
+func parseResponses(t *testing.T, responses [][]byte) []*g53.RRset {
+	var rrs []*g53.RRset
+	for i, data := range responses {
+		msg, err := rdata.MessageFromWire(util.NewInputBuffer(data))
+		ut.Assert(t, err == nil, "transfer response should be valid")
+		ut.Equal(t, msg.Header.GetFlag(g53.FLAG_AA), true)
+		ut.Equal(t, msg.Question != nil, i == 0)
+		for _, rrset := range msg.Sections[g53.AnswerSection] {
+			for _, rdata := range rrset.Rdatas {
+				rr := *rrset
+				rr.Rdatas = []g53.Rdata{rdata}
+				rrs = append(rrs, &rr)
+			}
+		}
+	}
+	return rrs
+}
+
+func serialOf(rrset *g53.RRset) uint32 {
+	return rrset.Rdatas[0].(*g53.SOA).Serial
+}
+
+func TestAXFROut(t *testing.T) {
+	h := newTestXFRHandler(config.ViewAcl{View: viewselector.DefaultView, Acls: []string{acl.AnyAcl}})
+	request := g53.MakeQuery(g53.NameFromStringUnsafe("example.com."), g53.RR_AXFR, 512, false)
+
+	ctx := sendTransfer(h, request, core.TransportTCP)
+	ut.Equal(t, ctx.Client.Response.Header.Rcode, g53.R_REFUSED)
+
+	getTestZone(h).SetTransferAcls([]string{acl.AnyAcl})
+	ctx = sendTransfer(h, request, core.TransportUDP)
+	ut.Equal(t, ctx.Client.Response.Header.Rcode, g53.R_FORMERR)
+
+	notAuth := g53.MakeQuery(g53.NameFromStringUnsafe("a.example.com."), g53.RR_AXFR, 512, false)
+	ctx = sendTransfer(h, notAuth, core.TransportTCP)
+	ut.Equal(t, ctx.Client.Response.Header.Rcode, g53.R_NOTAUTH)
+
+	ctx = sendTransfer(h, request, core.TransportTCP)
+	ut.Equal(t, len(ctx.Client.RawResponses), 1)
+	rrsets := parseResponses(t, ctx.Client.RawResponses)
+	ut.Equal(t, len(rrsets), 6)
+	ut.Equal(t, rrsets[0].Type, g53.RR_SOA)
+	ut.Equal(t, rrsets[len(rrsets)-1].Type, g53.RR_SOA)
+}
+
+func TestIXFROut(t *testing.T) {
+	h := newTestXFRHandler(config.ViewAcl{View: viewselector.DefaultView, Acls: []string{acl.AnyAcl}})
+	z := getTestZone(h)
+	z.SetTransferAcls([]string{acl.AnyAcl})
+
+	updator, _ := z.GetUpdator(nil, true)
+	tx, _ := updator.Begin()
+	rrset, _ := g53.RRsetFromString("b.example.com. 3600 IN A 3.3.3.3")
+	updator.Add(tx, rrset)
+	rrset, _ = g53.RRsetFromString("a.example.com. 3600 IN A 1.1.1.1")
+	updator.DeleteRRset(tx, rrset)
+	updator.IncreaseSerialNumber(tx)
+	tx.Commit()
+
+	ctx := sendTransfer(h, makeIXFR(2), core.TransportTCP)
+	ut.Equal(t, len(ctx.Client.RawResponses), 0)
+	ut.Equal(t, len(ctx.Client.Response.Sections[g53.AnswerSection]), 1)
+	ut.Equal(t, serialOf(ctx.Client.Response.Sections[g53.AnswerSection][0]), uint32(2))
+
+	ctx = sendTransfer(h, makeIXFR(1), core.TransportUDP)
+	ut.Equal(t, len(ctx.Client.RawResponses), 0)
+	ut.Equal(t, len(ctx.Client.Response.Sections[g53.AnswerSection]), 1)
+
+	ctx = sendTransfer(h, makeIXFR(1), core.TransportTCP)
+	rrsets := parseResponses(t, ctx.Client.RawResponses)
+	ut.Equal(t, len(rrsets), 6)
+	ut.Equal(t, serialOf(rrsets[0]), uint32(2))
+	ut.Equal(t, serialOf(rrsets[1]), uint32(1))
+	ut.Equal(t, rrsets[2].Name.String(false), "a.example.com.")
+	ut.Equal(t, serialOf(rrsets[3]), uint32(2))
+	ut.Equal(t, rrsets[4].Name.String(false), "b.example.com.")
+	ut.Equal(t, serialOf(rrsets[5]), uint32(2))
+
+	//unknown serial falls back to axfr
+	ctx = sendTransfer(h, makeIXFR(0), core.TransportTCP)
+	rrsets = parseResponses(t, ctx.Client.RawResponses)
+	ut.Equal(t, len(rrsets), 6)
+	ut.Equal(t, rrsets[1].Type != g53.RR_SOA, true)
+}
+
+func TestTransferSignedZone(t *testing.T) {
+	h := newTestXFRHandler(config.ViewAcl{View: viewselector.DefaultView, Acls: []string{acl.AnyAcl}})
+	z := getTestZone(h)
+	z.SetTransferAcls([]string{acl.AnyAcl})
+	origin := g53.NameFromStringUnsafe("example.com.")
+	ksk, _ := dnssec.GenerateKey(origin, dnssec.AlgorithmED25519, true)
+	zsk, _ := dnssec.GenerateKey(origin, dnssec.AlgorithmED25519, false)
+	err := z.EnableDNSSEC(&zone.SignPolicy{
+		Keys:     []*dnssec.Key{ksk, zsk},
+		Validity: 24 * time.Hour,
+		Refresh:  6 * time.Hour,
+	})
+	ut.Assert(t, err == nil, "sign zone failed: %v", err)
+
+	request := g53.MakeQuery(origin, g53.RR_AXFR, 512, false)
+	rrs := parseResponses(t, sendTransfer(h, request, core.TransportTCP).Client.RawResponses)
+	ut.Equal(t, rrs[0].Type, g53.RR_SOA)
+	ut.Equal(t, rrs[len(rrs)-1].Type, g53.RR_SOA)
+
+	rrsets := make(map[string]*g53.RRset)
+	sigs := make(map[string]*rdata.RRSIG)
+	for _, rr := range rrs[:len(rrs)-1] {
+		if rr.Type == g53.RR_RRSIG {
+			sig := rr.Rdatas[0].(*rdata.RRSIG)
+			sigs[rr.Name.String(false)+rdata.TypeString(sig.Covered)] = sig
+			continue
+		}
+		key := rr.Name.String(false) + rdata.TypeString(rr.Type)
+		if rrset, ok := rrsets[key]; ok {
+			rrset.Rdatas = append(rrset.Rdatas, rr.Rdatas...)
+		} else {
+			rrsets[key] = rr
+		}
+	}
+
+	dnskey := rrsets["example.com.DNSKEY"]
+	ut.Assert(t, dnskey != nil, "dnskey should be transferred")
+	ut.Equal(t, len(dnskey.Rdatas), 2)
+	ut.Assert(t, rrsets["a.example.com.NSEC"] != nil, "nsec should be transferred")
+	for key, rrset := range rrsets {
+		sig, ok := sigs[key]
+		ut.Assert(t, ok, "%s should be signed", key)
+		signer := zsk
+		if rrset.Type == g53.RR_DNSKEY {
+			signer = ksk
+		}
+		err := dnssec.Verify(rrset, sig, origin, signer.DNSKEY)
+		ut.Assert(t, err == nil, "verify %s failed: %v", key, err)
+	}
+
+	//signatures aren't in journal, ixfr falls back to axfr
+	updator, _ := z.GetUpdator(nil, true)
+	tx, _ := updator.Begin()
+	rrset, _ := g53.RRsetFromString("b.example.com. 3600 IN A 3.3.3.3")
+	updator.Add(tx, rrset)
+	updator.IncreaseSerialNumber(tx)
+	tx.Commit()
+	rrs = parseResponses(t, sendTransfer(h, makeIXFR(1), core.TransportTCP).Client.RawResponses)
+	ut.Equal(t, serialOf(rrs[0]), uint32(2))
+	ut.Equal(t, rrs[1].Type != g53.RR_SOA, true)
+	signed := false
+	for _, rr := range rrs {
+		if rr.Type == g53.RR_RRSIG && rr.Name.String(false) == "b.example.com." {
+			signed = true
+		}
+	}
+	ut.Assert(t, signed, "new rrset should be transferred with signatures")
+}
+
+func TestTransferWithTSIG(t *testing.T) {
+	h := newTestXFRHandler(config.ViewAcl{
+		View:         viewselector.DefaultView,
+		KeyName:      testKeyName,
+		KeySecret:    testKeySecret,
+		KeyAlgorithm: string(g53.HmacMD5),
+	})
+	z := getTestZone(h)
+	z.SetTransferAcls([]string{acl.AnyAcl})
+
+	updator, _ := z.GetUpdator(nil, true)
+	tx, _ := updator.Begin()
+	for i := 0; i < 500; i++ {
+		rrset, _ := g53.RRsetFromString(fmt.Sprintf("txt%d.example.com. 3600 IN TXT \"%060d\"", i, i))
+		updator.Add(tx, rrset)
+	}
+	tx.Commit()
+
+	request := g53.MakeQuery(g53.NameFromStringUnsafe("example.com."), g53.RR_AXFR, 512, false)
+	ctx := sendTransfer(h, request, core.TransportTCP)
+	ut.Equal(t, ctx.Client.Response.Header.Rcode, g53.R_REFUSED)
+
+	tsig, _ := g53.NewTSIG(testKeyName, testKeySecret, string(g53.HmacMD5))
+	request.SetTSIG(tsig)
+	render := g53.NewMsgRender()
+	request.Rend(render)
+	request, _ = g53.MessageFromWire(util.NewInputBuffer(render.Data()))
+	requestMAC := request.Tsig.MAC
+
+	ctx = sendTransfer(h, request, core.TransportTCP)
+	responses := ctx.Client.RawResponses
+	ut.Assert(t, len(responses) > 1, "transfer should has multiple messages")
+	ut.Equal(t, len(parseResponses(t, responses)), 506)
+
+	secret, _ := base64.StdEncoding.DecodeString(testKeySecret)
+	prevMAC := requestMAC
+	for i, data := range responses {
+		msg, _ := g53.MessageFromWire(util.NewInputBuffer(data))
+		tsig := msg.Tsig
+		ut.Assert(t, tsig != nil, "every message should be signed")
+		if i == 0 {
+			ut.Assert(t, tsig.VerifyTsig(msg, testKeySecret, prevMAC) == nil, "first message should be signed with full variables")
+		} else {
+			h := hmac.New(md5.New, secret)
+			binary.Write(h, binary.BigEndian, uint16(len(prevMAC)))
+			h.Write(prevMAC)
+			unsigned := data[:len(data)-tsigWireLen(tsig)]
+			h.Write(unsigned[:10])
+			binary.Write(h, binary.BigEndian, binary.BigEndian.Uint16(unsigned[10:])-1)
+			h.Write(unsigned[12:])
+			binary.Write(h, binary.BigEndian, uint16(tsig.TimeSigned>>32))
+			binary.Write(h, binary.BigEndian, uint32(tsig.TimeSigned))
+			binary.Write(h, binary.BigEndian, tsig.Fudge)
+			ut.Equal(t, hmac.Equal(h.Sum(nil), tsig.MAC), true)
+		}
+		prevMAC = tsig.MAC
+	}
+}
+
+func tsigWireLen(tsig *g53.TSIG) int {
+	buf := util.NewOutputBuffer(512)
+	tsig.ToWire(buf)
+	return int(buf.Len())
+}
@@ -0,0 +1,248 @@
+package xfr
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+var (
+	errUnknownKey       = errors.New("tsig key isn't configured")
+	errUnknownAlgorithm = errors.New("tsig algorithm isn't supported")
+	errUnsignedResponse = errors.New("transfer response isn't signed")
+	errInvalidTSIG      = errors.New("tsig of transfer response is invalid")
+	errMalformedMessage = errors.New("message is malformed")
+)
+
+// tsig could be omitted for at most 99 messages in a transfer
+const maxUnsignedMessages = 99
+
+// g53 always signs message with full tsig variables, but for messages after
+// the first one in a transfer, only the previous mac, the message and the
+// timers are digested, RFC 8945 5.3.1
+type tsigSigner struct {
+	tsig    g53.TSIG
+	hash    hash.Hash
+	prevMAC []byte
+}
+
+func newTSIGSigner(tsig *g53.TSIG, secret string) (*tsigSigner, error) {
+	h, err := newTSIGHash(tsig.Algorithm, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tsigSigner{
+		tsig: *tsig,
+		hash: h,
+	}, nil
+}
+
+func newTSIGHash(algorithm g53.TSIGAlgorithm, secret string) (hash.Hash, error) {
+	rawSecret, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	var h func() hash.Hash
+	switch algorithm {
+	case g53.HmacMD5:
+		h = md5.New
+	case g53.HmacSHA1:
+		h = sha1.New
+	case g53.HmacSHA256:
+		h = sha256.New
+	case g53.HmacSHA512:
+		h = sha512.New
+	default:
+		return nil, errUnknownAlgorithm
+	}
+	return hmac.New(h, rawSecret), nil
+}
+
+func (s *tsigSigner) setPrevMAC(mac []byte) {
+	s.prevMAC = mac
+}
+
+// return the message with tsig appended
+func (s *tsigSigner) sign(message []byte) []byte {
+	tsig := s.tsig
+	tsig.TimeSigned = uint64(time.Now().Unix())
+
+	buf := util.NewOutputBuffer(uint(len(message)) + 512)
+	buf.WriteUint16(uint16(len(s.prevMAC)))
+	buf.WriteData(s.prevMAC)
+	buf.WriteData(message)
+	buf.WriteUint16(uint16(tsig.TimeSigned >> 32))
+	buf.WriteUint32(uint32(tsig.TimeSigned))
+	buf.WriteUint16(tsig.Fudge)
+
+	s.hash.Reset()
+	s.hash.Write(buf.Data())
+	tsig.MAC = s.hash.Sum(nil)
+	tsig.MACSize = uint16(len(tsig.MAC))
+	s.prevMAC = tsig.MAC
+
+	buf.Clear()
+	buf.WriteData(message)
+	tsig.ToWire(buf)
+	arCount := uint16(message[10])<<8 | uint16(message[11])
+	buf.WriteUint16At(arCount+1, 10)
+	return buf.Data()
+}
+
+// responses of a transfer are verified in order, the first one digests the
+// request mac and full tsig variables, the following ones digest the previous
+// mac, messages which are unsigned since then and the timers, RFC 8945 5.3.1
+type tsigVerifier struct {
+	hash     hash.Hash
+	prevMAC  []byte
+	unsigned [][]byte
+	first    bool
+}
+
+func newTSIGVerifier(request *g53.TSIG, secret string) (*tsigVerifier, error) {
+	h, err := newTSIGHash(request.Algorithm, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tsigVerifier{
+		hash:    h,
+		prevMAC: request.MAC,
+		first:   true,
+	}, nil
+}
+
+func (v *tsigVerifier) verify(message []byte, tsig *g53.TSIG) error {
+	if tsig == nil {
+		if v.first || len(v.unsigned) == maxUnsignedMessages {
+			return errUnsignedResponse
+		}
+		v.unsigned = append(v.unsigned, message)
+		return nil
+	}
+
+	if tsig.Error != 0 {
+		return errInvalidTSIG
+	}
+
+	offset, err := tsigOffset(message)
+	if err != nil {
+		return err
+	}
+
+	buf := util.NewOutputBuffer(uint(len(message)) + 512)
+	buf.WriteUint16(uint16(len(v.prevMAC)))
+	buf.WriteData(v.prevMAC)
+	for _, m := range v.unsigned {
+		buf.WriteData(m)
+	}
+	start := buf.Len()
+	buf.WriteData(message[:offset])
+	arCount := uint16(message[10])<<8 | uint16(message[11])
+	buf.WriteUint16At(tsig.OrigId, start)
+	buf.WriteUint16At(arCount-1, start+10)
+	if v.first {
+		g53.NameFromStringUnsafe(strings.ToLower(tsig.Header.Name.String(false))).ToWire(buf)
+		buf.WriteUint16(uint16(g53.CLASS_ANY))
+		buf.WriteUint32(0)
+		g53.NameFromStringUnsafe(string(tsig.Algorithm)).ToWire(buf)
+	}
+	buf.WriteUint16(uint16(tsig.TimeSigned >> 32))
+	buf.WriteUint32(uint32(tsig.TimeSigned))
+	buf.WriteUint16(tsig.Fudge)
+	if v.first {
+		buf.WriteUint16(tsig.Error)
+		buf.WriteUint16(tsig.OtherLen)
+		buf.WriteData(tsig.OtherData)
+	}
+
+	v.hash.Reset()
+	v.hash.Write(buf.Data())
+	if hmac.Equal(v.hash.Sum(nil), tsig.MAC) == false {
+		return errInvalidTSIG
+	}
+
+	now := time.Now().Unix()
+	if signed := int64(tsig.TimeSigned); now-signed > int64(tsig.Fudge) || signed-now > int64(tsig.Fudge) {
+		return errInvalidTSIG
+	}
+
+	v.prevMAC = tsig.MAC
+	v.unsigned = nil
+	v.first = false
+	return nil
+}
+
+// the last message of transfer must be signed
+func (v *tsigVerifier) finish() error {
+	if v.first || len(v.unsigned) != 0 {
+		return errUnsignedResponse
+	}
+	return nil
+}
+
+// tsig is the last rr in additional section
+func tsigOffset(message []byte) (int, error) {
+	if len(message) < 12 {
+		return 0, errMalformedMessage
+	}
+
+	qdCount := int(binary.BigEndian.Uint16(message[4:]))
+	rrCount := 0
+	for i := 6; i < 12; i += 2 {
+		rrCount += int(binary.BigEndian.Uint16(message[i:]))
+	}
+	if rrCount == 0 {
+		return 0, errMalformedMessage
+	}
+
+	pos := 12
+	var err error
+	for i := 0; i < qdCount; i++ {
+		if pos, err = skipName(message, pos); err != nil {
+			return 0, err
+		}
+		pos += 4
+	}
+
+	for i := 0; i < rrCount-1; i++ {
+		if pos, err = skipName(message, pos); err != nil {
+			return 0, err
+		}
+		if pos+10 > len(message) {
+			return 0, errMalformedMessage
+		}
+		pos += 10 + int(binary.BigEndian.Uint16(message[pos+8:]))
+	}
+
+	if pos >= len(message) {
+		return 0, errMalformedMessage
+	}
+	return pos, nil
+}
+
+func skipName(message []byte, pos int) (int, error) {
+	for pos < len(message) {
+		l := int(message[pos])
+		if l == 0 {
+			return pos + 1, nil
+		} else if l&0xc0 == 0xc0 {
+			return pos + 2, nil
+		}
+		pos += l + 1
+	}
+	return 0, errMalformedMessage
+}
@@ -1,6 +1,7 @@
 package xfr
 
 import (
+	"github.com/zdnscloud/g53"
 	"github.com/zdnscloud/vanguard/core"
 	"github.com/zdnscloud/vanguard/resolver/auth"
 	"github.com/zdnscloud/vanguard/viewselector"
@@ -10,18 +11,26 @@ type XFRHandler struct {
 	core.DefaultHandler
 
 	viewSelector *viewselector.SelectorMgr
+	auth         *auth.AuthDataSource
 	runner       *XFRRunner
 }
 
 func NewXFRHandler(viewselector *viewselector.SelectorMgr, auth *auth.AuthDataSource) *XFRHandler {
+	runner := newXFRRunner(auth)
+	go newRefresher(auth, runner).run()
 	return &XFRHandler{
 		viewSelector: viewselector,
-		runner:       newXFRRunner(auth),
+		auth:         auth,
+		runner:       runner,
 	}
 }
 
+// notify from master triggers transfer in, and axfr/ixfr query from
+// secondaries is answered with zone data
 func (h *XFRHandler) HandleQuery(ctx *core.Context) {
-	if h.viewSelector.SelectView(ctx) {
+	if ctx.Client.Request.Header.Opcode == g53.OP_QUERY {
+		h.handleTransfer(ctx)
+	} else if h.viewSelector.SelectView(ctx) {
 		h.runner.HandleNotify(ctx)
 	}
 }